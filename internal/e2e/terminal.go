@@ -0,0 +1,120 @@
+package e2e
+
+/*
+ * terminal.go
+ * Fake terminal, for opshell
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Keys which opshell handles specially, for Harness.Press.
+const (
+	KeyTab   = 0x09 /* Same as Ctrl+I. */
+	KeyCtrlI = 0x09
+	KeyCtrlJ = 0x0a
+	KeyCtrlO = 0x0f
+	KeyCtrlY = 0x19
+	KeyEnter = '\r'
+)
+
+// errTimeout is returned by Terminal.expect if it gives up waiting.
+var errTimeout = errors.New("timed out")
+
+// Terminal is a fake terminal, for an opshell.Shell.  The shell reads
+// keystrokes from it and writes output to it, which it keeps.
+type Terminal struct {
+	inr *io.PipeReader
+	inw *io.PipeWriter
+
+	mu      sync.Mutex
+	out     []byte
+	cursor  int           /* Where the next expect starts looking. */
+	changed chan struct{} /* Closed and remade when out changes. */
+}
+
+// newTerminal returns a new Terminal, ready for use.
+func newTerminal() *Terminal {
+	pr, pw := io.Pipe()
+	return &Terminal{
+		inr:     pr,
+		inw:     pw,
+		changed: make(chan struct{}),
+	}
+}
+
+// Read reads keystrokes sent with Type.
+func (t *Terminal) Read(b []byte) (int, error) { return t.inr.Read(b) }
+
+// Write adds b to t's output.  It never returns an error.
+func (t *Terminal) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.out = append(t.out, b...)
+	close(t.changed)
+	t.changed = make(chan struct{})
+	return len(b), nil
+}
+
+// Type sends s to the shell, as if it were typed.  It blocks until the shell
+// has read s.
+func (t *Terminal) Type(s string) error {
+	_, err := io.WriteString(t.inw, s)
+	return err
+}
+
+// Close closes t's keyboard, which looks like Ctrl+D to the shell.
+func (t *Terminal) Close() error { return t.inw.Close() }
+
+// Output returns everything written to t.
+func (t *Terminal) Output() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.out)
+}
+
+// expect waits for output matching re after the end of the previous match,
+// and returns what matched re's first subexpression.  If nothing matches
+// before timeout, expect returns an error wrapping errTimeout with the
+// unmatched output.
+func (t *Terminal) expect(
+	re *regexp.Regexp,
+	timeout time.Duration,
+) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		/* See if we've got it already. */
+		t.mu.Lock()
+		loc := re.FindSubmatchIndex(t.out[t.cursor:])
+		if 4 <= len(loc) {
+			m := string(t.out[t.cursor+loc[2] : t.cursor+loc[3]])
+			t.cursor += loc[1]
+			t.mu.Unlock()
+			return m, nil
+		}
+		changed, rest := t.changed, string(t.out[t.cursor:])
+		t.mu.Unlock()
+
+		/* Nope, wait for more. */
+		select {
+		case <-changed:
+		case <-timer.C:
+			return "", fmt.Errorf(
+				"%w after %s, unmatched output: %q",
+				errTimeout,
+				timeout,
+				rest,
+			)
+		}
+	}
+}
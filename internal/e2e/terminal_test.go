@@ -0,0 +1,75 @@
+package e2e
+
+/*
+ * terminal_test.go
+ * Tests for terminal.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTerminal_Expect(t *testing.T) {
+	term := newTerminal()
+	re := regexp.MustCompile(`m(o+)se`)
+
+	/* Output written while we wait should be found. */
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(term, "a mose, a moose, ")
+	}()
+	for _, want := range []string{"o", "oo"} {
+		if got, err := term.expect(re, time.Second); nil != err {
+			t.Fatalf("Error waiting for %q: %s", want, err)
+		} else if got != want {
+			t.Errorf(
+				"Incorrect match:\n got: %q\nwant: %q",
+				got,
+				want,
+			)
+		}
+	}
+
+	/* Old output shouldn't match again. */
+	_, err := term.expect(re, 10*time.Millisecond)
+	if !errors.Is(err, errTimeout) {
+		t.Fatalf(
+			"Incorrect error:\n got: %v\nwant: %s",
+			err,
+			errTimeout,
+		)
+	}
+
+	/* But new output should. */
+	io.WriteString(term, "a mooose")
+	if got, err := term.expect(re, time.Second); nil != err {
+		t.Fatalf("Error waiting for third moose: %s", err)
+	} else if "ooo" != got {
+		t.Errorf("Incorrect match:\n got: %q\nwant: %q", got, "ooo")
+	}
+}
+
+func TestTerminal_Type(t *testing.T) {
+	term := newTerminal()
+	go term.Type("kittens")
+	b := make([]byte, 7)
+	if _, err := io.ReadFull(term, b); nil != err {
+		t.Fatalf("Error reading keystrokes: %s", err)
+	} else if "kittens" != string(b) {
+		t.Errorf("Incorrect keystrokes:\n got: %q\nwant: kittens", b)
+	}
+	term.Close()
+	if _, err := term.Read(b); !errors.Is(err, io.EOF) {
+		t.Errorf(
+			"Incorrect error after Close:\n got: %v\nwant: EOF",
+			err,
+		)
+	}
+}
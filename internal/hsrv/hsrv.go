@@ -6,7 +6,7 @@ package hsrv
  * HTTP server
  * By J. Stuart McMurray
  * Created 20240324
- * Last Modified 20240925
+ * Last Modified 20261016
  */
 
 import (
@@ -26,6 +26,7 @@ import (
 	"text/template"
 
 	"github.com/magisterquis/curlrevshell/internal/iobroker"
+	"github.com/magisterquis/curlrevshell/internal/pivot"
 	"github.com/magisterquis/curlrevshell/lib/ctxerrgroup"
 	"github.com/magisterquis/curlrevshell/lib/opshell"
 	"github.com/magisterquis/curlrevshell/lib/sstls"
@@ -62,9 +63,11 @@ var ErrOneShellClosed = errors.New("closed after shell received")
 type Server struct {
 	sl       *slog.Logger
 	fdir     string /* Static files directory. */
+	bdir     string /* Prebuilt binaries directory. */
 	ich      <-chan string
 	och      chan<- opshell.CLine
 	iob      *iobroker.Broker
+	pv       *pivot.Pivot /* May be nil. */
 	l        sstls.Listener
 	ps       pinkSender
 	oneShell bool /* Close listener after getting a shell. */
@@ -84,15 +87,18 @@ type Server struct {
 // serving.
 // Static files will be served from fdir, if non-empty.  If
 // tmplf is non-empty, it is taken as a file from which to read the callback
-// template.
+// template.  Prebuilt binaries will be served from bdir, if non-empty, with
+// config patched in.  If pv isn't nil, implants may use it for pivoting.
 func New(
 	sl *slog.Logger,
 	addr string,
 	fdir string,
 	tmplf string,
+	bdir string,
 	ich <-chan string,
 	och chan<- opshell.CLine,
 	iob *iobroker.Broker,
+	pv *pivot.Pivot,
 	certFile string,
 	cbAddrs []string, /* Callback addresses, for one-liners. */
 	printIPv6 bool,
@@ -117,9 +123,11 @@ func New(
 	s := &Server{
 		sl:        sl,
 		fdir:      fdir,
+		bdir:      bdir,
 		ich:       ich,
 		och:       och,
 		iob:       iob,
+		pv:        pv,
 		l:         l,
 		ps:        pinkSender{och},
 		tmplf:     tmplf,
@@ -187,6 +195,21 @@ func (s *Server) Do(ctx context.Context) error {
 		s.Printf(ScriptColor, "\n")
 	}
 
+	/* Tell user where to get prebuilt binaries. */
+	if "" != s.bdir && 0 != len(s.lAddrs) {
+		s.Logf(ScriptColor, "To get binaries from %s:", s.bdir)
+		s.Printf(ScriptColor, "\n")
+		for _, a := range s.lAddrs {
+			s.Printf(
+				ScriptColor,
+				CurlFormat+BinarySuffix,
+				s.l.Fingerprint,
+				a,
+			)
+		}
+		s.Printf(ScriptColor, "\n")
+	}
+
 	/* Tell user how to get a callback. */
 	s.printCallbackHelp()
 
@@ -211,6 +234,13 @@ func (s *Server) Do(ctx context.Context) error {
 	return eg.Wait()
 }
 
+// Addr returns the address on which s is listening.
+func (s *Server) Addr() net.Addr { return s.l.Addr() }
+
+// Fingerprint returns the fingerprint of s's TLS certificate's public key,
+// suitable for curl's --pinnedpubkey.
+func (s *Server) Fingerprint() string { return s.l.Fingerprint }
+
 // listenAddresseses gets all of the addresses we have for the box.
 func (s *Server) listenAddresses() ([]string, error) {
 	var addrs []string
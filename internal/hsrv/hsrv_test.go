@@ -5,7 +5,7 @@ package hsrv
  * Tests for hserv.go
  * By J. Stuart McMurray
  * Created 20240324
- * Last Modified 20240926
+ * Last Modified 20261016
  */
 
 import (
@@ -42,15 +42,15 @@ func newTestServer(t *testing.T) (
 	*Server,
 	func(),
 ) {
-	return newTestServerMaybeWithDir(t, false)
+	return newTestServerMaybeWithDir(t, false, false)
 }
 
 // newTestServerMaybeWithDir returns a new server, suitable for testing.
 // The returned function may be called to shut down the server, which will
 // closs the chanLog and CLine channels.  It need not be explicitly called.
-// By default, no static files directory will be made.  Set makeFDir to true
-// to create one.
-func newTestServerMaybeWithDir(t *testing.T, makeFDir bool) (
+// By default, no static files or binaries directory will be made.  Set
+// makeFDir or makeBDir to true to create one.
+func newTestServerMaybeWithDir(t *testing.T, makeFDir, makeBDir bool) (
 	chanlog.ChanLog, /* Server logs. */
 	chan<- string, /* From shell */
 	<-chan opshell.CLine,
@@ -62,10 +62,13 @@ func newTestServerMaybeWithDir(t *testing.T, makeFDir bool) (
 		ich    = make(chan string, 1024)
 		och    = make(chan opshell.CLine, 1024)
 	)
-	var td string
+	var td, bd string
 	if makeFDir {
 		td = t.TempDir()
 	}
+	if makeBDir {
+		bd = t.TempDir()
+	}
 	iob, err := iobroker.New(ich, och)
 	if nil != err {
 		t.Fatalf("Error setting up IO Broker: %s", err)
@@ -76,9 +79,11 @@ func newTestServerMaybeWithDir(t *testing.T, makeFDir bool) (
 		"127.0.0.1:0",
 		td,
 		"",
+		bd,
 		ich,
 		och,
 		iob,
+		nil,
 		"",
 		cbAddrs,
 		true,
@@ -131,54 +136,44 @@ func newTestServerMaybeWithDir(t *testing.T, makeFDir bool) (
 			Line: fmt.Sprintf("Listening on %s", s.l.Addr()),
 		},
 	}}
-	fileWCLs := []wantCLine{{
-		want: opshell.CLine{
-			Color: ScriptColor,
-			Line:  "To get files from " + td + ":",
-		},
-	}, {
-		want: opshell.CLine{
-			Color:       ScriptColor,
-			Line:        "\n",
-			NoTimestamp: true,
-		},
-	}, {
-		want: opshell.CLine{
-			Color: ScriptColor,
-			Line: fmt.Sprintf(
-				CurlFormat+FileSuffix,
-				s.l.Fingerprint,
-				cbAddrs[0],
-			),
-			NoTimestamp: true,
-		},
-	}, {
-		want: opshell.CLine{
-			Color: ScriptColor,
-			Line: fmt.Sprintf(
-				CurlFormat+FileSuffix,
-				s.l.Fingerprint,
-				net.JoinHostPort(cbAddrs[1], listenPort),
-			),
-			NoTimestamp: true,
-		},
-	}, {
-		want: opshell.CLine{
-			Color: ScriptColor,
-			Line: fmt.Sprintf(
-				CurlFormat+FileSuffix,
-				s.l.Fingerprint,
-				s.l.Addr().String(),
-			),
-			NoTimestamp: true,
-		},
-	}, {
-		want: opshell.CLine{
-			Color:       ScriptColor,
-			Line:        "\n",
-			NoTimestamp: true,
-		},
-	}}
+	dirWCLs := func(what, dir, suffix string) []wantCLine {
+		wcls := []wantCLine{{
+			want: opshell.CLine{
+				Color: ScriptColor,
+				Line:  "To get " + what + " from " + dir + ":",
+			},
+		}, {
+			want: opshell.CLine{
+				Color:       ScriptColor,
+				Line:        "\n",
+				NoTimestamp: true,
+			},
+		}}
+		for _, a := range []string{
+			cbAddrs[0],
+			net.JoinHostPort(cbAddrs[1], listenPort),
+			s.l.Addr().String(),
+		} {
+			wcls = append(wcls, wantCLine{
+				want: opshell.CLine{
+					Color: ScriptColor,
+					Line: fmt.Sprintf(
+						CurlFormat+suffix,
+						s.l.Fingerprint,
+						a,
+					),
+					NoTimestamp: true,
+				},
+			})
+		}
+		return append(wcls, wantCLine{
+			want: opshell.CLine{
+				Color:       ScriptColor,
+				Line:        "\n",
+				NoTimestamp: true,
+			},
+		})
+	}
 	shellWCLs := []wantCLine{{
 		want: opshell.CLine{
 			Color: ScriptColor,
@@ -213,11 +208,20 @@ func newTestServerMaybeWithDir(t *testing.T, makeFDir bool) (
 	wantCLines := make(
 		[]wantCLine,
 		0,
-		len(listeningWCLs)+len(fileWCLs)+len(shellWCLs),
+		len(listeningWCLs)+len(shellWCLs),
 	)
 	wantCLines = append(wantCLines, listeningWCLs...)
 	if makeFDir {
-		wantCLines = append(wantCLines, fileWCLs...)
+		wantCLines = append(
+			wantCLines,
+			dirWCLs("files", td, FileSuffix)...,
+		)
+	}
+	if makeBDir {
+		wantCLines = append(
+			wantCLines,
+			dirWCLs("binaries", bd, BinarySuffix)...,
+		)
 	}
 	wantCLines = append(wantCLines, shellWCLs...)
 	for i, want := range wantCLines {
@@ -253,11 +257,21 @@ func newTestServerMaybeWithDir(t *testing.T, makeFDir bool) (
 }
 
 func TestServer_Smoketest(t *testing.T) {
-	newTestServer(t)
+	_, _, _, s, _ := newTestServer(t)
+	if got, want := s.Addr().String(), s.l.Addr().String(); got != want {
+		t.Errorf("Incorrect address:\n got: %s\nwant: %s", got, want)
+	}
+	if got, want := s.Fingerprint(), s.l.Fingerprint; got != want {
+		t.Errorf(
+			"Incorrect fingerprint:\n got: %s\nwant: %s",
+			got,
+			want,
+		)
+	}
 }
 
 func TestServer_SmoketestWithDir(t *testing.T) {
-	newTestServerMaybeWithDir(t, true)
+	newTestServerMaybeWithDir(t, true, false)
 }
 
 func TestSortAddresses(t *testing.T) {
@@ -5,7 +5,7 @@ package iobroker
  * Events and logging things
  * By J. Stuart McMurray
  * Created 20240919
- * Last Modified 20240926
+ * Last Modified 20261016
  */
 
 import (
@@ -31,27 +31,53 @@ const (
 	logColor = opshell.ColorGreen
 	// errColor is used for unhappy logs.
 	errColor = opshell.ColorRed
+	// stderrColor is used for a shell's standard error, when it's sent
+	// separately.
+	stderrColor = opshell.ColorYellow
 )
 
 // Log messages, keys, and values.
 const (
-	LMAlreadyConnected = "Connection already established"
-	LMDisconnected     = "Disconnected"
-	LMDisconnecting    = "Previous shell disconnecting"
-	LMIncorrectKey     = "Incorrect key"
-	LMKeyMissing       = "Key missing"
-	LMNewConnection    = "New connection"
-	LMShellIO          = "Shell I/O"
-	LMShuttingDown     = "Shutting down"
-
+	LMAlreadyConnected   = "Connection already established"
+	LMDisconnected       = "Disconnected"
+	LMDisconnecting      = "Previous shell disconnecting"
+	LMFileDiscarded      = "File discarded"
+	LMFileIncomplete     = "File incomplete"
+	LMFileNotSent        = "File not sent"
+	LMFileSaved          = "File saved"
+	LMFileSent           = "File sent"
+	LMFramingSupported   = "Framing supported"
+	LMIncompleteFrame    = "Incomplete frame"
+	LMIncorrectKey       = "Incorrect key"
+	LMKeyMissing         = "Key missing"
+	LMNewConnection      = "New connection"
+	LMShellExited        = "Shell exited"
+	LMShellIO            = "Shell I/O"
+	LMShuttingDown       = "Shutting down"
+	LMTransfersSupported = "Transfers supported"
+	LMUnknownControl     = "Unknown control message"
+	LMUnknownFrame       = "Unknown frame type"
+	LMUnknownTransfer    = "Unknown transfer message"
+	LMWindowSize         = "Window size"
+
+	LKColumns      = "columns"
 	LKData         = "data"
 	LKDirection    = "direction"
 	LKError        = "error"
+	LKExitCode     = "exit_code"
+	LKFile         = "file"
 	LKIncorrectKey = "incorrect_key"
 	LKKey          = "key"
+	LKPath         = "path"
+	LKRows         = "rows"
+	LKSignal       = "signal"
+	LKSize         = "size"
+	LKStream       = "stream"
+	LKType         = "type"
 
 	LVInput  sDirection = "input"
 	LVOutput sDirection = "output"
+	LVStderr            = "stderr"
 )
 
 const (
@@ -110,7 +136,17 @@ func (b *Broker) RemoveEventListener(ch chan<- Event) {
 
 // sendLine sends a line back to the shell.
 func (b *Broker) sendLine(color opshell.Color, addr, format string, a ...any) {
-	b.och <- opshell.CLine{
+	b.och <- *newLine(color, addr, format, a...)
+}
+
+// newLine makes a line to send back to the shell.
+func newLine(
+	color opshell.Color,
+	addr string,
+	format string,
+	a ...any,
+) *opshell.CLine {
+	return &opshell.CLine{
 		Color: color,
 		Line: fmt.Sprintf(
 			"[%s] %s",
@@ -120,6 +156,16 @@ func (b *Broker) sendLine(color opshell.Color, addr, format string, a ...any) {
 	}
 }
 
+// logLine is like Logf, but returns the line instead of sending it.
+func (b *Broker) logLine(addr, format string, a ...any) *opshell.CLine {
+	return newLine(logColor, addr, format, a...)
+}
+
+// errLine is like Errorf, but returns the line instead of sending it.
+func (b *Broker) errLine(addr, format string, a ...any) *opshell.CLine {
+	return newLine(errColor, addr, format, a...)
+}
+
 // Logf sends the message to the shell, in green.
 func (b *Broker) Logf(addr, format string, a ...any) {
 	b.sendLine(logColor, addr, format, a...)
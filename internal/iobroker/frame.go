@@ -0,0 +1,195 @@
+package iobroker
+
+/*
+ * frame.go
+ * Framed output from simpleshell
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+// framedHello starts a simpleshell.FramedShell's output.
+const framedHello = simpleshell.TransferMarker + simpleshell.FramedHello + "\n"
+
+// frameState is whether or not a shell's output is framed.
+type frameState int
+
+// frameStates.
+const (
+	frameStateUnknown frameState = iota
+	frameStatePlain
+	frameStateFramed
+)
+
+// frameFilter splits a simpleshell.FramedShell's output into standard output,
+// standard error, and control messages.  Standard output is passed to a
+// transferFilter.  Output which doesn't start with framedHello is all
+// treated as standard output.
+type frameFilter struct {
+	b    *Broker
+	sl   *slog.Logger
+	addr string
+	tf   *transferFilter
+
+	state frameState
+	held  []byte /* Possible hello or partial frame. */
+}
+
+// newFrameFilter returns a new frameFilter for b.  The returned filter is not
+// safe for concurrent use.
+func (b *Broker) newFrameFilter(sl *slog.Logger, addr string) *frameFilter {
+	return &frameFilter{
+		b:    b,
+		sl:   sl,
+		addr: addr,
+		tf:   b.newTransferFilter(sl, addr),
+	}
+}
+
+// filter appends the output in o to ret, as with transferFilter.filter.
+// Output which might be the start of a hello or a frame is held until the
+// next call to filter or finish.
+func (ff *frameFilter) filter(ret []outChunk, o []byte) []outChunk {
+	/* Work out if this is framed. */
+	if frameStateUnknown == ff.state {
+		buf := append(ff.held, o...)
+		ff.held = nil
+		switch {
+		case bytes.HasPrefix(buf, []byte(framedHello)):
+			ff.state = frameStateFramed
+			o = buf[len(framedHello):]
+			ff.sl.Info(LMFramingSupported)
+		case bytes.HasPrefix([]byte(framedHello), buf):
+			ff.held = buf
+			return ret
+		default:
+			ff.state = frameStatePlain
+			o = buf
+		}
+	}
+	if frameStatePlain == ff.state {
+		return ff.tf.filter(ret, o)
+	}
+
+	/* Finish off a frame we've got part of, copying only as much of o as
+	we need to. */
+	for 0 != len(ff.held) && 0 != len(o) {
+		n := min(heldFrameNeeds(ff.held), len(o))
+		ff.held = slices.Grow(ff.held, heldFrameNeeds(ff.held))
+		ff.held = append(ff.held, o[:n]...)
+		o = o[n:]
+		if 0 == heldFrameNeeds(ff.held) {
+			_, ret = ff.unframe(ret, ff.held)
+			ff.held = nil
+		}
+	}
+
+	/* Unframe ALL the frames. */
+	var rest []byte
+	if rest, ret = ff.unframe(ret, o); 0 != len(rest) {
+		ff.held = make([]byte, 0, len(rest)+heldFrameNeeds(rest))
+		ff.held = append(ff.held, rest...)
+	}
+	return ret
+}
+
+// unframe appends the output in the complete frames in buf to ret, and
+// returns what's left after the last complete frame.
+func (ff *frameFilter) unframe(
+	ret []outChunk,
+	buf []byte,
+) (rest []byte, _ []outChunk) {
+	for simpleshell.FrameHeaderLen <= len(buf) {
+		n := int(buf[1])<<8 | int(buf[2])
+		if len(buf) < simpleshell.FrameHeaderLen+n {
+			break
+		}
+		t := buf[0]
+		buf = buf[simpleshell.FrameHeaderLen:]
+		p := buf[:n]
+		buf = buf[n:]
+		switch t {
+		case simpleshell.FrameStdout:
+			ret = ff.tf.filter(ret, p)
+		case simpleshell.FrameStderr:
+			if 0 != len(p) {
+				ret = append(ret, outChunk{
+					o:      p,
+					stderr: true,
+				})
+			}
+		case simpleshell.FrameControl:
+			ff.handleControl(string(p))
+		default: /* Newer version, maybe. */
+			ff.sl.Error(LMUnknownFrame, LKType, string(t))
+		}
+	}
+	return buf, ret
+}
+
+// heldFrameNeeds returns how many more bytes the partial frame in held needs
+// to have either a complete header or a complete frame.
+func heldFrameNeeds(held []byte) int {
+	if len(held) < simpleshell.FrameHeaderLen {
+		return simpleshell.FrameHeaderLen - len(held)
+	}
+	n := int(held[1])<<8 | int(held[2])
+	return simpleshell.FrameHeaderLen + n - len(held)
+}
+
+// finish returns whatever's held by ff or its transferFilter.  It should be
+// called once output is finished.
+func (ff *frameFilter) finish() []outChunk {
+	held := ff.held
+	ff.held = nil
+	var ret []outChunk
+	switch ff.state {
+	case frameStateUnknown:
+		ret = ff.tf.filter(nil, held)
+	case frameStateFramed:
+		if 0 != len(held) {
+			ff.sl.Error(LMIncompleteFrame, LKSize, len(held))
+			ret = append(ret, outChunk{msg: ff.b.errLine(
+				ff.addr,
+				"Output ended in the middle of a frame",
+			)})
+		}
+	}
+	return append(ret, ff.tf.finish()...)
+}
+
+// handleControl handles a control message.
+func (ff *frameFilter) handleControl(msg string) {
+	verb, args, _ := strings.Cut(msg, " ")
+	switch verb {
+	case simpleshell.ControlExit:
+		code, err := strconv.Atoi(args)
+		if nil != err {
+			break
+		}
+		ff.b.status.Store("exit status " + args)
+		ff.sl.Info(LMShellExited, LKExitCode, code)
+		return
+	case simpleshell.ControlSignal:
+		ff.b.status.Store("signal: " + args)
+		ff.sl.Info(LMShellExited, LKSignal, args)
+		return
+	case simpleshell.ControlWindowSize:
+		cols, rows, _ := strings.Cut(args, " ")
+		ff.sl.Info(LMWindowSize, LKColumns, cols, LKRows, rows)
+		return
+	case simpleshell.ControlHeartbeat:
+		return
+	}
+	ff.sl.Error(LMUnknownControl, LKData, msg)
+}
@@ -0,0 +1,240 @@
+package iobroker
+
+/*
+ * frame_test.go
+ * Tests for frame.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/magisterquis/curlrevshell/lib/chanlog"
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+// frame returns a frame of type t with payload p.
+func frame(t byte, p string) string {
+	return string(simpleshell.AppendFrame(nil, t, []byte(p)))
+}
+
+// filterAll filters have through a new frameFilter for b, chunk bytes at a
+// time, and returns the standard output, standard error, and messages.
+func filterAll(b *Broker, have string, chunk int) (
+	stdout string,
+	stderr string,
+	msgs []string,
+) {
+	ff := b.newFrameFilter(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		"addr",
+	)
+	var ocs []outChunk
+	for 0 != len(have) {
+		n := min(chunk, len(have))
+		ocs = append(ocs, ff.filter(nil, []byte(have[:n]))...)
+		have = have[n:]
+	}
+	for _, oc := range append(ocs, ff.finish()...) {
+		if oc.stderr {
+			stderr += string(oc.o)
+		} else {
+			stdout += string(oc.o)
+		}
+		if nil != oc.msg {
+			msgs = append(msgs, oc.msg.Line)
+		}
+	}
+	return stdout, stderr, msgs
+}
+
+func TestFrameFilter(t *testing.T) {
+	for _, c := range []struct {
+		name          string
+		have          string
+		wantStdout    string
+		wantStderr    string
+		wantMsgs      []string
+		wantTransfers bool
+		wantStatus    string
+	}{{
+		name: "framed",
+		have: framedHello +
+			frame(simpleshell.FrameStdout, "before") +
+			frame(simpleshell.FrameStderr, "oops\n") +
+			frame(
+				simpleshell.FrameStdout,
+				simpleshell.TransferMarker+
+					simpleshell.TransferHello+"\n",
+			) +
+			frame(simpleshell.FrameControl, "heartbeat") +
+			frame('?', "from the future") +
+			frame(simpleshell.FrameStdout, "after") +
+			frame(simpleshell.FrameControl, "exit 3"),
+		wantStdout:    "beforeafter",
+		wantStderr:    "oops\n",
+		wantTransfers: true,
+		wantStatus:    "exit status 3",
+	}, {
+		name: "signal",
+		have: framedHello +
+			frame(simpleshell.FrameStdout, "kittens") +
+			frame(simpleshell.FrameControl, "signal killed"),
+		wantStdout: "kittens",
+		wantStatus: "signal: killed",
+	}, {
+		name: "plain",
+		have: simpleshell.TransferMarker + simpleshell.TransferHello +
+			"\nkittens",
+		wantStdout:    "kittens",
+		wantTransfers: true,
+	}, {
+		name:       "plain_hello_prefix",
+		have:       framedHello[:4],
+		wantStdout: framedHello[:4],
+	}, {
+		name:       "plain_stderr_frame",
+		have:       frame(simpleshell.FrameStderr, "kittens"),
+		wantStdout: frame(simpleshell.FrameStderr, "kittens"),
+	}, {
+		name: "incomplete",
+		have: framedHello +
+			frame(simpleshell.FrameStdout, "kittens")[:4],
+		wantMsgs: []string{
+			"[addr] Output ended in the middle of a frame",
+		},
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			for _, chunk := range []int{len(c.have), 1, 7} {
+				testFrameFilter(
+					t,
+					chunk,
+					c.have,
+					c.wantStdout,
+					c.wantStderr,
+					c.wantMsgs,
+					c.wantTransfers,
+					c.wantStatus,
+				)
+			}
+		})
+	}
+}
+
+// testFrameFilter tests filtering have, chunk bytes at a time.
+func testFrameFilter(
+	t *testing.T,
+	chunk int,
+	have string,
+	wantStdout string,
+	wantStderr string,
+	wantMsgs []string,
+	wantTransfers bool,
+	wantStatus string,
+) {
+	t.Helper()
+	b := new(Broker)
+	stdout, stderr, msgs := filterAll(b, have, chunk)
+	if stdout != wantStdout {
+		t.Errorf(
+			"Incorrect stdout with %d-byte chunks:\n"+
+				" got: %q\n"+
+				"want: %q",
+			chunk,
+			stdout,
+			wantStdout,
+		)
+	}
+	if stderr != wantStderr {
+		t.Errorf(
+			"Incorrect stderr with %d-byte chunks:\n"+
+				" got: %q\n"+
+				"want: %q",
+			chunk,
+			stderr,
+			wantStderr,
+		)
+	}
+	if !slices.Equal(msgs, wantMsgs) {
+		t.Errorf(
+			"Incorrect messages with %d-byte chunks:\n"+
+				" got: %q\n"+
+				"want: %q",
+			chunk,
+			msgs,
+			wantMsgs,
+		)
+	}
+	if got := b.transfers.Load(); got != wantTransfers {
+		t.Errorf(
+			"Incorrect transfers with %d-byte chunks:\n"+
+				" got: %v\n"+
+				"want: %v",
+			chunk,
+			got,
+			wantTransfers,
+		)
+	}
+	if got, _ := b.status.Load().(string); got != wantStatus {
+		t.Errorf(
+			"Incorrect status with %d-byte chunks:\n"+
+				" got: %q\n"+
+				"want: %q",
+			chunk,
+			got,
+			wantStatus,
+		)
+	}
+}
+
+func TestBrokerConnectInOut_Framed(t *testing.T) {
+	iob, _, och := newTestBroker(t)
+	var (
+		_, sl       = chanlog.New()
+		ctx, cancel = context.WithCancel(context.Background())
+		inr, inw    = io.Pipe()
+		outr, outw  = io.Pipe()
+		done        = make(chan struct{})
+	)
+	defer cancel()
+	go func() {
+		defer close(done)
+		iob.ConnectInOut(ctx, sl, "addr", inw, outr)
+	}()
+	opshell.ExpectShellMessages(t, och, opshell.CLine{
+		Color: logColor,
+		Line:  "[addr] " + ShellReadyMessage,
+	})
+
+	/* Standard error should be colored, and the exit status should
+	show up when the shell's gone. */
+	go func() {
+		io.WriteString(outw, framedHello+
+			frame(simpleshell.FrameStdout, "out\n")+
+			frame(simpleshell.FrameStderr, "err\n")+
+			frame(simpleshell.FrameControl, "exit 2"),
+		)
+		outw.Close()
+		inr.Close()
+	}()
+	opshell.ExpectShellMessages(t, och, opshell.CLine{
+		Line:  "out\n",
+		Plain: true,
+	}, opshell.CLine{
+		Color: stderrColor,
+		Line:  "err\n",
+		Plain: true,
+	}, opshell.CLine{
+		Color: errColor,
+		Line: "[addr] " + ShellDisconnectedMessage +
+			" (exit status 2)",
+	})
+	<-done
+}
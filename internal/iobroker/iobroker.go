@@ -6,7 +6,7 @@ package iobroker
  * Turn stream I/O into shell-friendly I/O
  * By J. Stuart McMurray
  * Created 20240919
- * Last Modified 20241003
+ * Last Modified 20261016
  */
 
 import (
@@ -19,6 +19,8 @@ import (
 	"log/slog"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/magisterquis/curlrevshell/lib/opshell"
 	"golang.org/x/sync/errgroup"
@@ -35,6 +37,15 @@ type sDirection string
 // Broker handles I/O From shells.  It ensures only one shell is connected
 // at once, but also makes sure it disconnects properly.
 type Broker struct {
+	// LootDir is the directory in which to save files sent by a
+	// simpleshell.TransferShell.  It is created if it doesn't exist.
+	// If LootDir is empty, such files are discarded.
+	LootDir string
+
+	// PutDir is the directory from which to send files requested with
+	// simpleshell.PutCommand.  If PutDir is empty, any file may be sent.
+	PutDir string
+
 	mu        sync.Mutex
 	key       string
 	cancelIn  func()
@@ -42,13 +53,16 @@ type Broker struct {
 	bidirKey  string /* Bidirectional sentinel key. */
 	wg        sync.WaitGroup
 	noMore    bool
+	transfers atomic.Bool  /* Shell is a simpleshell.TransferShell. */
+	status    atomic.Value /* Exit status, from a FramedShell. */
 
 	evMu        sync.Mutex
 	evCh        chan Event
 	evListeners map[chan<- Event]struct{}
 
-	ich <-chan string
-	och chan<- opshell.CLine
+	ich     <-chan string
+	och     chan<- opshell.CLine
+	outRoom chan struct{} /* Room for output lines in och. */
 }
 
 // New returns a new Broker, ready for use.  New's methods are safe for
@@ -62,9 +76,14 @@ func New(ich <-chan string, och chan<- opshell.CLine) (*Broker, error) {
 			err,
 		)
 	}
+	outRoom := make(chan struct{}, maxOutQueued)
+	for range maxOutQueued {
+		outRoom <- struct{}{}
+	}
 	return &Broker{
 		ich:         ich,
 		och:         och,
+		outRoom:     outRoom,
 		bidirKey:    string(bidirKeyBuf),
 		evCh:        make(chan Event, EVChanLen),
 		evListeners: make(map[chan<- Event]struct{}),
@@ -106,7 +125,7 @@ func (b *Broker) ConnectIn(
 		LVInput,
 		key,
 		func(ctx context.Context, sl *slog.Logger) error {
-			return b.proxyIn(ctx, sl, w)
+			return b.proxyIn(ctx, sl, addr, w)
 		},
 	)
 }
@@ -129,7 +148,7 @@ func (b *Broker) ConnectOut(
 		LVOutput,
 		key,
 		func(ctx context.Context, sl *slog.Logger) error {
-			return b.proxyOut(ctx, sl, r)
+			return b.proxyOut(ctx, sl, addr, r)
 		},
 	)
 }
@@ -315,18 +334,25 @@ func (b *Broker) connect(
 		go f() /* Avoid deadlock. */
 	}
 
-	/* If both sides of the shell are gone, tell the user. */
+	/* If both sides of the shell are gone, tell the user, and how it
+	went if we know. */
 	if nil == *cancelUs && nil == *cancelOther {
-		b.Errorf(addr, "%s", ShellDisconnectedMessage)
+		if es, _ := b.status.Load().(string); "" != es {
+			b.Errorf(addr, "%s (%s)", ShellDisconnectedMessage, es)
+		} else {
+			b.Errorf(addr, "%s", ShellDisconnectedMessage)
+		}
 		b.evCh <- Event{Type: EventTypeDisconnected}
 	}
 }
 
 // ProxyIn proxies from the ich passed to New. to the writer set by b.ConnectIn
-// or b.ConnectInOut.
+// or b.ConnectInOut.  Lines starting with simpleshell.PutCommand cause a file
+// to be sent.
 func (b *Broker) proxyIn(
 	ctx context.Context,
 	sl *slog.Logger,
+	addr string,
 	w io.Writer,
 ) error {
 	/* Set up to flush the writer, if it's flushable. */
@@ -345,6 +371,20 @@ func (b *Broker) proxyIn(
 			if !ok {  /* Input channel closed. */
 				return nil
 			}
+			/* Files to put are sent a bit differently. */
+			if isPutCommand(l) {
+				err := b.sendFile(sl, addr, w, l)
+				if nil != err {
+					return err
+				}
+				if err := flush(); nil != err {
+					return fmt.Errorf(
+						"flushing file: %w",
+						err,
+					)
+				}
+				continue
+			}
 			if _, err := io.WriteString(w, l); nil != err {
 				return fmt.Errorf("sending line: %w", err)
 			}
@@ -365,70 +405,62 @@ func (b *Broker) proxyIn(
 }
 
 // proxyOut proxies from the writer set by b.ConnectOut or b.ConnectInOut to
-// the och passed to New.
+// the och passed to New.  Transfers from a simpleshell.TransferShell are
+// removed from the output and handled.
 func (b *Broker) proxyOut(
 	ctx context.Context,
 	sl *slog.Logger,
+	addr string,
 	r io.Reader,
 ) error {
-	/* Make read data available to us. */
-	type outRet struct {
-		o   string
-		err error
-	}
-	och := make(chan outRet, 2)
+	/* Read output in the background.  While we wait for the operator,
+	it piles up in q, until there's too much and we stop reading. */
+	b.transfers.Store(false)
+	b.status.Store("")
+	q := newOutQueue()
 	go func() {
-		defer close(och)
 		var (
-			buf = make([]byte, 2048)
-			n   int
-			err error
+			bp  = outBufPool.Get().(*[]byte)
+			buf = (*bp)[:outReadLen]
+			ff  = b.newFrameFilter(sl, addr)
+			ocs []outChunk
 		)
-		for nil == ctx.Err() && nil == err {
-			n, err = r.Read(buf) /* Try to read a bit. */
-			if 0 != n {          /* Send data if we have it. */
-				och <- outRet{o: string(buf[:n])}
+		defer outBufPool.Put(bp)
+		for nil == ctx.Err() {
+			n, err := r.Read(buf) /* Try to read a bit. */
+			if 0 != n {           /* Send data if we have it. */
+				ocs = ff.filter(ocs[:0], buf[:n])
+				q.put(ctx, ocs)
 			}
 			if nil != err { /* And an error if we have one. */
-				och <- outRet{err: err}
+				q.put(ctx, append(
+					ff.finish(),
+					outChunk{err: err},
+				))
+				return
 			}
 		}
 	}()
 
 	/* Proxy output until something happens. */
-	var err error
-	for nil == err {
-		select {
-		case o, ok := <-och: /* Chunk of output. */
-			if !ok {
-				err = io.EOF /* Will be cleared later. */
-				break
-			}
-			/* If we got output. send it forth. */
-			if "" != o.o {
-				select {
-				case b.och <- opshell.CLine{
-					Line:  o.o,
-					Plain: true,
-				}:
-					sl.Info(LMShellIO, LKData, o.o)
-				case <-ctx.Done(): /* Should stop. */
-				}
-			}
-			/* If we got an error, we're done. */
-			if nil != o.err {
-				err = o.err
-			}
-		case <-ctx.Done(): /* Someone told us to stop. */
-		}
-		/* If the context is done, save the error if we don't have
-		a better one. */
-		if nil != ctx.Err() {
+	var (
+		ocs []outChunk
+		err error
+	)
+	for nil == err && nil == ctx.Err() {
+		ocs = q.take(ctx, ocs)
+		for _, oc := range ocs {
 			if nil == err {
-				err = context.Cause(ctx)
+				err = b.sendOut(ctx, sl, oc)
 			}
+			putOutBuf(oc)
 		}
 	}
+	/* If the context is done, save the error if we don't have a better
+	one. */
+	if nil == err {
+		err = context.Cause(ctx)
+	}
 
 	/* Some errors just indicate "normal" termination. */
 	if errors.Is(err, io.EOF) ||
@@ -440,3 +472,72 @@ func (b *Broker) proxyOut(
 
 	return err
 }
+
+// sendOut sends oc's output or message to the operator and returns oc's
+// error.  Output is logged.  Output is only sent when fewer than maxOutQueued
+// lines are waiting for the operator, so as not to hold up everything else.
+func (b *Broker) sendOut(
+	ctx context.Context,
+	sl *slog.Logger,
+	oc outChunk,
+) error {
+	/* If we got output, send it forth. */
+	if 0 != len(oc.o) && b.waitForOutRoom(ctx) {
+		cl := opshell.CLine{
+			Line:  string(oc.o),
+			Plain: true,
+			Taken: b.outRoom,
+		}
+		if oc.stderr {
+			cl.Color = stderrColor
+		}
+		select {
+		case b.och <- cl:
+			logOut(sl, cl.Line, oc.stderr)
+		case <-ctx.Done(): /* Should stop. */
+			b.outRoom <- struct{}{}
+		}
+	}
+	/* Same with messages about transfers. */
+	if nil != oc.msg {
+		select {
+		case b.och <- *oc.msg:
+		case <-ctx.Done(): /* Should stop. */
+		}
+	}
+	return oc.err
+}
+
+// waitForOutRoom waits until fewer than maxOutQueued lines are waiting for
+// the operator and takes room for another.  The room is given back via the
+// line's opshell.CLine.Taken.  Shells get room in the order they asked for
+// it.  waitForOutRoom returns false if ctx is done first.
+func (b *Broker) waitForOutRoom(ctx context.Context) bool {
+	select {
+	case <-b.outRoom:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// logOut logs output sent to the operator, in pieces of at most maxOutLog
+// bytes.  Pieces end on a rune boundary, if there's one nearby.
+func logOut(sl *slog.Logger, o string, stderr bool) {
+	for 0 != len(o) {
+		n := min(len(o), maxOutLog)
+		for i := n; len(o) > i && n-utf8.UTFMax < i; i-- {
+			if utf8.RuneStart(o[i]) {
+				n = i
+				break
+			}
+		}
+		p := o[:n]
+		o = o[n:]
+		if stderr {
+			sl.Info(LMShellIO, LKStream, LVStderr, LKData, p)
+		} else {
+			sl.Info(LMShellIO, LKData, p)
+		}
+	}
+}
@@ -5,7 +5,7 @@ package iobroker
  * Tests for iobroker.go
  * By J. Stuart McMurray
  * Created 20240925
- * Last Modified 20241003
+ * Last Modified 20261016
  */
 
 import (
@@ -13,12 +13,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/magisterquis/curlrevshell/lib/chanlog"
 	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
@@ -453,3 +458,225 @@ func TestBrokerConnectInOut(t *testing.T) {
 		})
 	})
 }
+
+// chunkReader returns data in chunks of at most n bytes, like a request body
+// might.
+type chunkReader struct {
+	data []byte
+	n    int
+}
+
+// Read implements io.Reader.
+func (cr *chunkReader) Read(b []byte) (int, error) {
+	if 0 == len(cr.data) {
+		return 0, io.EOF
+	}
+	n := copy(b[:min(len(b), cr.n)], cr.data)
+	cr.data = cr.data[n:]
+	return n, nil
+}
+
+// BenchmarkBrokerProxyOut measures how fast a mebibyte of output gets to the
+// operator.  Each op is a mebibyte, so allocs/op is allocations per MiB.
+func BenchmarkBrokerProxyOut(b *testing.B) {
+	/* A mebibyte of something like cat'ing a file. */
+	var plain []byte
+	for i := 0; len(plain) < 1<<20; i++ {
+		plain = fmt.Appendf(plain, "Line %d of a big file\n", i)
+	}
+	plain = plain[:1<<20]
+	framed := []byte(framedHello)
+	for p := plain; 0 != len(p); {
+		n := min(len(p), 4096)
+		framed = simpleshell.AppendFrame(
+			framed,
+			simpleshell.FrameStdout,
+			p[:n],
+		)
+		p = p[n:]
+	}
+
+	for _, c := range []struct {
+		name string
+		have []byte
+	}{{
+		name: "plain",
+		have: plain,
+	}, {
+		name: "framed",
+		have: framed,
+	}} {
+		for _, rn := range []int{512, 4096, 32768} {
+			b.Run(fmt.Sprintf("%s/read_%d", c.name, rn), func(
+				b *testing.B,
+			) {
+				benchmarkBrokerProxyOut(b, c.have, rn)
+			})
+		}
+	}
+}
+
+// benchmarkBrokerProxyOut proxies have, read n bytes at a time, b.N times.
+func benchmarkBrokerProxyOut(b *testing.B, have []byte, n int) {
+	var (
+		och  = make(chan opshell.CLine, 1024)
+		sl   = slog.New(slog.NewJSONHandler(io.Discard, nil))
+		done = make(chan struct{})
+	)
+	iob, err := New(nil, och)
+	if nil != err {
+		b.Fatalf("Error making broker: %s", err)
+	}
+	/* Operator who reads really fast. */
+	go func() {
+		defer close(done)
+		for cl := range och {
+			cl.Taken <- struct{}{}
+		}
+	}()
+	b.SetBytes(1 << 20)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if err := iob.proxyOut(
+			context.Background(),
+			sl,
+			"addr",
+			&chunkReader{data: have, n: n},
+		); nil != err {
+			b.Fatalf("Error proxying: %s", err)
+		}
+	}
+	b.StopTimer()
+	close(och)
+	<-done
+}
+
+// countingReader is an endless reader which counts how much's been read.
+type countingReader struct{ n atomic.Int64 }
+
+// Read implements io.Reader.
+func (cr *countingReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 'a'
+	}
+	cr.n.Add(int64(len(b)))
+	return len(b), nil
+}
+
+func TestBrokerProxyOut_Backpressure(t *testing.T) {
+	var (
+		och         = make(chan opshell.CLine, 1024)
+		sl          = slog.New(slog.NewJSONHandler(io.Discard, nil))
+		cr          countingReader
+		ctx, cancel = context.WithCancel(context.Background())
+		ech         = make(chan error, 1)
+	)
+	defer cancel()
+	iob, err := New(nil, och)
+	if nil != err {
+		t.Fatalf("Error making broker: %s", err)
+	}
+	go func() { ech <- iob.proxyOut(ctx, sl, "addr", &cr) }()
+
+	/* With nobody reading och, we should stop reading eventually, with
+	room left in och for everybody else. */
+	var last int64
+	for {
+		time.Sleep(100 * time.Millisecond)
+		n := cr.n.Load()
+		if n == last {
+			break
+		}
+		last = n
+	}
+	if got := len(och); maxOutQueued != got {
+		t.Errorf(
+			"Incorrect queued lines:\n got: %d\nwant: %d",
+			got,
+			maxOutQueued,
+		)
+	}
+	if max := int64(maxOutMemory); max < last {
+		t.Errorf("Read %d bytes, expected at most %d", last, max)
+	}
+
+	/* Reading output should let more through. */
+	timeout := time.After(10 * time.Second)
+	for last == cr.n.Load() {
+		select {
+		case cl := <-och:
+			cl.Taken <- struct{}{}
+		case <-timeout:
+			t.Fatalf("Reading stalled after output was read")
+		}
+	}
+
+	/* Should stop when asked. */
+	cancel()
+	select {
+	case err := <-ech:
+		if nil != err {
+			t.Errorf("Error proxying: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Proxying didn't stop")
+	}
+}
+
+func TestBrokerWaitForOutRoom(t *testing.T) {
+	iob, _, och := newTestBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	/* Use up all the room. */
+	for i := range maxOutQueued {
+		if !iob.waitForOutRoom(ctx) {
+			t.Fatalf("No room for line %d", i)
+		}
+		och <- opshell.CLine{Taken: iob.outRoom}
+	}
+
+	/* Taking a line should make room for another. */
+	got := make(chan bool, 1)
+	go func() { got <- iob.waitForOutRoom(ctx) }()
+	select {
+	case <-got:
+		t.Fatalf("Got room without any lines being taken")
+	case <-time.After(10 * time.Millisecond):
+	}
+	opshell.ExpectShellMessages(t, och, opshell.CLine{})
+	select {
+	case ok := <-got:
+		if !ok {
+			t.Errorf("Didn't get room after a line was taken")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("No room after a line was taken")
+	}
+
+	/* Should give up when the context's done. */
+	cancel()
+	if iob.waitForOutRoom(ctx) {
+		t.Errorf("Got room after cancel")
+	}
+}
+
+func TestLogOut(t *testing.T) {
+	var (
+		cl, sl = chanlog.New()
+		have   = strings.Repeat("a", maxOutLog-1) + "é" + "moose"
+	)
+	logOut(sl, have, true)
+	for _, want := range []string{
+		strings.Repeat("a", maxOutLog-1),
+		"émoose",
+	} {
+		cl.ExpectJSON(t, 0, chanlog.Exact(chanlog.Fields{
+			"level":  "INFO",
+			"msg":    LMShellIO,
+			LKStream: LVStderr,
+			LKData:   want,
+		}))
+	}
+}
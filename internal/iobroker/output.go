@@ -0,0 +1,171 @@
+package iobroker
+
+/*
+ * output.go
+ * Coalesce output on its way to the operator
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	// outReadLen is how much output we try to read at once.
+	outReadLen = 32 * 1024
+
+	// maxOutLine is the most output we send the operator in one
+	// opshell.CLine.
+	maxOutLine = 64 * 1024
+
+	// maxOutPending is how much output we hold while waiting on the
+	// operator before we stop reading more.
+	maxOutPending = 256 * 1024
+
+	// maxOutQueued is how many lines may be waiting for the operator
+	// before we hold off on sending output, to leave room for everything
+	// else.
+	maxOutQueued = 8
+
+	// maxOutMemory is roughly the most output we hold at once: what's
+	// waiting for the operator, what's being sent, and what's been read
+	// since.
+	maxOutMemory = maxOutQueued*maxOutLine + 2*(maxOutPending+outReadLen)
+
+	// maxOutLog is the most output we log at once.  Much more and
+	// log/slog starts allocating buffers for every log line.
+	maxOutLog = 4 * 1024
+)
+
+// outBufPool holds buffers for reading and coalescing output.  Each is a
+// *[]byte with a capacity of maxOutLine.
+var outBufPool = sync.Pool{New: func() any {
+	b := make([]byte, 0, maxOutLine)
+	return &b
+}}
+
+// getOutBuf gets an empty buffer from outBufPool.
+func getOutBuf() *[]byte {
+	bp := outBufPool.Get().(*[]byte)
+	*bp = (*bp)[:0]
+	return bp
+}
+
+// putOutBuf returns oc's output buffer to outBufPool, if it came from there.
+func putOutBuf(oc outChunk) {
+	if nil == oc.buf {
+		return
+	}
+	*oc.buf = oc.o[:0]
+	outBufPool.Put(oc.buf)
+}
+
+// outQueue holds output while the operator's busy.  Output from the same
+// stream is coalesced into chunks of up to maxOutLine bytes, and writers
+// block when too much is held.
+type outQueue struct {
+	mu     sync.Mutex
+	chunks []outChunk
+	size   int /* Bytes of output in chunks. */
+
+	ready chan struct{} /* Something's in chunks. */
+	taken chan struct{} /* Chunks were taken. */
+}
+
+// newOutQueue returns a new outQueue, ready for use.
+func newOutQueue() *outQueue {
+	return &outQueue{
+		ready: make(chan struct{}, 1),
+		taken: make(chan struct{}, 1),
+	}
+}
+
+// put adds ocs to q.  Output in ocs is copied, so ocs may be reused as soon
+// as put returns.  If q holds maxOutPending or more bytes, put blocks until
+// some is taken or ctx is done.
+func (q *outQueue) put(ctx context.Context, ocs []outChunk) {
+	q.mu.Lock()
+	for _, oc := range ocs {
+		q.add(oc)
+	}
+	full := maxOutPending <= q.size
+	q.mu.Unlock()
+	poke(q.ready)
+
+	/* Hold off on reading more until the operator's caught up a bit. */
+	for full {
+		select {
+		case <-q.taken:
+		case <-ctx.Done():
+			return
+		}
+		q.mu.Lock()
+		full = maxOutPending <= q.size
+		q.mu.Unlock()
+	}
+}
+
+// add adds oc to the end of q's chunks.  q.mu must be held.
+func (q *outQueue) add(oc outChunk) {
+	for 0 != len(oc.o) {
+		/* Add to the previous chunk if we can. */
+		n := len(q.chunks)
+		if 0 == n ||
+			nil != q.chunks[n-1].msg ||
+			nil != q.chunks[n-1].err ||
+			oc.stderr != q.chunks[n-1].stderr ||
+			maxOutLine == len(q.chunks[n-1].o) {
+			bp := getOutBuf()
+			q.chunks = append(q.chunks, outChunk{
+				o:      *bp,
+				buf:    bp,
+				stderr: oc.stderr,
+			})
+			n++
+		}
+		last := &q.chunks[n-1]
+		l := min(len(oc.o), maxOutLine-len(last.o))
+		last.o = append(last.o, oc.o[:l]...)
+		oc.o = oc.o[l:]
+		q.size += l
+	}
+	if nil != oc.msg || nil != oc.err {
+		q.chunks = append(q.chunks, outChunk{msg: oc.msg, err: oc.err})
+	}
+}
+
+// take waits for chunks to be put in q and returns all of them.  The chunks
+// are appended to spare[:0], which may be nil.  take returns nil if ctx is
+// done first.  The chunks' output should be returned with putOutBuf when it's
+// no longer needed.
+func (q *outQueue) take(ctx context.Context, spare []outChunk) []outChunk {
+	clear(spare)
+	for {
+		q.mu.Lock()
+		ocs := q.chunks
+		if 0 != len(ocs) {
+			q.chunks, q.size = spare[:0], 0
+		}
+		q.mu.Unlock()
+		if 0 != len(ocs) {
+			poke(q.taken)
+			return ocs
+		}
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// poke sends to ch if it's not already full.
+func poke(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,148 @@
+package iobroker
+
+/*
+ * output_test.go
+ * Tests for output.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+)
+
+// chunkString returns a string representation of oc, for comparison.
+func chunkString(oc outChunk) string {
+	var parts []string
+	if 0 != len(oc.o) {
+		s := "o"
+		if oc.stderr {
+			s = "e"
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d", s, len(oc.o)))
+	}
+	if nil != oc.msg {
+		parts = append(parts, "msg:"+oc.msg.Line)
+	}
+	if nil != oc.err {
+		parts = append(parts, "err:"+oc.err.Error())
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestOutQueue(t *testing.T) {
+	var (
+		q    = newOutQueue()
+		big  = make([]byte, maxOutLine+10)
+		have = [][]outChunk{{
+			{o: []byte("abc")},
+			{o: []byte("def")},
+			{o: []byte("gh"), stderr: true},
+		}, {
+			{o: []byte("ij"), stderr: true},
+			{msg: &opshell.CLine{Line: "kittens"}},
+			{o: big},
+			{err: io.EOF},
+		}}
+		want = []string{
+			"o:6",
+			"e:4",
+			"msg:kittens",
+			fmt.Sprintf("o:%d", maxOutLine),
+			"o:10",
+			"err:EOF",
+		}
+	)
+	for _, ocs := range have {
+		q.put(context.Background(), ocs)
+	}
+	/* Output should be copied. */
+	copy(big, "moose")
+	ocs := q.take(context.Background(), nil)
+	got := make([]string, len(ocs))
+	for i, oc := range ocs {
+		got[i] = chunkString(oc)
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		t.Errorf("Incorrect chunks:\n got:\n%s\nwant:\n%s", g, w)
+	}
+	if "abcdef" != string(ocs[0].o) {
+		t.Errorf("Incorrect output:\n got: %q\nwant: abcdef", ocs[0].o)
+	}
+	if 0 != ocs[3].o[0] {
+		t.Errorf("Output not copied")
+	}
+}
+
+func TestOutQueue_Backpressure(t *testing.T) {
+	q := newOutQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	/* Fill the queue, which should block until we take. */
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.put(ctx, []outChunk{{o: make([]byte, maxOutPending)}})
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Put didn't block with a full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if ocs := q.take(ctx, nil); 0 == len(ocs) {
+		t.Fatalf("Took no chunks")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Put still blocked after take")
+	}
+
+	/* Take should give up when the context's done. */
+	cancel()
+	if ocs := q.take(ctx, nil); nil != ocs {
+		t.Errorf("Took chunks after cancel: %v", ocs)
+	}
+}
+
+func TestOutBufPool(t *testing.T) {
+	bp := getOutBuf()
+	if b := *bp; 0 != len(b) || maxOutLine != cap(b) {
+		t.Fatalf(
+			"Incorrect buffer:\n"+
+				" got: len %d, cap %d\n"+
+				"want: len 0, cap %d",
+			len(b),
+			cap(b),
+			maxOutLine,
+		)
+	}
+	putOutBuf(outChunk{o: append(*bp, "kittens"...), buf: bp})
+	/* Not from the pool, shouldn't be added. */
+	putOutBuf(outChunk{o: []byte("moose")})
+	if b := *getOutBuf(); 0 != len(b) {
+		t.Errorf("Pooled buffer not empty: %q", b)
+	}
+
+	/* Putting buffers back shouldn't allocate. */
+	ocs := make([]outChunk, 101)
+	for i := range ocs {
+		bp := getOutBuf()
+		ocs[i] = outChunk{o: append(*bp, "kittens"...), buf: bp}
+	}
+	if n := testing.AllocsPerRun(len(ocs)-1, func() {
+		putOutBuf(ocs[0])
+		ocs = ocs[1:]
+	}); 0 != n {
+		t.Errorf("Putting a buffer back took %f allocations", n)
+	}
+}
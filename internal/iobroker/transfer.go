@@ -0,0 +1,410 @@
+package iobroker
+
+/*
+ * transfer.go
+ * File transfers with simpleshell
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+	"github.com/magisterquis/curlrevshell/lib/uu"
+)
+
+const (
+	// maxTransferLine is the longest line we'll hold on to while waiting
+	// for the rest of it after a simpleshell.TransferMarker.
+	maxTransferLine = 4096
+
+	// maxLootSuffix is the largest number we'll add to a loot file's name
+	// to avoid clobbering an existing file.
+	maxLootSuffix = 1000
+
+	// uuBeginPrefix and uuEndLine start and end a uuencoded file.
+	uuBeginPrefix = "begin "
+	uuEndLine     = "end"
+)
+
+// outChunk is a chunk of a shell's output, or a message about it for the
+// user.  Output returned by a filter may be part of the filter's input, and
+// is only valid until the filter is next called.
+type outChunk struct {
+	o      []byte
+	buf    *[]byte /* o's buffer, if it's from outBufPool. */
+	stderr bool    /* o is from standard error. */
+	msg    *opshell.CLine
+	err    error
+}
+
+// transferFilter removes messages and files sent by a
+// simpleshell.TransferShell from a shell's output.  Files are saved in
+// b.LootDir.
+type transferFilter struct {
+	b    *Broker
+	sl   *slog.Logger
+	addr string
+
+	held   []byte /* Possible marker start or partial line. */
+	inMsg  bool   /* Got a marker, waiting for its line. */
+	inFile bool   /* Decoding a file. */
+
+	/* The file we're saving. */
+	name string   /* Name on target. */
+	f    *os.File /* Nil if we're discarding the file. */
+	n    int64
+	dbuf []byte
+}
+
+// newTransferFilter returns a new transferFilter for b.  The returned filter
+// is not safe for concurrent use.
+func (b *Broker) newTransferFilter(
+	sl *slog.Logger,
+	addr string,
+) *transferFilter {
+	return &transferFilter{b: b, sl: sl, addr: addr}
+}
+
+// filter appends the output in o which isn't part of a transfer as well as
+// messages for the user about transfers to ret, in order, and returns ret.
+// Output which might be the start of a transfer is held until the next call
+// to filter or finish.
+func (tf *transferFilter) filter(ret []outChunk, o []byte) []outChunk {
+	var (
+		marker = []byte(simpleshell.TransferMarker)
+		buf    = o
+		out    = func(b []byte) {
+			if 0 != len(b) {
+				ret = append(ret, outChunk{o: b})
+			}
+		}
+	)
+	if 0 != len(tf.held) {
+		buf = append(tf.held, o...)
+	}
+	for 0 != len(buf) {
+		/* Outside of a transfer, look for the next one. */
+		if !tf.inMsg && !tf.inFile {
+			i := bytes.Index(buf, marker)
+			if -1 == i {
+				keep := partialSuffix(buf, marker)
+				out(buf[:len(buf)-keep])
+				buf = buf[len(buf)-keep:]
+				break
+			}
+			out(buf[:i])
+			buf = buf[i+len(marker):]
+			tf.inMsg = true
+			continue
+		}
+
+		/* In a transfer, we work a line at a time. */
+		i := bytes.IndexByte(buf, '\n')
+		if -1 == i {
+			if maxTransferLine < len(buf) {
+				ret = append(ret, tf.abandon(
+					"line too long",
+				)...)
+				out(buf)
+				buf = nil
+			}
+			break
+		}
+		line := bytes.TrimSuffix(buf[:i], []byte{'\r'})
+		buf = buf[i+1:]
+		if msg := tf.handleLine(line); nil != msg {
+			ret = append(ret, outChunk{msg: msg})
+		}
+	}
+	tf.held = bytes.Clone(buf)
+	return ret
+}
+
+// finish returns held output which turned out not to be a transfer, or a
+// message about a file which was being received but wasn't finished.  It
+// should be called once output is finished.
+func (tf *transferFilter) finish() []outChunk {
+	held := tf.held
+	tf.held = nil
+	if tf.inMsg || tf.inFile {
+		return tf.abandon("output ended")
+	}
+	if 0 != len(held) {
+		return []outChunk{{o: held}}
+	}
+	return nil
+}
+
+// abandon gives up on the current transfer.  The returned message explains
+// why, if a file was being received.
+func (tf *transferFilter) abandon(why string) []outChunk {
+	var ret []outChunk
+	if tf.inFile {
+		tf.closeFile(errors.New(why))
+		ret = append(ret, outChunk{msg: tf.b.errLine(
+			tf.addr,
+			"Incomplete file %s: %s",
+			tf.name,
+			why,
+		)})
+	}
+	tf.inMsg = false
+	tf.inFile = false
+	return ret
+}
+
+// handleLine handles a line following a marker or in a file.  It returns a
+// message for the user, if there is one.
+func (tf *transferFilter) handleLine(line []byte) *opshell.CLine {
+	/* The line after the marker is what's being sent. */
+	if tf.inMsg {
+		tf.inMsg = false
+		switch l := string(line); {
+		case simpleshell.TransferHello == l:
+			tf.b.transfers.Store(true)
+			tf.sl.Info(LMTransfersSupported)
+			return nil
+		case strings.HasPrefix(l, uuBeginPrefix):
+			return tf.startFile(l)
+		default:
+			tf.sl.Error(LMUnknownTransfer, LKData, l)
+			return tf.b.errLine(
+				tf.addr,
+				"Unknown transfer message %q",
+				l,
+			)
+		}
+	}
+
+	/* In a file, save data until the end. */
+	if uuEndLine == string(line) {
+		return tf.finishFile()
+	}
+	if nil == tf.f {
+		return nil
+	}
+	var err error
+	if tf.dbuf, err = uu.AppendDecode(tf.dbuf[:0], line); nil != err {
+		err = fmt.Errorf("decoding: %w", err)
+	} else if _, err = tf.f.Write(tf.dbuf); nil != err {
+		err = fmt.Errorf("writing: %w", err)
+	}
+	if nil != err {
+		tf.closeFile(err)
+		return tf.b.errLine(
+			tf.addr,
+			"Error saving file %s: %s",
+			tf.name,
+			err,
+		)
+	}
+	tf.n += int64(len(tf.dbuf))
+	return nil
+}
+
+// startFile starts saving a file, given its uuencoded begin line.
+func (tf *transferFilter) startFile(begin string) *opshell.CLine {
+	tf.inFile = true
+	tf.n = 0
+	_, tf.name, _ = strings.Cut(
+		strings.TrimPrefix(begin, uuBeginPrefix),
+		" ",
+	)
+
+	/* Work out where to put it. */
+	if "" == tf.b.LootDir {
+		tf.sl.Error(LMFileDiscarded, LKPath, tf.name)
+		return tf.b.errLine(
+			tf.addr,
+			"Discarding file %s, as there's no loot directory",
+			tf.name,
+		)
+	}
+	f, err := createLootFile(tf.b.LootDir, tf.name)
+	if nil != err {
+		tf.sl.Error(LMFileDiscarded, LKPath, tf.name, LKError, err)
+		return tf.b.errLine(
+			tf.addr,
+			"Error saving file %s: %s",
+			tf.name,
+			err,
+		)
+	}
+	tf.f = f
+	return nil
+}
+
+// finishFile finishes saving a file.
+func (tf *transferFilter) finishFile() *opshell.CLine {
+	tf.inFile = false
+	if nil == tf.f {
+		return nil
+	}
+	fn := tf.f.Name()
+	if err := tf.closeFile(nil); nil != err {
+		return tf.b.errLine(
+			tf.addr,
+			"Error saving file %s: %s",
+			tf.name,
+			err,
+		)
+	}
+	tf.sl.Info(LMFileSaved, LKPath, tf.name, LKFile, fn, LKSize, tf.n)
+	return tf.b.logLine(
+		tf.addr,
+		"Saved %s (%d bytes) as %s",
+		tf.name,
+		tf.n,
+		fn,
+	)
+}
+
+// closeFile closes the file we're saving, if we have one.  If err is not nil,
+// it's logged as the reason the file is incomplete.
+func (tf *transferFilter) closeFile(err error) error {
+	if nil == tf.f {
+		return nil
+	}
+	fn := tf.f.Name()
+	cerr := tf.f.Close()
+	tf.f = nil
+	if nil == err && nil != cerr {
+		err = fmt.Errorf("closing %s: %w", fn, cerr)
+	}
+	if nil != err {
+		tf.sl.Error(
+			LMFileIncomplete,
+			LKPath, tf.name,
+			LKFile, fn,
+			LKSize, tf.n,
+			LKError, err,
+		)
+	}
+	return err
+}
+
+// createLootFile creates a new file in dir named after the last element of
+// name.  If the file already exists, a number is added to the name.
+func createLootFile(dir, name string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0700); nil != err {
+		return nil, fmt.Errorf("making loot directory: %w", err)
+	}
+	base := filepath.Base(filepath.FromSlash(name))
+	if "." == base || string(filepath.Separator) == base {
+		base = "file"
+	}
+	fn := filepath.Join(dir, base)
+	for i := 1; i <= maxLootSuffix; i++ {
+		f, err := os.OpenFile(
+			fn,
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+			0600,
+		)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+		fn = filepath.Join(dir, base+"."+strconv.Itoa(i))
+	}
+	return nil, fmt.Errorf("too many files named %s", base)
+}
+
+// partialSuffix returns the length of the longest suffix of b which is a
+// prefix of marker, but not all of marker.
+func partialSuffix(b, marker []byte) int {
+	for n := min(len(b), len(marker)-1); 0 < n; n-- {
+		if bytes.HasSuffix(b, marker[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// isPutCommand returns true if l is a simpleshell.PutCommand line.
+func isPutCommand(l string) bool {
+	c, _, _ := strings.Cut(l, " ")
+	return simpleshell.PutCommand == strings.TrimSpace(c)
+}
+
+// sendFile handles a simpleshell.PutCommand line from the user by sending the
+// named file, uuencoded, to w.  The line should be the command followed by
+// the file to send and optionally the path to which to write it on target.
+// Only errors writing to w are returned; other errors are sent to the user.
+func (b *Broker) sendFile(
+	sl *slog.Logger,
+	addr string,
+	w io.Writer,
+	line string,
+) error {
+	/* Work out what to send. */
+	args := strings.Fields(line)
+	if 2 != len(args) && 3 != len(args) {
+		b.Errorf(
+			addr,
+			"Usage: %s file [path on target]",
+			simpleshell.PutCommand,
+		)
+		return nil
+	}
+	src, dst := args[1], filepath.Base(args[1])
+	if 3 == len(args) {
+		dst = args[2]
+	}
+	if !b.transfers.Load() {
+		b.Errorf(addr, "Shell doesn't support %s", args[0])
+		return nil
+	}
+	if "" != b.PutDir {
+		src = filepath.Join(b.PutDir, filepath.Clean("/"+src))
+	}
+	f, err := os.Open(src)
+	if nil != err {
+		sl.Error(LMFileNotSent, LKFile, src, LKError, err)
+		b.Errorf(addr, "Error opening %s: %s", src, err)
+		return nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if nil != err {
+		sl.Error(LMFileNotSent, LKFile, src, LKError, err)
+		b.Errorf(addr, "Error getting info about %s: %s", src, err)
+		return nil
+	} else if !fi.Mode().IsRegular() {
+		sl.Error(LMFileNotSent, LKFile, src, LKError, "not a file")
+		b.Errorf(addr, "Not a regular file: %s", src)
+		return nil
+	}
+
+	/* Send it. */
+	if _, err := fmt.Fprintf(
+		w,
+		"%s %s\n",
+		simpleshell.PutCommand,
+		dst,
+	); nil != err {
+		return fmt.Errorf("sending %s: %w", simpleshell.PutCommand, err)
+	}
+	e := uu.NewFileEncoder(w, fi.Mode(), dst)
+	n, err := io.Copy(e, f)
+	if cerr := e.Close(); nil == err {
+		err = cerr
+	}
+	if nil != err {
+		return fmt.Errorf("sending %s: %w", src, err)
+	}
+	sl.Info(LMFileSent, LKFile, src, LKPath, dst, LKSize, n)
+	b.Logf(addr, "Sent %s (%d bytes) to %s", src, n, dst)
+	return nil
+}
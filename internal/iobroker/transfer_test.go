@@ -0,0 +1,219 @@
+package iobroker
+
+/*
+ * transfer_test.go
+ * Tests for transfer.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+	"github.com/magisterquis/curlrevshell/lib/uu"
+)
+
+// uuFile returns contents uuencoded with name, preceded by
+// simpleshell.TransferMarker.
+func uuFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	var sb strings.Builder
+	sb.WriteString(simpleshell.TransferMarker)
+	e := uu.NewFileEncoder(&sb, 0644, name)
+	if _, err := io.WriteString(e, contents); nil != err {
+		t.Fatalf("Error encoding %s: %s", name, err)
+	}
+	if err := e.Close(); nil != err {
+		t.Fatalf("Error finishing encoding %s: %s", name, err)
+	}
+	return sb.String()
+}
+
+func TestTransferFilter(t *testing.T) {
+	var (
+		contents = strings.Repeat("kittens\n", 100)
+		have     = "before" +
+			simpleshell.TransferMarker + simpleshell.TransferHello +
+			"\nmiddle" +
+			uuFile(t, "/tmp/moose.txt", contents) +
+			"after"
+		want = "beforemiddleafter"
+	)
+	for _, c := range []struct {
+		name  string
+		chunk int
+	}{
+		{"all_at_once", len(have)},
+		{"byte_by_byte", 1},
+		{"odd_chunks", 7},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := &Broker{LootDir: t.TempDir()}
+			tf := b.newTransferFilter(
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+				"addr",
+			)
+
+			/* Filter it all. */
+			var (
+				got  strings.Builder
+				msgs []string
+			)
+			s := have
+			for 0 != len(s) {
+				n := min(c.chunk, len(s))
+				ocs := tf.filter(nil, []byte(s[:n]))
+				s = s[n:]
+				if 0 == len(s) {
+					ocs = append(ocs, tf.finish()...)
+				}
+				for _, oc := range ocs {
+					got.Write(oc.o)
+					if nil != oc.msg {
+						msgs = append(msgs, oc.msg.Line)
+					}
+				}
+			}
+
+			/* Make sure everything went the right way. */
+			if got := got.String(); got != want {
+				t.Errorf(
+					"Incorrect output:\n"+
+						" got: %q\n"+
+						"want: %q",
+					got,
+					want,
+				)
+			}
+			if !b.transfers.Load() {
+				t.Errorf("Hello not noticed")
+			}
+			fn := filepath.Join(b.LootDir, "moose.txt")
+			wantMsg := "[addr] Saved /tmp/moose.txt " +
+				"(800 bytes) as " + fn
+			if 1 != len(msgs) || wantMsg != msgs[0] {
+				t.Errorf(
+					"Incorrect messages:\n"+
+						" got: %q\n"+
+						"want: %q",
+					msgs,
+					[]string{wantMsg},
+				)
+			}
+			if b, err := os.ReadFile(fn); nil != err {
+				t.Errorf("Error reading saved file: %s", err)
+			} else if got := string(b); got != contents {
+				t.Errorf(
+					"Incorrect file contents:\n"+
+						" got: %q\n"+
+						"want: %q",
+					got,
+					contents,
+				)
+			}
+		})
+	}
+}
+
+func TestTransferFilter_Incomplete(t *testing.T) {
+	b := &Broker{LootDir: t.TempDir()}
+	tf := b.newTransferFilter(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		"addr",
+	)
+	f := uuFile(t, "moose", "kittens")
+	ocs := append(tf.filter(nil, []byte(f[:len(f)-5])), tf.finish()...)
+	if 1 != len(ocs) || nil == ocs[0].msg {
+		t.Fatalf("Expected one message, got %#v", ocs)
+	}
+	want := "[addr] Incomplete file moose: output ended"
+	if got := ocs[0].msg.Line; got != want {
+		t.Errorf("Incorrect message:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestCreateLootFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "loot")
+	for _, want := range []string{"passwd", "passwd.1", "passwd.2"} {
+		f, err := createLootFile(dir, "/etc/passwd")
+		if nil != err {
+			t.Fatalf("Error creating %s: %s", want, err)
+		}
+		f.Close()
+		if got := filepath.Base(f.Name()); got != want {
+			t.Errorf(
+				"Incorrect name:\n got: %s\nwant: %s",
+				got,
+				want,
+			)
+		}
+	}
+}
+
+func TestBroker_SendFile(t *testing.T) {
+	var (
+		iob, _, och = newTestBroker(t)
+		sl          = slog.New(slog.NewTextHandler(io.Discard, nil))
+		contents    = "kittens"
+		buf         bytes.Buffer
+	)
+	iob.PutDir = t.TempDir()
+	if err := os.WriteFile(
+		filepath.Join(iob.PutDir, "moose"),
+		[]byte(contents),
+		0600,
+	); nil != err {
+		t.Fatalf("Error making file to send: %s", err)
+	}
+
+	/* Without a TransferShell, nothing should be sent. */
+	line := simpleshell.PutCommand + " ../moose /tmp/m\n"
+	if err := iob.sendFile(sl, "addr", &buf, line); nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if 0 != buf.Len() {
+		t.Errorf("Sent without transfer support: %q", buf.String())
+	}
+	want := "[addr] Shell doesn't support " + simpleshell.PutCommand
+	if got := (<-och).Line; got != want {
+		t.Errorf("Incorrect message:\n got: %s\nwant: %s", got, want)
+	}
+
+	/* With one, the file should be sent, and from only PutDir. */
+	iob.transfers.Store(true)
+	if err := iob.sendFile(sl, "addr", &buf, line); nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	want = "[addr] Sent " + filepath.Join(iob.PutDir, "moose") +
+		" (7 bytes) to /tmp/m"
+	if got := (<-och).Line; got != want {
+		t.Errorf("Incorrect message:\n got: %s\nwant: %s", got, want)
+	}
+	cmd, err := buf.ReadString('\n')
+	if nil != err {
+		t.Fatalf("Error reading command: %s", err)
+	} else if want := simpleshell.PutCommand + " /tmp/m\n"; cmd != want {
+		t.Errorf("Incorrect command:\n got: %q\nwant: %q", cmd, want)
+	}
+	fd, err := uu.NewFileDecoder(&buf)
+	if nil != err {
+		t.Fatalf("Error starting to decode: %s", err)
+	}
+	if b, err := io.ReadAll(fd); nil != err {
+		t.Errorf("Error decoding: %s", err)
+	} else if got := string(b); got != contents {
+		t.Errorf(
+			"Incorrect contents:\n got: %q\nwant: %q",
+			got,
+			contents,
+		)
+	}
+}
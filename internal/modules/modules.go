@@ -0,0 +1,80 @@
+// Package modules is curlrevshell's built-in library of shell functions.
+package modules
+
+/*
+ * modules.go
+ * Built-in library of shell functions
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/magisterquis/curlrevshell/lib/shellfuncsfile"
+)
+
+// src holds the modules themselves.
+//
+//go:embed src
+var src embed.FS
+
+// FS holds the modules, suitable for use as a [shellfuncsfile.Converter]'s
+// Base.
+var FS fs.FS
+
+func init() {
+	var err error
+	if FS, err = fs.Sub(src, "src"); nil != err {
+		panic(fmt.Sprintf("getting modules directory: %s", err))
+	}
+}
+
+// Module describes a module.
+type Module struct {
+	Name string   /* File name. */
+	Docs []string /* TABDOC lines, less the prefix. */
+}
+
+// List lists the modules in FS.
+func List() ([]Module, error) {
+	des, err := fs.ReadDir(FS, ".")
+	if nil != err {
+		return nil, fmt.Errorf("reading modules directory: %w", err)
+	}
+	ms := make([]Module, 0, len(des))
+	for _, de := range des {
+		b, err := fs.ReadFile(FS, de.Name())
+		if nil != err {
+			return nil, fmt.Errorf("reading %s: %w", de.Name(), err)
+		}
+		m := Module{Name: de.Name()}
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			if l, ok := strings.CutPrefix(
+				s.Text(),
+				shellfuncsfile.DocPrefix,
+			); ok {
+				m.Docs = append(m.Docs, strings.TrimSpace(l))
+			}
+		}
+		if err := s.Err(); nil != err {
+			return nil, fmt.Errorf("parsing %s: %w", de.Name(), err)
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// Export writes the modules to dir, which will be created if it doesn't
+// exist.  Existing files won't be overwritten.
+func Export(dir string) error {
+	return os.CopyFS(dir, FS)
+}
@@ -0,0 +1,109 @@
+package modules
+
+/*
+ * modules_test.go
+ * Tests for modules.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/curlrevshell/lib/shellfuncsfile"
+)
+
+func TestList(t *testing.T) {
+	ms, err := List()
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if 0 == len(ms) {
+		t.Fatalf("No modules")
+	}
+	for _, m := range ms {
+		if 0 == len(m.Docs) {
+			t.Errorf("Module %s has no TABDOC lines", m.Name)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "modules")
+	if err := Export(dir); nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	/* Make sure we got all the files. */
+	des, err := fs.ReadDir(FS, ".")
+	if nil != err {
+		t.Fatalf("Error listing modules: %s", err)
+	}
+	for _, de := range des {
+		want, err := fs.ReadFile(FS, de.Name())
+		if nil != err {
+			t.Fatalf("Error reading %s: %s", de.Name(), err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, de.Name()))
+		if nil != err {
+			t.Errorf(
+				"Error reading exported %s: %s",
+				de.Name(),
+				err,
+			)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("Exported %s differs", de.Name())
+		}
+	}
+	/* Don't clobber things. */
+	if err := Export(dir); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Second export did not fail with ErrExist: %v", err)
+	}
+}
+
+// TestModules makes sure the modules convert and each documented function
+// exists.
+func TestModules(t *testing.T) {
+	conv := shellfuncsfile.NewDefaultConverter()
+	conv.AddListFunction = true
+	conv.Base = FS
+	b, err := conv.From()
+	if nil != err {
+		t.Fatalf("Error converting modules: %s", err)
+	}
+	ms, err := List()
+	if nil != err {
+		t.Fatalf("Error listing modules: %s", err)
+	}
+	if _, err := exec.LookPath("/bin/sh"); nil != err {
+		return
+	}
+	/* Make sure we can call tab_list, and it has everything. */
+	out, err := exec.Command(
+		"/bin/sh",
+		"-c",
+		string(b)+"\n"+shellfuncsfile.ListFuncName,
+	).CombinedOutput()
+	if nil != err {
+		t.Fatalf("Error running modules: %s\n%s", err, out)
+	}
+	lines := strings.Split(string(out), "\n")
+	for _, m := range ms {
+		for _, d := range m.Docs {
+			name, _, _ := strings.Cut(d, " ")
+			if !slices.ContainsFunc(lines, func(l string) bool {
+				return strings.HasPrefix(l, name+" ")
+			}) {
+				t.Errorf("Function %s missing from list", name)
+			}
+		}
+	}
+}
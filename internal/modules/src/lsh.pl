@@ -0,0 +1,35 @@
+#!/usr/bin/env perl
+# lsh.pl
+# Directory listing, with hashes
+# By J. Stuart McMurray
+# Created 20261016
+# Last Modified 20261016
+#
+# TABDOC: lsh List files with sizes, times, and SHA256 hashes: lsh [dir...]
+
+use strict;
+use warnings;
+use Digest::SHA;
+use POSIX qw/strftime/;
+
+@ARGV = (".") unless @ARGV;
+for my $dir (@ARGV) {
+	opendir my $dh, $dir or do { warn "$dir: $!\n"; next };
+	for my $name (sort grep { !/^\.\.?$/ } readdir $dh) {
+		my $path = "$dir/$name";
+		my @st = lstat $path or do { warn "$path: $!\n"; next };
+		my $hash = "-";
+		if (-f _) {
+			my $sha = Digest::SHA->new(256);
+			$hash = eval { $sha->addfile($path, "b")->hexdigest }
+				// "unreadable";
+		}
+		printf "%06o %10d %s %s %s\n",
+			$st[2],
+			$st[7],
+			strftime("%Y-%m-%dT%H:%M:%S", localtime $st[9]),
+			$hash,
+			$path;
+	}
+	closedir $dh;
+}
@@ -0,0 +1,371 @@
+package pivot
+
+/*
+ * forward.go
+ * ssh-style port forwarding
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+const (
+	// ForwardCommand is the operator command to manage port forwards.
+	// Without arguments, it lists forwards.
+	ForwardCommand = "@forward"
+
+	// ForwardUsage describes ForwardCommand's arguments.
+	ForwardUsage = ForwardCommand + " [-L|-R [bind:]port host:port] " +
+		"[-K number]"
+
+	// defaultForwardBind is the bind address used when a forward's given
+	// only a port.
+	defaultForwardBind = "127.0.0.1"
+)
+
+// forward is a local or remote port forward.  Local forwards listen on our
+// side and connect on the implant's side.  Remote forwards are the other
+// way around.
+type forward struct {
+	n      int
+	remote bool
+	bind   string       /* Listen address, after listening. */
+	target string       /* Where to connect. */
+	wid    string       /* Remote forwards' ID, for the implant. */
+	l      net.Listener /* Local forwards' listener. */
+
+	conns atomic.Int64 /* All connections. */
+	open  atomic.Int64 /* Open connections. */
+	sent  atomic.Int64 /* Bytes sent to target. */
+	recvd atomic.Int64 /* Bytes received from target. */
+}
+
+// String returns f in ssh-ish form.
+func (f *forward) String() string {
+	flag := "-L"
+	if f.remote {
+		flag = "-R"
+	}
+	return fmt.Sprintf("%d: %s %s -> %s", f.n, flag, f.bind, f.target)
+}
+
+// logger returns sl with f's details.
+func (f *forward) logger(sl *slog.Logger) *slog.Logger {
+	return sl.With(
+		LKForward, f.n,
+		LKRemote, f.remote,
+		LKListenAddr, f.bind,
+		LKDestination, f.target,
+	)
+}
+
+// proxy proxies between c, accepted from f's listener, and sc, connected to
+// f's target, and logs how it went.  Both are closed before proxy returns.
+func (f *forward) proxy(sl *slog.Logger, c, sc io.ReadWriteCloser) {
+	f.conns.Add(1)
+	f.open.Add(1)
+	defer f.open.Add(-1)
+	sl.Info(LMStreamStarted)
+	start := time.Now()
+	to, from := splice(c, sc, &f.sent, &f.recvd)
+	sl.Info(
+		LMStreamFinished,
+		LKToDest, to,
+		LKFromDest, from,
+		LKDuration, time.Since(start).String(),
+	)
+}
+
+// HandleCommand handles a ForwardCommand line from the user.  It returns
+// false if line isn't a ForwardCommand line.  Local forwards are closed when
+// ctx is done.
+func (p *Pivot) HandleCommand(ctx context.Context, line string) bool {
+	args := strings.Fields(line)
+	if 0 == len(args) || ForwardCommand != args[0] {
+		return false
+	}
+	switch {
+	case 1 == len(args):
+		p.listForwards()
+	case 3 == len(args) && "-K" == args[1]:
+		p.closeForward(args[2])
+	case 4 == len(args) && "-L" == args[1]:
+		p.addLocalForward(ctx, forwardBind(args[2]), args[3])
+	case 4 == len(args) && "-R" == args[1]:
+		/* This takes a round-trip to the implant. */
+		go p.addRemoteForward(ctx, forwardBind(args[2]), args[3])
+	default:
+		p.errorf("", "Usage: %s", ForwardUsage)
+	}
+	return true
+}
+
+// forwardBind adds defaultForwardBind to s if it's only a port.
+func forwardBind(s string) string {
+	if _, err := strconv.ParseUint(s, 10, 16); nil == err {
+		return net.JoinHostPort(defaultForwardBind, s)
+	}
+	return s
+}
+
+// addForward gives f a number and adds it to p's forwards.
+func (p *Pivot) addForward(f *forward) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastFwd++
+	f.n = p.lastFwd
+	p.forwards[f.n] = f
+}
+
+// removeForward removes the forward numbered n from p's forwards and
+// returns it, or nil if there's no such forward.  p.mu must be held.
+func (p *Pivot) removeForward(n int) *forward {
+	f, ok := p.forwards[n]
+	if !ok {
+		return nil
+	}
+	delete(p.forwards, n)
+	return f
+}
+
+// addLocalForward listens on bind and proxies connections to target, via the
+// implant.
+func (p *Pivot) addLocalForward(ctx context.Context, bind, target string) {
+	l, err := net.Listen("tcp", bind)
+	if nil != err {
+		p.sl.Error(
+			LMForwardFailed,
+			LKListenAddr, bind,
+			LKDestination, target,
+			LKError, err,
+		)
+		p.errorf("", "Error listening on %s: %s", bind, err)
+		return
+	}
+	f := &forward{bind: l.Addr().String(), target: target, l: l}
+	p.addForward(f)
+	sl := f.logger(p.sl)
+	sl.Info(LMForwardStarted)
+	p.logf("", "Forwarding %s", f)
+
+	go func() {
+		stop := context.AfterFunc(ctx, func() { l.Close() })
+		defer stop()
+		for {
+			c, err := l.Accept()
+			if nil != err {
+				return
+			}
+			go p.handleLocal(ctx, f, sl, c)
+		}
+	}()
+}
+
+// handleLocal proxies c, from f's listener, to f's target via the implant.
+func (p *Pivot) handleLocal(
+	ctx context.Context,
+	f *forward,
+	sl *slog.Logger,
+	c net.Conn,
+) {
+	defer c.Close()
+	sl = sl.With(LKClient, c.RemoteAddr().String())
+	sc, err := p.Dial(ctx, f.target)
+	if nil != err {
+		sl.Error(LMStreamFailed, LKError, err)
+		p.errorf("", "Forward %d: %s", f.n, err)
+		return
+	}
+	f.proxy(sl, c, sc)
+}
+
+// addRemoteForward asks the implant to listen on bind and proxies connections
+// to target from our side.
+func (p *Pivot) addRemoteForward(ctx context.Context, bind, target string) {
+	/* Add it first, so we don't miss connections. */
+	f := &forward{
+		remote: true,
+		bind:   bind,
+		target: target,
+		wid:    strconv.FormatUint(rand.Uint64(), 36),
+	}
+	p.addForward(f)
+
+	/* Ask the implant to listen.  It may have been closed with -K while
+	we were waiting, in which case there's nothing more to say. */
+	res := p.ask(ctx, simpleshell.PivotListen, f.wid, bind, false)
+	p.mu.Lock()
+	_, stillOpen := p.forwards[f.n]
+	if stillOpen && nil != res.err {
+		p.removeForward(f.n)
+	} else if stillOpen {
+		f.bind = res.listening
+	}
+	p.mu.Unlock()
+	if !stillOpen {
+		return
+	} else if nil != res.err {
+		f.logger(p.sl).Error(LMForwardFailed, LKError, res.err)
+		p.errorf(
+			"",
+			"Error listening on implant's %s: %s",
+			bind,
+			res.err,
+		)
+		return
+	}
+	f.logger(p.sl).Info(LMForwardStarted)
+	p.logf("", "Forwarding %s", f)
+}
+
+// acceptRemote proxies between w and r, from a connection accepted for the
+// remote forward with the given implant ID, and the forward's target.
+func (p *Pivot) acceptRemote(
+	ctx context.Context,
+	sl *slog.Logger,
+	w http.ResponseWriter,
+	r io.Reader,
+	wid string,
+) {
+	/* Work out where this one goes. */
+	var f *forward
+	p.mu.Lock()
+	for _, v := range p.forwards {
+		if v.remote && wid == v.wid {
+			f = v
+			sl = f.logger(sl)
+			break
+		}
+	}
+	p.mu.Unlock()
+	if nil == f {
+		sl.Error(LMUnknownStream, LKForward, wid)
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	/* Connect to the target, and tell the implant it worked. */
+	if !p.reserveStream() {
+		sl.Error(LMStreamFailed, LKError, ErrTooManyStreams)
+		http.Error(w, "", http.StatusServiceUnavailable)
+		return
+	}
+	d := net.Dialer{Timeout: cmp.Or(p.StreamTimeout, DefaultStreamTimeout)}
+	c, err := d.DialContext(ctx, "tcp", f.target)
+	if nil != err {
+		p.releaseStream()
+		sl.Error(LMStreamFailed, LKError, err)
+		p.errorf("", "Forward %d: %s", f.n, err)
+		http.Error(w, "", http.StatusBadGateway)
+		return
+	}
+	sc, err := p.startStream(w, r)
+	if nil != err {
+		c.Close()
+		p.releaseStream()
+		sl.Error(LMStreamFailed, LKError, err)
+		return
+	}
+	sc.release = p.releaseStream
+
+	/* Proxy until someone's done. */
+	go f.proxy(sl, sc, c)
+	sc.wait(ctx)
+}
+
+// closeForward closes the forward with the number in s.  Connections already
+// made aren't closed.
+func (p *Pivot) closeForward(s string) {
+	n, err := strconv.Atoi(s)
+	if nil != err {
+		p.errorf("", "Invalid forward number %q", s)
+		return
+	}
+	p.mu.Lock()
+	f := p.removeForward(n)
+	if nil != f && f.remote {
+		err = p.instruct(simpleshell.PivotUnlisten, f.wid)
+	}
+	p.mu.Unlock()
+	if nil == f {
+		p.errorf("", "No forward %d", n)
+		return
+	}
+	if nil != f.l {
+		f.l.Close()
+	}
+	sl := f.logger(p.sl)
+	if nil != err {
+		sl.Error(LMForwardClosed, LKError, err)
+		p.errorf("", "Closed %s, but couldn't tell implant: %s", f, err)
+		return
+	}
+	sl.Info(LMForwardClosed)
+	p.logf("", "Closed %s", f)
+}
+
+// dropRemoteForwards removes all remote forwards, which the implant no longer
+// has, because of why.
+func (p *Pivot) dropRemoteForwards(why string) {
+	var dropped []*forward
+	p.mu.Lock()
+	for _, n := range slices.Sorted(maps.Keys(p.forwards)) {
+		if f := p.forwards[n]; f.remote {
+			dropped = append(dropped, p.removeForward(n))
+		}
+	}
+	p.mu.Unlock()
+	for _, f := range dropped {
+		f.logger(p.sl).Info(LMForwardClosed, LKError, why)
+		p.errorf("", "Closed %s: %s", f, why)
+	}
+}
+
+// listForwards tells the user about p's forwards.
+func (p *Pivot) listForwards() {
+	p.logf("", "%s", p.describeForwards())
+}
+
+// describeForwards describes p's forwards, for listForwards.  Sending it to
+// the user happens without p.mu held, as it may take a while.
+func (p *Pivot) describeForwards() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if 0 == len(p.forwards) {
+		return "No forwards"
+	}
+	var sb strings.Builder
+	sb.WriteString("Forwards:")
+	for _, n := range slices.Sorted(maps.Keys(p.forwards)) {
+		f := p.forwards[n]
+		fmt.Fprintf(
+			&sb,
+			"\n%s, %d connections (%d open), "+
+				"%d bytes sent, %d bytes received",
+			f,
+			f.conns.Load(),
+			f.open.Load(),
+			f.sent.Load(),
+			f.recvd.Load(),
+		)
+	}
+	return sb.String()
+}
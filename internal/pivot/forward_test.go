@@ -0,0 +1,277 @@
+package pivot
+
+/*
+ * forward_test.go
+ * Tests for forward.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/chanlog"
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+// newEchoListener returns the address of a listener which echos back whatever
+// it gets.
+func newEchoListener(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Error listening: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if nil != err {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// testEcho makes sure a connection to addr echos.
+func testEcho(t *testing.T, addr string) {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if nil != err {
+		t.Fatalf("Error connecting to %s: %s", addr, err)
+	}
+	defer c.Close()
+	want := strings.Repeat("kittens", 10000)
+	go io.WriteString(c, want)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(c, got); nil != err {
+		t.Fatalf("Error reading echo: %s", err)
+	} else if string(got) != want {
+		t.Fatalf("Incorrect echo")
+	}
+}
+
+// nextLine returns the next line sent to och, or fails the test if there
+// isn't one soon.
+func nextLine(t *testing.T, och <-chan opshell.CLine) string {
+	t.Helper()
+	select {
+	case l := <-och:
+		return l.Line
+	case <-time.After(time.Minute):
+		t.Fatalf("Timeout waiting for message")
+		return ""
+	}
+}
+
+func TestPivotHandleCommand_NotForward(t *testing.T) {
+	p := New(nil, nil)
+	for _, have := range []string{"", "ls", "@forwards", "echo @forward"} {
+		if p.HandleCommand(context.Background(), have) {
+			t.Errorf("Handled %q", have)
+		}
+	}
+}
+
+func TestPivotHandleCommand_Local(t *testing.T) {
+	testPivotHandleCommand(t, "-L")
+}
+
+func TestPivotHandleCommand_Remote(t *testing.T) {
+	testPivotHandleCommand(t, "-R")
+}
+
+// testPivotHandleCommand tests a forward made with the given flag.
+func testPivotHandleCommand(t *testing.T, flag string) {
+	p, _, _, och := newTestPivot(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	target := newEchoListener(t)
+
+	/* Start the forward and work out where it's listening. */
+	if !p.HandleCommand(
+		ctx,
+		ForwardCommand+" "+flag+" 127.0.0.1:0 "+target,
+	) {
+		t.Fatalf("Forward command not handled")
+	}
+	l := nextLine(t, och)
+	prefix := "Forwarding 1: " + flag + " 127.0.0.1:"
+	suffix := " -> " + target
+	if !strings.HasPrefix(l, prefix) || !strings.HasSuffix(l, suffix) {
+		t.Fatalf("Unexpected message: %s", l)
+	}
+	bind := strings.TrimSuffix(strings.TrimPrefix(l, prefix), suffix)
+	bind = "127.0.0.1:" + bind
+
+	/* Make sure it works. */
+	testEcho(t, bind)
+	testEcho(t, bind)
+
+	/* Make sure it's listed, after the connections are done. */
+	want := "Forwards:\n1: " + flag + " " + bind + " -> " + target +
+		", 2 connections (0 open), " +
+		"140000 bytes sent, 140000 bytes received"
+	var got string
+	for range 100 {
+		p.HandleCommand(ctx, ForwardCommand)
+		if got = nextLine(t, och); got == want {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got != want {
+		t.Errorf("Incorrect list:\n got: %s\nwant: %s", got, want)
+	}
+
+	/* Stop it. */
+	p.HandleCommand(ctx, ForwardCommand+" -K 1")
+	want = "Closed 1: " + flag + " " + bind + " -> " + target
+	if got := nextLine(t, och); got != want {
+		t.Errorf("Incorrect message:\n got: %s\nwant: %s", got, want)
+	}
+	p.HandleCommand(ctx, ForwardCommand)
+	if got, want := nextLine(t, och), "No forwards"; got != want {
+		t.Errorf("Incorrect list:\n got: %s\nwant: %s", got, want)
+	}
+
+	/* The implant may take a moment to stop listening. */
+	for range 100 {
+		c, err := net.Dial("tcp", bind)
+		if nil != err {
+			return
+		}
+		c.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Still listening on %s", bind)
+}
+
+func TestPivotHandleCommand_KillPendingRemote(t *testing.T) {
+	var (
+		_, sl       = chanlog.New()
+		och         = make(chan opshell.CLine, 1024)
+		p           = New(sl, och)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	/* Implant which doesn't answer on its own. */
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			p.ConnectControl(r.Context(), sl, "addr", w)
+		},
+	))
+	defer svr.Close()
+	res, err := http.Get(svr.URL)
+	if nil != err {
+		t.Fatalf("Error connecting control: %s", err)
+	}
+	defer res.Body.Close()
+	if got := nextLine(t, och); "[addr] Pivot connected" != got {
+		t.Fatalf("Unexpected message: %s", got)
+	}
+	scanner := bufio.NewScanner(res.Body)
+	nextInstruction := func() []string {
+		t.Helper()
+		if !scanner.Scan() {
+			t.Fatalf("No instruction: %v", scanner.Err())
+		}
+		return strings.Fields(scanner.Text())
+	}
+
+	/* Kill the forward before the implant's listening. */
+	p.HandleCommand(ctx, ForwardCommand+" -R 127.0.0.1:0 127.0.0.1:1")
+	ins := nextInstruction()
+	if 3 != len(ins) || simpleshell.PivotListen != ins[0] {
+		t.Fatalf("Unexpected instruction: %q", ins)
+	}
+	id := ins[1]
+	p.HandleCommand(ctx, ForwardCommand+" -K 1")
+	want := "Closed 1: -R 127.0.0.1:0 -> 127.0.0.1:1"
+	if got := nextLine(t, och); got != want {
+		t.Errorf("Incorrect message:\n got: %s\nwant: %s", got, want)
+	}
+	if got := nextInstruction(); 2 != len(got) ||
+		simpleshell.PivotUnlisten != got[0] ||
+		id != got[1] {
+		t.Errorf("Unexpected instruction: %q", got)
+	}
+
+	/* The implant answering late shouldn't bring it back. */
+	p.ConnectStream(
+		ctx,
+		sl,
+		httptest.NewRecorder(),
+		http.NoBody,
+		id,
+		http.Header{simpleshell.PivotListeningHeader: []string{
+			"127.0.0.1:1234",
+		}},
+	)
+	time.Sleep(100 * time.Millisecond)
+	p.HandleCommand(ctx, ForwardCommand)
+	if got, want := nextLine(t, och), "No forwards"; got != want {
+		t.Errorf("Incorrect list:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestPivotListForwards_Unlocked(t *testing.T) {
+	/* Nobody's reading messages. */
+	och := make(chan opshell.CLine)
+	p := New(nil, och)
+	go p.HandleCommand(context.Background(), ForwardCommand)
+	time.Sleep(100 * time.Millisecond)
+
+	/* Forwards should still be usable. */
+	locked := make(chan struct{})
+	go func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(10 * time.Second):
+		t.Errorf("Listing forwards blocked other forward operations")
+	}
+	if got, want := nextLine(t, och), "No forwards"; got != want {
+		t.Errorf("Incorrect list:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestForwardBind(t *testing.T) {
+	for have, want := range map[string]string{
+		"4444":           "127.0.0.1:4444",
+		"0.0.0.0:4444":   "0.0.0.0:4444",
+		":4444":          ":4444",
+		"[::1]:4444":     "[::1]:4444",
+		"localhost:4444": "localhost:4444",
+		"65536":          "65536",
+	} {
+		if got := forwardBind(have); got != want {
+			t.Errorf(
+				"Incorrect bind address for %q:\n"+
+					" got: %s\n"+
+					"want: %s",
+				have,
+				got,
+				want,
+			)
+		}
+	}
+}
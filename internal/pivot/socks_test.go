@@ -0,0 +1,141 @@
+package pivot
+
+/*
+ * socks_test.go
+ * Tests for socks.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// rwBuffer reads from r and writes to w.
+type rwBuffer struct {
+	r *bytes.Reader
+	w bytes.Buffer
+}
+
+func (b *rwBuffer) Read(p []byte) (int, error)  { return b.r.Read(p) }
+func (b *rwBuffer) Write(p []byte) (int, error) { return b.w.Write(p) }
+
+func TestSOCKSHandshake(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		have     []byte
+		wantDst  string
+		wantCode byte
+		wantErr  bool
+		wantSent []byte
+	}{{
+		name: "ipv4",
+		have: []byte{
+			5, 1, 0,
+			5, 1, 0, 1, 127, 0, 0, 1, 0x11, 0x5c,
+		},
+		wantDst:  "127.0.0.1:4444",
+		wantSent: []byte{5, 0},
+	}, {
+		name: "domain",
+		have: append(append(
+			[]byte{5, 2, 2, 0, 5, 1, 0, 3, 11},
+			"example.com"...,
+		), 0, 80),
+		wantDst:  "example.com:80",
+		wantSent: []byte{5, 0},
+	}, {
+		name: "ipv6",
+		have: []byte{
+			5, 1, 0,
+			5, 1, 0, 4,
+			0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+			0, 22,
+		},
+		wantDst:  "[::1]:22",
+		wantSent: []byte{5, 0},
+	}, {
+		name:     "auth_required",
+		have:     []byte{5, 1, 2},
+		wantErr:  true,
+		wantSent: []byte{5, 0xFF},
+	}, {
+		name: "bind",
+		have: []byte{
+			5, 1, 0,
+			5, 2, 0, 1, 127, 0, 0, 1, 0, 80,
+		},
+		wantDst:  "127.0.0.1:80",
+		wantCode: socksCommandNotSupported,
+		wantErr:  true,
+		wantSent: []byte{5, 0},
+	}, {
+		name:     "bad_atyp",
+		have:     []byte{5, 1, 0, 5, 1, 0, 9},
+		wantCode: socksATYPNotSupported,
+		wantErr:  true,
+		wantSent: []byte{5, 0},
+	}, {
+		name:    "socks4",
+		have:    []byte{4, 1, 0, 80, 127, 0, 0, 1, 0},
+		wantErr: true,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			rw := &rwBuffer{r: bytes.NewReader(c.have)}
+			dst, code, err := socksHandshake(rw)
+			if gotErr := nil != err; gotErr != c.wantErr {
+				t.Errorf("Unexpected error state: %v", err)
+			}
+			if dst != c.wantDst {
+				t.Errorf(
+					"Incorrect destination:\n"+
+						" got: %s\n"+
+						"want: %s",
+					dst,
+					c.wantDst,
+				)
+			}
+			if code != c.wantCode {
+				t.Errorf(
+					"Incorrect code:\n got: %d\nwant: %d",
+					code,
+					c.wantCode,
+				)
+			}
+			if got := rw.w.Bytes(); !bytes.Equal(got, c.wantSent) {
+				t.Errorf(
+					"Incorrect reply:\n got: %v\nwant: %v",
+					got,
+					c.wantSent,
+				)
+			}
+		})
+	}
+}
+
+func TestSOCKSReplyCode(t *testing.T) {
+	for _, c := range []struct {
+		have error
+		want byte
+	}{
+		{DialError("dial tcp: connection refused"), 5},
+		{DialError("dial tcp: connect: network is unreachable"), 3},
+		{DialError("dial tcp: connect: no route to host"), 4},
+		{DialError("dial tcp: lookup x: no such host"), 4},
+		{DialError("too many connections"), 1},
+		{fmt.Errorf("wrapped: %w", DialError("connection refused")), 5},
+		{ErrNoImplant, 1},
+	} {
+		if got := socksReplyCode(c.have); got != c.want {
+			t.Errorf(
+				"Incorrect code for %q:\n got: %d\nwant: %d",
+				c.have,
+				got,
+				c.want,
+			)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package chanlog
+
+/*
+ * match.go
+ * Match parsed log records
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout is how long ExpectJSON and ExpectJSONUnordered wait for each
+// log record if passed a timeout of 0.
+const DefaultTimeout = 10 * time.Second
+
+// Fields matches a subset of a JSON log record's fields.  Fields not in a
+// Fields are ignored.  Values may be
+//   - A Fields or map[string]any, which matches a group, such as
+//     http_request, in the same way
+//   - A Matcher, such as from Regexp or Func
+//   - A *regexp.Regexp, which matches strings
+//   - Anything else, which matches if it encodes to the same JSON as the
+//     field; slog.LevelInfo and "INFO" both work.
+type Fields map[string]any
+
+// Matcher matches a single field's value, as decoded by encoding/json.
+type Matcher struct {
+	desc string
+	f    func(v any) bool
+}
+
+// String returns m's description.
+func (m Matcher) String() string { return m.desc }
+
+// Func returns a Matcher which matches values for which f returns true.  The
+// description is used in error messages.
+func Func(desc string, f func(v any) bool) Matcher {
+	return Matcher{desc: desc, f: f}
+}
+
+// Regexp returns a Matcher which matches strings matching the regex re.  It
+// panics if re doesn't compile.
+func Regexp(re string) Matcher { return regexpMatcher(regexp.MustCompile(re)) }
+
+// Any returns a Matcher which matches anything, as long as the field's
+// there.
+func Any() Matcher { return Func("anything", func(any) bool { return true }) }
+
+// regexpMatcher returns a Matcher which matches strings matching re.
+func regexpMatcher(re *regexp.Regexp) Matcher {
+	return Func("/"+re.String()+"/", func(v any) bool {
+		s, ok := v.(string)
+		return ok && re.MatchString(s)
+	})
+}
+
+// JSONMatcher matches a JSON log record.  Fields is one, as is what Exact
+// returns.
+type JSONMatcher interface {
+	// match returns a description of each way rec doesn't match, or nil
+	// if it does.
+	match(rec map[string]any) []string
+	fmt.Stringer
+}
+
+// match implements JSONMatcher.
+func (fs Fields) match(rec map[string]any) []string {
+	return matchFields("", rec, fs, false)
+}
+
+// String returns fs as a JSON-ish string.
+func (fs Fields) String() string { return describe(fs) }
+
+// exact is returned by Exact.
+type exact Fields
+
+// Exact returns a JSONMatcher which is like fs, but which also doesn't allow
+// extra fields, other than time fields.  Time fields are the record's time and
+// any string which parses as an RFC3339 timestamp or a time.Duration; they're
+// ignored unless they're in fs.
+func Exact(fs Fields) JSONMatcher { return exact(fs) }
+
+// match implements JSONMatcher.
+func (e exact) match(rec map[string]any) []string {
+	return matchFields("", rec, Fields(e), true)
+}
+
+// String returns e as a JSON-ish string.
+func (e exact) String() string { return "exactly " + describe(Fields(e)) }
+
+// ExpectJSON is like Expect, but parses each log line as JSON and checks it
+// with the corresponding JSONMatcher.  ExpectJSON waits up to timeout for
+// each line, or DefaultTimeout if timeout is 0.  It calls t.Errorf for
+// mismatches, with a line per mismatched field.
+func (cl ChanLog) ExpectJSON(
+	t *testing.T,
+	timeout time.Duration,
+	want ...JSONMatcher,
+) {
+	t.Helper()
+	for _, w := range want {
+		rec, line, ok := cl.nextRecord(t, timeout, w.String())
+		if !ok {
+			return
+		}
+		if diffs := w.match(rec); 0 != len(diffs) {
+			t.Errorf(
+				"Unexpected log line:\n%s\n got: %s\nwant: %s",
+				strings.Join(diffs, "\n"),
+				line,
+				w,
+			)
+		}
+	}
+}
+
+// ExpectJSONUnordered is like ExpectJSON, but doesn't require the lines come
+// in order.
+func (cl ChanLog) ExpectJSONUnordered(
+	t *testing.T,
+	timeout time.Duration,
+	want ...JSONMatcher,
+) {
+	t.Helper()
+	want = slices.Clone(want)
+	for 0 != len(want) {
+		/* Grab a line. */
+		rec, line, ok := cl.nextRecord(t, timeout, fmt.Sprintf(
+			"%d messages",
+			len(want),
+		))
+		if !ok {
+			return
+		}
+		/* Make sure this line was one we wanted. */
+		i := slices.IndexFunc(want, func(w JSONMatcher) bool {
+			return nil == w.match(rec)
+		})
+		if -1 == i {
+			ws := make([]string, len(want))
+			for i, w := range want {
+				ws[i] = w.String()
+			}
+			t.Errorf(
+				"Unexpected log line: %s\nwant one of:\n%s",
+				line,
+				strings.Join(ws, "\n"),
+			)
+			return
+		}
+		want = slices.Delete(want, i, i+1)
+	}
+}
+
+// nextRecord waits up to timeout for the next log line and parses it.  If no
+// line comes, the channel's closed, or the line isn't a JSON object,
+// nextRecord calls t.Errorf and returns false.  waitingFor is used in the
+// error message.
+func (cl ChanLog) nextRecord(
+	t *testing.T,
+	timeout time.Duration,
+	waitingFor string,
+) (rec map[string]any, line string, ok bool) {
+	t.Helper()
+	if 0 == timeout {
+		timeout = DefaultTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case line, ok = <-cl:
+		if !ok {
+			t.Errorf(
+				"Log channel closed while waiting for %s",
+				waitingFor,
+			)
+			return nil, "", false
+		}
+	case <-timer.C:
+		t.Errorf(
+			"Timed out after %s waiting for %s",
+			timeout,
+			waitingFor,
+		)
+		return nil, "", false
+	}
+	if err := json.Unmarshal([]byte(line), &rec); nil != err {
+		t.Errorf("Error parsing log line %q: %s", line, err)
+		return nil, line, false
+	}
+	return rec, line, true
+}
+
+// matchFields returns descriptions of how got doesn't match want.  The field
+// names in the descriptions are prefixed with prefix.  If exact is true,
+// fields in got but not want, other than time fields, are mismatches.
+func matchFields(
+	prefix string,
+	got map[string]any,
+	want Fields,
+	exact bool,
+) []string {
+	var diffs []string
+	for _, k := range slices.Sorted(maps.Keys(want)) {
+		g, ok := got[k]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf(
+				"%s%s: missing, want %s",
+				prefix,
+				k,
+				describe(want[k]),
+			))
+			continue
+		}
+		diffs = append(
+			diffs,
+			matchValue(prefix+k, g, want[k], exact)...,
+		)
+	}
+	if !exact {
+		return diffs
+	}
+	for _, k := range slices.Sorted(maps.Keys(got)) {
+		if _, ok := want[k]; ok || isTimeField(k, got[k]) {
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf(
+			"%s%s: unexpected, got %s",
+			prefix,
+			k,
+			describe(got[k]),
+		))
+	}
+	return diffs
+}
+
+// matchValue returns a description of how got doesn't match want, or nil if
+// it does.  name is the field's name.
+func matchValue(name string, got, want any, exact bool) []string {
+	/* Groups get matched field-by-field. */
+	var wfs Fields
+	switch w := want.(type) {
+	case Fields:
+		wfs = w
+	case map[string]any:
+		wfs = w
+	case *regexp.Regexp:
+		want = regexpMatcher(w)
+	}
+	if nil != wfs {
+		gfs, ok := got.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf(
+				"%s: got %s, want group %s",
+				name,
+				describe(got),
+				describe(wfs),
+			)}
+		}
+		return matchFields(name+".", gfs, wfs, exact)
+	}
+
+	/* Everything else is a single value. */
+	var ok bool
+	if m, isM := want.(Matcher); isM {
+		ok = m.f(got)
+	} else {
+		ok = describe(got) == describe(want)
+	}
+	if ok {
+		return nil
+	}
+	return []string{fmt.Sprintf(
+		"%s: got %s, want %s",
+		name,
+		describe(got),
+		describe(want),
+	)}
+}
+
+// isTimeField returns true if the field named k with the value v looks like
+// it holds a time or duration.
+func isTimeField(k string, v any) bool {
+	if slog.TimeKey == k {
+		return true
+	}
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if _, err := time.Parse(time.RFC3339Nano, s); nil == err {
+		return true
+	}
+	/* ParseDuration likes plain 0, which is more likely a count. */
+	_, err := time.ParseDuration(s)
+	return nil == err && "0" != s
+}
+
+// describe returns v as a JSON-ish string, for messages.  Matchers are
+// described by their descriptions.
+func describe(v any) string {
+	var fs Fields
+	switch v := v.(type) {
+	case Matcher:
+		return v.String()
+	case *regexp.Regexp:
+		return regexpMatcher(v).String()
+	case Fields:
+		fs = v
+	case map[string]any:
+		fs = v
+	default:
+		b, err := json.Marshal(v)
+		if nil != err {
+			return fmt.Sprintf("%#v", v)
+		}
+		return string(b)
+	}
+	/* Groups get each field described. */
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, k := range slices.Sorted(maps.Keys(fs)) {
+		if 0 != i {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, "%q:%s", k, describe(fs[k]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
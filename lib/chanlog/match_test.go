@@ -0,0 +1,147 @@
+package chanlog
+
+/*
+ * match_test.go
+ * Tests for match.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChanLog_ExpectJSON(t *testing.T) {
+	cl, sl := New()
+	sl.Info("kittens", "count", 3, slog.Group(
+		"http_request",
+		"method", "GET",
+		"id", "abc123",
+	))
+	sl.Warn("moose", "duration", time.Minute.String())
+	cl.ExpectJSON(t, time.Second,
+		Fields{
+			slog.MessageKey: "kittens",
+			slog.LevelKey:   slog.LevelInfo,
+			"count":         3,
+			"http_request": Fields{
+				"method": Regexp(`^G`),
+				"id": Func("six chars", func(v any) bool {
+					s, ok := v.(string)
+					return ok && 6 == len(s)
+				}),
+			},
+		},
+		Exact(Fields{slog.LevelKey: "WARN", slog.MessageKey: "moose"}),
+	)
+}
+
+func TestChanLog_ExpectJSONUnordered(t *testing.T) {
+	cl, sl := New()
+	have := []string{"kittens", "moose", "kittens", "tridge"}
+	for _, msg := range have {
+		sl.Info(msg)
+	}
+	want := make([]JSONMatcher, len(have))
+	for i, msg := range have {
+		want[len(want)-1-i] = Fields{slog.MessageKey: msg}
+	}
+	cl.ExpectJSONUnordered(t, time.Second, want...)
+	cl.ExpectEmpty(t)
+}
+
+func TestJSONMatcher(t *testing.T) {
+	rec := `{"time":"","level":"INFO","msg":"kittens","count":3,` +
+		`"http_request":{"method":"GET","host":"example.com"},` +
+		`"duration":"1.5s","when":"2024-09-25T01:02:03Z","id":"0"}`
+	for _, c := range []struct {
+		name string
+		have JSONMatcher
+		want []string
+	}{{
+		name: "subset",
+		have: Fields{"msg": "kittens", "count": 3},
+	}, {
+		name: "nested_group",
+		have: Fields{"http_request": map[string]any{"method": "GET"}},
+	}, {
+		name: "regexp",
+		have: Fields{"msg": regexp.MustCompile(`^kit`)},
+	}, {
+		name: "any",
+		have: Fields{"when": Any()},
+	}, {
+		name: "mismatches",
+		have: Fields{
+			"msg":          "moose",
+			"count":        Regexp(`3`),
+			"missing":      true,
+			"http_request": Fields{"method": "POST"},
+			"level":        Fields{},
+		},
+		want: []string{
+			`count: got 3, want /3/`,
+			`http_request.method: got "GET", want "POST"`,
+			`level: got "INFO", want group {}`,
+			`missing: missing, want true`,
+			`msg: got "kittens", want "moose"`,
+		},
+	}, {
+		name: "exact_ignores_time",
+		have: Exact(Fields{
+			"level":        "INFO",
+			"msg":          "kittens",
+			"count":        3,
+			"http_request": Fields{"method": "GET", "host": Any()},
+			"id":           "0",
+		}),
+	}, {
+		name: "exact_extras",
+		have: Exact(Fields{
+			"msg":          "kittens",
+			"http_request": Fields{"method": "GET"},
+		}),
+		want: []string{
+			`http_request.host: unexpected, got "example.com"`,
+			`count: unexpected, got 3`,
+			`id: unexpected, got "0"`,
+			`level: unexpected, got "INFO"`,
+		},
+	}, {
+		name: "exact_time_listed",
+		have: Exact(Fields{"duration": "2s"}),
+		want: []string{
+			`duration: got "1.5s", want "2s"`,
+			`count: unexpected, got 3`,
+			`http_request: unexpected, got ` +
+				`{"host":"example.com","method":"GET"}`,
+			`id: unexpected, got "0"`,
+			`level: unexpected, got "INFO"`,
+			`msg: unexpected, got "kittens"`,
+		},
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			var m map[string]any
+			if err := json.Unmarshal([]byte(rec), &m); nil != err {
+				t.Fatalf("Error parsing record: %s", err)
+			}
+			got := c.have.match(m)
+			if !slices.Equal(got, c.want) {
+				t.Errorf(
+					"Incorrect mismatches:\n"+
+						" got:\n%s\n"+
+						"want:\n%s",
+					strings.Join(got, "\n"),
+					strings.Join(c.want, "\n"),
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package fswatch - Notice when a file or directory changes
+//
+// Changes are noticed with inotify(7) where it's available and by polling
+// everywhere else.  Only the watched file or directory and, for directories,
+// the files directly in the directory are watched.
+package fswatch
+
+/*
+ * fswatch.go
+ * Notice when a file or directory changes
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/ctxerrgroup"
+)
+
+// PollInterval is how often we check for changes if we can't use inotify(7).
+// It must not be modified during a call to Watch.
+var PollInterval = time.Second
+
+// notifier calls notify every time it notices a change.  It returns when ctx
+// is done.
+type notifier func(ctx context.Context, notify func()) error
+
+// Watch watches name, which may be a file or a directory, and calls f after
+// something changes and things have been quiet for settle.  Calls to f won't
+// happen concurrently; changes which happen while f is running will cause
+// another call to f after f returns.
+//
+// Watch uses inotify(7) if possible and polls every PollInterval if not.
+// Watch returns nil when ctx is done.
+func Watch(
+	ctx context.Context,
+	name string,
+	settle time.Duration,
+	f func(),
+) error {
+	/* Work out how we'll notice changes. */
+	n, err := newInotifyNotifier(name)
+	if nil != err { /* No inotify, we'll poll. */
+		n = func(ctx context.Context, notify func()) error {
+			return poll(ctx, name, PollInterval, notify)
+		}
+	}
+
+	/* Notify and debounce. */
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default: /* Already have a change pending. */
+		}
+	}
+	eg, ectx := ctxerrgroup.WithContext(ctx)
+	eg.GoContext(ectx, func(ctx context.Context) error {
+		return n(ctx, notify)
+	})
+	eg.GoContext(ectx, func(ctx context.Context) error {
+		return debounce(ctx, settle, changed, f)
+	})
+
+	/* Wait for something to go wrong or someone to tell us to stop. */
+	if err := eg.Wait(); nil != err && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// debounce calls f after something's sent on changed and nothing else has been
+// sent for settle.
+func debounce(
+	ctx context.Context,
+	settle time.Duration,
+	changed <-chan struct{},
+	f func(),
+) error {
+	timer := time.NewTimer(settle)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return context.Cause(ctx)
+		case <-changed: /* Something changed, wait for quiet. */
+			timer.Reset(settle)
+		case <-timer.C: /* Quiet, tell someone. */
+			f()
+		}
+	}
+}
+
+// fileState is the bits of a file's info we check for changes while polling.
+type fileState struct {
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// poll checks name every interval and calls notify when anything changes.
+func poll(
+	ctx context.Context,
+	name string,
+	interval time.Duration,
+	notify func(),
+) error {
+	last := snapshot(name)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-ticker.C:
+		}
+		/* See if anything's different. */
+		if cur := snapshot(name); !maps.Equal(last, cur) {
+			last = cur
+			notify()
+		}
+	}
+}
+
+// snapshot gets the state of name and, if it's a directory, the files in it.
+// Errors are treated as the file not existing, which is close enough.
+func snapshot(name string) map[string]fileState {
+	ret := make(map[string]fileState)
+
+	/* Get the file itself. */
+	fi, err := os.Stat(name)
+	if nil != err {
+		return ret
+	}
+	ret[""] = stateOf(fi)
+	if !fi.IsDir() {
+		return ret
+	}
+
+	/* Get the files in the directory. */
+	des, err := os.ReadDir(name)
+	if nil != err {
+		return ret
+	}
+	for _, de := range des {
+		fi, err := os.Stat(filepath.Join(name, de.Name()))
+		if nil != err {
+			continue
+		}
+		ret[de.Name()] = stateOf(fi)
+	}
+
+	return ret
+}
+
+// stateOf returns the fileState for fi.
+func stateOf(fi fs.FileInfo) fileState {
+	return fileState{
+		size:    fi.Size(),
+		mode:    fi.Mode(),
+		modTime: fi.ModTime(),
+	}
+}
+
+// errNoInotify is returned by newInotifyNotifier when there's no inotify(7).
+var errNoInotify = fmt.Errorf("inotify: %w", errors.ErrUnsupported)
@@ -0,0 +1,127 @@
+package fswatch
+
+/*
+ * fswatch_test.go
+ * Tests for fswatch.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testSettle is how long we wait for things to settle in tests.
+const testSettle = 10 * time.Millisecond
+
+// testWatch starts watch going and returns a channel which receives a value
+// every time watch notices a change.  watch is stopped when the test ends.
+func testWatch(
+	t *testing.T,
+	watch func(ctx context.Context, notify func()) error,
+) <-chan struct{} {
+	t.Helper()
+	var (
+		ch          = make(chan struct{}, 1024)
+		ech         = make(chan error, 1)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	go func() {
+		ech <- watch(ctx, func() { ch <- struct{}{} })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-ech; nil != err && ctx.Err() != err {
+			t.Errorf("Watch error: %s", err)
+		}
+	})
+	/* Give the watcher a moment to get going. */
+	time.Sleep(testSettle)
+	return ch
+}
+
+// expectChange waits for something on ch.
+func expectChange(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("Change not noticed after %s", what)
+	}
+}
+
+// writeFile writes a file or calls t.Fatalf.
+func writeFile(t *testing.T, name, contents string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(contents), 0600); nil != err {
+		t.Fatalf("Error writing to %s: %s", name, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		watch func(
+			name string,
+		) func(ctx context.Context, notify func()) error
+	}{{
+		name: "Watch",
+		watch: func(name string) func(context.Context, func()) error {
+			return func(ctx context.Context, notify func()) error {
+				return Watch(ctx, name, testSettle, notify)
+			}
+		},
+	}, {
+		name: "poll",
+		watch: func(name string) func(context.Context, func()) error {
+			return func(ctx context.Context, notify func()) error {
+				return poll(ctx, name, testSettle, notify)
+			}
+		},
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			t.Run("file", func(t *testing.T) {
+				fn := filepath.Join(t.TempDir(), "f")
+				writeFile(t, fn, "kittens")
+				ch := testWatch(t, c.watch(fn))
+				writeFile(t, fn, "moose")
+				expectChange(t, ch, "write")
+				if err := os.Remove(fn); nil != err {
+					t.Fatalf(
+						"Error removing %s: %s",
+						fn,
+						err,
+					)
+				}
+				expectChange(t, ch, "removal")
+			})
+			t.Run("directory", func(t *testing.T) {
+				d := t.TempDir()
+				ch := testWatch(t, c.watch(d))
+				writeFile(t, filepath.Join(d, "a"), "kittens")
+				expectChange(t, ch, "new file")
+				writeFile(t, filepath.Join(d, "a"), "moose")
+				expectChange(t, ch, "write")
+			})
+			t.Run("directory_trailing_slash", func(t *testing.T) {
+				d := t.TempDir()
+				ch := testWatch(t, c.watch(d+"/"))
+				writeFile(t, filepath.Join(d, "a"), "kittens")
+				expectChange(t, ch, "new file")
+				writeFile(t, filepath.Join(d, "a"), "moose")
+				expectChange(t, ch, "write")
+			})
+			t.Run("missing_file", func(t *testing.T) {
+				fn := filepath.Join(t.TempDir(), "f")
+				ch := testWatch(t, c.watch(fn))
+				writeFile(t, fn, "kittens")
+				expectChange(t, ch, "creation")
+			})
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package fswatch
+
+/*
+ * inotify_linux.go
+ * Watch for changes with inotify(7)
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// inotifyMask is the set of events we care about.
+const inotifyMask = syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE |
+	syscall.IN_CREATE |
+	syscall.IN_DELETE |
+	syscall.IN_DELETE_SELF |
+	syscall.IN_MODIFY |
+	syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO |
+	syscall.IN_MOVE_SELF
+
+// newInotifyNotifier returns a notifier which uses inotify(7) to watch name.
+// name's parent directory is watched for changes to name itself, which works
+// with editors which write a new file and rename it.  If name is a directory,
+// it's watched as well.  For . and /, the parent and the directory are one and
+// the same.
+func newInotifyNotifier(name string) (notifier, error) {
+	/* Without cleaning, dir/ would have a parent of dir. */
+	name = filepath.Clean(name)
+
+	/* Get an inotify instance which works with the runtime's poller, so
+	we can close it to stop reads. */
+	fd, err := syscall.InotifyInit1(
+		syscall.IN_NONBLOCK | syscall.IN_CLOEXEC,
+	)
+	if nil != err {
+		return nil, fmt.Errorf("%w: %w", errNoInotify, err)
+	}
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	/* Watch the parent directory, which we need either way. */
+	var (
+		dir  = filepath.Dir(name)
+		base = filepath.Base(name)
+	)
+	pwd, err := syscall.InotifyAddWatch(fd, dir, inotifyMask)
+	if nil != err {
+		f.Close()
+		return nil, fmt.Errorf("watching %s: %w", dir, err)
+	}
+
+	/* addSelf watches name itself, if it's a directory.  It returns -1
+	if name isn't a directory we can watch. */
+	addSelf := func() int {
+		if fi, err := os.Stat(name); nil != err || !fi.IsDir() {
+			return -1
+		}
+		wd, err := syscall.InotifyAddWatch(fd, name, inotifyMask)
+		if nil != err {
+			return -1
+		}
+		return wd
+	}
+	swd := addSelf()
+
+	return func(ctx context.Context, notify func()) error {
+		/* Reads stop when the file's closed. */
+		go func() { <-ctx.Done(); f.Close() }()
+
+		/* handle notifies if we care about the event.  The parent
+		and name may well be the same watch, so we check both. */
+		handle := func(ev inotifyEvent) {
+			if pwd == ev.wd && ev.name == base {
+				/* If name's a new directory, watch it as
+				well. */
+				if -1 == swd {
+					swd = addSelf()
+				}
+				notify()
+				return
+			}
+			if swd == ev.wd {
+				if 0 != ev.mask&syscall.IN_IGNORED {
+					swd = -1
+				}
+				notify()
+			}
+		}
+
+		/* Read events until something goes wrong. */
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+
+			syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if nil != ctx.Err() {
+				return context.Cause(ctx)
+			} else if errors.Is(err, syscall.EINTR) {
+				continue
+			} else if nil != err {
+				return fmt.Errorf("reading events: %w", err)
+			}
+			/* Work out if we care about any of these events. */
+			for b := buf[:n]; 0 != len(b); {
+				ev, rest, ok := parseInotifyEvent(b)
+				if !ok { /* Unpossible. */
+					break
+				}
+				handle(ev)
+				b = rest
+			}
+		}
+	}, nil
+}
+
+// inotifyEvent is the bits of an inotify event we care about.
+type inotifyEvent struct {
+	wd   int
+	mask uint32
+	name string
+}
+
+// parseInotifyEvent parses the inotify event at the start of b.  It returns
+// the rest of b after the event.  If b doesn't contain a whole event, ok will
+// be false.
+func parseInotifyEvent(b []byte) (ev inotifyEvent, rest []byte, ok bool) {
+	/* Get the fixed-size bits. */
+	if len(b) < syscall.SizeofInotifyEvent {
+		return inotifyEvent{}, nil, false
+	}
+	ne := binary.NativeEndian
+	ev.wd = int(int32(ne.Uint32(b)))
+	ev.mask = ne.Uint32(b[4:])
+	nl := int(ne.Uint32(b[12:]))
+	b = b[syscall.SizeofInotifyEvent:]
+
+	/* Get the name, which is NUL-padded. */
+	if len(b) < nl {
+		return inotifyEvent{}, nil, false
+	}
+	ev.name = string(bytes.TrimRight(b[:nl], "\x00"))
+
+	return ev, b[nl:], true
+}
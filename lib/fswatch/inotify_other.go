@@ -0,0 +1,14 @@
+//go:build !linux
+
+package fswatch
+
+/*
+ * inotify_other.go
+ * No inotify(7), use polling instead
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+// newInotifyNotifier always returns errNoInotify.
+func newInotifyNotifier(string) (notifier, error) { return nil, errNoInotify }
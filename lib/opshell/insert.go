@@ -5,7 +5,7 @@ package opshell
  * Insert a callback's returned slice to the shell
  * By J. Stuart McMurray
  * Created 202406025
- * Last Modified 20240707
+ * Last Modified 20261016
  */
 
 import (
@@ -17,6 +17,32 @@ import (
 // No error is returned; all errors are handled by sending messages to the
 // user.
 func (s *Shell) insert() {
+	/* Get the bytes to insert. */
+	b, err := s.insertGen()
+	if nil != err {
+		s.Logf(
+			ColorRed,
+			false,
+			"Error working out what to insert: %s",
+			err,
+		)
+		return
+	}
+	s.Insert(s.insertName, b)
+}
+
+// Insert sends b to the shell as if it were generated for Ctrl+I, minified if
+// a minifier was passed to New.  Messages about the insertion will be logged
+// with the loggable name.
+// No error is returned; all errors are handled by sending messages to the
+// user.
+func (s *Shell) Insert(name string, b []byte) {
+	s.send(name, s.minified(b))
+}
+
+// send sends b to the shell, as-is.  Messages about the insertion will be
+// logged with the loggable name.
+func (s *Shell) send(name string, b []byte) {
 	/* errf logs an error to the shell. */
 	errf := func(format string, args ...any) {
 		s.Logf(
@@ -26,12 +52,8 @@ func (s *Shell) insert() {
 			args...,
 		)
 	}
-	/* Get the bytes to insert. */
-	b, err := s.insertGen()
-	if nil != err {
-		errf("Error working out what to insert: %s", err)
-		return
-	} else if 0 == len(b) {
+	/* Make sure there's something to insert. */
+	if 0 == len(b) {
 		errf("Lazily refusing to insert 0 bytes")
 		return
 	}
@@ -40,11 +62,11 @@ func (s *Shell) insert() {
 	her := sha256.New()
 
 	/* Send it off for insertion. */
-	s.Logf(ColorGreen, false, "Inserting %s...", s.insertName)
+	s.Logf(ColorGreen, false, "Inserting %s...", name)
 	n, err := io.MultiWriter(ChanWriter(s.ich), her).Write(b)
 	if nil != err {
 		/* This is actually pretty unpossible. */
-		errf("Error inserting %s: %s", s.insertName, err)
+		errf("Error inserting %s: %s", name, err)
 		return
 	}
 	/* All done.  Tell the user what just happened. */
@@ -52,10 +74,41 @@ func (s *Shell) insert() {
 		errf("Unsure why we inserted 0 bytes")
 		return
 	}
-	s.Logf(ColorGreen, false, "Inserted %d bytes from %s", n, s.insertName)
+	s.Logf(ColorGreen, false, "Inserted %d bytes from %s", n, name)
 	s.Logf(ColorGreen, false, "SHA256: %x", her.Sum(nil))
 }
 
+// OfferInsert is like Insert, but waits for the user to hit Ctrl+Y before
+// inserting b.  Only the latest offer is kept; previous offers are discarded.
+func (s *Shell) OfferInsert(name string, b []byte) {
+	b = s.minified(b)
+	s.offerL.Lock()
+	defer s.offerL.Unlock()
+	s.offerName = name
+	s.offer = b
+	s.Logf(
+		ColorCyan,
+		false,
+		"Hit Ctrl+Y to insert %d bytes from %s",
+		len(b),
+		name,
+	)
+}
+
+// insertOffer inserts whatever was last passed to OfferInsert, as on Ctrl+Y.
+func (s *Shell) insertOffer() {
+	/* Grab the offer, if we have one. */
+	s.offerL.Lock()
+	name, b := s.offerName, s.offer
+	s.offerName, s.offer = "", nil
+	s.offerL.Unlock()
+	if nil == b {
+		s.Logf(ColorRed, false, "Nothing waiting to be inserted")
+		return
+	}
+	s.send(name, b)
+}
+
 // pretendInsert is like insert but sends what would have been inserted to
 // the shell instead.
 func (s *Shell) pretendInsert() {
@@ -72,11 +125,31 @@ func (s *Shell) pretendInsert() {
 	}
 
 	/* Send it back to the user. */
+	if nil == s.minify {
+		s.Logf(
+			ColorCyan,
+			false,
+			"Would have sent the following %d bytes:\n%s",
+			len(b),
+			b,
+		)
+		return
+	}
+	mb := s.minified(b)
 	s.Logf(
 		ColorCyan,
 		false,
-		"Would have sent the following %d bytes:\n%s",
+		"Would have sent the following %d bytes, minified from %d:\n%s",
+		len(mb),
 		len(b),
-		b,
+		mb,
 	)
 }
+
+// minified returns b, minified with s.minify if we have it.
+func (s *Shell) minified(b []byte) []byte {
+	if nil == s.minify {
+		return b
+	}
+	return s.minify(b)
+}
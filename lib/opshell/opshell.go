@@ -6,7 +6,7 @@ package opshell
  * Operator's interactive shell
  * By J. Stuart McMurray
  * Created 20240324
- * Last Modified 20240707
+ * Last Modified 20261016
  */
 
 import (
@@ -55,7 +55,18 @@ type CLine struct {
 	Line        string
 	Prompt      string
 	NoTimestamp bool /* Don't print a timestamp. */
-	Plain       bool /* No newline, color, timestamp, or anything else. */
+	Plain       bool /* No newline, timestamp, or color unless Color. */
+
+	// Taken, if not nil, is sent a value once the line's been taken from
+	// the output channel.  It should have room.
+	Taken chan<- struct{}
+}
+
+// took sends to cl.Taken, if it's not nil.
+func (cl CLine) took() {
+	if nil != cl.Taken {
+		cl.Taken <- struct{}{}
+	}
 }
 
 // Shell is the shell used by an operator.  It's a wrapper around
@@ -68,8 +79,13 @@ type Shell struct {
 	noTimestamps bool
 	insertGen    func() ([]byte, error) /* Bytes-generator for ^I. */
 	insertName   string                 /* Loggable name for insertGen. */
+	minify       func([]byte) []byte    /* Optional insertion minifier. */
 	wL           sync.Mutex             /* Write lock. */
 
+	offerL    sync.Mutex /* Insertion waiting for Ctrl+Y. */
+	offerName string
+	offer     []byte
+
 	silenced       bool        /* Don't write plain messages for a bit. */
 	silenceTimer   *time.Timer /* Unsilences after output's quiet. */
 	lastPlainWrite time.Time   /* Last attempted write. */
@@ -81,7 +97,8 @@ type Shell struct {
 // resources.  ich will be closed before Shell.Do returns.  IF noTimestamps is
 // true, no timestamps will be printed.
 // insertGen will be called to generate bytes to send to the shell on Ctrl+I
-// and will be logged as if it were inserting data from insertName.
+// and will be logged as if it were inserting data from insertName.  If minify
+// isn't nil, it will be called to shrink whatever's inserted.
 func New(
 	ich chan<- string,
 	och <-chan CLine,
@@ -89,15 +106,108 @@ func New(
 	noTimestamps bool,
 	insertGen func() ([]byte, error),
 	insertName string,
+	minify func([]byte) []byte,
 ) (*Shell, func(), error) {
+	s := newShell(
+		stdioRW{},
+		ich,
+		och,
+		prompt,
+		noTimestamps,
+		insertGen,
+		insertName,
+		minify,
+	)
+
+	/* Open the controlling TTY, for raw mode and output. */
+	var err error
+	if s.ttyF, err = os.Open(ttyPath); nil != err {
+		return nil, nil, fmt.Errorf("opening controlling TTY: %w", err)
+	}
+
+	/* Cleanup things. */
+	var oldState *goxterm.State
+	cleanup := sync.OnceFunc(func() {
+		/* Restore the terminal state. */
+		if nil != oldState {
+			goxterm.Restore(int(s.ttyF.Fd()), oldState)
+		}
+
+		/* Close the underlying TTY. */
+		s.ttyF.Close()
+	})
+
+	/* Set the initial size. */
+	if err := s.resize(); nil != err {
+		cleanup()
+		return nil, nil, fmt.Errorf("setting initial size: %w", err)
+	}
+
+	/* Put the TTY in raw mode. */
+	if oldState, err = goxterm.MakeRaw(int(s.ttyF.Fd())); nil != err {
+		cleanup()
+		return nil, nil, fmt.Errorf(
+			"putting terminal in raw mode: %w",
+			err,
+		)
+	}
+
+	return s, cleanup, nil
+}
+
+// NewHeadless is like New, but uses rw instead of stdio and the controlling
+// TTY.  The terminal is width columns by height rows, and is never resized.
+// There's no TTY state to restore, so no cleanup function is returned.  This
+// is meant for testing.
+func NewHeadless(
+	rw io.ReadWriter,
+	width int,
+	height int,
+	ich chan<- string,
+	och <-chan CLine,
+	prompt string,
+	noTimestamps bool,
+	insertGen func() ([]byte, error),
+	insertName string,
+	minify func([]byte) []byte,
+) (*Shell, error) {
+	s := newShell(
+		rw,
+		ich,
+		och,
+		prompt,
+		noTimestamps,
+		insertGen,
+		insertName,
+		minify,
+	)
+	if err := s.t.SetSize(width, height); nil != err {
+		return nil, fmt.Errorf("setting terminal size: %w", err)
+	}
+	return s, nil
+}
+
+// newShell returns a new Shell which reads and writes rw, without touching a
+// TTY.
+func newShell(
+	rw io.ReadWriter,
+	ich chan<- string,
+	och <-chan CLine,
+	prompt string,
+	noTimestamps bool,
+	insertGen func() ([]byte, error),
+	insertName string,
+	minify func([]byte) []byte,
+) *Shell {
 	/* Shell to return. */
-	s := Shell{
-		t:            goxterm.NewTerminal(stdioRW{}, prompt),
+	s := &Shell{
+		t:            goxterm.NewTerminal(rw, prompt),
 		ich:          ich,
 		och:          och,
 		noTimestamps: noTimestamps,
 		insertGen:    insertGen,
 		insertName:   insertName,
+		minify:       minify,
 	}
 	/* Set up a timer to unsilence the shell after there's been a lull. */
 	s.silenceTimer = time.AfterFunc(0, func() {
@@ -143,6 +253,8 @@ func New(
 			go s.insert()
 		case 0x0a: /* ^J, like ^I but just locally. */
 			go s.pretendInsert()
+		case 0x19: /* ^Y, yes, insert what was offered. */
+			go s.insertOffer()
 			/* This is left here but commented out to make it that
 			much easier to add another Ctrl+Key. */
 			//default:
@@ -154,40 +266,8 @@ func New(
 			//	)
 		}
 	}
-	/* Open the controlling TTY, for raw mode and output. */
-	var err error
-	if s.ttyF, err = os.Open(ttyPath); nil != err {
-		return nil, nil, fmt.Errorf("opening controlling TTY: %w", err)
-	}
 
-	/* Cleanup things. */
-	var oldState *goxterm.State
-	cleanup := sync.OnceFunc(func() {
-		/* Restore the terminal state. */
-		if nil != oldState {
-			goxterm.Restore(int(s.ttyF.Fd()), oldState)
-		}
-
-		/* Close the underlying TTY. */
-		s.ttyF.Close()
-	})
-
-	/* Set the initial size. */
-	if err := s.resize(); nil != err {
-		cleanup()
-		return nil, nil, fmt.Errorf("setting initial size: %w", err)
-	}
-
-	/* Put the TTY in raw mode. */
-	if oldState, err = goxterm.MakeRaw(int(s.ttyF.Fd())); nil != err {
-		cleanup()
-		return nil, nil, fmt.Errorf(
-			"putting terminal in raw mode: %w",
-			err,
-		)
-	}
-
-	return &s, cleanup, nil
+	return s
 }
 
 // Do proxies between the channels with which the shell was made and stdio as
@@ -197,8 +277,10 @@ func (s *Shell) Do(ctx context.Context) error {
 	/* Do ALL the things. */
 	eg, ectx := ctxerrgroup.WithContext(ctx)
 
-	/* Resize on SIGWINCH. */
-	eg.GoContext(ectx, s.handleWINCH)
+	/* Resize on SIGWINCH, if we've a TTY to resize. */
+	if nil != s.ttyF {
+		eg.GoContext(ectx, s.handleWINCH)
+	}
 
 	/* Read lines from stdin, send them out.  It'd be nice to do this in
 	the errgroup, but goxterm.Terminal.ReadLine doesn't let us stop it. */
@@ -275,6 +357,7 @@ func (s *Shell) handleOutput(ctx context.Context) error {
 			if !ok {
 				return ErrOutputClosed
 			}
+			cl.took()
 		}
 		/* Set the prompt if we have one. */
 		if p := cl.Prompt; "" != p {
@@ -284,7 +367,7 @@ func (s *Shell) handleOutput(ctx context.Context) error {
 		var err error
 		if cl.Plain {
 			/* Straight to the terminal. */
-			err = s.writePlain(cl.Line)
+			err = s.writePlain(cl.Color, cl.Line)
 		} else {
 			/* Print the line nicely. */
 			_, err = s.Logf(cl.Color, cl.NoTimestamp, "%s", cl.Line)
@@ -296,8 +379,8 @@ func (s *Shell) handleOutput(ctx context.Context) error {
 }
 
 // writePlain writes a plain message to the terminal, assuming the terminal's
-// not being silenced.
-func (s *Shell) writePlain(line string) error {
+// not being silenced.  The message is colored unless color is ColorNone.
+func (s *Shell) writePlain(color Color, line string) error {
 	s.wL.Lock()
 	defer s.wL.Unlock()
 
@@ -309,7 +392,7 @@ func (s *Shell) writePlain(line string) error {
 	}
 
 	/* Actually do the write. */
-	_, err := io.WriteString(s.t, line)
+	_, err := io.WriteString(s.t, s.WrapInColor(line, color))
 	return err
 }
 
@@ -5,11 +5,14 @@ package opshell
  * Tests for opshell.go
  * By J. Stuart McMurray
  * Created 20240324
- * Last Modified 20240507
+ * Last Modified 20261016
  */
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"regexp"
 	"strings"
 	"testing"
@@ -179,3 +182,77 @@ func TestRemoveTimestamp(t *testing.T) {
 		})
 	}
 }
+
+func TestNewHeadless(t *testing.T) {
+	var (
+		inr, inw = io.Pipe()
+		outr, ow = io.Pipe()
+		ich      = make(chan string, 1)
+		och      = make(chan CLine, 1)
+		outch    = make(chan string, 1024)
+	)
+	defer inw.Close()
+	s, err := NewHeadless(
+		struct {
+			io.Reader
+			io.Writer
+		}{inr, ow},
+		80,
+		24,
+		ich,
+		och,
+		"> ",
+		true,
+		nil,
+		"",
+		nil,
+	)
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ech := make(chan error, 1)
+	go func() { ech <- s.Do(ctx) }()
+	go func() {
+		defer close(outch)
+		b := make([]byte, 1024)
+		for {
+			n, err := outr.Read(b)
+			if 0 != n {
+				outch <- string(b[:n])
+			}
+			if nil != err {
+				return
+			}
+		}
+	}()
+
+	/* Lines typed should come out of ich. */
+	if _, err := io.WriteString(inw, "kittens\r"); nil != err {
+		t.Fatalf("Error typing: %s", err)
+	}
+	if got, want := <-ich, "kittens"; got != want {
+		t.Errorf("Incorrect line:\n got: %q\nwant: %q", got, want)
+	}
+
+	/* Colored lines should make it to the terminal. */
+	och <- CLine{Color: ColorRed, Line: "moose"}
+	var (
+		got  string
+		want = s.WrapInColor("moose\r\n", ColorRed)
+	)
+	for !strings.Contains(got, want) {
+		o, ok := <-outch
+		if !ok {
+			t.Fatalf("Output closed before %q, got %q", want, got)
+		}
+		got += o
+	}
+
+	/* Closing the input should stop the shell. */
+	inw.Close()
+	if err := <-ech; !errors.Is(err, io.EOF) {
+		t.Errorf("Incorrect error:\n got: %v\nwant: %s", err, io.EOF)
+	}
+}
@@ -3,7 +3,7 @@
  * Test for shell messages
  * By J. Stuart McMurray
  * Created 20240925
- * Last Modified 20240926
+ * Last Modified 20261016
  */
 
 package opshell
@@ -38,6 +38,8 @@ func ExpectShellMessages(t *testing.T, och <-chan CLine, wantCLines ...CLine) {
 				t.FailNow()
 			}
 			nGot++
+			got.took()
+			got.Taken = nil
 			if got != want {
 				t.Errorf(
 					"Incorrect shell message:\n"+
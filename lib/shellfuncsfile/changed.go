@@ -0,0 +1,113 @@
+package shellfuncsfile
+
+/*
+ * changed.go
+ * Work out which functions changed
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// funcStartRE matches the first line of a shell function.
+var funcStartRE = regexp.MustCompile(
+	`^(?:function\s+)?([A-Za-z_][A-Za-z0-9_]*)\s*\(\s*\)`,
+)
+
+// A Function is a chunk of a shell functions file, as returned by
+// SplitFunctions.
+type Function struct {
+	// Name is the function's name.  It's the empty string for anything
+	// before the first function.
+	Name string
+	// Code is the function's code, including comments and blank lines
+	// just before it and anything after it, up to the next function.
+	Code []byte
+}
+
+// SplitFunctions splits b into functions.  Functions are found by looking
+// for lines which look like the start of a function (e.g. name() {...).  Each
+// returned Function contains the comment and blank lines immediately before
+// it, which is handy for # TABDOC: lines.  Anything before the first function
+// is returned in a Function with an empty name.  Concatenating the returned
+// Functions' code yields b.
+func SplitFunctions(b []byte) []Function {
+	var (
+		ret     []Function
+		cur     = Function{}
+		pending []byte /* Comments which may belong to the next func. */
+	)
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if 0 == len(line) {
+			continue
+		}
+		/* Comments and blank lines might go with the next function. */
+		if t := bytes.TrimSpace(line); 0 == len(t) || '#' == t[0] {
+			pending = append(pending, line...)
+			continue
+		}
+		/* If this isn't a new function, it's part of the current
+		one. */
+		m := funcStartRE.FindSubmatch(line)
+		if nil == m {
+			cur.Code = append(cur.Code, pending...)
+			cur.Code = append(cur.Code, line...)
+			pending = nil
+			continue
+		}
+		/* New function, finish the old one. */
+		if 0 != len(cur.Code) || "" != cur.Name {
+			ret = append(ret, cur)
+		}
+		cur = Function{Name: string(m[1]), Code: pending}
+		cur.Code = append(cur.Code, line...)
+		pending = nil
+	}
+	/* Don't forget the last one. */
+	cur.Code = append(cur.Code, pending...)
+	if 0 != len(cur.Code) || "" != cur.Name {
+		ret = append(ret, cur)
+	}
+
+	return ret
+}
+
+// ChangedFunctions returns the functions in new which aren't the same in old,
+// as split by SplitFunctions, concatenated in the order they appear in new.
+// Functions with the same name are compared in the order in which they
+// appear.  If nothing's changed, ChangedFunctions returns nil.
+func ChangedFunctions(old, new []byte) []byte {
+	/* key disambiguates functions with the same name. */
+	key := func(f Function, seen map[string]int) string {
+		k := f.Name + "/" + strconv.Itoa(seen[f.Name])
+		seen[f.Name]++
+		return k
+	}
+
+	/* Work out what we had before. */
+	var (
+		oldFuncs = make(map[string][]byte)
+		seen     = make(map[string]int)
+	)
+	for _, f := range SplitFunctions(old) {
+		oldFuncs[key(f, seen)] = f.Code
+	}
+
+	/* Keep everything which doesn't match. */
+	var ret []byte
+	clear(seen)
+	for _, f := range SplitFunctions(new) {
+		o, ok := oldFuncs[key(f, seen)]
+		if ok && bytes.Equal(o, f.Code) {
+			continue
+		}
+		ret = append(ret, f.Code...)
+	}
+
+	return ret
+}
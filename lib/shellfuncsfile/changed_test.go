@@ -0,0 +1,82 @@
+package shellfuncsfile
+
+/*
+ * changed_test.go
+ * Tests for changed.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+func TestChangedFunctions(t *testing.T) {
+	/* Roll a bunch of test cases.  We'll whine later if filenames aren't
+	correct. */
+	testCases := make(map[string]struct{})
+	files := make(map[string][]byte)
+	a := txtar.Parse(
+		mustReadTestdataFile(t, "testdata/changed/cases.txtar"),
+	)
+	for _, f := range a.Files {
+		name, _, ok := strings.Cut(f.Name, ".")
+		if !ok {
+			t.Fatalf("Test case name %s missing dot", f.Name)
+		}
+		testCases[name] = struct{}{}
+		files[f.Name] = f.Data
+	}
+
+	/* Test ALL the cases. */
+	for n := range testCases {
+		t.Run(n, func(t *testing.T) {
+			/* Grab the old/new/want files. */
+			var old, new, want []byte
+			for _, p := range []struct {
+				ext string
+				b   *[]byte
+			}{
+				{"old", &old},
+				{"new", &new},
+				{"want", &want},
+			} {
+				var ok bool
+				if *p.b, ok = files[n+"."+p.ext]; !ok {
+					t.Fatalf("Missing %s file", p.ext)
+				}
+			}
+			/* See what we get. */
+			got := ChangedFunctions(old, new)
+			if !bytes.Equal(got, want) {
+				t.Errorf(
+					"Incorrect changed functions:\n"+
+						"old:\n%s\n"+
+						"new:\n%s\n"+
+						"got:\n%s\n"+
+						"want:\n%s\n",
+					old,
+					new,
+					got,
+					want,
+				)
+			}
+		})
+	}
+}
+
+func TestSplitFunctions_Rejoin(t *testing.T) {
+	have := mustReadTestdataFile(t, "testdata/changed/cases.txtar")
+	var got []byte
+	for _, f := range SplitFunctions(have) {
+		got = append(got, f.Code...)
+	}
+	if !bytes.Equal(got, have) {
+		t.Errorf("Rejoined functions differ:\ngot:\n%s", got)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+/*
+ * format.go
+ * Output formats
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/magisterquis/curlrevshell/lib/shellfuncsfile"
+)
+
+// Output formats.
+const (
+	FormatFunctions = "functions"
+	FormatOneLiner  = "oneliner"
+	FormatScript    = "script"
+	FormatTemplate  = "template"
+	FormatJSON      = "json"
+)
+
+// formats maps format names to their descriptions and formatters.
+var formats = []struct {
+	name string
+	desc string
+	f    func([]byte) ([]byte, error)
+}{{
+	name: FormatFunctions,
+	desc: "Shell functions, as-is",
+	f:    func(b []byte) ([]byte, error) { return b, nil },
+}, {
+	name: FormatOneLiner,
+	desc: "One line which base64-decodes and evals the functions",
+	f: func(b []byte) ([]byte, error) {
+		return shellfuncsfile.OneLiner(b), nil
+	},
+}, {
+	name: FormatScript,
+	desc: "Standalone script, run as ./script.sh function [args...]",
+	f:    shellfuncsfile.Script,
+}, {
+	name: FormatTemplate,
+	desc: "curlrevshell -callback-template which sends the functions",
+	f: func(b []byte) ([]byte, error) {
+		return shellfuncsfile.CallbackTemplate(b), nil
+	},
+}, {
+	name: FormatJSON,
+	desc: "JSON manifest of functions, docs, and hashes",
+	f: func(b []byte) ([]byte, error) {
+		j, err := json.MarshalIndent(
+			shellfuncsfile.NewManifest(b),
+			"",
+			"\t",
+		)
+		return append(j, '\n'), err
+	},
+}}
+
+// Format converts b into the named format.
+func Format(name string, b []byte) ([]byte, error) {
+	for _, f := range formats {
+		if f.name == name {
+			return f.f(b)
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q", name)
+}
+
+// formatUsage returns a table describing the formats.
+func formatUsage() string {
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 2, 8, 2, ' ', 0)
+	for _, f := range formats {
+		fmt.Fprintf(tw, "  %s\t%s\n", f.name, f.desc)
+	}
+	tw.Flush()
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -6,7 +6,7 @@ package main
  * Command-line wrapper around the shellfuncsfile library.
  * By J. Stuart McMurray
  * Created 20240731
- * Last Modified 20240731
+ * Last Modified 20261016
  */
 
 import (
@@ -28,6 +28,21 @@ func rmain() int {
 			false,
 			"Don't also generate a tab_list() function",
 		)
+		config = flag.String(
+			"config",
+			"",
+			"Optional filters config `file`",
+		)
+		minify = flag.Bool(
+			"minify",
+			false,
+			"Remove comments and unneeded whitespace",
+		)
+		format = flag.String(
+			"format",
+			FormatFunctions,
+			"Output `format` (see below)",
+		)
 	)
 	flag.Usage = func() {
 		fmt.Fprintf(
@@ -41,6 +56,14 @@ Options:
 			os.Args[0],
 		)
 		flag.PrintDefaults()
+		fmt.Fprintf(
+			os.Stderr,
+			`
+Formats:
+%s
+`,
+			formatUsage(),
+		)
 	}
 	flag.Parse()
 
@@ -52,10 +75,17 @@ Options:
 	/* Convert ALL the things. */
 	conv := shellfuncsfile.NewDefaultConverter()
 	conv.AddListFunction = !*noList
+	conv.Config = *config
 	b, err := conv.From(flag.Args()...)
 	if nil != err {
 		log.Fatalf("Error: %s", err)
 	}
+	if *minify {
+		b = shellfuncsfile.Minify(b, conv.AddListFunction)
+	}
+	if b, err = Format(*format, b); nil != err {
+		log.Fatalf("Error formatting output: %s", err)
+	}
 	if _, err := os.Stdout.Write(b); nil != err {
 		log.Fatalf("Output error: %s", err)
 	}
@@ -0,0 +1,238 @@
+package shellfuncsfile
+
+/*
+ * config.go
+ * Filters from a config file
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/tools/txtar"
+)
+
+// DirConfigName is the name of a config file which, if present in a source
+// directory, configures filters for files in that directory.
+const DirConfigName = ".shellfuncsfile"
+
+// Config file directives.
+const (
+	directiveCommand  = "command"
+	directiveNone     = "none"
+	directiveTemplate = "template"
+	directiveTimeout  = "timeout"
+)
+
+// ParseConfig parses a config file, which maps file name globs to filters.
+// The config file is a txtar archive; see
+// https://pkg.go.dev/golang.org/x/tools/txtar#hdr-Txtar_format.
+//
+// Each line of the archive's comment is either blank, a comment starting with
+// a #, or a directive.  The directives are
+//
+//	timeout duration
+//	glob command shell command...
+//	glob template name
+//	glob none
+//
+// The timeout directive sets the timeout for commands in subsequent command
+// directives.  A command directive sets the filter for files matching glob to
+// a [CommandFilter] run in dir.  A template directive sets the filter for
+// glob to a [TemplateFilter] using the template in the archive's file with the
+// given name.  A none directive disables handling files matching glob, even
+// if they also match other globs, including those for built-in filters.
+//
+// In the returned map, globs for none directives map to nil Filters.
+// The returned filters' output is not cached; see [Converter.Config].
+func ParseConfig(b []byte, dir string) (map[string]Filter, error) {
+	var (
+		a       = txtar.Parse(b)
+		filters = make(map[string]Filter)
+		timeout = DefaultCommandTimeout
+		files   = make(map[string][]byte, len(a.Files))
+	)
+	for _, f := range a.Files {
+		files[f.Name] = f.Data
+	}
+
+	/* Parse each line of the comment. */
+	scanner := bufio.NewScanner(bytes.NewReader(a.Comment))
+	for lineN := 1; scanner.Scan(); lineN++ {
+		/* Skip comments and blank lines. */
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+		/* errf is shorthand for returning an error. */
+		errf := func(format string, a ...any) error {
+			return fmt.Errorf(
+				"line %d: %s",
+				lineN,
+				fmt.Sprintf(format, a...),
+			)
+		}
+		/* Work out what this line should do. */
+		glob, rest, _ := strings.Cut(line, " ")
+		directive, arg, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		arg = strings.TrimSpace(arg)
+		/* Timeouts don't have a glob. */
+		if directiveTimeout == glob {
+			d, err := time.ParseDuration(
+				strings.TrimSpace(rest),
+			)
+			if nil != err {
+				return nil, errf("invalid timeout: %s", err)
+			}
+			timeout = d
+			continue
+		}
+		/* Make sure the glob is ok. */
+		if _, err := filepath.Match(glob, ""); nil != err {
+			return nil, errf("invalid glob %q: %s", glob, err)
+		}
+		switch directive {
+		case directiveCommand:
+			if "" == arg {
+				return nil, errf("missing command")
+			}
+			filters[glob] = CommandFilter(arg, dir, timeout)
+		case directiveTemplate:
+			tb, ok := files[arg]
+			if !ok {
+				return nil, errf("template %q not found", arg)
+			}
+			tmpl, err := template.New(arg).Parse(string(tb))
+			if nil != err {
+				return nil, errf(
+					"parsing template %q: %s",
+					arg,
+					err,
+				)
+			}
+			filters[glob] = TemplateFilter(tmpl)
+		case directiveNone:
+			filters[glob] = nil
+		case "":
+			return nil, errf("missing directive for %q", glob)
+		default:
+			return nil, errf("unknown directive %q", directive)
+		}
+	}
+	if err := scanner.Err(); nil != err {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	return filters, nil
+}
+
+// applyConfig parses the config in b with ParseConfig and merges the
+// resulting filters into filters.  Non-nil filters are wrapped in c.cached.
+// Nil filters are kept, to shadow other filters in fromReader.
+func (c *Converter) applyConfig(
+	filters map[string]Filter,
+	b []byte,
+	dir string,
+) error {
+	cfs, err := ParseConfig(b, dir)
+	if nil != err {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	for glob, f := range cfs {
+		if nil == f {
+			filters[glob] = nil
+			continue
+		}
+		filters[glob] = c.cached(
+			fmt.Sprintf("%s\x00%s\x00%x", dir, glob, sum),
+			f,
+		)
+	}
+	return nil
+}
+
+// cacheEntry is a filter's output for a file with specific contents.
+type cacheEntry struct {
+	sum [sha256.Size]byte
+	out []byte
+	gen uint64 /* c.cacheGen when last used. */
+}
+
+// cached wraps f such that f is only called if the file passed to the
+// returned Filter is different from the last time a file with the same name
+// was passed to a Filter returned from c.cached with the same spec.
+func (c *Converter) cached(spec string, f Filter) Filter {
+	return func(filename string, r io.Reader) ([]byte, error) {
+		/* Hash the file, to see if we've seen it before. */
+		b, err := io.ReadAll(r)
+		if nil != err {
+			return nil, fmt.Errorf("slurping: %w", err)
+		}
+		sum := sha256.Sum256(b)
+
+		/* If we have it, life's easy. */
+		key := spec + "\x00" + filename
+		c.cacheL.Lock()
+		ce, ok := c.cache[key]
+		if ok && ce.sum == sum {
+			ce.gen = c.cacheGen
+			c.cache[key] = ce
+			c.cacheL.Unlock()
+			return bytes.Clone(ce.out), nil
+		}
+		c.cacheL.Unlock()
+
+		/* Nope, filter it. */
+		out, err := f(filename, bytes.NewReader(b))
+		if nil != err {
+			return nil, err
+		}
+
+		/* Save it for next time. */
+		c.cacheL.Lock()
+		defer c.cacheL.Unlock()
+		if nil == c.cache {
+			c.cache = make(map[string]cacheEntry)
+		}
+		c.cache[key] = cacheEntry{
+			sum: sum,
+			out: bytes.Clone(out),
+			gen: c.cacheGen,
+		}
+
+		return out, nil
+	}
+}
+
+// startCacheGen starts a new cache generation, for a call to From.  It returns
+// the new generation, for passing to pruneCache.
+func (c *Converter) startCacheGen() uint64 {
+	c.cacheL.Lock()
+	defer c.cacheL.Unlock()
+	c.cacheGen++
+	return c.cacheGen
+}
+
+// pruneCache removes cached output which hasn't been used since generation
+// gen started.  This gets rid of output from old configs and files which are
+// no more.
+func (c *Converter) pruneCache(gen uint64) {
+	c.cacheL.Lock()
+	defer c.cacheL.Unlock()
+	for k, ce := range c.cache {
+		if ce.gen < gen {
+			delete(c.cache, k)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package shellfuncsfile
+
+/*
+ * config_test.go
+ * Tests for config.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		have   string
+		globs  []string
+		errStr string
+	}{{
+		name: "empty",
+	}, {
+		name: "all_directives",
+		have: `# Comment
+timeout 1s
+*.py command python3 py2sh.py
+
+*.awk template awk
+*.sh none
+-- awk --
+{{.FuncName}}() { awk {{.Quoted}} "$@"; }
+`,
+		globs: []string{"*.awk", "*.py", "*.sh"},
+	}, {
+		name:   "missing_template",
+		have:   "*.awk template awk\n",
+		errStr: `line 1: template "awk" not found`,
+	}, {
+		name:   "unknown_directive",
+		have:   "\n*.awk kittens\n",
+		errStr: `line 2: unknown directive "kittens"`,
+	}, {
+		name:   "missing_directive",
+		have:   "*.awk\n",
+		errStr: `line 1: missing directive for "*.awk"`,
+	}, {
+		name: "bad_timeout",
+		have: "timeout moose\n",
+		errStr: `line 1: invalid timeout: ` +
+			`time: invalid duration "moose"`,
+	}, {
+		name:   "bad_glob",
+		have:   "[ none\n",
+		errStr: `line 1: invalid glob "[": syntax error in pattern`,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseConfig([]byte(c.have), "")
+			if "" != c.errStr {
+				if nil == err {
+					t.Fatalf("Expected error, got none")
+				} else if got := err.Error(); got != c.errStr {
+					t.Fatalf(
+						"Incorrect error:\n"+
+							" got: %s\n"+
+							"want: %s",
+						got,
+						c.errStr,
+					)
+				}
+				return
+			} else if nil != err {
+				t.Fatalf("Error: %s", err)
+			}
+			if len(got) != len(c.globs) {
+				t.Fatalf(
+					"Got %d filters, want %d",
+					len(got),
+					len(c.globs),
+				)
+			}
+			for _, glob := range c.globs {
+				if _, ok := got[glob]; !ok {
+					t.Errorf("Missing filter for %s", glob)
+				}
+			}
+		})
+	}
+}
+
+func TestConverterFrom_DirConfig(t *testing.T) {
+	var (
+		d     = t.TempDir()
+		count = filepath.Join(t.TempDir(), "count")
+		files = map[string]string{
+			DirConfigName: `*.up command echo x >>` + count +
+				`; echo "$(basename "$1" .up)() { echo ` +
+				`$(tr a-z A-Z); }"
+*.tmpl template t
+*.sh none
+-- t --
+{{.FuncName}}() { echo {{.Base64}} | base64 -d; }
+`,
+			"a.up":   "kittens",
+			"b.tmpl": "moose",
+			"c.sh":   "ignored() { :; }",
+		}
+		want = `a() { echo KITTENS; }
+b() { echo bW9vc2U= | base64 -d; }
+`
+	)
+	for n, c := range files {
+		fn := filepath.Join(d, n)
+		if err := os.WriteFile(fn, []byte(c), 0600); nil != err {
+			t.Fatalf("Error writing %s: %s", fn, err)
+		}
+	}
+
+	/* Convert it a couple of times, make sure the command only ran
+	once. */
+	conv := NewDefaultConverter()
+	for range 2 {
+		got, err := conv.From(d)
+		if nil != err {
+			t.Fatalf("From error: %s", err)
+		}
+		if string(got) != want {
+			t.Fatalf(
+				"Incorrect output:\ngot:\n%s\nwant:\n%s",
+				got,
+				want,
+			)
+		}
+	}
+	b, err := os.ReadFile(count)
+	if nil != err {
+		t.Fatalf("Error reading count file %s: %s", count, err)
+	}
+	if n := strings.Count(string(b), "x"); 1 != n {
+		t.Errorf("Command ran %d times, expected once", n)
+	}
+}
+
+func TestConverterFrom_Config(t *testing.T) {
+	conv := NewDefaultConverter()
+	conv.FS = fstest.MapFS{
+		"config": {Data: []byte("*.pl template t\n-- t --\n" +
+			"{{.FuncName}}() { perl -e {{.Quoted}}; }\n")},
+		"a.pl": {Data: []byte("print 'hi'")},
+	}
+	conv.Config = "config"
+	want := `a() { perl -e 'print '\''hi'\'''; }` + "\n"
+	got, err := conv.From("a.pl")
+	if nil != err {
+		t.Fatalf("From error: %s", err)
+	}
+	if !bytes.Equal(got, []byte(want)) {
+		t.Fatalf("Incorrect output:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConverterFrom_NoneShadows(t *testing.T) {
+	conv := NewDefaultConverter()
+	conv.FS = fstest.MapFS{
+		"d/" + DirConfigName: {Data: []byte("a*.sh none\n")},
+		"d/a.sh":             {Data: []byte("a() { :; }\n")},
+		"d/b.sh":             {Data: []byte("b() { :; }\n")},
+	}
+	want := "b() { :; }\n"
+	got, err := conv.From("d")
+	if nil != err {
+		t.Fatalf("From error: %s", err)
+	}
+	if string(got) != want {
+		t.Fatalf("Incorrect output:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConverterFrom_CachePruned(t *testing.T) {
+	var (
+		conv = NewDefaultConverter()
+		fsys = fstest.MapFS{
+			"d/a.up": {Data: []byte("kittens")},
+			"d/b.up": {Data: []byte("moose")},
+		}
+	)
+	conv.FS = fsys
+	conv.Config = "config"
+	for _, c := range []struct {
+		name   string
+		config string
+		remove string
+		want   int
+	}{{
+		name:   "first",
+		config: "*.up template t\n-- t --\n{{.FuncName}}() { :; }\n",
+		want:   2,
+	}, {
+		name:   "changed_config",
+		config: "*.up template t\n-- t --\n{{.FuncName}}() { :;}\n",
+		want:   2,
+	}, {
+		name:   "removed_file",
+		config: "*.up template t\n-- t --\n{{.FuncName}}() { :;}\n",
+		remove: "d/b.up",
+		want:   1,
+	}} {
+		fsys["config"] = &fstest.MapFile{Data: []byte(c.config)}
+		delete(fsys, c.remove)
+		if _, err := conv.From("d"); nil != err {
+			t.Fatalf("From error (%s): %s", c.name, err)
+		}
+		if got := len(conv.cache); got != c.want {
+			t.Errorf(
+				"Incorrect cache size (%s):\n"+
+					" got: %d\n"+
+					"want: %d",
+				c.name,
+				got,
+				c.want,
+			)
+		}
+	}
+}
+
+func TestCommandFilter_Timeout(t *testing.T) {
+	_, err := CommandFilter("exec sleep 1", "", 10*time.Millisecond)(
+		"x",
+		strings.NewReader(""),
+	)
+	want := `"exec sleep 1" did not finish within 10ms`
+	if nil == err {
+		t.Fatalf("Command did not time out")
+	} else if got := err.Error(); got != want {
+		t.Fatalf("Incorrect error:\n got: %s\nwant: %s", got, want)
+	}
+}
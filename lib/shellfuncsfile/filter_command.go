@@ -0,0 +1,82 @@
+package shellfuncsfile
+
+/*
+ * filter_command.go
+ * Turn a file into shell functions with an external command
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultCommandTimeout is the default amount of time a command run by
+// a CommandFilter has to finish.
+const DefaultCommandTimeout = 10 * time.Second
+
+// commandShell is the shell used to run a CommandFilter's command.
+const commandShell = "/bin/sh"
+
+// commandWaitDelay is how long we wait for a killed command's children to
+// close its output.
+const commandWaitDelay = time.Second
+
+// CommandFilter returns a Filter which runs command with /bin/sh -c.  The
+// source file is sent to the command's stdin and the command should write
+// shell functions to its stdout.  The source file's name is passed to the
+// command as $1.  The command will be run in dir if dir isn't the empty
+// string and killed if it doesn't finish within timeout.  If timeout is 0,
+// DefaultCommandTimeout is used.
+func CommandFilter(command, dir string, timeout time.Duration) Filter {
+	if 0 == timeout {
+		timeout = DefaultCommandTimeout
+	}
+	return func(filename string, r io.Reader) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			timeout,
+		)
+		defer cancel()
+
+		/* Roll the command. */
+		var (
+			sout = new(bytes.Buffer)
+			serr = new(bytes.Buffer)
+			cmd  = exec.CommandContext(
+				ctx,
+				commandShell,
+				"-c", command,
+				commandShell, filename,
+			)
+		)
+		cmd.Dir = dir
+		cmd.WaitDelay = commandWaitDelay
+		cmd.Stdin = r
+		cmd.Stdout = sout
+		cmd.Stderr = serr
+
+		/* Run it and hope it works. */
+		if err := cmd.Run(); nil != ctx.Err() {
+			return nil, fmt.Errorf(
+				"%q did not finish within %s",
+				command,
+				timeout,
+			)
+		} else if nil != err {
+			if s := strings.TrimSpace(serr.String()); "" != s {
+				err = fmt.Errorf("%w (stderr: %s)", err, s)
+			}
+			return nil, fmt.Errorf("running %q: %w", command, err)
+		}
+
+		return sout.Bytes(), nil
+	}
+}
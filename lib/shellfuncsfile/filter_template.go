@@ -0,0 +1,65 @@
+package shellfuncsfile
+
+/*
+ * filter_template.go
+ * Turn a file into shell functions with a template
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/magisterquis/curlrevshell/lib/uu"
+)
+
+// TemplateParams is passed to the template used by a TemplateFilter.
+type TemplateParams struct {
+	FileName string /* Source file's name. */
+	FuncName string /* Base of FileName, less the extension. */
+	Content  string /* Source file's contents, unmodified. */
+	Base64   string /* Content, base64-encoded without newlines. */
+	UU       string /* Content, uuencoded like Perl's pack("u"). */
+	Quoted   string /* Content, single-quoted for the shell. */
+}
+
+// TemplateFilter returns a Filter which executes tmpl with a TemplateParams
+// describing the source file.
+func TemplateFilter(tmpl *template.Template) Filter {
+	return func(filename string, r io.Reader) ([]byte, error) {
+		/* Slurp the file. */
+		b, err := io.ReadAll(r)
+		if nil != err {
+			return nil, fmt.Errorf("slurping: %w", err)
+		}
+
+		/* Work out the template's parameters. */
+		base := filepath.Base(filename)
+		params := TemplateParams{
+			FileName: filename,
+			FuncName: strings.TrimSuffix(base, filepath.Ext(base)),
+			Content:  string(b),
+			Base64:   base64.StdEncoding.EncodeToString(b),
+			UU:       string(uu.AppendEncode(nil, b)),
+			Quoted: "'" + strings.ReplaceAll(
+				string(b),
+				"'",
+				`'\''`,
+			) + "'",
+		}
+
+		/* Roll the shell functions. */
+		ret := new(bytes.Buffer)
+		if err := tmpl.Execute(ret, params); nil != err {
+			return nil, fmt.Errorf("executing template: %w", err)
+		}
+		return ret.Bytes(), nil
+	}
+}
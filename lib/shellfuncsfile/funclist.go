@@ -5,7 +5,7 @@ package shellfuncsfile
  * Shell function to print the list of functions we offer.
  * By J. Stuart McMurray
  * Created 20240728
- * Last Modified 20240928
+ * Last Modified 20261016
  */
 
 import (
@@ -51,25 +51,13 @@ func GenFuncList(s string) ([]byte, error) {
 	/* Add each line to the table. */
 	for _, line := range strings.Split(s, "\n") {
 		/* Don't care about non-doc lines. */
-		if !strings.HasPrefix(line, DocPrefix) {
+		name, desc, ok := parseDocLine(line)
+		if !ok {
 			continue
 		}
 
-		/* Get the first word and rest of the line. */
-		line = strings.TrimPrefix(line, DocPrefix)
-		line = strings.TrimSpace(line)
-		if "" == line { /* Need something to report. */
-			continue
-		}
-		name, desc, _ := strings.Cut(line, " ")
-
 		/* Add it to the help table. */
-		fmt.Fprintf(
-			tw,
-			"%s\t- %s\n",
-			strings.TrimSpace(name),
-			strings.TrimSpace(desc),
-		)
+		fmt.Fprintf(tw, "%s\t- %s\n", name, desc)
 	}
 	tw.Flush()
 
@@ -95,3 +83,16 @@ func GenFuncList(s string) ([]byte, error) {
 
 	return ret.Bytes(), nil
 }
+
+// parseDocLine splits a line starting with DocPrefix into the documented
+// function's name and description.  ok is false if line doesn't start with
+// DocPrefix or has nothing after it.
+func parseDocLine(line string) (name, desc string, ok bool) {
+	/* Get the first word and rest of the line. */
+	line, ok = strings.CutPrefix(line, DocPrefix)
+	if line = strings.TrimSpace(line); !ok || "" == line {
+		return "", "", false
+	}
+	name, desc, _ = strings.Cut(line, " ")
+	return strings.TrimSpace(name), strings.TrimSpace(desc), true
+}
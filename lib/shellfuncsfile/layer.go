@@ -0,0 +1,125 @@
+package shellfuncsfile
+
+/*
+ * layer.go
+ * Stack filesystems on top of each other
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// layerFS is returned by Layer.
+type layerFS []fs.FS
+
+// Layer returns an [fs.FS] which serves each file from the first of fss which
+// has it.  Directory listings are merged.
+func Layer(fss ...fs.FS) fs.FS {
+	return layerFS(slices.DeleteFunc(slices.Clone(fss), func(f fs.FS) bool {
+		return nil == f
+	}))
+}
+
+// Open opens the named file from the first layer which has it.  Directories'
+// listings are merged, as with ReadDir.
+func (l layerFS) Open(name string) (fs.File, error) {
+	for _, f := range l {
+		o, err := f.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if nil != err {
+			return nil, err
+		}
+		/* Directories need all the layers. */
+		if fi, err := o.Stat(); nil != err {
+			o.Close()
+			return nil, err
+		} else if fi.IsDir() {
+			return &layerDir{File: o, l: l, name: name}, nil
+		}
+		return o, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir reads and merges the named directory from every layer which has it.
+// If more than one layer has a file with the same name, the entry from the
+// first layer is used.
+func (l layerFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var (
+		found bool
+		seen  = make(map[string]bool)
+		des   []fs.DirEntry
+	)
+	for _, f := range l {
+		ds, err := fs.ReadDir(f, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if nil != err {
+			return nil, err
+		}
+		found = true
+		for _, d := range ds {
+			if seen[d.Name()] {
+				continue
+			}
+			seen[d.Name()] = true
+			des = append(des, d)
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{
+			Op:   "readdir",
+			Path: name,
+			Err:  fs.ErrNotExist,
+		}
+	}
+	slices.SortFunc(des, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return des, nil
+}
+
+// layerDir is a directory in a layerFS.
+type layerDir struct {
+	fs.File
+	l    layerFS
+	name string
+	des  []fs.DirEntry /* Lazily read. */
+	read bool
+}
+
+// ReadDir implements fs.ReadDirFile.  The entries come from every layer in
+// which the directory exists.
+func (d *layerDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	/* Get the list of entries the first time. */
+	if !d.read {
+		des, err := d.l.ReadDir(d.name)
+		if nil != err {
+			return nil, err
+		}
+		d.des = des
+		d.read = true
+	}
+
+	/* Return as many as are asked for. */
+	if 0 >= n {
+		ret := d.des
+		d.des = nil
+		return ret, nil
+	}
+	if 0 == len(d.des) {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.des))
+	ret := d.des[:n]
+	d.des = d.des[n:]
+	return ret, nil
+}
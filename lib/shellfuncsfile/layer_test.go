@@ -0,0 +1,57 @@
+package shellfuncsfile
+
+/*
+ * layer_test.go
+ * Tests for layer.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLayer(t *testing.T) {
+	top := fstest.MapFS{
+		"a":     {Data: []byte("top a")},
+		"d/b":   {Data: []byte("top b")},
+		"top_c": {Data: []byte("top c")},
+	}
+	bottom := fstest.MapFS{
+		"a":        {Data: []byte("bottom a")},
+		"d/b":      {Data: []byte("bottom b")},
+		"d/e":      {Data: []byte("bottom e")},
+		"bottom_f": {Data: []byte("bottom f")},
+	}
+	l := Layer(top, nil, bottom)
+	if err := fstest.TestFS(
+		l,
+		"a", "d/b", "d/e", "top_c", "bottom_f",
+	); nil != err {
+		t.Fatalf("Layered filesystem broken: %s", err)
+	}
+	for name, want := range map[string]string{
+		"a":        "top a",
+		"d/b":      "top b",
+		"d/e":      "bottom e",
+		"top_c":    "top c",
+		"bottom_f": "bottom f",
+	} {
+		b, err := fs.ReadFile(l, name)
+		if nil != err {
+			t.Errorf("Error reading %s: %s", name, err)
+			continue
+		}
+		if got := string(b); got != want {
+			t.Errorf(
+				"Incorrect %s:\n got: %s\nwant: %s",
+				name,
+				got,
+				want,
+			)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package shellfuncsfile
+
+/*
+ * minify.go
+ * Make shell scripts smaller
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"strings"
+)
+
+// minifyState is what sort of thing the minifier's in the middle of.
+type minifyState int
+
+// Minifier states.  Everything but minifyCode is copied as-is.
+const (
+	minifyCode   minifyState = iota /* Shell code. */
+	minifySubst                     /* $(...), also shell code. */
+	minifySingle                    /* '...' */
+	minifyDouble                    /* "..." */
+	minifyTick                      /* `...` */
+	minifyParam                     /* ${...} */
+	minifyArith                     /* $((...)) */
+)
+
+// minifyFrame is one level of nesting in the minifier.
+type minifyFrame struct {
+	state minifyState
+	depth int /* Parens, for minifySubst and minifyArith. */
+}
+
+// heredoc is a here-document we'll need to skip.
+type heredoc struct {
+	delim     string
+	stripTabs bool /* <<- */
+}
+
+// Minify makes shell script b smaller by removing comments, blank lines,
+// indentation, and runs of whitespace.  Quoted strings, parameter expansions,
+// arithmetic, command substitutions in backticks, here-documents, and line
+// continuations are left as they are.  If keepDocs is true, lines starting
+// with DocPrefix are kept, less indentation.
+//
+// Minify isn't a full shell parser.  It aims to be conservative: when in doubt
+// it leaves things alone.  Unusual code like a case statement in a $(...) in
+// double quotes may confuse it.
+func Minify(b []byte, keepDocs bool) []byte {
+	var (
+		out       = make([]byte, 0, len(b))
+		stack     = []minifyFrame{{state: minifyCode}}
+		lineStart int       /* Start of the current line in out. */
+		space     bool      /* Need a space before the next code. */
+		cont      bool      /* Line started with a continuation. */
+		heredocs  []heredoc /* To skip after this line. */
+	)
+	top := func() *minifyFrame { return &stack[len(stack)-1] }
+	push := func(s minifyState, depth int) {
+		stack = append(stack, minifyFrame{state: s, depth: depth})
+	}
+	pop := func() {
+		if 1 < len(stack) {
+			stack = stack[:len(stack)-1]
+		}
+	}
+	/* emit adds code to out, with a space first if we need one. */
+	emit := func(p ...byte) {
+		if space && (len(out) != lineStart || cont) {
+			out = append(out, ' ')
+		}
+		space = false
+		out = append(out, p...)
+	}
+	/* wordStart is true if we're at the start of a word. */
+	wordStart := func() bool {
+		if space || len(out) == lineStart {
+			return true
+		}
+		return -1 != bytes.IndexByte([]byte(";&|()"), out[len(out)-1])
+	}
+
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		next := byte(0)
+		if i+1 < len(b) {
+			next = b[i+1]
+		}
+		f := top()
+		switch f.state {
+		case minifySingle:
+			out = append(out, c)
+			if '\'' == c {
+				pop()
+			}
+			continue
+		case minifyTick:
+			out = append(out, c)
+			if '\\' == c && 0 != next {
+				out = append(out, next)
+				i++
+			} else if '`' == c {
+				pop()
+			}
+			continue
+		case minifyArith:
+			out = append(out, c)
+			switch c {
+			case '(':
+				f.depth++
+			case ')':
+				if f.depth--; 0 == f.depth {
+					pop()
+				}
+			}
+			continue
+		case minifyDouble, minifyParam:
+			switch {
+			case '\\' == c && 0 != next:
+				out = append(out, c, next)
+				i++
+			case minifyDouble == f.state && '"' == c,
+				minifyParam == f.state && '}' == c:
+				out = append(out, c)
+				pop()
+			case minifyParam == f.state && '\'' == c:
+				out = append(out, c)
+				push(minifySingle, 0)
+			case minifyParam == f.state && '"' == c:
+				out = append(out, c)
+				push(minifyDouble, 0)
+			case '`' == c:
+				out = append(out, c)
+				push(minifyTick, 0)
+			case '$' == c && '(' == next:
+				i += minifyDollarParen(b, i, &out, push)
+			case '$' == c && '{' == next:
+				out = append(out, c, next)
+				i++
+				push(minifyParam, 0)
+			default:
+				out = append(out, c)
+			}
+			continue
+		}
+
+		/* Shell code, the interesting bit. */
+		switch c {
+		case ' ', '\t', '\r':
+			space = true
+		case '\n':
+			space = false
+			/* Don't need blank lines. */
+			if len(out) == lineStart && !cont {
+				heredocs = minifyHeredocs(b, &i, &out, heredocs)
+				lineStart = len(out)
+				continue
+			}
+			out = append(out, '\n')
+			heredocs = minifyHeredocs(b, &i, &out, heredocs)
+			lineStart = len(out)
+			cont = false
+		case '\\':
+			emit(c)
+			if 0 == next {
+				continue
+			}
+			out = append(out, next)
+			i++
+			if '\n' == next { /* Continuation. */
+				lineStart = len(out)
+				cont = true
+			}
+		case '#':
+			if !wordStart() {
+				emit(c)
+				continue
+			}
+			/* Comment.  Work out where it ends. */
+			end := bytes.IndexByte(b[i:], '\n')
+			if -1 == end {
+				end = len(b) - i
+			}
+			if keepDocs && len(out) == lineStart && !cont &&
+				strings.HasPrefix(string(b[i:]), DocPrefix) {
+				space = false
+				out = append(out, bytes.TrimRight(
+					b[i:i+end],
+					" \t\r",
+				)...)
+			}
+			i += end - 1
+		case '\'':
+			emit(c)
+			push(minifySingle, 0)
+		case '"':
+			emit(c)
+			push(minifyDouble, 0)
+		case '`':
+			emit(c)
+			push(minifyTick, 0)
+		case '$':
+			switch next {
+			case '(':
+				emit()
+				i += minifyDollarParen(b, i, &out, push)
+			case '{':
+				emit(c, next)
+				i++
+				push(minifyParam, 0)
+			default:
+				emit(c)
+			}
+		case '(':
+			emit(c)
+			if minifySubst == f.state {
+				f.depth++
+			}
+		case ')':
+			emit(c)
+			if minifySubst == f.state {
+				if f.depth--; 0 == f.depth {
+					pop()
+				}
+			}
+		case '<':
+			/* Here-document? */
+			if '<' != next || (i+2 < len(b) && '<' == b[i+2]) {
+				/* Nope, or a here-string. */
+				n := 1
+				for i+n < len(b) && '<' == b[i+n] {
+					n++
+				}
+				emit(b[i : i+n]...)
+				i += n - 1
+				continue
+			}
+			emit()
+			n, hd := minifyHeredocStart(b[i:])
+			out = append(out, b[i:i+n]...)
+			i += n - 1
+			if "" != hd.delim {
+				heredocs = append(heredocs, hd)
+			}
+		default:
+			emit(c)
+		}
+	}
+
+	return out
+}
+
+// minifyDollarParen copies the $( or $(( at b[i] to out and pushes the right
+// state.  It returns the number of bytes beyond b[i] it consumed.
+func minifyDollarParen(
+	b []byte,
+	i int,
+	out *[]byte,
+	push func(minifyState, int),
+) int {
+	if i+2 < len(b) && '(' == b[i+2] {
+		*out = append(*out, b[i:i+3]...)
+		push(minifyArith, 2)
+		return 2
+	}
+	*out = append(*out, b[i:i+2]...)
+	push(minifySubst, 1)
+	return 1
+}
+
+// minifyHeredocStart parses the <<WORD or <<-WORD at the start of b.  It
+// returns the number of bytes which make up the operator and word, and the
+// here-document's delimiter, which will be empty if there's no word.
+func minifyHeredocStart(b []byte) (int, heredoc) {
+	var hd heredoc
+	n := 2 /* << */
+	if n < len(b) && '-' == b[n] {
+		hd.stripTabs = true
+		n++
+	}
+	for n < len(b) && (' ' == b[n] || '\t' == b[n]) {
+		n++
+	}
+	/* Read the word, removing quotes. */
+	var (
+		delim []byte
+		quote byte
+	)
+WORD:
+	for ; n < len(b); n++ {
+		c := b[n]
+		switch {
+		case 0 != quote && c == quote:
+			quote = 0
+		case 0 != quote:
+			delim = append(delim, c)
+		case '\'' == c || '"' == c:
+			quote = c
+		case '\\' == c && n+1 < len(b) && '\n' != b[n+1]:
+			n++
+			delim = append(delim, b[n])
+		case bytes.ContainsRune([]byte(" \t\r\n;&|<>()"), rune(c)):
+			break WORD
+		default:
+			delim = append(delim, c)
+		}
+	}
+	hd.delim = string(delim)
+	return n, hd
+}
+
+// minifyHeredocs copies the bodies of the here-documents in hds, which start
+// after b[*i], to out.  *i is updated to point to the last byte copied.  The
+// returned slice is always empty.
+func minifyHeredocs(b []byte, i *int, out *[]byte, hds []heredoc) []heredoc {
+	for _, hd := range hds {
+		for *i+1 < len(b) {
+			/* Grab a line. */
+			start := *i + 1
+			end := bytes.IndexByte(b[start:], '\n')
+			if -1 == end {
+				end = len(b)
+			} else {
+				end += start + 1
+			}
+			line := b[start:end]
+			*out = append(*out, line...)
+			*i = end - 1
+			/* If it's the delimiter, this one's done. */
+			l := strings.TrimRight(string(line), "\r\n")
+			if hd.stripTabs {
+				l = strings.TrimLeft(l, "\t")
+			}
+			if l == hd.delim {
+				break
+			}
+		}
+	}
+	return hds[:0]
+}
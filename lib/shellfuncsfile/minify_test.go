@@ -0,0 +1,100 @@
+package shellfuncsfile
+
+/*
+ * minify_test.go
+ * Tests for minify.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+func TestMinify(t *testing.T) {
+	/* Roll a bunch of test cases. */
+	var testCases []string
+	files := make(map[string][]byte)
+	a := txtar.Parse(
+		mustReadTestdataFile(t, "testdata/minify/cases.txtar"),
+	)
+	for _, f := range a.Files {
+		name, ext, ok := strings.Cut(f.Name, ".")
+		if !ok {
+			t.Fatalf("Test case name %s missing dot", f.Name)
+		}
+		if "sh" == ext {
+			testCases = append(testCases, name)
+		}
+		files[f.Name] = f.Data
+	}
+
+	for _, n := range testCases {
+		t.Run(n, func(t *testing.T) {
+			have := files[n+".sh"]
+			want, ok := files[n+".min"]
+			if !ok {
+				t.Fatalf("Missing min file")
+			}
+			wantDocs, ok := files[n+".docs"]
+			if !ok {
+				wantDocs = want
+			}
+			for _, c := range []struct {
+				keepDocs bool
+				want     []byte
+			}{
+				{false, want},
+				{true, wantDocs},
+			} {
+				got := Minify(have, c.keepDocs)
+				if !bytes.Equal(got, c.want) {
+					t.Errorf(
+						"Incorrect minification "+
+							"(keepDocs:%t):\n"+
+							"have:\n%s\n"+
+							"got:\n%s\n"+
+							"want:\n%s",
+						c.keepDocs,
+						have,
+						got,
+						c.want,
+					)
+				}
+				mustRunSame(t, have, got)
+			}
+		})
+	}
+}
+
+// mustRunSame runs have and got with /bin/sh, if we have it, and makes sure
+// they have the same output.
+func mustRunSame(t *testing.T, have, got []byte) {
+	t.Helper()
+	if _, err := exec.LookPath("/bin/sh"); nil != err {
+		return
+	}
+	var outs [2][]byte
+	for i, b := range [][]byte{have, got} {
+		var err error
+		cmd := exec.Command("/bin/sh", "-c", string(b))
+		if outs[i], err = cmd.CombinedOutput(); nil != err {
+			t.Fatalf("Error running script: %s\n%s", err, b)
+		}
+	}
+	if !bytes.Equal(outs[0], outs[1]) {
+		t.Errorf(
+			"Minified script output differs:\n"+
+				"have:\n%s\n"+
+				"got:\n%s",
+			outs[0],
+			outs[1],
+		)
+	}
+}
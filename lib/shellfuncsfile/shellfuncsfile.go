@@ -16,7 +16,7 @@ package shellfuncsfile
  * Turn a file or directory into shell functions
  * By J. Stuart McMurray
  * Created 20240706
- * Last Modified 20240731
+ * Last Modified 20261016
  */
 
 import (
@@ -66,9 +66,29 @@ type Converter struct {
 	// Converter.From.
 	AddListFunction bool
 
+	// Config is the name of an optional config file, as described in
+	// [ParseConfig], which is read every time Converter.From is called.
+	// Commands it configures are run in the config file's directory.
+	// Config must not be modified during a call to Converter.From.
+	Config string
+
+	// Base, if set, is layered beneath every directory source, as with
+	// [Layer].  Files in a source directory take precedence over files in
+	// Base with the same name.  If From is called with no directory
+	// sources, Base is converted on its own and put before any single-file
+	// sources, so the files' functions take precedence.
+	// Base must not be modified during a call to Converter.From.
+	Base fs.FS
+
 	// filters maps a glob to a filter.
 	filtersL sync.RWMutex
 	filters  map[string]Filter
+
+	// cache holds output from filters from config files.  Entries not
+	// used during a successful call to From are removed.
+	cacheL   sync.Mutex
+	cache    map[string]cacheEntry
+	cacheGen uint64
 }
 
 // NewDefaultConverter returns a new converter with the default set of filters,
@@ -86,6 +106,9 @@ func NewDefaultConverter() *Converter {
 func (c *Converter) SetFilter(ext string, filter Filter) {
 	c.filtersL.Lock()
 	defer c.filtersL.Unlock()
+	if nil == c.filters {
+		c.filters = make(map[string]Filter)
+	}
 	/* If we don't have a filter, it's really a delete. */
 	if nil == filter {
 		delete(c.filters, ext)
@@ -96,8 +119,11 @@ func (c *Converter) SetFilter(ext string, filter Filter) {
 }
 
 // fromDirectory converts files in source which have a converter and
-// concatenates the result.
-func (c *Converter) fromDirectory(source string) ([]byte, error) {
+// concatenates the result.  If c.Base is set, it is layered beneath source.
+func (c *Converter) fromDirectory(
+	source string,
+	filters map[string]Filter,
+) ([]byte, error) {
 	/* Got a directory.  We'll want to operate in just that. */
 	var sfs fs.FS
 	if nil == c.FS {
@@ -112,17 +138,55 @@ func (c *Converter) fromDirectory(source string) ([]byte, error) {
 			)
 		}
 	}
+	if nil != c.Base {
+		sfs = Layer(sfs, c.Base)
+	}
 
-	/* Copy filters, to avoid races. */
-	c.filtersL.RLock()
-	filters := maps.Clone(c.filters)
-	c.filtersL.RUnlock()
+	/* Commands run in the source directory, if it's a real one. */
+	var dir string
+	if nil == c.FS {
+		dir = source
+	}
+	return c.fromFS(sfs, source, dir, filters)
+}
+
+// fromFS converts files in sfs which have a converter and concatenates the
+// result.  If sfs has a DirConfigName file, its filters are added to a copy of
+// filters and its commands are run in dir.  Errors will refer to files as if
+// they were in source.
+func (c *Converter) fromFS(
+	sfs fs.FS,
+	source string,
+	dir string,
+	filters map[string]Filter,
+) ([]byte, error) {
+	/* Add in this directory's config, if we have one. */
+	if b, err := fs.ReadFile(sfs, DirConfigName); nil == err {
+		filters = maps.Clone(filters)
+		if err := c.applyConfig(filters, b, dir); nil != err {
+			return nil, fmt.Errorf(
+				"applying config from %s: %w",
+				filepath.Join(source, DirConfigName),
+				err,
+			)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf(
+			"reading %s: %w",
+			filepath.Join(source, DirConfigName),
+			err,
+		)
+	}
 
-	/* Get the appropriate files in the directory. */
+	/* Get the appropriate files in the directory.  Files which match
+	nil filters will be skipped later. */
 	var fileNames []string
 	patterns := maps.Keys(filters)
 	slices.Sort(patterns)
 	for _, pattern := range patterns {
+		if nil == filters[pattern] {
+			continue
+		}
 		ms, err := fs.Glob(sfs, pattern)
 		if nil != err {
 			return nil, fmt.Errorf(
@@ -139,6 +203,10 @@ func (c *Converter) fromDirectory(source string) ([]byte, error) {
 	/* Convert each file, appending to one big buffer. */
 	var buf bytes.Buffer
 	for _, fileName := range fileNames {
+		/* Config files aren't sources. */
+		if DirConfigName == fileName {
+			continue
+		}
 		/* "Real" filename */
 		fn := filepath.Join(source, fileName)
 		/* Don't care about non-regular files. */
@@ -163,9 +231,11 @@ func (c *Converter) fromDirectory(source string) ([]byte, error) {
 				)
 			}
 			defer f.Close()
-			/* Convert it. */
+			/* Convert it, unless it's been turned off. */
 			b, err := c.fromReader(f, fileName, filters)
-			if nil != err {
+			if errors.Is(err, errNoConverter) {
+				return nil
+			} else if nil != err {
 				return fmt.Errorf(
 					"converting %s: %w",
 					fn,
@@ -184,7 +254,10 @@ func (c *Converter) fromDirectory(source string) ([]byte, error) {
 }
 
 // fromSingleFile converts a single file.
-func (c *Converter) fromSingleFile(name string) ([]byte, error) {
+func (c *Converter) fromSingleFile(
+	name string,
+	filters map[string]Filter,
+) ([]byte, error) {
 	/* Slurp the file. */
 	var (
 		b   []byte
@@ -200,9 +273,6 @@ func (c *Converter) fromSingleFile(name string) ([]byte, error) {
 	}
 
 	/* Convert it. */
-	c.filtersL.RLock()
-	filters := maps.Clone(c.filters)
-	c.filtersL.RUnlock()
 	res, err := c.fromReader(bytes.NewReader(b), name, filters)
 	if errors.Is(err, errNoConverter) { /* That's ok. */
 		res = b
@@ -213,7 +283,8 @@ func (c *Converter) fromSingleFile(name string) ([]byte, error) {
 	return res, err
 }
 
-// fromReader converts b using the first filter which matches fn.
+// fromReader converts b using the first filter which matches fn.  If any nil
+// filter matches fn, fn isn't converted.
 // The filters must be passed in explicitly, to avoid a race between AddFilter
 // and FromDirectory.
 func (c *Converter) fromReader(
@@ -238,10 +309,16 @@ func (c *Converter) fromReader(
 				err,
 			)
 		}
-		if ok {
+		if !ok {
+			continue
+		}
+		/* Disabled files stay disabled. */
+		if nil == filters[pattern] {
+			return nil, errNoConverter
+		}
+		if nil == f {
 			f = filters[pattern]
 			matchedPattern = pattern
-			break
 		}
 	}
 	if nil == f { /* No filter for this file, that's ok. */
@@ -276,11 +353,40 @@ func (c *Converter) fromReader(
 // names do not start with a period, adding newlines as needed.
 //
 // Filter patterns will be tried in lexicographical order.
+//
+// If c.Base is set, it's layered beneath directory sources, or converted on
+// its own and put first if there are no directory sources.
+//
+// If c.Config is set, it's read before any sources are converted.
 func (c *Converter) From(sources ...string) ([]byte, error) {
-	var buf bytes.Buffer
+	gen := c.startCacheGen()
+
+	/* Copy filters, to avoid races. */
+	c.filtersL.RLock()
+	filters := maps.Clone(c.filters)
+	c.filtersL.RUnlock()
+	if nil == filters {
+		filters = make(map[string]Filter)
+	}
+
+	/* Add in the config file, if we have one. */
+	if "" != c.Config {
+		if err := c.applyConfigFile(filters); nil != err {
+			return nil, fmt.Errorf(
+				"applying config from %s: %w",
+				c.Config,
+				err,
+			)
+		}
+	}
+
 	/* Convert ALL the sources. */
+	var (
+		sbuf   bytes.Buffer
+		sawDir bool
+	)
 	for _, source := range sources {
-		b, err := c.from(source)
+		b, isDir, err := c.from(source, filters)
 		if nil != err {
 			return nil, fmt.Errorf(
 				"converting %s: %w",
@@ -288,8 +394,20 @@ func (c *Converter) From(sources ...string) ([]byte, error) {
 				err,
 			)
 		}
+		sawDir = sawDir || isDir
+		sbuf.Write(b)
+	}
+
+	/* If Base wasn't layered beneath a directory, it goes first. */
+	var buf bytes.Buffer
+	if nil != c.Base && !sawDir {
+		b, err := c.fromFS(c.Base, ".", "", filters)
+		if nil != err {
+			return nil, fmt.Errorf("converting base: %w", err)
+		}
 		buf.Write(b)
 	}
+	buf.Write(sbuf.Bytes())
 
 	/* Add a list if we're meant to. */
 	if c.AddListFunction {
@@ -304,43 +422,72 @@ func (c *Converter) From(sources ...string) ([]byte, error) {
 		buf.Write(lf)
 	}
 
+	/* Anything we didn't use this time is probably stale. */
+	c.pruneCache(gen)
+
 	return buf.Bytes(), nil
 }
 
-// from does what From says it does, but for only once source and doesn't
-// add the list function.
-func (c *Converter) from(source string) ([]byte, error) {
-	/* If this is a single file, life's easy. */
+// applyConfigFile reads c.Config and adds its filters to filters.
+func (c *Converter) applyConfigFile(filters map[string]Filter) error {
 	var (
-		fi  fs.FileInfo
 		b   []byte
+		dir string
 		err error
 	)
+	if nil == c.FS {
+		b, err = os.ReadFile(c.Config)
+		dir = filepath.Dir(c.Config)
+	} else {
+		b, err = fs.ReadFile(c.FS, c.Config)
+	}
+	if nil != err {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	return c.applyConfig(filters, b, dir)
+}
+
+// from does what From says it does, but for only once source and doesn't
+// add the list function or a lone Base.  isDir is true if source is a
+// directory.
+func (c *Converter) from(
+	source string,
+	filters map[string]Filter,
+) (b []byte, isDir bool, err error) {
+	/* If this is a single file, life's easy. */
+	var fi fs.FileInfo
 	if nil == c.FS {
 		fi, err = os.Stat(source)
 	} else {
 		fi, err = fs.Stat(c.FS, source)
 	}
 	if nil != err {
-		return nil, fmt.Errorf("unable to get file info: %w", err)
+		return nil, false, fmt.Errorf(
+			"unable to get file info: %w",
+			err,
+		)
 	}
 	switch {
 	case fi.IsDir():
-		if b, err = c.fromDirectory(source); nil != err {
-			return nil, fmt.Errorf(
+		if b, err = c.fromDirectory(source, filters); nil != err {
+			return nil, true, fmt.Errorf(
 				"converting files in directory: %w",
 				err,
 			)
 		}
+		return b, true, nil
 	case fi.Mode().IsRegular():
-		if b, err = c.fromSingleFile(source); nil != err {
-			return nil, fmt.Errorf("converting file: %w", err)
+		if b, err = c.fromSingleFile(source, filters); nil != err {
+			return nil, false, fmt.Errorf(
+				"converting file: %w",
+				err,
+			)
 		}
 	default:
-		return nil, InvalidTypeError{FI: fi}
+		return nil, false, InvalidTypeError{FI: fi}
 	}
 
-	return b, nil
+	return b, false, nil
 }
 
 // InvalidTypeError is returned from Converter.From when the source is neither
@@ -5,7 +5,7 @@ package shellfuncsfile
  * Turn a file or directory into shell functions
  * By J. Stuart McMurray
  * Created 20240706
- * Last Modified 20240731
+ * Last Modified 20261016
  */
 
 import (
@@ -16,6 +16,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 //go:embed testdata
@@ -169,3 +170,69 @@ func mustReadTestdataFile(t *testing.T, fn string) []byte {
 	}
 	return b
 }
+
+func TestConverterFrom_Base(t *testing.T) {
+	base := fstest.MapFS{
+		"a.sh": {
+			Data: []byte("# TABDOC: a Base a\na() { :; }\n"),
+		},
+		"b.sh": {
+			Data: []byte("# TABDOC: b Base b\nb() { :; }\n"),
+		},
+		"ignored.txt": {Data: []byte("not a function\n")},
+		DirConfigName: {Data: []byte("*.txt none\n")},
+	}
+	src := fstest.MapFS{
+		"d/b.sh": {
+			Data: []byte("# TABDOC: b Source b\nb() { :; }\n"),
+		},
+		"d/c.sh": {Data: []byte("c() { :; }\n")},
+	}
+	for _, c := range []struct {
+		name    string
+		sources []string
+		want    string
+	}{{
+		name: "base_only",
+		want: "# TABDOC: a Base a\na() { :; }\n" +
+			"# TABDOC: b Base b\nb() { :; }\n",
+	}, {
+		name:    "layered",
+		sources: []string{"d"},
+		want: "# TABDOC: a Base a\na() { :; }\n" +
+			"# TABDOC: b Source b\nb() { :; }\n" +
+			"c() { :; }\n",
+	}, {
+		name:    "single_file",
+		sources: []string{"d/b.sh"},
+		want: "# TABDOC: a Base a\na() { :; }\n" +
+			"# TABDOC: b Base b\nb() { :; }\n" +
+			"# TABDOC: b Source b\nb() { :; }\n",
+	}, {
+		name:    "file_and_directory",
+		sources: []string{"d/c.sh", "d"},
+		want: "c() { :; }\n" +
+			"# TABDOC: a Base a\na() { :; }\n" +
+			"# TABDOC: b Source b\nb() { :; }\n" +
+			"c() { :; }\n",
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			conv := NewDefaultConverter()
+			conv.FS = src
+			conv.Base = base
+			b, err := conv.From(c.sources...)
+			if nil != err {
+				t.Fatalf("Error: %s", err)
+			}
+			if got := string(b); got != c.want {
+				t.Errorf(
+					"Incorrect output:\n"+
+						"got:\n%s\n"+
+						"want:\n%s",
+					got,
+					c.want,
+				)
+			}
+		})
+	}
+}
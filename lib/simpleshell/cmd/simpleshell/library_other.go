@@ -0,0 +1,38 @@
+//go:build !linux || !cgo
+
+package main
+
+/*
+ * library_other.go
+ * Run a shell when loaded as a library
+ * By J. Stuart McMurray
+ * Created 20241012
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"os"
+	"runtime/debug"
+)
+
+// ctorBuildMode is the -buildmode value which causes init() to run a shell.
+const ctorBuildMode = "c-shared"
+
+func init() {
+	/* Figure out if we're in a shared object file.  If so, we'll use
+	this constructor function to run our shell.  Detaching needs cgo
+	and Linux, so it's always a goroutine. */
+	bi, ok := debug.ReadBuildInfo()
+	if !ok { /* No way to know if we're a library, so give up :( */
+		return
+	}
+	/* If we seem to be in a library, spawn a shell. */
+	for _, s := range bi.Settings {
+		if "-buildmode" == s.Key && ctorBuildMode == s.Value {
+			os.Unsetenv("LD_PRELOAD")
+			go shell(context.Background(), "", "", nil)
+			return
+		}
+	}
+}
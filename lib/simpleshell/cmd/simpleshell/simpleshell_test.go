@@ -0,0 +1,108 @@
+package main
+
+/*
+ * simpleshell_test.go
+ * Tests for simpleshell.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRanges(t *testing.T) {
+	for _, c := range []struct {
+		have    string
+		parse   func(string) (int, error)
+		n       int
+		want    []int
+		wantErr bool
+	}{{
+		have:  "",
+		parse: strconv.Atoi,
+		n:     24,
+	}, {
+		have:  "9-12, 14,16",
+		parse: strconv.Atoi,
+		n:     24,
+		want:  []int{9, 10, 11, 12, 14, 16},
+	}, {
+		have:  "22-1",
+		parse: strconv.Atoi,
+		n:     24,
+		want:  []int{22, 23, 0, 1},
+	}, {
+		have:    "20-24",
+		parse:   strconv.Atoi,
+		n:       24,
+		wantErr: true,
+	}, {
+		have:  "mon-fri",
+		parse: parseWeekday,
+		n:     7,
+		want:  []int{1, 2, 3, 4, 5},
+	}, {
+		have:  "Saturday,Sun",
+		parse: parseWeekday,
+		n:     7,
+		want:  []int{6, 0},
+	}, {
+		have:    "Mo",
+		parse:   parseWeekday,
+		n:       7,
+		wantErr: true,
+	}} {
+		t.Run(c.have, func(t *testing.T) {
+			got, err := parseRanges(c.have, c.n, c.parse)
+			if c.wantErr {
+				if nil == err {
+					t.Errorf("No error, got %v", got)
+				}
+				return
+			} else if nil != err {
+				t.Fatalf("Error: %s", err)
+			}
+			if !slices.Equal(got, c.want) {
+				t.Errorf(
+					"Incorrect list:\n got: %v\nwant: %v",
+					got,
+					c.want,
+				)
+			}
+		})
+	}
+}
+
+func TestParseKillDate(t *testing.T) {
+	for _, c := range []struct {
+		have string
+		want time.Time
+	}{{
+		have: "",
+	}, {
+		have: "2026-10-16",
+		want: time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local),
+	}, {
+		have: "2026-10-16T14:30:00Z",
+		want: time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC),
+	}} {
+		t.Run(c.have, func(t *testing.T) {
+			got, err := parseKillDate(c.have)
+			if nil != err {
+				t.Fatalf("Error: %s", err)
+			}
+			if !got.Equal(c.want) {
+				t.Errorf(
+					"Incorrect time:\n got: %s\nwant: %s",
+					got,
+					c.want,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+/*
+ * loader.c
+ * Load a library, for testing
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+#include <dlfcn.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+int
+main(int argc, char **argv)
+{
+	if (2 > argc) {
+		fprintf(stderr, "Usage: %s library [seconds]\n", argv[0]);
+		return 1;
+	}
+
+	/* Load the library and tell everybody. */
+	if (NULL == dlopen(argv[1], RTLD_NOW)) {
+		fprintf(stderr, "dlopen: %s\n", dlerror());
+		return 2;
+	}
+	printf("loaded\n");
+	fflush(stdout);
+
+	/* Hang around, if we're meant to. */
+	if (3 <= argc)
+		sleep(atoi(argv[2]));
+
+	return 0;
+}
@@ -0,0 +1,349 @@
+package main
+
+/*
+ * implant.go
+ * Simulated simpleshells
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+// Shell kinds, for -shell.
+const (
+	KindEcho     = "echo"
+	KindReplay   = "replay"
+	KindScripted = "scripted"
+	KindMix      = "mix"
+)
+
+// implantConfig configures simulated implants.
+type implantConfig struct {
+	conn       simpleshell.ConnConfig
+	kind       string                    /* -shell */
+	recording  []simpleshell.ReplayEvent /* For KindReplay. */
+	split      float64                   /* Fraction using /i and /o. */
+	lifetime   time.Duration             /* Mean time before we hang up. */
+	backoff    time.Duration             /* Mean wait between tries. */
+	slow       float64                   /* Fraction reading slowly. */
+	slowRate   int                       /* Slow reader bytes/second. */
+	burst      []byte                    /* Big output. */
+	burstEvery time.Duration             /* Mean time between bursts. */
+	noFraming  bool
+}
+
+// runImplant connects a simulated implant over and over until ctx is done.
+func runImplant(ctx context.Context, conf implantConfig, st *stats) {
+	for nil == ctx.Err() {
+		connectOnce(ctx, conf, st)
+		sleep(ctx, expRand(conf.backoff))
+	}
+}
+
+// connectOnce connects a simulated implant once and records how it went.
+func connectOnce(ctx context.Context, conf implantConfig, st *stats) {
+	/* Work out how we'll connect this time. */
+	cc := conf.conn
+	cc.Mode = simpleshell.ModeDuplex
+	if rand.Float64() < conf.split {
+		cc.Mode = simpleshell.ModeSplit
+	}
+	var slowRate int
+	if rand.Float64() < conf.slow {
+		slowRate = conf.slowRate
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if 0 != conf.lifetime {
+		cctx, cancel = context.WithTimeout(cctx, expRand(conf.lifetime))
+		defer cancel()
+	}
+
+	/* Roll a shell. */
+	ss := newSoakShell(
+		newInnerShell(conf),
+		st,
+		slowRate,
+		conf.burst,
+		conf.burstEvery,
+	)
+	var shell simpleshell.Shell = ss
+	if !conf.noFraming {
+		shell = simpleshell.NewFramedShell(shell)
+	}
+
+	/* Connect and note what happened.  We don't count being told to
+	stop. */
+	err := simpleshell.Go(cctx, cc, shell)
+	switch {
+	case nil != ctx.Err():
+	case nil != cctx.Err():
+		st.ended(ss.connected(), false, nil)
+	default:
+		st.ended(ss.connected(), true, err)
+	}
+}
+
+// newInnerShell returns the sort of shell requested in conf.
+func newInnerShell(conf implantConfig) simpleshell.Shell {
+	kind := conf.kind
+	if KindMix == kind {
+		kinds := []string{KindEcho, KindScripted}
+		if 0 != len(conf.recording) {
+			kinds = append(kinds, KindReplay)
+		}
+		kind = kinds[rand.IntN(len(kinds))]
+	}
+	switch kind {
+	case KindReplay:
+		return simpleshell.NewReplayShell(conf.recording)
+	case KindScripted:
+		return newScriptedShell(conf.burst)
+	default:
+		_, _, shell := simpleshell.NewEchoShell()
+		return shell
+	}
+}
+
+// newScriptedShell returns a FuncShell with a few commands handy for poking
+// at Curlrevshell by hand.
+func newScriptedShell(burst []byte) *simpleshell.FuncShell {
+	fs := simpleshell.NewFuncShell(map[string]simpleshell.ShellFunc{
+		"echo": func(args []string, _ io.Reader, w io.Writer) error {
+			_, err := fmt.Fprintln(w, args)
+			return err
+		},
+		"burst": func(args []string, _ io.Reader, w io.Writer) error {
+			n := len(burst)
+			if 0 != len(args) {
+				var err error
+				if n, err = strconv.Atoi(args[0]); nil != err {
+					return err
+				}
+			}
+			_, err := w.Write(makeBurst(n))
+			return err
+		},
+		"sleep": func(args []string, _ io.Reader, _ io.Writer) error {
+			if 0 == len(args) {
+				return errors.New("need a duration")
+			}
+			d, err := time.ParseDuration(args[0])
+			if nil != err {
+				return err
+			}
+			time.Sleep(d)
+			return nil
+		},
+	})
+	fs.Help = map[string]string{
+		"echo":  "Print the arguments",
+		"burst": "Send a lot of output, optionally with a size",
+		"sleep": "Wait for a duration",
+	}
+	fs.Prompt = "soak$ "
+	return fs
+}
+
+// soakShell wraps another Shell to read its input slowly, send bursts of
+// output, and record stats.  Its inner shell is stopped when its input is
+// finished, as that means it's been disconnected.
+type soakShell struct {
+	inner      simpleshell.Shell
+	st         *stats
+	slowRate   int
+	burst      []byte
+	burstEvery time.Duration
+
+	start time.Time
+	first sync.Once
+	conn  chan struct{} /* Closed on first output read. */
+
+	in   io.Reader
+	outr *io.PipeReader
+	outw *io.PipeWriter
+}
+
+// newSoakShell returns a new soakShell wrapping inner.  If slowRate is
+// nonzero, input will be read at about slowRate bytes per second.  If
+// burstEvery is nonzero, burst will be sent after random intervals averaging
+// burstEvery.
+func newSoakShell(
+	inner simpleshell.Shell,
+	st *stats,
+	slowRate int,
+	burst []byte,
+	burstEvery time.Duration,
+) *soakShell {
+	pr, pw := io.Pipe()
+	return &soakShell{
+		inner:      inner,
+		st:         st,
+		slowRate:   slowRate,
+		burst:      burst,
+		burstEvery: burstEvery,
+		start:      time.Now(),
+		conn:       make(chan struct{}),
+		outr:       pr,
+		outw:       pw,
+	}
+}
+
+// SetInput sets s's input.
+func (s *soakShell) SetInput(in io.Reader) { s.in = in }
+
+// Output returns s's output, which is timed.
+func (s *soakShell) Output() io.ReadCloser { return soakOutput{s} }
+
+// String returns "soak shell".
+func (s *soakShell) String() string { return "soak shell" }
+
+// connected returns true if s's output was read, which happens after
+// connecting to Curlrevshell.
+func (s *soakShell) connected() bool {
+	select {
+	case <-s.conn:
+		return true
+	default:
+		return false
+	}
+}
+
+// Go runs the inner shell, proxies its output, and sends bursts.
+func (s *soakShell) Go(ctx context.Context) error {
+	/* Stop the inner shell when input's finished. */
+	ictx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.inner.SetInput(&soakInput{
+		r:      s.in,
+		rate:   s.slowRate,
+		st:     s.st,
+		cancel: cancel,
+	})
+
+	/* Proxy output from the inner shell, and send bursts.  Once we're
+	disconnected, nobody's listening, so writes shouldn't block. */
+	var (
+		wg       sync.WaitGroup
+		bctx, bc = context.WithCancel(ictx)
+		out      = s.inner.Output()
+	)
+	defer bc()
+	defer context.AfterFunc(ictx, func() { s.outw.Close() })()
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(s, out); nil != err {
+			out.Close()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		s.sendBursts(bctx)
+	}()
+	err := s.inner.Go(ictx)
+
+	/* Let the last of the output through. */
+	bc()
+	wg.Wait()
+	s.outw.CloseWithError(err)
+	return err
+}
+
+// Write writes b to s's output, and records how long it took.
+func (s *soakShell) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := s.outw.Write(b)
+	s.st.wrote(n, time.Since(start))
+	return n, err
+}
+
+// sendBursts sends s.burst every so often until ctx is done.
+func (s *soakShell) sendBursts(ctx context.Context) {
+	if 0 == s.burstEvery || 0 == len(s.burst) {
+		return
+	}
+	for sleep(ctx, expRand(s.burstEvery)) {
+		if _, err := s.Write(s.burst); nil != err {
+			return
+		}
+	}
+}
+
+// soakOutput is a soakShell's output.  It notes the first read.
+type soakOutput struct{ s *soakShell }
+
+// Read reads from o's soakShell's output.
+func (o soakOutput) Read(b []byte) (int, error) {
+	o.s.first.Do(func() {
+		o.s.st.connectedAfter(time.Since(o.s.start))
+		close(o.s.conn)
+	})
+	return o.s.outr.Read(b)
+}
+
+// Close closes o's soakShell's output.
+func (o soakOutput) Close() error { return o.s.outr.Close() }
+
+// soakInput is a soakShell's input.  It counts bytes, optionally reads
+// slowly, and calls cancel when reading fails.
+type soakInput struct {
+	r      io.Reader
+	rate   int
+	st     *stats
+	cancel func()
+}
+
+// Read reads from i's reader, at most rate/10 bytes every tenth of a second if
+// rate is set.
+func (i *soakInput) Read(b []byte) (int, error) {
+	if 0 != i.rate {
+		b = b[:min(len(b), max(i.rate/10, 1))]
+		time.Sleep(time.Second / 10)
+	}
+	n, err := i.r.Read(b)
+	i.st.read(n)
+	if nil != err {
+		i.cancel()
+	}
+	return n, err
+}
+
+// makeBurst makes n bytes of output, in 80-byte lines.
+func makeBurst(n int) []byte {
+	line := []byte(
+		"0123456789abcdefghijklmnopqrstuvwxyz" +
+			"ABCDEFGHIJKLMNOPQRSTUVWXYZ-=+_)(*&^%$#@!\n",
+	)
+	return bytes.Repeat(line, n/len(line)+1)[:n]
+}
+
+// expRand returns a random duration, exponentially distributed with mean d.
+func expRand(d time.Duration) time.Duration {
+	return time.Duration(rand.ExpFloat64() * float64(d))
+}
+
+// sleep sleeps for d, or until ctx is done.  It returns false if ctx is done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
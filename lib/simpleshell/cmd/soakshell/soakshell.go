@@ -0,0 +1,235 @@
+// Program soakshell - Load and soak test Curlrevshell with simulated implants
+package main
+
+/*
+ * soakshell.go
+ * Load and soak test Curlrevshell with simulated implants
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/lib/simpleshell"
+)
+
+func main() { os.Exit(rmain()) }
+
+func rmain() int {
+	/* Command-line flags. */
+	var (
+		c2 = flag.String(
+			"c2",
+			"https://127.0.0.1:4444/io",
+			"Curlrevshell's `URL`",
+		)
+		fingerprint = flag.String(
+			"fingerprint",
+			"",
+			"Curlrevshell's TLS `fingerprint`",
+		)
+		nImplants = flag.Uint(
+			"implants",
+			10,
+			"Simulated implant `count`",
+		)
+		duration = flag.Duration(
+			"duration",
+			0,
+			"Test `duration`, or 0 to run until interrupted",
+		)
+		kind = flag.String(
+			"shell",
+			KindMix,
+			"Simulated shell `kind` (echo, replay, scripted, mix)",
+		)
+		recording = flag.String(
+			"recording",
+			"",
+			"Recorded session `file` for replay shells",
+		)
+		split = flag.Float64(
+			"split",
+			0.5,
+			"Use /i and /o instead of /io for this `fraction` "+
+				"of connections",
+		)
+		lifetime = flag.Duration(
+			"lifetime",
+			30*time.Second,
+			"Mean connection `lifetime` before a random "+
+				"disconnect, or 0 to never disconnect",
+		)
+		backoff = flag.Duration(
+			"backoff",
+			time.Second,
+			"Mean `wait` between connections",
+		)
+		slow = flag.Float64(
+			"slow",
+			0.1,
+			"Read input slowly for this `fraction` of connections",
+		)
+		slowRate = flag.Int(
+			"slow-rate",
+			64,
+			"Slow readers' `bytes` per second",
+		)
+		burstSize = flag.Int(
+			"burst-size",
+			1024*1024,
+			"Output burst size in `bytes`",
+		)
+		burstEvery = flag.Duration(
+			"burst-every",
+			10*time.Second,
+			"Mean `interval` between output bursts, or 0 for none",
+		)
+		reportEvery = flag.Duration(
+			"report-every",
+			10*time.Second,
+			"Report `interval`",
+		)
+		debugURL = flag.String(
+			"debug-url",
+			"",
+			"Optional `URL` of Curlrevshell's -debug-address, "+
+				"e.g. http://127.0.0.1:6060",
+		)
+		logFile = flag.String(
+			"log",
+			"",
+			"Optional Curlrevshell -log `file` to watch for errors",
+		)
+		noFraming = flag.Bool(
+			"no-framing",
+			false,
+			"Don't send stderr and exit status separately",
+		)
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: %s [options]
+
+Starts simulated simpleshells which connect to Curlrevshell over and over,
+with a mix of /io and /i+/o connections, random disconnects, slow readers, and
+bursts of output, and reports how it's going.  With -debug-url, Curlrevshell's
+goroutines and memory are reported as well.
+
+Options:
+`,
+			os.Args[0],
+		)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	/* Work out our implants' config. */
+	conf := implantConfig{
+		conn: simpleshell.ConnConfig{
+			C2:          *c2,
+			Fingerprint: *fingerprint,
+		},
+		kind:       *kind,
+		split:      *split,
+		lifetime:   *lifetime,
+		backoff:    *backoff,
+		slow:       *slow,
+		slowRate:   *slowRate,
+		burst:      makeBurst(*burstSize),
+		burstEvery: *burstEvery,
+		noFraming:  *noFraming,
+	}
+	switch *kind {
+	case KindEcho, KindScripted, KindMix:
+	case KindReplay:
+		if "" == *recording {
+			log.Printf("Need -recording for replay shells")
+			return 1
+		}
+	default:
+		log.Printf("Unknown shell kind %q", *kind)
+		return 1
+	}
+	if "" != *recording {
+		f, err := os.Open(*recording)
+		if nil != err {
+			log.Printf("Error opening recording: %s", err)
+			return 1
+		}
+		conf.recording, err = simpleshell.ParseRecording(f)
+		f.Close()
+		if nil != err {
+			log.Printf("Error parsing recording: %s", err)
+			return 1
+		}
+	}
+
+	/* Run until we're told to stop or time's up. */
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if 0 != *duration {
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	/* Start ALL the things.  We get the server's stats before starting
+	implants, to have a baseline. */
+	var (
+		st = newStats()
+		wg sync.WaitGroup
+	)
+	pollServer := func(ctx context.Context) {
+		if "" == *debugURL {
+			return
+		}
+		st.polled(getServerStats(
+			ctx,
+			strings.TrimSuffix(*debugURL, "/")+"/debug/vars",
+		))
+	}
+	pollServer(ctx)
+	if "" != *logFile {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tailLog(ctx, *logFile, st); nil != err {
+				log.Printf("Error watching log: %s", err)
+			}
+		}()
+	}
+	for range *nImplants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runImplant(ctx, conf, st)
+		}()
+	}
+	log.Printf("Started %d simulated implants", *nImplants)
+
+	/* Report every so often. */
+	last := time.Now()
+	for sleep(ctx, *reportEvery) {
+		pollServer(ctx)
+		st.report(os.Stdout, time.Since(last))
+		last = time.Now()
+	}
+	wg.Wait()
+
+	/* One last report, with the server's final state. */
+	pollServer(context.Background())
+	st.report(os.Stdout, time.Since(last))
+
+	return 0
+}
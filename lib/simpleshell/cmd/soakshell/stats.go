@@ -0,0 +1,354 @@
+package main
+
+/*
+ * stats.go
+ * Keep track of how things are going
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxSamples is the most latency samples we keep between reports.
+const maxSamples = 100000
+
+// stats holds what's happened since the last report, as well as running
+// totals.
+type stats struct {
+	mu sync.Mutex
+
+	/* Since the last report. */
+	connLat  []time.Duration
+	writeLat []time.Duration
+	outBytes int64
+	inBytes  int64
+
+	/* Since the start. */
+	start        time.Time
+	attempts     int
+	connected    int
+	serverEnded  int
+	clientEnded  int
+	errs         map[string]int
+	outTotal     int64
+	inTotal      int64
+	maxConnLat   time.Duration
+	maxWriteLat  time.Duration
+	rejections   map[string]int /* From Curlrevshell's log. */
+	firstServer  serverStats
+	lastServer   serverStats
+	serverErr    error
+	serverPolled bool
+}
+
+// newStats returns a new stats, ready for use.
+func newStats() *stats {
+	return &stats{
+		start:      time.Now(),
+		errs:       make(map[string]int),
+		rejections: make(map[string]int),
+	}
+}
+
+// connectedAfter notes a connection was made after d.
+func (s *stats) connectedAfter(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.connLat) < maxSamples {
+		s.connLat = append(s.connLat, d)
+	}
+	s.maxConnLat = max(s.maxConnLat, d)
+}
+
+// ended notes a connection attempt ended.  connected is true if output was
+// read, byServer is true if we didn't hang up first, and err is what
+// simpleshell.Go returned.
+func (s *stats) ended(connected, byServer bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	switch {
+	case nil != err:
+		s.errs[err.Error()]++
+	case byServer:
+		s.serverEnded++
+	default:
+		s.clientEnded++
+	}
+	if connected {
+		s.connected++
+	}
+}
+
+// wrote notes n bytes of output were written, which took d.
+func (s *stats) wrote(n int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outBytes += int64(n)
+	s.outTotal += int64(n)
+	if len(s.writeLat) < maxSamples {
+		s.writeLat = append(s.writeLat, d)
+	}
+	s.maxWriteLat = max(s.maxWriteLat, d)
+}
+
+// read notes n bytes of input were read.
+func (s *stats) read(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inBytes += int64(n)
+	s.inTotal += int64(n)
+}
+
+// rejected notes Curlrevshell logged an error with the message msg.
+func (s *stats) rejected(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejections[msg]++
+}
+
+// polled notes the result of asking Curlrevshell how it's doing.
+func (s *stats) polled(ss serverStats, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serverErr = err
+	if nil != err {
+		return
+	}
+	if !s.serverPolled {
+		s.firstServer = ss
+		s.serverPolled = true
+	}
+	s.lastServer = ss
+}
+
+// report writes a report to w and resets the since-the-last-report stats.
+// interval is the time since the last report.
+func (s *stats) report(w io.Writer, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := time.Since(s.start).Round(time.Second)
+
+	fmt.Fprintf(
+		w,
+		"[%s] connections: %d attempts, %d connected, "+
+			"%d ended by server, %d ended by us, %d errors\n",
+		elapsed,
+		s.attempts,
+		s.connected,
+		s.serverEnded,
+		s.clientEnded,
+		sumValues(s.errs),
+	)
+	fmt.Fprintf(
+		w,
+		"[%s] connect latency: %s, max %s\n",
+		elapsed,
+		percentiles(s.connLat),
+		s.maxConnLat,
+	)
+	fmt.Fprintf(
+		w,
+		"[%s] output write latency: %s, max %s\n",
+		elapsed,
+		percentiles(s.writeLat),
+		s.maxWriteLat,
+	)
+	fmt.Fprintf(
+		w,
+		"[%s] throughput: out %s/s (%s total), in %s/s (%s total)\n",
+		elapsed,
+		byteSize(perSecond(s.outBytes, interval)),
+		byteSize(s.outTotal),
+		byteSize(perSecond(s.inBytes, interval)),
+		byteSize(s.inTotal),
+	)
+	for _, k := range slices.Sorted(maps.Keys(s.errs)) {
+		fmt.Fprintf(w, "[%s] error: %s: %d\n", elapsed, k, s.errs[k])
+	}
+	for _, k := range slices.Sorted(maps.Keys(s.rejections)) {
+		fmt.Fprintf(
+			w,
+			"[%s] server logged: %s: %d\n",
+			elapsed,
+			k,
+			s.rejections[k],
+		)
+	}
+	switch {
+	case nil != s.serverErr:
+		fmt.Fprintf(w, "[%s] server: %s\n", elapsed, s.serverErr)
+	case s.serverPolled:
+		f, l := s.firstServer, s.lastServer
+		fmt.Fprintf(
+			w,
+			"[%s] server: %d goroutines (%+d), %s heap (%+s), "+
+				"%s sys (%+s), %d GCs\n",
+			elapsed,
+			l.Goroutines,
+			l.Goroutines-f.Goroutines,
+			byteSize(l.MemStats.HeapAlloc),
+			byteSize(int64(l.MemStats.HeapAlloc)-
+				int64(f.MemStats.HeapAlloc)),
+			byteSize(l.MemStats.Sys),
+			byteSize(int64(l.MemStats.Sys)-int64(f.MemStats.Sys)),
+			l.MemStats.NumGC,
+		)
+	}
+
+	/* Start the next interval afresh. */
+	s.connLat = s.connLat[:0]
+	s.writeLat = s.writeLat[:0]
+	s.outBytes = 0
+	s.inBytes = 0
+}
+
+// serverStats is what we get from Curlrevshell's -debug-address.
+type serverStats struct {
+	Goroutines int `json:"goroutines"`
+	MemStats   struct {
+		HeapAlloc uint64
+		Sys       uint64
+		NumGC     uint32
+	} `json:"memstats"`
+}
+
+// getServerStats gets stats from the expvar endpoint at u.
+func getServerStats(ctx context.Context, u string) (serverStats, error) {
+	var ss serverStats
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if nil != err {
+		return ss, fmt.Errorf("preparing request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if nil != err {
+		return ss, fmt.Errorf("requesting stats: %w", err)
+	}
+	defer res.Body.Close()
+	if http.StatusOK != res.StatusCode {
+		return ss, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&ss); nil != err {
+		return ss, fmt.Errorf("decoding stats: %w", err)
+	}
+	return ss, nil
+}
+
+// tailLog follows Curlrevshell's JSON log in the file named fn, starting at
+// its end, and notes the messages of errors until ctx is done.
+func tailLog(ctx context.Context, fn string, st *stats) error {
+	f, err := os.Open(fn)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekEnd); nil != err {
+		return fmt.Errorf("seeking to end: %w", err)
+	}
+	br := bufio.NewReader(f)
+	var partial string
+	for {
+		l, err := br.ReadString('\n')
+		partial += l
+		if nil == err {
+			countRejection(partial, st)
+			partial = ""
+			continue
+		} else if io.EOF != err {
+			return fmt.Errorf("reading: %w", err)
+		}
+		/* Wait for more log. */
+		if !sleep(ctx, time.Second) {
+			return nil
+		}
+	}
+}
+
+// countRejection notes the message in the JSON log line l if l is an error.
+func countRejection(l string, st *stats) {
+	var rec struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}
+	if err := json.Unmarshal([]byte(l), &rec); nil != err ||
+		"ERROR" != rec.Level {
+		return
+	}
+	st.rejected(rec.Msg)
+}
+
+// percentiles returns a string with the 50th, 90th, and 99th percentiles of
+// ds, which will be sorted.
+func percentiles(ds []time.Duration) string {
+	if 0 == len(ds) {
+		return "no samples"
+	}
+	slices.Sort(ds)
+	p := func(n int) time.Duration {
+		return ds[min(len(ds)-1, len(ds)*n/100)]
+	}
+	return fmt.Sprintf(
+		"p50 %s, p90 %s, p99 %s (%d samples)",
+		p(50),
+		p(90),
+		p(99),
+		len(ds),
+	)
+}
+
+// byteSize is a number of bytes which prints nicely.
+type byteSize int64
+
+// Format implements fmt.Formatter.  The + flag is honored.
+func (b byteSize) Format(f fmt.State, verb rune) {
+	var sign string
+	switch {
+	case 0 > b:
+		sign = "-"
+		b = -b
+	case f.Flag('+'):
+		sign = "+"
+	}
+	n, unit := float64(b), "B"
+	for _, u := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		if 1024 > n {
+			break
+		}
+		n, unit = n/1024, u
+	}
+	if "B" == unit {
+		fmt.Fprintf(f, "%s%d%s", sign, int64(b), unit)
+		return
+	}
+	fmt.Fprintf(f, "%s%.1f%s", sign, n, unit)
+}
+
+// perSecond returns n divided by d's seconds.
+func perSecond(n int64, d time.Duration) int64 {
+	if 0 >= d {
+		return 0
+	}
+	return int64(float64(n) / d.Seconds())
+}
+
+// sumValues returns the sum of m's values.
+func sumValues(m map[string]int) int {
+	var n int
+	for _, v := range m {
+		n += v
+	}
+	return n
+}
@@ -0,0 +1,114 @@
+package main
+
+/*
+ * stats_test.go
+ * Tests for stats.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPercentiles(t *testing.T) {
+	for _, c := range []struct {
+		have []time.Duration
+		want string
+	}{{
+		want: "no samples",
+	}, {
+		have: []time.Duration{time.Second},
+		want: "p50 1s, p90 1s, p99 1s (1 samples)",
+	}, {
+		have: func() []time.Duration {
+			ds := make([]time.Duration, 100)
+			for i := range ds {
+				ds[len(ds)-1-i] = time.Duration(i) * time.Second
+			}
+			return ds
+		}(),
+		want: "p50 50s, p90 1m30s, p99 1m39s (100 samples)",
+	}} {
+		if got := percentiles(c.have); got != c.want {
+			t.Errorf(
+				"Incorrect percentiles:\n"+
+					"have: %s\n"+
+					" got: %s\n"+
+					"want: %s",
+				c.have,
+				got,
+				c.want,
+			)
+		}
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	for _, c := range []struct {
+		have   byteSize
+		format string
+		want   string
+	}{
+		{0, "%s", "0B"},
+		{1023, "%s", "1023B"},
+		{1024, "%s", "1.0KiB"},
+		{1536 * 1024, "%s", "1.5MiB"},
+		{-2048, "%s", "-2.0KiB"},
+		{2048, "%+s", "+2.0KiB"},
+		{-10, "%+s", "-10B"},
+		{0, "%+s", "+0B"},
+	} {
+		if got := fmt.Sprintf(c.format, c.have); got != c.want {
+			t.Errorf(
+				"Incorrect formatting:\n"+
+					"  have: %d\n"+
+					"format: %s\n"+
+					"   got: %s\n"+
+					"  want: %s",
+				int64(c.have),
+				c.format,
+				got,
+				c.want,
+			)
+		}
+	}
+}
+
+func TestCountRejection(t *testing.T) {
+	st := newStats()
+	for _, l := range []string{
+		`{"level":"ERROR","msg":"Connection already established"}`,
+		`{"level":"INFO","msg":"New shell"}`,
+		`{"level":"ERROR","msg":"Connection already established"}`,
+		`{"level":"ERROR","msg":"Incorrect key"}`,
+		`not json`,
+		``,
+	} {
+		countRejection(l, st)
+	}
+	want := map[string]int{
+		"Connection already established": 2,
+		"Incorrect key":                  1,
+	}
+	if len(st.rejections) != len(want) {
+		t.Errorf(
+			"Incorrect rejections:\n got: %v\nwant: %v",
+			st.rejections,
+			want,
+		)
+	}
+	for k, v := range want {
+		if got := st.rejections[k]; got != v {
+			t.Errorf(
+				"Incorrect count for %q:\n got: %d\nwant: %d",
+				k,
+				got,
+				v,
+			)
+		}
+	}
+}
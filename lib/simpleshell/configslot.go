@@ -0,0 +1,126 @@
+package simpleshell
+
+/*
+ * configslot.go
+ * Config patched into prebuilt binaries
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// ConfigSlotStart starts a config slot.
+	ConfigSlotStart = "\x00crs:config:"
+
+	// ConfigSlotEnd ends a config slot.
+	ConfigSlotEnd = ":config\x00"
+
+	// EmptyConfigSlot is a config slot with no config.  A binary which
+	// wants config patched in by PatchConfigSlots should hold a copy in
+	// a variable and read it with ParseConfigSlot.
+	EmptyConfigSlot = ConfigSlotStart + configSlotPadding + ConfigSlotEnd
+
+	// ConfigSlotLen is the size of a config slot, including
+	// ConfigSlotStart and ConfigSlotEnd.
+	ConfigSlotLen = len(EmptyConfigSlot)
+
+	// ConfigSlotMaxLen is the longest encoded config which fits in a
+	// config slot.
+	ConfigSlotMaxLen = len(configSlotPadding)
+)
+
+// Config slot keys, used by Simpleshell the program.
+const (
+	ConfigSlotArgs        = "args"
+	ConfigSlotC2          = "c2"
+	ConfigSlotFingerprint = "fingerprint"
+	ConfigSlotFraming     = "framing"
+)
+
+// configSlotPadding is the empty space in EmptyConfigSlot.  It's a constant
+// so EmptyConfigSlot is a single string in a compiled binary.
+const (
+	configSlotPadding = configSlotPad1K + configSlotPad1K
+	configSlotPad1K   = configSlotPad256 + configSlotPad256 +
+		configSlotPad256 + configSlotPad256
+	configSlotPad256 = configSlotPad64 + configSlotPad64 +
+		configSlotPad64 + configSlotPad64
+	configSlotPad64 = configSlotPad16 + configSlotPad16 +
+		configSlotPad16 + configSlotPad16
+	configSlotPad16 = "\x00\x00\x00\x00\x00\x00\x00\x00" +
+		"\x00\x00\x00\x00\x00\x00\x00\x00"
+)
+
+// ErrNoConfigSlot is returned by PatchConfigSlots if it can't find a config
+// slot.
+var ErrNoConfigSlot = errors.New("no config slot found")
+
+// ParseConfigSlot returns the config in slot, which should be
+// EmptyConfigSlot or a patched copy of it.
+func ParseConfigSlot(slot string) (url.Values, error) {
+	if ConfigSlotLen != len(slot) {
+		return nil, fmt.Errorf(
+			"slot is %d bytes, not %d",
+			len(slot),
+			ConfigSlotLen,
+		)
+	}
+	enc := strings.TrimRight(
+		slot[len(ConfigSlotStart):len(slot)-len(ConfigSlotEnd)],
+		"\x00",
+	)
+	return url.ParseQuery(enc)
+}
+
+// PatchConfigSlots returns a copy of b with every config slot holding conf.
+// Config slots already holding config are overwritten.  If there are no
+// config slots in b, PatchConfigSlots returns ErrNoConfigSlot.
+func PatchConfigSlots(b []byte, conf url.Values) ([]byte, error) {
+	/* Make the new slot. */
+	enc := conf.Encode()
+	if ConfigSlotMaxLen < len(enc) {
+		return nil, fmt.Errorf(
+			"config too big for slot: %d > %d",
+			len(enc),
+			ConfigSlotMaxLen,
+		)
+	}
+	slot := ConfigSlotStart + enc + configSlotPadding[len(enc):] +
+		ConfigSlotEnd
+
+	/* Find and patch ALL the slots.  The slot's start on its own might
+	be in b as well, so we make sure the end is in the right place. */
+	var (
+		ret   = bytes.Clone(b)
+		n     int
+		start = []byte(ConfigSlotStart)
+		end   = []byte(ConfigSlotEnd)
+	)
+	for i := 0; ; {
+		j := bytes.Index(ret[i:], start)
+		if -1 == j {
+			break
+		}
+		i += j
+		if len(ret)-i < ConfigSlotLen ||
+			!bytes.HasSuffix(ret[i:i+ConfigSlotLen], end) {
+			i++
+			continue
+		}
+		copy(ret[i:], slot)
+		i += ConfigSlotLen
+		n++
+	}
+	if 0 == n {
+		return nil, ErrNoConfigSlot
+	}
+	return ret, nil
+}
@@ -0,0 +1,106 @@
+package simpleshell
+
+/*
+ * configslot_test.go
+ * Tests for configslot.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigSlot(t *testing.T) {
+	got, err := ParseConfigSlot(EmptyConfigSlot)
+	if nil != err {
+		t.Fatalf("Error parsing empty slot: %s", err)
+	}
+	if 0 != len(got) {
+		t.Errorf("Empty slot not empty: %q", got)
+	}
+	if _, err := ParseConfigSlot(EmptyConfigSlot[1:]); nil == err {
+		t.Errorf("No error parsing short slot")
+	}
+}
+
+func TestPatchConfigSlots(t *testing.T) {
+	conf := url.Values{
+		ConfigSlotC2:          {"https://example.com/io"},
+		ConfigSlotFingerprint: {"kittens="},
+		ConfigSlotArgs:        {"|/bin/sh|-i"},
+	}
+	/* A lone ConfigSlotStart shouldn't be a problem, nor should an
+	already-patched slot. */
+	var (
+		before  = "\x7fELF" + ConfigSlotStart + "junk"
+		between = "moose"
+		after   = "more junk"
+		patched = strings.Replace(
+			EmptyConfigSlot,
+			strings.Repeat("\x00", 4),
+			"c2=x",
+			1,
+		)
+		have = []byte(before + EmptyConfigSlot + between + patched +
+			after)
+	)
+	got, err := PatchConfigSlots(have, conf)
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if EmptyConfigSlot != string(have[len(before):][:ConfigSlotLen]) {
+		t.Errorf("Original modified")
+	}
+
+	/* Everything but the slots should be the same. */
+	var (
+		s1 = len(before)
+		e1 = s1 + ConfigSlotLen
+		s2 = e1 + len(between)
+		e2 = s2 + ConfigSlotLen
+	)
+	if !bytes.Equal(got[:s1], have[:s1]) ||
+		!bytes.Equal(got[e1:s2], have[e1:s2]) ||
+		!bytes.Equal(got[e2:], have[e2:]) {
+		t.Errorf(
+			"Non-slot bytes changed:\n got: %q\nwant: %q",
+			got,
+			have,
+		)
+	}
+	for _, s := range []int{s1, s2} {
+		pc, err := ParseConfigSlot(string(got[s:][:ConfigSlotLen]))
+		if nil != err {
+			t.Errorf("Error parsing slot at %d: %s", s, err)
+		} else if !maps.EqualFunc(pc, conf, slices.Equal) {
+			t.Errorf(
+				"Incorrect config at %d:\n got: %q\nwant: %q",
+				s,
+				pc,
+				conf,
+			)
+		}
+	}
+}
+
+func TestPatchConfigSlots_Errors(t *testing.T) {
+	if _, err := PatchConfigSlots(
+		[]byte(EmptyConfigSlot[:ConfigSlotLen-1]),
+		nil,
+	); !errors.Is(err, ErrNoConfigSlot) {
+		t.Errorf("Incorrect error for no slot: %v", err)
+	}
+	if _, err := PatchConfigSlots([]byte(EmptyConfigSlot), url.Values{
+		ConfigSlotArgs: {strings.Repeat("x", ConfigSlotMaxLen)},
+	}); nil == err {
+		t.Errorf("No error for too-big config")
+	}
+}
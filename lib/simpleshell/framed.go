@@ -0,0 +1,258 @@
+package simpleshell
+
+/*
+ * framed.go
+ * Stdout, stderr, and exit status, separately
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// FramedHello follows TransferMarker when a FramedShell starts, to
+	// tell Curlrevshell the rest of the output is framed.  Each frame is
+	// a type byte (FrameStdout, FrameStderr, or FrameControl), a two-byte
+	// big-endian payload length, and the payload.
+	FramedHello = "framed"
+
+	// FrameHeaderLen is the length of a frame's type and length.
+	FrameHeaderLen = 3
+
+	// FrameMaxLen is the longest a frame's payload may be.
+	FrameMaxLen = 0xFFFF
+
+	// FrameStdout, FrameStderr, and FrameControl are the types of
+	// frames.  Control frames' payloads are one of the Control* messages,
+	// space-separated from its arguments.  Frames of unknown types should
+	// be ignored.
+	FrameStdout  byte = 'o'
+	FrameStderr  byte = 'e'
+	FrameControl byte = 'c'
+
+	// ControlExit is followed by the shell's exit code.
+	ControlExit = "exit"
+
+	// ControlSignal is followed by the name of the signal which killed
+	// the shell.
+	ControlSignal = "signal"
+
+	// ControlWindowSize is followed by the number of columns and rows in
+	// the shell's window.
+	ControlWindowSize = "winsize"
+
+	// ControlHeartbeat is sent every FramedShell.HeartbeatInterval, to
+	// keep anything in the middle from thinking the connection's idle.
+	ControlHeartbeat = "heartbeat"
+
+	// DefaultHeartbeatInterval is how often a FramedShell sends a
+	// heartbeat if FramedShell.HeartbeatInterval isn't set.
+	DefaultHeartbeatInterval = 30 * time.Second
+)
+
+// FramedShell wraps a Shell and sends its standard output and standard error
+// to Curlrevshell in separate frames, along with its exit status.  If the
+// wrapped Shell is a [StderrShell], its standard error is sent in
+// FrameStderr frames.  Input is passed to the wrapped Shell unchanged.
+type FramedShell struct {
+	// HeartbeatInterval is how often to send a heartbeat.  If unset,
+	// DefaultHeartbeatInterval is used.  If negative, no heartbeats are
+	// sent.
+	HeartbeatInterval time.Duration
+
+	shell Shell
+
+	outr *io.PipeReader
+	outw *io.PipeWriter
+	out  lockedWriter /* Wraps outw, a frame per write. */
+}
+
+// NewFramedShell returns a new FramedShell which wraps shell.
+func NewFramedShell(shell Shell) *FramedShell {
+	pr, pw := io.Pipe()
+	return &FramedShell{
+		shell: shell,
+		outr:  pr,
+		outw:  pw,
+		out:   lockedWriter{w: pw},
+	}
+}
+
+// SetInput sets the wrapped Shell's input.
+func (f *FramedShell) SetInput(in io.Reader) { f.shell.SetInput(in) }
+
+// Output returns an [io.Reader] on which f sends framed output.
+func (f *FramedShell) Output() io.ReadCloser { return f.outr }
+
+// String returns the wrapped Shell's name.
+func (f *FramedShell) String() string { return fmt.Sprint(f.shell) }
+
+// Go runs the wrapped Shell, framing its output and sending its exit status
+// when it's finished.
+func (f *FramedShell) Go(ctx context.Context) error {
+	/* Output sources, which must be had before the shell starts. */
+	var serr io.ReadCloser
+	if ss, ok := f.shell.(StderrShell); ok {
+		serr = ss.Stderr()
+	}
+
+	/* Let Curlrevshell know what's coming, and send the wrapped shell's
+	output.  If something goes wrong, we stop reading. */
+	var (
+		wg   sync.WaitGroup
+		oerr error
+		emu  sync.Mutex
+	)
+	frame := func(t byte, r io.ReadCloser) {
+		defer wg.Done()
+		_, err := io.Copy(frameWriter{w: &f.out, t: t}, r)
+		if nil == err {
+			return
+		}
+		r.Close()
+		emu.Lock()
+		defer emu.Unlock()
+		oerr = cmp.Or(oerr, err)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := io.WriteString(
+			&f.out,
+			TransferMarker+FramedHello+"\n",
+		); nil != err {
+			f.shell.Output().Close()
+			if nil != serr {
+				serr.Close()
+			}
+			emu.Lock()
+			defer emu.Unlock()
+			oerr = fmt.Errorf("sending hello: %w", err)
+			return
+		}
+		wg.Add(1)
+		go frame(FrameStdout, f.shell.Output())
+		if nil != serr {
+			wg.Add(1)
+			go frame(FrameStderr, serr)
+		}
+	}()
+
+	/* Heartbeat until the shell's done. */
+	hbDone := make(chan struct{})
+	if hbi := cmp.Or(
+		f.HeartbeatInterval,
+		DefaultHeartbeatInterval,
+	); 0 < hbi {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.heartbeat(hbDone, hbi)
+		}()
+	}
+
+	/* Wait for the shell to finish, then tell Curlrevshell how it
+	went. */
+	serrGo := f.shell.Go(ctx)
+	close(hbDone)
+	wg.Wait()
+	if c := exitControl(serrGo); "" != c && nil == oerr {
+		oerr = f.Control(c)
+	}
+	f.outw.CloseWithError(oerr)
+	if nil != serrGo {
+		return serrGo
+	} else if nil != oerr {
+		return fmt.Errorf("proxying output: %w", oerr)
+	}
+	return nil
+}
+
+// Control sends a control message to Curlrevshell.  This is normally only
+// needed to send ControlWindowSize; see [FramedShell.WindowSize].
+func (f *FramedShell) Control(msg string) error {
+	_, err := frameWriter{w: &f.out, t: FrameControl}.Write([]byte(msg))
+	return err
+}
+
+// WindowSize tells Curlrevshell the shell's window has the given number of
+// columns and rows.
+func (f *FramedShell) WindowSize(cols, rows int) error {
+	return f.Control(fmt.Sprintf("%s %d %d", ControlWindowSize, cols, rows))
+}
+
+// heartbeat sends a heartbeat every interval until done is closed or sending
+// fails.
+func (f *FramedShell) heartbeat(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := f.Control(ControlHeartbeat); nil != err {
+				return
+			}
+		}
+	}
+}
+
+// exitControl returns the control message describing a shell which returned
+// err, or the empty string if err doesn't say how the shell exited.
+func exitControl(err error) string {
+	var ee *ExitError
+	switch {
+	case nil == err:
+		return ControlExit + " 0"
+	case !errors.As(err, &ee):
+		return ""
+	case nil != ee.Signal:
+		return ControlSignal + " " + ee.Signal.String()
+	default:
+		return ControlExit + " " + strconv.Itoa(ee.Code)
+	}
+}
+
+// frameWriter is an io.Writer which writes what's written to it to w as
+// frames of type t.  Each frame is written with a single call to w.Write.
+type frameWriter struct {
+	w io.Writer
+	t byte
+}
+
+// Write writes b to fw.w in as many frames as it takes.
+func (fw frameWriter) Write(b []byte) (int, error) {
+	var n int
+	for 0 != len(b) {
+		p := b[:min(len(b), FrameMaxLen)]
+		if _, err := fw.w.Write(AppendFrame(
+			make([]byte, 0, FrameHeaderLen+len(p)),
+			fw.t,
+			p,
+		)); nil != err {
+			return n, err
+		}
+		n += len(p)
+		b = b[len(p):]
+	}
+	return n, nil
+}
+
+// AppendFrame appends a frame of type t with the given payload to b and
+// returns the extended slice.  The payload must not be longer than
+// FrameMaxLen.
+func AppendFrame(b []byte, t byte, payload []byte) []byte {
+	b = append(b, t, byte(len(payload)>>8), byte(len(payload)))
+	return append(b, payload...)
+}
@@ -0,0 +1,179 @@
+package simpleshell
+
+/*
+ * framed_test.go
+ * Tests for framed.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFrame is a frame read by readFrames.
+type testFrame struct {
+	t byte
+	p string
+}
+
+// readFrames reads the hello and frames from r until EOF.
+func readFrames(t *testing.T, r io.Reader) []testFrame {
+	t.Helper()
+	want := TransferMarker + FramedHello + "\n"
+	hello := make([]byte, len(want))
+	if _, err := io.ReadFull(r, hello); nil != err {
+		t.Fatalf("Error reading hello: %s", err)
+	} else if got := string(hello); got != want {
+		t.Fatalf("Incorrect hello:\n got: %q\nwant: %q", got, want)
+	}
+	var fs []testFrame
+	for {
+		h := make([]byte, FrameHeaderLen)
+		if _, err := io.ReadFull(r, h); errors.Is(err, io.EOF) {
+			return fs
+		} else if nil != err {
+			t.Fatalf("Error reading frame header: %s", err)
+		}
+		p := make([]byte, int(h[1])<<8|int(h[2]))
+		if _, err := io.ReadFull(r, p); nil != err {
+			t.Fatalf("Error reading frame payload: %s", err)
+		}
+		fs = append(fs, testFrame{t: h[0], p: string(p)})
+	}
+}
+
+func TestFramedShell(t *testing.T) {
+	cs, err := NewCmdShell(exec.Command(
+		"sh", "-c",
+		"read x; echo \"$x\"; echo oops >&2; exit 3",
+	))
+	if nil != err {
+		t.Fatalf("Error setting up shell: %s", err)
+	}
+	s := NewFramedShell(NewTransferShell(cs))
+	s.HeartbeatInterval = -1
+	s.SetInput(strings.NewReader("kittens\n"))
+
+	/* Run the shell and get its output. */
+	ech := make(chan error, 1)
+	go func() { ech <- s.Go(context.Background()) }()
+	fs := readFrames(t, s.Output())
+	var ee *ExitError
+	if err := <-ech; !errors.As(err, &ee) || 3 != ee.Code {
+		t.Errorf("Incorrect error: %v", err)
+	}
+
+	/* Output and error should be separate.  The order between them
+	isn't guaranteed. */
+	var (
+		stdout     string
+		stderr     string
+		wantStdout = TransferMarker + TransferHello + "\nkittens\n"
+		wantStderr = "oops\n"
+	)
+	for _, f := range fs[:len(fs)-1] {
+		switch f.t {
+		case FrameStdout:
+			stdout += f.p
+		case FrameStderr:
+			stderr += f.p
+		default:
+			t.Errorf("Unexpected frame: %q", f)
+		}
+	}
+	if stdout != wantStdout {
+		t.Errorf(
+			"Incorrect stdout:\n got: %q\nwant: %q",
+			stdout,
+			wantStdout,
+		)
+	}
+	if stderr != wantStderr {
+		t.Errorf(
+			"Incorrect stderr:\n got: %q\nwant: %q",
+			stderr,
+			wantStderr,
+		)
+	}
+	want := testFrame{t: FrameControl, p: ControlExit + " 3"}
+	if got := fs[len(fs)-1]; got != want {
+		t.Errorf("Incorrect last frame:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestFramedShell_Heartbeat(t *testing.T) {
+	in, _, es := NewEchoShell()
+	s := NewFramedShell(es)
+	s.HeartbeatInterval = time.Millisecond
+
+	/* Wait for a heartbeat or two. */
+	ech := make(chan error, 1)
+	go func() { ech <- s.Go(context.Background()) }()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		in.Close()
+	}()
+	fs := readFrames(t, s.Output())
+	if err := <-ech; nil != err {
+		t.Errorf("Shell error: %s", err)
+	}
+	hb := testFrame{t: FrameControl, p: ControlHeartbeat}
+	if !slices.Contains(fs, hb) {
+		t.Errorf("No heartbeat in %q", fs)
+	}
+	want := testFrame{t: FrameControl, p: ControlExit + " 0"}
+	if got := fs[len(fs)-1]; got != want {
+		t.Errorf("Incorrect last frame:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestFrameWriter(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		have = bytes.Repeat([]byte{'x'}, FrameMaxLen+10)
+	)
+	n, err := frameWriter{w: &buf, t: FrameStderr}.Write(have)
+	if nil != err {
+		t.Fatalf("Write error: %s", err)
+	} else if len(have) != n {
+		t.Errorf("Short write: %d/%d", n, len(have))
+	}
+	want := append(
+		AppendFrame(nil, FrameStderr, have[:FrameMaxLen]),
+		AppendFrame(nil, FrameStderr, have[FrameMaxLen:])...,
+	)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Incorrect frames")
+	}
+}
+
+func TestExitControl(t *testing.T) {
+	for _, c := range []struct {
+		have error
+		want string
+	}{
+		{nil, "exit 0"},
+		{&ExitError{Code: 2}, "exit 2"},
+		{&ExitError{Code: -1, Signal: os.Kill}, "signal killed"},
+		{errors.New("kittens"), ""},
+	} {
+		if got := exitControl(c.have); got != c.want {
+			t.Errorf(
+				"Incorrect control:\n got: %q\nwant: %q",
+				got,
+				c.want,
+			)
+		}
+	}
+}
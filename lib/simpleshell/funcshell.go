@@ -0,0 +1,285 @@
+package simpleshell
+
+/*
+ * funcshell.go
+ * Shell made of Go functions
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	// FuncShellHelp is the built-in command which lists a FuncShell's
+	// commands, unless the FuncShell has its own.
+	FuncShellHelp = "help"
+
+	// FuncShellExit is the built-in command which stops a FuncShell,
+	// unless the FuncShell has its own.
+	FuncShellExit = "exit"
+)
+
+// ErrUnterminatedQuote is returned by ParseLine when a line has a quote
+// without its closing quote.
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+// ErrTrailingBackslash is returned by ParseLine when a line ends with an
+// unescaped backslash.
+var ErrTrailingBackslash = errors.New("trailing backslash")
+
+// ShellFunc handles a command for a FuncShell.  args holds the command's
+// arguments, not including the command itself.  stdin is the FuncShell's
+// input, after the command's line; anything read from it won't be read as a
+// command.  It's a *[bufio.Reader], so it may be read a line at a time
+// without reading too much.  A returned error is sent to Curlrevshell.
+type ShellFunc func(args []string, stdin io.Reader, stdout io.Writer) error
+
+// FuncShell is a [Shell] which runs Go functions instead of a subprocess.
+// Each line of input is split with ParseLine, and the first word is used to
+// find a ShellFunc to call.  Errors and panics from ShellFuncs are sent to
+// Curlrevshell, via Stderr if it's been called.
+type FuncShell struct {
+	// Help optionally holds a short description of commands, for the
+	// built-in help.
+	Help map[string]string
+
+	// Prompt, if set, is sent before reading each line.
+	Prompt string
+
+	funcs map[string]ShellFunc
+	in    io.Reader
+
+	outr *io.PipeReader
+	outw *io.PipeWriter
+	errr *io.PipeReader /* Set by Stderr. */
+	errw *io.PipeWriter
+}
+
+// NewFuncShell returns a new FuncShell which runs the functions in funcs.
+// funcs' keys are the commands.
+func NewFuncShell(funcs map[string]ShellFunc) *FuncShell {
+	pr, pw := io.Pipe()
+	return &FuncShell{
+		funcs: maps.Clone(funcs),
+		outr:  pr,
+		outw:  pw,
+	}
+}
+
+// SetInput sets the [io.Reader] from which f reads commands.
+func (f *FuncShell) SetInput(in io.Reader) { f.in = in }
+
+// Output returns an [io.Reader] on which f sends output.
+func (f *FuncShell) Output() io.ReadCloser { return f.outr }
+
+// Stderr returns an [io.Reader] on which f sends errors, which will then not
+// be sent on Output.  Stderr must be called before Go.
+func (f *FuncShell) Stderr() io.ReadCloser {
+	if nil == f.errr {
+		f.errr, f.errw = io.Pipe()
+	}
+	return f.errr
+}
+
+// String returns "func shell".
+func (f *FuncShell) String() string { return "func shell" }
+
+// Go reads and runs commands until f's input is finished, FuncShellExit is
+// run, or ctx is done.  ctx is only checked between commands.
+func (f *FuncShell) Go(ctx context.Context) error {
+	var errw io.Writer = f.outw
+	if nil != f.errw {
+		errw = f.errw
+	}
+	err := f.run(ctx, errw)
+	f.outw.CloseWithError(err)
+	if nil != f.errw {
+		f.errw.CloseWithError(err)
+	}
+	return err
+}
+
+// run does what Go says it does.  Errors are written to errw.
+func (f *FuncShell) run(ctx context.Context, errw io.Writer) error {
+	br := bufio.NewReader(f.in)
+	for nil == ctx.Err() {
+		/* Get a command and run it. */
+		if "" != f.Prompt {
+			_, err := io.WriteString(f.outw, f.Prompt)
+			if nil != err {
+				return fmt.Errorf("sending prompt: %w", err)
+			}
+		}
+		l, rerr := br.ReadString('\n')
+		if exit, err := f.runLine(l, br, errw); nil != err {
+			return err
+		} else if exit {
+			return nil
+		}
+
+		/* If that was the last line, we're done. */
+		if errors.Is(rerr, io.EOF) {
+			return nil
+		} else if nil != rerr {
+			return fmt.Errorf("reading input: %w", rerr)
+		}
+	}
+	return nil
+}
+
+// runLine runs the command in l, if there is one.  exit is true if the command
+// is the built-in FuncShellExit.  Errors from the command are written to errw;
+// runLine only returns an error if writing to errw fails.
+func (f *FuncShell) runLine(
+	l string,
+	stdin io.Reader,
+	errw io.Writer,
+) (exit bool, err error) {
+	args, err := ParseLine(l)
+	switch {
+	case nil != err:
+	case 0 == len(args):
+		return false, nil
+	case FuncShellExit == args[0] && nil == f.funcs[args[0]]:
+		return true, nil
+	default:
+		if err = f.runFunc(args, stdin); nil != err {
+			err = fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+	if nil == err {
+		return false, nil
+	}
+	if _, werr := fmt.Fprintf(errw, "%s\n", err); nil != werr {
+		return false, fmt.Errorf("sending error: %w", werr)
+	}
+	return false, nil
+}
+
+// runFunc runs the ShellFunc for args[0], with the rest of args as its
+// arguments.  A panic is returned as an error.
+func (f *FuncShell) runFunc(args []string, stdin io.Reader) (err error) {
+	sf, ok := f.funcs[args[0]]
+	switch {
+	case ok:
+	case FuncShellHelp == args[0]:
+		sf = f.help
+	default:
+		return errors.New("command not found")
+	}
+	defer func() {
+		if r := recover(); nil != r {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return sf(args[1:], stdin, f.outw)
+}
+
+// help is the built-in FuncShellHelp, which lists f's commands.
+func (f *FuncShell) help(_ []string, _ io.Reader, stdout io.Writer) error {
+	/* Work out what we have, including built-ins which haven't been
+	replaced. */
+	descs := map[string]string{
+		FuncShellExit: "Stop the shell",
+		FuncShellHelp: "List commands",
+	}
+	for name := range f.funcs {
+		descs[name] = ""
+	}
+	for name := range descs {
+		if d, ok := f.Help[name]; ok {
+			descs[name] = d
+		}
+	}
+
+	/* List it all, nicely. */
+	var (
+		names = slices.Sorted(maps.Keys(descs))
+		width = len(slices.MaxFunc(names, func(a, b string) int {
+			return len(a) - len(b)
+		}))
+		sb strings.Builder
+	)
+	for _, name := range names {
+		sb.WriteString(strings.TrimRight(fmt.Sprintf(
+			"%-*s  %s",
+			width,
+			name,
+			descs[name],
+		), " "))
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(stdout, sb.String())
+	return err
+}
+
+// ParseLine splits a line into words, more or less like a POSIX shell.
+// Words are separated by unquoted whitespace.  Single quotes preserve
+// everything between them.  Double quotes preserve everything between them
+// but backslashes before double quotes and backslashes.  Outside of quotes,
+// a backslash preserves the next character.  Nothing is expanded.
+func ParseLine(line string) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+		quote  rune /* Quote we're in, or 0. */
+		escape bool /* Previous rune was a backslash. */
+	)
+	for _, r := range line {
+		switch {
+		case escape:
+			if '"' == quote && '"' != r && '\\' != r {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escape = false
+		case '\'' == quote:
+			if '\'' == r {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case '\\' == r:
+			escape = true
+			inWord = true
+		case '"' == quote:
+			if '"' == r {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case '\'' == r, '"' == r:
+			quote = r
+			inWord = true
+		case strings.ContainsRune(" \t\r\n", r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	switch {
+	case 0 != quote:
+		return nil, ErrUnterminatedQuote
+	case escape:
+		return nil, ErrTrailingBackslash
+	case inWord:
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,148 @@
+package simpleshell
+
+/*
+ * funcshell_test.go
+ * Tests for funcshell.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testFuncs are ShellFuncs for testing.
+var testFuncs = map[string]ShellFunc{
+	"echo": func(args []string, _ io.Reader, stdout io.Writer) error {
+		_, err := fmt.Fprintln(stdout, strings.Join(args, " "))
+		return err
+	},
+	"read": func(args []string, stdin io.Reader, stdout io.Writer) error {
+		l, err := stdin.(*bufio.Reader).ReadString('\n')
+		if nil != err {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "got %s", l)
+		return err
+	},
+	"fail": func([]string, io.Reader, io.Writer) error {
+		return errors.New("kittens")
+	},
+	"panic": func([]string, io.Reader, io.Writer) error {
+		panic("moose")
+	},
+}
+
+func TestFuncShell(t *testing.T) {
+	s := NewFuncShell(testFuncs)
+	s.Help = map[string]string{"echo": "Say something"}
+	testShell(
+		t,
+		context.Background(),
+		s,
+		`echo "a  b" c\ d
+read
+kittens
+fail
+panic
+nope
+echo 'unterminated
+help
+
+exit
+echo not reached
+`,
+		`a  b c d
+got kittens
+fail: kittens
+panic: panic: moose
+nope: command not found
+unterminated quote
+echo   Say something
+exit   Stop the shell
+fail
+help   List commands
+panic
+read
+`,
+	)
+}
+
+func TestFuncShell_Stderr(t *testing.T) {
+	s := NewFuncShell(testFuncs)
+	s.SetInput(strings.NewReader("fail\necho ok"))
+	var (
+		ech     = make(chan error, 1)
+		serr    = s.Stderr()
+		errBuf  strings.Builder
+		errDone = make(chan struct{})
+	)
+	go func() {
+		defer close(errDone)
+		io.Copy(&errBuf, serr)
+	}()
+	go func() { ech <- s.Go(context.Background()) }()
+	out, err := io.ReadAll(s.Output())
+	if nil != err {
+		t.Fatalf("Error reading output: %s", err)
+	}
+	<-errDone
+	if err := <-ech; nil != err {
+		t.Errorf("Shell error: %s", err)
+	}
+	if got, want := string(out), "ok\n"; got != want {
+		t.Errorf("Incorrect output:\n got: %q\nwant: %q", got, want)
+	}
+	if got, want := errBuf.String(), "fail: kittens\n"; got != want {
+		t.Errorf("Incorrect stderr:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	for _, c := range []struct {
+		have    string
+		want    []string
+		wantErr error
+	}{
+		{"", nil, nil},
+		{"  \t\n", nil, nil},
+		{"ls -lart /tmp\n", []string{"ls", "-lart", "/tmp"}, nil},
+		{`a 'b c' "d e"`, []string{"a", "b c", "d e"}, nil},
+		{`a'b'"c"d`, []string{"abcd"}, nil},
+		{`'' ""`, []string{"", ""}, nil},
+		{`a\ b \'c\"`, []string{"a b", `'c"`}, nil},
+		{`'a\b"c'`, []string{`a\b"c`}, nil},
+		{`"a\"b\\c\d"`, []string{`a"b\c\d`}, nil},
+		{`"$HOME" ~`, []string{"$HOME", "~"}, nil},
+		{`a 'b`, nil, ErrUnterminatedQuote},
+		{`a "b`, nil, ErrUnterminatedQuote},
+		{`a \`, nil, ErrTrailingBackslash},
+	} {
+		got, err := ParseLine(c.have)
+		if !errors.Is(err, c.wantErr) {
+			t.Errorf(
+				"Incorrect error for %q:\n got: %v\nwant: %v",
+				c.have,
+				err,
+				c.wantErr,
+			)
+			continue
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf(
+				"Incorrect words for %q:\n got: %q\nwant: %q",
+				c.have,
+				got,
+				c.want,
+			)
+		}
+	}
+}
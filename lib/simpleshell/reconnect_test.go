@@ -0,0 +1,229 @@
+package simpleshell
+
+/*
+ * reconnect_test.go
+ * Tests for reconnect.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, c := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{1000, time.Minute},
+	} {
+		got := backoff(time.Second, time.Minute, c.failures)
+		if got != c.want {
+			t.Errorf(
+				"Incorrect backoff after %d failures:\n"+
+					" got: %s\n"+
+					"want: %s",
+				c.failures,
+				got,
+				c.want,
+			)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	d := time.Second
+	if got := jitter(d, 0); got != d {
+		t.Errorf("Jitter with 0 changed %s to %s", d, got)
+	}
+	var lower, higher bool
+	for range 1000 {
+		got := jitter(d, 0.25)
+		if got < 750*time.Millisecond || got > 1250*time.Millisecond {
+			t.Fatalf("Jitter out of range: %s", got)
+		}
+		lower = lower || got < d
+		higher = higher || got > d
+	}
+	if !lower || !higher {
+		t.Errorf("Jitter only went one way")
+	}
+}
+
+func TestGoReconnect(t *testing.T) {
+	var (
+		input       = "kittens"
+		nConn       atomic.Int64
+		nShell      atomic.Int64
+		wantConn    = int64(3)
+		ctx, cancel = context.WithCancel(context.Background())
+		ech         = make(chan error, wantConn)
+	)
+	defer cancel()
+
+	/* Server which checks each shell echoes. */
+	svr := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		ech <- func() error {
+			rc := http.NewResponseController(w)
+			if err := rc.EnableFullDuplex(); nil != err {
+				return fmt.Errorf("enabling duplex: %w", err)
+			}
+			if _, err := io.WriteString(w, input); nil != err {
+				return fmt.Errorf("sending input: %w", err)
+			}
+			if err := rc.Flush(); nil != err {
+				return fmt.Errorf("flushing: %w", err)
+			}
+			b := make([]byte, len(input))
+			if _, err := io.ReadFull(r.Body, b); nil != err {
+				return fmt.Errorf("reading output: %w", err)
+			} else if got := string(b); got != input {
+				return fmt.Errorf("incorrect output %q", got)
+			}
+			return nil
+		}()
+		if wantConn == nConn.Add(1) {
+			cancel()
+		}
+	}))
+	defer svr.Close()
+	var nFail atomic.Int64
+	fsvr := newFailingServer(t, &nFail)
+
+	/* Connect a few times, failing every other time. */
+	err := GoReconnect(ctx, ConnConfig{}, ReconnectConfig{
+		C2s:        []string{fsvr.URL, svr.URL},
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+		Jitter:     0.5,
+	}, func() (Shell, error) {
+		nShell.Add(1)
+		_, _, shell := NewEchoShell()
+		return shell, nil
+	})
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	close(ech)
+	for err := range ech {
+		if nil != err {
+			t.Errorf("Handler error: %s", err)
+		}
+	}
+	if got := nConn.Load(); wantConn != got {
+		t.Errorf("Expected %d connections, got %d", wantConn, got)
+	}
+	/* Once we've a working C2, we should stick with it. */
+	if got := nFail.Load(); 1 != got {
+		t.Errorf("Expected 1 failed attempt, got %d", got)
+	}
+	/* Failed attempts shouldn't have made shells. */
+	if got := nShell.Load(); wantConn != got {
+		t.Errorf("Expected %d shells, got %d", wantConn, got)
+	}
+}
+
+func TestGoReconnect_Limits(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		rconf       ReconnectConfig
+		wantAtLeast int64
+		wantAtMost  int64
+	}{{
+		name: "max_attempts",
+		rconf: ReconnectConfig{
+			MinBackoff:  time.Millisecond,
+			MaxAttempts: 3,
+		},
+		wantAtLeast: 3,
+		wantAtMost:  3,
+	}, {
+		name: "max_duration",
+		rconf: ReconnectConfig{
+			MinBackoff:  5 * time.Millisecond,
+			MaxBackoff:  5 * time.Millisecond,
+			MaxDuration: 50 * time.Millisecond,
+		},
+		wantAtLeast: 2,
+		wantAtMost:  11,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			var nFail, nShell atomic.Int64
+			svr := newFailingServer(t, &nFail)
+			err := GoReconnect(
+				context.Background(),
+				ConnConfig{C2: svr.URL},
+				c.rconf,
+				func() (Shell, error) {
+					nShell.Add(1)
+					_, _, shell := NewEchoShell()
+					return shell, nil
+				},
+			)
+			if !errors.Is(err, ErrGaveUp) {
+				t.Errorf("Incorrect error: %v", err)
+			}
+			if got := nShell.Load(); 0 != got {
+				t.Errorf(
+					"Made %d shells for failed attempts",
+					got,
+				)
+			}
+			got := nFail.Load()
+			if got < c.wantAtLeast || got > c.wantAtMost {
+				t.Errorf(
+					"Expected %d-%d attempts, got %d",
+					c.wantAtLeast,
+					c.wantAtMost,
+					got,
+				)
+			}
+		})
+	}
+}
+
+// newFailingServer returns an HTTP server which counts requests in n and
+// responds to them with a 503.  The server is closed when the test ends.
+func newFailingServer(t *testing.T, n *atomic.Int64) *httptest.Server {
+	svr := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		n.Add(1)
+		/* Don't wait for the rest of the request. */
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(svr.Close)
+	return svr
+}
+
+// mustDeadURL returns a URL to which connections will fail.
+func mustDeadURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer l.Close()
+	return "http://" + l.Addr().String() + IOPath
+}
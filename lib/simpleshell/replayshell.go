@@ -0,0 +1,387 @@
+package simpleshell
+
+/*
+ * replayshell.go
+ * Shell which replays a recorded session
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Bits of Curlrevshell's -log output, for ParseShellIOLog.  These must match
+// the ones in internal/iobroker.
+const (
+	shellIOMessage  = "Shell I/O"
+	shellIOInput    = "input"
+	shellIOOutput   = "output"
+	shellIOStderr   = "stderr"
+	asciicastInput  = "i"
+	asciicastOutput = "o"
+)
+
+// ErrReplayMismatch is returned by [ReplayShell.Go] when ReplayShell.Strict
+// is set and a line of input doesn't match the recording.
+var ErrReplayMismatch = errors.New("input doesn't match recording")
+
+// ReplayEvent is a bit of input or output from a recorded session.
+type ReplayEvent struct {
+	// At is when the event happened, relative to the start of the
+	// recording.
+	At time.Duration
+
+	// Input is true if Data was sent to the shell and false if the shell
+	// sent it.
+	Input bool
+
+	// Stderr is true if Data is output sent on standard error.
+	Stderr bool
+
+	// Data is what was sent.  Input is one line, usually with its
+	// newline.
+	Data string
+}
+
+// ParseRecording parses a recorded session in any of the formats understood
+// by ParseShellIOLog or ParseAsciicast, working out which from the first
+// line.
+func ParseRecording(r io.Reader) ([]ReplayEvent, error) {
+	br := bufio.NewReader(r)
+	l, err := br.Peek(br.Size())
+	if nil != err && !errors.Is(err, io.EOF) &&
+		!errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	l, _, _ = bytes.Cut(l, []byte("\n"))
+	var header struct {
+		Version any `json:"version"`
+	}
+	if err := json.Unmarshal(l, &header); nil == err &&
+		nil != header.Version {
+		return ParseAsciicast(br)
+	}
+	return ParseShellIOLog(br)
+}
+
+// ParseShellIOLog parses the Shell I/O records in JSON logs written by
+// Curlrevshell's -log.  Other records are ignored, as are lines which aren't
+// JSON.  If the log has more than one shell's I/O, all of it is returned.
+func ParseShellIOLog(r io.Reader) ([]ReplayEvent, error) {
+	var (
+		evs   []ReplayEvent
+		start time.Time
+		dec   = json.NewDecoder(r)
+	)
+	for {
+		/* Get a record. */
+		var rec struct {
+			Time      string `json:"time"`
+			Msg       string `json:"msg"`
+			Direction string `json:"direction"`
+			Stream    string `json:"stream"`
+			Data      string `json:"data"`
+		}
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			return evs, nil
+		} else if nil != err {
+			return nil, fmt.Errorf("decoding record: %w", err)
+		}
+		if shellIOMessage != rec.Msg {
+			continue
+		}
+
+		/* Work out when it happened.  Logs with no times play
+		without waiting. */
+		ev := ReplayEvent{
+			Data:   rec.Data,
+			Stderr: shellIOStderr == rec.Stream,
+		}
+		t, err := time.Parse(time.RFC3339Nano, rec.Time)
+		if nil == err {
+			if start.IsZero() {
+				start = t
+			}
+			ev.At = t.Sub(start)
+		}
+		switch rec.Direction {
+		case shellIOInput:
+			ev.Input = true
+		case shellIOOutput:
+		default:
+			return nil, fmt.Errorf(
+				"unknown direction %q",
+				rec.Direction,
+			)
+		}
+		evs = append(evs, ev)
+	}
+}
+
+// ParseAsciicast parses an asciicast, as made by asciinema.  Versions 2 and 3
+// are supported.  Input, which is recorded a keystroke at a time, is turned
+// into lines.  Events other than input and output are ignored.
+func ParseAsciicast(r io.Reader) ([]ReplayEvent, error) {
+	/* Make sure we understand the format. */
+	dec := json.NewDecoder(r)
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := dec.Decode(&header); nil != err {
+		return nil, fmt.Errorf("decoding header: %w", err)
+	}
+	if 2 != header.Version && 3 != header.Version {
+		return nil, fmt.Errorf("unsupported version %d", header.Version)
+	}
+
+	var (
+		evs  []ReplayEvent
+		at   time.Duration
+		line strings.Builder
+	)
+	for {
+		/* Get an event. */
+		var (
+			secs  float64
+			etype string
+			data  string
+			ev    = []any{&secs, &etype, &data}
+		)
+		if err := dec.Decode(&ev); errors.Is(err, io.EOF) {
+			break
+		} else if nil != err {
+			return nil, fmt.Errorf("decoding event: %w", err)
+		}
+		/* Version 3 times are since the previous event. */
+		d := time.Duration(math.Round(secs * float64(time.Second)))
+		if 3 == header.Version {
+			at += d
+		} else {
+			at = d
+		}
+
+		switch etype {
+		case asciicastOutput:
+			evs = append(evs, ReplayEvent{At: at, Data: data})
+		case asciicastInput: /* Keystrokes, turned into lines. */
+			for _, c := range data {
+				if '\r' != c && '\n' != c {
+					line.WriteRune(c)
+					continue
+				}
+				evs = append(evs, ReplayEvent{
+					At:    at,
+					Input: true,
+					Data:  line.String() + "\n",
+				})
+				line.Reset()
+			}
+		}
+	}
+
+	/* Don't lose a last, unfinished line. */
+	if 0 != line.Len() {
+		evs = append(evs, ReplayEvent{
+			At:    at,
+			Input: true,
+			Data:  line.String(),
+		})
+	}
+	return evs, nil
+}
+
+// ReplayShell is a [Shell] which replays a recorded session.  Output is sent
+// with the recording's timing, and when the recording has input, ReplayShell
+// waits for a line of input before carrying on.  ReplayEvents may be parsed
+// from a recording with ParseRecording.
+type ReplayShell struct {
+	// Strict, if set, causes Go to return an error wrapping
+	// ErrReplayMismatch if a line of input doesn't match the recording,
+	// ignoring line endings.  Otherwise, input which matches a later line
+	// in the recording skips ahead to it, and input which doesn't match
+	// anything is taken as the next line, ignoring whitespace.
+	Strict bool
+
+	// Speed scales the recording's timing; 2 is twice as fast.  If unset,
+	// the recording is played at its original speed.
+	Speed float64
+
+	// MaxWait, if set, limits how long ReplayShell waits between events,
+	// after Speed is applied.
+	MaxWait time.Duration
+
+	evs []ReplayEvent
+	in  io.Reader
+
+	outr *io.PipeReader
+	outw *io.PipeWriter
+	errr *io.PipeReader /* Set by Stderr. */
+	errw *io.PipeWriter
+}
+
+// NewReplayShell returns a new ReplayShell which replays evs.
+func NewReplayShell(evs []ReplayEvent) *ReplayShell {
+	pr, pw := io.Pipe()
+	return &ReplayShell{
+		evs:  evs,
+		outr: pr,
+		outw: pw,
+	}
+}
+
+// SetInput sets the [io.Reader] from which s reads input.
+func (s *ReplayShell) SetInput(in io.Reader) { s.in = in }
+
+// Output returns an [io.Reader] on which s sends recorded output.
+func (s *ReplayShell) Output() io.ReadCloser { return s.outr }
+
+// Stderr returns an [io.Reader] on which s sends recorded standard error,
+// which will then not be sent on Output.  Stderr must be called before Go.
+func (s *ReplayShell) Stderr() io.ReadCloser {
+	if nil == s.errr {
+		s.errr, s.errw = io.Pipe()
+	}
+	return s.errr
+}
+
+// String returns "replay shell".
+func (s *ReplayShell) String() string { return "replay shell" }
+
+// Go replays the recording until it ends, s's input is finished, or ctx is
+// done.
+func (s *ReplayShell) Go(ctx context.Context) error {
+	err := s.replay(ctx)
+	s.outw.CloseWithError(err)
+	if nil != s.errw {
+		s.errw.CloseWithError(err)
+	}
+	return err
+}
+
+// replay does what Go says it does.
+func (s *ReplayShell) replay(ctx context.Context) error {
+	/* Read input lines in the background, so we can give up waiting for
+	them.  The reader stops once we're done, even if ctx isn't. */
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		lines = make(chan string)
+		rerr  error
+	)
+	go func() {
+		defer close(lines)
+		br := bufio.NewReader(s.in)
+		for {
+			l, err := br.ReadString('\n')
+			if "" != l {
+				select {
+				case lines <- l:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			} else if nil != err {
+				rerr = fmt.Errorf("reading input: %w", err)
+				return
+			}
+		}
+	}()
+
+	var last time.Duration
+	for i := 0; i < len(s.evs); i++ {
+		ev := s.evs[i]
+		/* Output's easy, just wait and send it. */
+		if !ev.Input {
+			if !s.wait(ctx, ev.At-last) {
+				return nil
+			}
+			last = ev.At
+			w := s.outw
+			if ev.Stderr && nil != s.errw {
+				w = s.errw
+			}
+			if _, err := io.WriteString(w, ev.Data); nil != err {
+				return fmt.Errorf("sending output: %w", err)
+			}
+			continue
+		}
+
+		/* Input means waiting for a line. */
+		var (
+			l  string
+			ok bool
+		)
+		select {
+		case l, ok = <-lines:
+		case <-ctx.Done():
+			return nil
+		}
+		if !ok {
+			return rerr
+		}
+		if s.Strict {
+			if strings.TrimRight(l, "\r\n") !=
+				strings.TrimRight(ev.Data, "\r\n") {
+				return fmt.Errorf(
+					"%w: got %q, want %q",
+					ErrReplayMismatch,
+					l,
+					ev.Data,
+				)
+			}
+		} else {
+			i = s.findInput(i, l)
+		}
+		/* Don't wait for the time the operator took to type. */
+		last = s.evs[i].At
+	}
+	return nil
+}
+
+// findInput returns the index of the first input event at or after i which
+// matches l, ignoring whitespace, or i if there isn't one.
+func (s *ReplayShell) findInput(i int, l string) int {
+	l = strings.Join(strings.Fields(l), " ")
+	for j := i; j < len(s.evs); j++ {
+		if s.evs[j].Input &&
+			l == strings.Join(strings.Fields(s.evs[j].Data), " ") {
+			return j
+		}
+	}
+	return i
+}
+
+// wait waits for d, adjusted by s.Speed and s.MaxWait.  It returns false if
+// ctx is done first.
+func (s *ReplayShell) wait(ctx context.Context, d time.Duration) bool {
+	if 0 < s.Speed {
+		d = time.Duration(float64(d) / s.Speed)
+	}
+	if 0 < s.MaxWait {
+		d = min(d, s.MaxWait)
+	}
+	if 0 >= d {
+		return nil == ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,313 @@
+package simpleshell
+
+/*
+ * replayshell_test.go
+ * Tests for replayshell.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// replayLogEvents are the events in testdata/replay.log.
+var replayLogEvents = []ReplayEvent{{
+	Data: "$ ",
+}, {
+	At:    1500 * time.Millisecond,
+	Input: true,
+	Data:  "id\n",
+}, {
+	At:   1750 * time.Millisecond,
+	Data: "uid=0(root) gid=0(root)\n$ ",
+}, {
+	At:    4500 * time.Millisecond,
+	Input: true,
+	Data:  "cat /nope\n",
+}, {
+	At:     4600 * time.Millisecond,
+	Stderr: true,
+	Data:   "cat: /nope: No such file or directory\n",
+}, {
+	At:   4700 * time.Millisecond,
+	Data: "$ ",
+}}
+
+// replayCastEvents are the events in testdata/replay.cast.
+var replayCastEvents = []ReplayEvent{{
+	At:   500 * time.Millisecond,
+	Data: "$ ",
+}, {
+	At:    1750 * time.Millisecond,
+	Input: true,
+	Data:  "id\n",
+}, {
+	At:   1800 * time.Millisecond,
+	Data: "id\r\n",
+}, {
+	At:   2250 * time.Millisecond,
+	Data: "uid=0(root) gid=0(root)\r\n$ ",
+}, {
+	At:    3 * time.Second,
+	Input: true,
+	Data:  "exit",
+}}
+
+func TestParseRecording(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		want []ReplayEvent
+	}{{
+		name: "replay.log",
+		want: replayLogEvents,
+	}, {
+		name: "replay.cast",
+		want: replayCastEvents,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := os.Open("testdata/" + c.name)
+			if nil != err {
+				t.Fatalf("Error opening recording: %s", err)
+			}
+			defer f.Close()
+			got, err := ParseRecording(f)
+			if nil != err {
+				t.Fatalf("Error: %s", err)
+			}
+			if !slices.Equal(got, c.want) {
+				t.Errorf(
+					"Incorrect events:\n"+
+						" got: %+v\n"+
+						"want: %+v",
+					got,
+					c.want,
+				)
+			}
+		})
+	}
+}
+
+func TestParseAsciicast_V3(t *testing.T) {
+	have := `{"version": 3, "term": {"cols": 80, "rows": 24}}
+[0.5, "o", "$ "]
+[1.25, "i", "ls\n"]
+[0.25, "o", "kittens\n"]
+`
+	want := []ReplayEvent{{
+		At:   500 * time.Millisecond,
+		Data: "$ ",
+	}, {
+		At:    1750 * time.Millisecond,
+		Input: true,
+		Data:  "ls\n",
+	}, {
+		At:   2 * time.Second,
+		Data: "kittens\n",
+	}}
+	got, err := ParseAsciicast(strings.NewReader(have))
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf(
+			"Incorrect events:\n got: %+v\nwant: %+v",
+			got,
+			want,
+		)
+	}
+}
+
+func TestReplayShell(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		strict bool
+		have   string
+		want   string
+	}{{
+		name:   "strict",
+		strict: true,
+		have:   "id\ncat /nope\n",
+		want: "$ uid=0(root) gid=0(root)\n$ " +
+			"cat: /nope: No such file or directory\n$ ",
+	}, {
+		name: "lenient_skip",
+		have: "cat  /nope \n",
+		want: "$ cat: /nope: No such file or directory\n$ ",
+	}, {
+		name: "lenient_unmatched",
+		have: "whoami\n",
+		want: "$ uid=0(root) gid=0(root)\n$ ",
+	}, {
+		name: "no_input",
+		want: "$ ",
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewReplayShell(replayLogEvents)
+			s.Strict = c.strict
+			s.MaxWait = time.Nanosecond
+			testShell(t, context.Background(), s, c.have, c.want)
+		})
+	}
+}
+
+func TestReplayShell_Mismatch(t *testing.T) {
+	s := NewReplayShell(replayLogEvents)
+	s.Strict = true
+	s.MaxWait = time.Nanosecond
+	s.SetInput(strings.NewReader("whoami\n"))
+	var (
+		eg  errgroup.Group
+		buf bytes.Buffer
+	)
+	eg.Go(func() error { _, err := buf.ReadFrom(s.Output()); return err })
+	if err := s.Go(context.Background()); !errors.Is(
+		err,
+		ErrReplayMismatch,
+	) {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if err := eg.Wait(); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("Incorrect output error: %v", err)
+	}
+	if got, want := buf.String(), "$ "; got != want {
+		t.Errorf("Incorrect output:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestReplayShell_Stderr(t *testing.T) {
+	s := NewReplayShell(replayLogEvents)
+	s.MaxWait = time.Nanosecond
+	s.SetInput(strings.NewReader("id\ncat /nope\n"))
+	var (
+		eg         errgroup.Group
+		obuf, ebuf bytes.Buffer
+		stderr     = s.Stderr()
+	)
+	eg.Go(func() error { _, err := ebuf.ReadFrom(stderr); return err })
+	eg.Go(func() error { _, err := obuf.ReadFrom(s.Output()); return err })
+	eg.Go(func() error { return s.Go(context.Background()) })
+	if err := eg.Wait(); nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if got, want := obuf.String(),
+		"$ uid=0(root) gid=0(root)\n$ $ "; got != want {
+		t.Errorf("Incorrect output:\n got: %q\nwant: %q", got, want)
+	}
+	if got, want := ebuf.String(),
+		"cat: /nope: No such file or directory\n"; got != want {
+		t.Errorf("Incorrect stderr:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestReplayShell_Timing(t *testing.T) {
+	evs := []ReplayEvent{
+		{Data: "a"},
+		{At: time.Hour, Data: "b"},
+		{At: 2 * time.Hour, Data: "c"},
+	}
+	for _, c := range []struct {
+		name    string
+		speed   float64
+		maxWait time.Duration
+	}{{
+		name:  "speed",
+		speed: float64(time.Hour / time.Millisecond),
+	}, {
+		name:    "max_wait",
+		maxWait: time.Millisecond,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewReplayShell(evs)
+			s.Speed = c.speed
+			s.MaxWait = c.maxWait
+			start := time.Now()
+			testShell(t, context.Background(), s, "", "abc")
+			if d := time.Since(start); time.Second < d {
+				t.Errorf("Replay took %s", d)
+			}
+		})
+	}
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			10*time.Millisecond,
+		)
+		defer cancel()
+		s := NewReplayShell(evs)
+		ir, iw := io.Pipe()
+		defer iw.Close()
+		s.SetInput(ir)
+		go io.Copy(io.Discard, s.Output())
+		if err := s.Go(ctx); nil != err {
+			t.Errorf("Error: %s", err)
+		}
+	})
+}
+
+// blockedLineReader returns a line once its channel is closed, and EOF after
+// that.
+type blockedLineReader struct {
+	ch   chan struct{}
+	sent bool
+}
+
+// Read implements io.Reader.
+func (r *blockedLineReader) Read(p []byte) (int, error) {
+	<-r.ch
+	if r.sent {
+		return 0, io.EOF
+	}
+	r.sent = true
+	return copy(p, "id\n"), nil
+}
+
+func TestReplayShell_InputReaderStops(t *testing.T) {
+	s := NewReplayShell([]ReplayEvent{{Data: "$ "}})
+	r := &blockedLineReader{ch: make(chan struct{})}
+	s.SetInput(r)
+	var eg errgroup.Group
+	eg.Go(func() error {
+		_, err := io.Copy(io.Discard, s.Output())
+		return err
+	})
+	before := runtime.NumGoroutine()
+	if err := s.Go(context.Background()); nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if err := eg.Wait(); nil != err {
+		t.Fatalf("Output error: %s", err)
+	}
+
+	/* Input after the replay's finished shouldn't leave the reader
+	stuck. */
+	close(r.ch)
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		n := runtime.NumGoroutine()
+		if n < before {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf(
+				"Input reader still running:\n"+
+					" got: %d goroutines\n"+
+					"want: <%d",
+				n,
+				before,
+			)
+		}
+	}
+}
@@ -5,14 +5,18 @@ package simpleshell
  * Shell (or similar) subprocess
  * By J. Stuart McMurray
  * Created 20241013
- * Last Modified 20241013
+ * Last Modified 20261016
  */
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -38,9 +42,61 @@ type Shell interface {
 	Go(ctx context.Context) error
 }
 
+// StderrShell is a [Shell] which can send its standard error separately from
+// its standard output.
+type StderrShell interface {
+	Shell
+
+	// Stderr returns an io.ReadCloser from which the Shell's standard
+	// error will be read, instead of from Output.  Stderr must be called
+	// before Go.  Shells must close the returned io.ReadCloser when no
+	// more will be read, as with Output.
+	Stderr() io.ReadCloser
+}
+
+// DefaultKillGrace is how long a CmdShell waits after asking its process
+// nicely to terminate before killing it, if CmdShell.KillGrace isn't set.
+const DefaultKillGrace = 5 * time.Second
+
+// ExitError is returned by [CmdShell.Go] when the process doesn't exit
+// successfully.
+type ExitError struct {
+	// Code is the process's exit code, or -1 if it was killed by a
+	// signal.
+	Code int
+
+	// Signal is the signal which killed the process, or nil if it
+	// exited on its own.
+	Signal os.Signal
+
+	// Err is the underlying error.
+	Err *exec.ExitError
+}
+
+// newExitError returns an ExitError which wraps err.
+func newExitError(err *exec.ExitError) *ExitError {
+	return &ExitError{
+		Code:   err.ExitCode(),
+		Signal: exitSignal(err.ProcessState),
+		Err:    err,
+	}
+}
+
+// Error implements the error interface.
+func (err *ExitError) Error() string { return err.Err.Error() }
+
+// Unwrap returns err.Err.
+func (err *ExitError) Unwrap() error { return err.Err }
+
 // CmdShell turns an *[exec.Cmd] into a [Shell].
 type CmdShell struct {
+	// KillGrace is how long to wait after asking the process group to
+	// terminate before killing it, when the context passed to Go is
+	// done.  If unset, DefaultKillGrace is used.
+	KillGrace time.Duration
+
 	cmd *exec.Cmd
+	in  io.Reader /* Copied to cmd's stdin. */
 
 	/* Output from cmd. */
 	sout io.ReadCloser
@@ -49,6 +105,8 @@ type CmdShell struct {
 	/* Output to Curlrevshell. */
 	outr *io.PipeReader
 	outw *io.PipeWriter
+	errr *io.PipeReader /* Set by Stderr. */
+	errw *io.PipeWriter
 }
 
 // NewCmdShell returns a new CmdShell which wraps cmd.
@@ -72,27 +130,112 @@ func NewCmdShell(cmd *exec.Cmd) (*CmdShell, error) {
 	return &c, nil
 }
 
-// SetInput sets the [io.Reader] from which c reads input.
-func (c *CmdShell) SetInput(in io.Reader) { c.cmd.Stdin = in }
+// SetInput sets the [io.Reader] from which c reads input.  If in is also an
+// [io.Closer], Go closes it once the process has exited.
+func (c *CmdShell) SetInput(in io.Reader) { c.in = in }
 
 // Output returns an [io.Reader] on which c sends output.
 func (c *CmdShell) Output() io.ReadCloser { return c.outr }
 
-// Go runs c's [exec.Cmd].  ctx is not used; use [exec.CommandContext] or cause
-// an EOF on the [io.Reader] set via c.SetInPipe to stop Go.
+// Stderr returns an [io.Reader] on which c sends its process's standard
+// error, which will then not be sent on Output.  Stderr must be called
+// before Go.
+func (c *CmdShell) Stderr() io.ReadCloser {
+	if nil == c.errr {
+		c.errr, c.errw = io.Pipe()
+	}
+	return c.errr
+}
+
+// Go runs c's [exec.Cmd] in its own process group, where supported.  When
+// ctx is done, the process group is sent a SIGTERM, and then a SIGKILL
+// c.KillGrace later, after which c's pipes are closed.  Go returns an
+// *[ExitError] if the process doesn't exit successfully, including when it's
+// killed.  Go doesn't wait for more input once the process has exited.
 func (c *CmdShell) Go(ctx context.Context) error {
-	/* Start proxying output. */
-	var peg errgroup.Group
+	/* Start the process going.  We copy input ourselves, as otherwise
+	exec.Cmd.Wait waits for the next read from c.in to finish even after
+	the process has exited, which might never happen. */
+	setProcessGroup(c.cmd)
+	var (
+		stdin io.WriteCloser
+		err   error
+	)
+	if nil != c.in {
+		if stdin, err = c.cmd.StdinPipe(); nil != err {
+			err = fmt.Errorf("getting stdin pipe: %w", err)
+		}
+	}
+	if nil == err {
+		err = c.cmd.Start()
+	}
+	if nil != err {
+		c.outw.CloseWithError(err)
+		if nil != c.errw {
+			c.errw.CloseWithError(err)
+		}
+		return fmt.Errorf("starting process: %w", err)
+	}
+	if nil != stdin {
+		go func() {
+			io.Copy(stdin, c.in)
+			stdin.Close()
+		}()
+	}
+
+	/* Stop it if we're told to. */
+	done := make(chan struct{})
+	defer close(done)
+	defer context.AfterFunc(ctx, func() { c.kill(done) })()
+
+	/* Proxy output until everything writing to it is finished.  This
+	has to happen before we Wait, which closes the pipes.  Standard error
+	goes to Output unless someone's asked for it separately. */
+	var (
+		peg  errgroup.Group
+		errw io.Writer = c.outw
+	)
+	if nil != c.errw {
+		errw = c.errw
+	}
 	peg.Go(func() error { _, err := io.Copy(c.outw, c.sout); return err })
-	peg.Go(func() error { _, err := io.Copy(c.outw, c.serr); return err })
+	peg.Go(func() error { _, err := io.Copy(errw, c.serr); return err })
+	perr := peg.Wait()
+	c.outw.CloseWithError(perr)
+	if nil != c.errw {
+		c.errw.CloseWithError(perr)
+	}
 
-	/* Start the process going. */
-	var eg errgroup.Group
-	eg.Go(func() error { return c.cmd.Run() })
-	eg.Go(func() error { return c.outw.CloseWithError(peg.Wait()) })
+	/* Work out how it went.  Once the process is gone, there's nobody
+	left to read input, so unblock the copier if we can. */
+	err = c.cmd.Wait()
+	if ic, ok := c.in.(io.Closer); ok {
+		ic.Close()
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return newExitError(ee)
+	} else if nil != err {
+		return fmt.Errorf("waiting for process: %w", err)
+	} else if nil != perr && nil == ctx.Err() {
+		return fmt.Errorf("proxying output: %w", perr)
+	}
+	return nil
+}
 
-	/* Wait until everything finishes. */
-	return eg.Wait()
+// kill asks c's process group to terminate, and kills it if it's not done
+// before done is closed.
+func (c *CmdShell) kill(done <-chan struct{}) {
+	signalGroup(c.cmd.Process, false)
+	select {
+	case <-done:
+		return
+	case <-time.After(cmp.Or(c.KillGrace, DefaultKillGrace)):
+	}
+	signalGroup(c.cmd.Process, true)
+	/* Something may have left the process group with our pipes. */
+	c.sout.Close()
+	c.serr.Close()
 }
 
 // String calls c's [exec.Cmd.String].
@@ -120,6 +263,9 @@ func (e *EchoShell) SetInput(in io.Reader) { e.in = in }
 // NewEchoShell.
 func (e *EchoShell) Output() io.ReadCloser { return e.outr }
 
+// String returns "echo shell".
+func (e *EchoShell) String() string { return "echo shell" }
+
 // Go copies between the returned i/o pipes.  ctx is ignored; close the input
 // to stop Go.
 func (e *EchoShell) Go(ctx context.Context) error {
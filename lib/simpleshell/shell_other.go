@@ -0,0 +1,25 @@
+//go:build !unix
+
+package simpleshell
+
+/*
+ * shell_other.go
+ * No process groups, just processes
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing, as we don't have Unix process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup kills p.  There's no asking nicely, so kill is ignored.
+func signalGroup(p *os.Process, kill bool) error { return p.Kill() }
+
+// exitSignal always returns nil.
+func exitSignal(ps *os.ProcessState) os.Signal { return nil }
@@ -0,0 +1,45 @@
+//go:build unix
+
+package simpleshell
+
+/*
+ * shell_unix.go
+ * Process groups on Unix
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes cmd start in its own process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if nil == cmd.SysProcAttr {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalGroup sends SIGTERM, or SIGKILL if kill is true, to p's process
+// group.
+func signalGroup(p *os.Process, kill bool) error {
+	sig := syscall.SIGTERM
+	if kill {
+		sig = syscall.SIGKILL
+	}
+	return syscall.Kill(-p.Pid, sig)
+}
+
+// exitSignal returns the signal which killed the process described by ps, or
+// nil if it wasn't killed by a signal.
+func exitSignal(ps *os.ProcessState) os.Signal {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return nil
+	}
+	return ws.Signal()
+}
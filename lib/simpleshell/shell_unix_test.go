@@ -0,0 +1,151 @@
+//go:build unix
+
+package simpleshell
+
+/*
+ * shell_unix_test.go
+ * Tests for shell_unix.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCmdShell_ExitError(t *testing.T) {
+	s, err := NewCmdShell(exec.Command("sh", "-c", "exit 3"))
+	if nil != err {
+		t.Fatalf("Error setting up shell: %s", err)
+	}
+	s.SetInput(strings.NewReader(""))
+	err = s.Go(context.Background())
+	var ee *ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("Expected ExitError, got %T: %v", err, err)
+	}
+	if 3 != ee.Code {
+		t.Errorf("Incorrect exit code:\n got: %d\nwant: 3", ee.Code)
+	}
+	if nil != ee.Signal {
+		t.Errorf("Unexpected signal %s", ee.Signal)
+	}
+}
+
+func TestCmdShell_Cancel(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		script string
+		grace  time.Duration
+		want   os.Signal
+	}{{
+		/* The backgrounded sleep holds stdout, so Go won't return
+		before the grace period unless it gets the SIGTERM too. */
+		name:   "sigterm",
+		script: "sleep 60 & echo ready; wait",
+		grace:  time.Minute,
+		want:   syscall.SIGTERM,
+	}, {
+		name:   "sigkill",
+		script: `trap "" TERM; sleep 60 & echo ready; wait`,
+		grace:  100 * time.Millisecond,
+		want:   syscall.SIGKILL,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := NewCmdShell(exec.Command(
+				"sh", "-c", c.script,
+			))
+			if nil != err {
+				t.Fatalf("Error setting up shell: %s", err)
+			}
+			s.KillGrace = c.grace
+			s.SetInput(strings.NewReader(""))
+
+			/* Start the shell and wait for it to be ready. */
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ech := make(chan error, 1)
+			go func() { ech <- s.Go(ctx) }()
+			br := bufio.NewReader(s.Output())
+			if l, err := br.ReadString('\n'); nil != err {
+				t.Fatalf("Error reading from shell: %s", err)
+			} else if "ready\n" != l {
+				t.Fatalf("Unexpected output %q", l)
+			}
+
+			/* Kill it and make sure it dies. */
+			cancel()
+			var ee *ExitError
+			select {
+			case err = <-ech:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("Shell didn't die")
+			}
+			if !errors.As(err, &ee) {
+				t.Fatalf(
+					"Expected ExitError, got %T: %v",
+					err,
+					err,
+				)
+			}
+			if ee.Signal != c.want {
+				t.Errorf(
+					"Incorrect signal:\n"+
+						" got: %v\n"+
+						"want: %s",
+					ee.Signal,
+					c.want,
+				)
+			}
+			if -1 != ee.Code {
+				t.Errorf("Incorrect exit code %d", ee.Code)
+			}
+		})
+	}
+}
+
+func TestCmdShell_ExitWithoutInput(t *testing.T) {
+	s, err := NewCmdShell(exec.Command("sh", "-c", "exit 3"))
+	if nil != err {
+		t.Fatalf("Error setting up shell: %s", err)
+	}
+	/* Input which never comes. */
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	s.SetInput(pr)
+	ech := make(chan error, 1)
+	go func() { ech <- s.Go(context.Background()) }()
+	select {
+	case err = <-ech:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Shell exited but Go didn't return")
+	}
+	var ee *ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("Expected ExitError, got %T: %v", err, err)
+	}
+
+	/* Nothing should still be waiting for input. */
+	if _, err := pw.Write([]byte("late")); !errors.Is(
+		err,
+		io.ErrClosedPipe,
+	) {
+		t.Errorf(
+			"Incorrect late input error:\n"+
+				" got: %v\n"+
+				"want: %s",
+			err,
+			io.ErrClosedPipe,
+		)
+	}
+}
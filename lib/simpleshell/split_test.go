@@ -0,0 +1,174 @@
+package simpleshell
+
+/*
+ * split_test.go
+ * Tests for split.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSplitURLs(t *testing.T) {
+	for _, c := range []struct {
+		c2      string
+		wantIn  string
+		wantOut string
+	}{{
+		c2:      "https://example.com/io",
+		wantIn:  "https://example.com/i/id",
+		wantOut: "https://example.com/o/id",
+	}, {
+		c2:      "https://example.com/io/",
+		wantIn:  "https://example.com/i/id",
+		wantOut: "https://example.com/o/id",
+	}, {
+		c2:      "https://example.com:4444/crs/io?a=b",
+		wantIn:  "https://example.com:4444/crs/i/id?a=b",
+		wantOut: "https://example.com:4444/crs/o/id?a=b",
+	}, {
+		c2:      "http://example.com",
+		wantIn:  "http://example.com/i/id",
+		wantOut: "http://example.com/o/id",
+	}} {
+		gotIn, gotOut, err := splitURLs(c.c2, "id")
+		if nil != err {
+			t.Errorf("Error splitting %s: %s", c.c2, err)
+			continue
+		}
+		if gotIn != c.wantIn {
+			t.Errorf(
+				"Incorrect input URL for %s:\n"+
+					" got: %s\n"+
+					"want: %s",
+				c.c2,
+				gotIn,
+				c.wantIn,
+			)
+		}
+		if gotOut != c.wantOut {
+			t.Errorf(
+				"Incorrect output URL for %s:\n"+
+					" got: %s\n"+
+					"want: %s",
+				c.c2,
+				gotOut,
+				c.wantOut,
+			)
+		}
+	}
+}
+
+func TestGo_Split(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		mode Mode
+	}{
+		{"split", ModeSplit},
+		{"auto_fallback", ModeAuto},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			svr, check := newSplitServer(t, c.mode)
+			_, _, shell := NewEchoShell()
+			if err := Go(context.Background(), ConnConfig{
+				C2:            svr.URL + IOPath,
+				Mode:          c.mode,
+				DuplexTimeout: 100 * time.Millisecond,
+			}, shell); nil != err {
+				t.Fatalf("Error: %s", err)
+			}
+			check()
+		})
+	}
+}
+
+// newSplitServer returns a server which sends input on InputPath, expects it
+// back on OutputPath, and never responds on IOPath.  The returned function
+// checks that all went well, including that IOPath wasn't used in ModeSplit.
+func newSplitServer(t *testing.T, mode Mode) (*httptest.Server, func()) {
+	var (
+		input  = "kittens"
+		gotOut = make(chan struct{})
+		ech    = make(chan error, 2)
+		nIO    atomic.Int64
+		ids    = make(chan string, 2)
+		mux    = http.NewServeMux()
+		done   = make(chan struct{})
+	)
+	mux.HandleFunc(IOPath, func(w http.ResponseWriter, r *http.Request) {
+		/* Pretend something's eating our response. */
+		nIO.Add(1)
+		<-done
+	})
+	handleInput := func(w http.ResponseWriter, r *http.Request) error {
+		if _, err := io.WriteString(w, input); nil != err {
+			return fmt.Errorf("sending input: %w", err)
+		}
+		if err := http.NewResponseController(w).Flush(); nil != err {
+			return fmt.Errorf("flushing: %w", err)
+		}
+		<-gotOut
+		return nil
+	}
+	handleOutput := func(w http.ResponseWriter, r *http.Request) error {
+		b := make([]byte, len(input))
+		_, err := io.ReadFull(r.Body, b)
+		close(gotOut)
+		if nil != err {
+			return fmt.Errorf("reading output: %w", err)
+		} else if got := string(b); got != input {
+			return fmt.Errorf("incorrect output %q", got)
+		}
+		if b, err := io.ReadAll(r.Body); nil != err {
+			return fmt.Errorf("reading rest: %w", err)
+		} else if 0 != len(b) {
+			return fmt.Errorf("extra output %q", b)
+		}
+		return nil
+	}
+	for pattern, handler := range map[string]func(
+		http.ResponseWriter,
+		*http.Request,
+	) error{
+		"GET " + InputPath + "{id}":   handleInput,
+		"POST " + OutputPath + "{id}": handleOutput,
+	} {
+		mux.HandleFunc(pattern, func(
+			w http.ResponseWriter,
+			r *http.Request,
+		) {
+			ids <- r.PathValue("id")
+			ech <- handler(w, r)
+		})
+	}
+	svr := httptest.NewServer(mux)
+	t.Cleanup(svr.Close)
+	t.Cleanup(func() { close(done) })
+
+	return svr, func() {
+		t.Helper()
+		for range 2 {
+			if err := <-ech; nil != err {
+				t.Errorf("Handler error: %s", err)
+			}
+		}
+		if a, b := <-ids, <-ids; a != b {
+			t.Errorf("Input and output IDs differ: %q vs %q", a, b)
+		} else if "" == a {
+			t.Errorf("Empty ID")
+		}
+		if 0 != nIO.Load() && ModeSplit == mode {
+			t.Errorf("Unexpected request to %s", IOPath)
+		}
+	}
+}
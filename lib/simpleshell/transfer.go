@@ -0,0 +1,273 @@
+package simpleshell
+
+/*
+ * transfer.go
+ * File transfers without the shell's help
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/magisterquis/curlrevshell/lib/uu"
+)
+
+const (
+	// TransferMarker precedes a message from a TransferShell to
+	// Curlrevshell in the shell's output.  It is followed by a single
+	// line, which is either TransferHello or the begin line of a
+	// uuencoded file.
+	TransferMarker = "\x00crs:"
+
+	// TransferHello follows TransferMarker when a TransferShell starts,
+	// to tell Curlrevshell it may send files with PutCommand.
+	TransferHello = "transfers"
+
+	// GetCommand, followed by a space and a path, asks a TransferShell to
+	// send a file to Curlrevshell.  The file is sent as TransferMarker
+	// followed by a uuencoded file, as made by [uu.NewFileEncoder].
+	GetCommand = "@get"
+
+	// PutCommand, followed by a space, a path, a newline, and a uuencoded
+	// file, asks a TransferShell to write a file.
+	PutCommand = "@put"
+)
+
+// TransferShell wraps a Shell and handles GetCommand and PutCommand lines
+// itself, in Go, without involving the wrapped Shell.  All other input is
+// passed to the wrapped Shell.
+type TransferShell struct {
+	shell Shell
+	in    io.Reader
+
+	outr *io.PipeReader
+	outw *io.PipeWriter
+	out  lockedWriter /* Wraps outw. */
+}
+
+// NewTransferShell returns a new TransferShell which wraps shell.
+func NewTransferShell(shell Shell) *TransferShell {
+	pr, pw := io.Pipe()
+	return &TransferShell{
+		shell: shell,
+		outr:  pr,
+		outw:  pw,
+		out:   lockedWriter{w: pw},
+	}
+}
+
+// SetInput sets the [io.Reader] from which t reads input.
+func (t *TransferShell) SetInput(in io.Reader) { t.in = in }
+
+// Output returns an [io.Reader] on which t sends output.
+func (t *TransferShell) Output() io.ReadCloser { return t.outr }
+
+// Stderr returns the wrapped Shell's standard error, if it's a [StderrShell].
+// Otherwise, the returned io.ReadCloser is always at EOF.
+func (t *TransferShell) Stderr() io.ReadCloser {
+	if ss, ok := t.shell.(StderrShell); ok {
+		return ss.Stderr()
+	}
+	return io.NopCloser(strings.NewReader(""))
+}
+
+// String returns the wrapped Shell's name.
+func (t *TransferShell) String() string { return fmt.Sprint(t.shell) }
+
+// Go runs the wrapped Shell, handling transfers in the meantime.  Go returns
+// once the wrapped Shell is finished, without waiting for t's input to be
+// closed.
+func (t *TransferShell) Go(ctx context.Context) error {
+	/* The wrapped shell gets input via us. */
+	sir, siw := io.Pipe()
+	t.shell.SetInput(sir)
+	go func() { siw.CloseWithError(t.handleInput(siw)) }()
+
+	/* Let Curlrevshell know we can do transfers, and send it the
+	wrapped shell's output. */
+	ech := make(chan error, 1)
+	go func() {
+		if _, err := io.WriteString(
+			&t.out,
+			TransferMarker+TransferHello+"\n",
+		); nil != err {
+			t.shell.Output().Close()
+			ech <- fmt.Errorf("sending hello: %w", err)
+			return
+		}
+		_, err := io.Copy(&t.out, t.shell.Output())
+		ech <- err
+	}()
+
+	/* Wait for the shell to finish. */
+	serr := t.shell.Go(ctx)
+	oerr := <-ech
+	sir.Close()
+	t.outw.CloseWithError(oerr)
+	if nil != serr {
+		return serr
+	} else if nil != oerr {
+		return fmt.Errorf("proxying output: %w", oerr)
+	}
+	return nil
+}
+
+// handleInput reads lines from t's input, handles transfers, and sends
+// everything else to w.
+func (t *TransferShell) handleInput(w io.Writer) error {
+	br := bufio.NewReader(t.in)
+	for {
+		l, err := br.ReadString('\n')
+		/* Transfers are ours; everything else is the shell's. */
+		if cmd, path, ok := transferCommand(l); ok {
+			switch cmd {
+			case GetCommand:
+				t.get(path)
+			case PutCommand:
+				t.put(path, br)
+			}
+		} else if "" != l {
+			if _, err := io.WriteString(w, l); nil != err {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if nil != err {
+			return err
+		}
+	}
+}
+
+// transferCommand splits a line into a transfer command and its path.  ok is
+// false if the line isn't a complete transfer command.
+func transferCommand(l string) (cmd, path string, ok bool) {
+	if !strings.HasSuffix(l, "\n") {
+		return "", "", false
+	}
+	l = strings.TrimRight(l, "\r\n")
+	cmd, path, _ = strings.Cut(l, " ")
+	if GetCommand != cmd && PutCommand != cmd {
+		return "", "", false
+	}
+	if path = strings.TrimSpace(path); "" == path {
+		return "", "", false
+	}
+	return cmd, path, true
+}
+
+// get sends the file at path to Curlrevshell.  Errors are sent as output.
+func (t *TransferShell) get(path string) {
+	if err := t.sendFile(path); nil != err {
+		fmt.Fprintf(&t.out, "%s %s: %s\n", GetCommand, path, err)
+	}
+}
+
+// sendFile sends the file at path to Curlrevshell, uuencoded.  Nothing else
+// is sent while the file is being sent.
+func (t *TransferShell) sendFile(path string) error {
+	/* Make sure we have something sendable. */
+	f, err := os.Open(path)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if nil != err {
+		return err
+	} else if !fi.Mode().IsRegular() {
+		return errors.New("not a regular file")
+	}
+
+	/* Send it all at once. */
+	t.out.Lock()
+	defer t.out.Unlock()
+	if _, err := io.WriteString(t.out.w, TransferMarker); nil != err {
+		return fmt.Errorf("sending marker: %w", err)
+	}
+	e := uu.NewFileEncoder(t.out.w, fi.Mode(), path)
+	if _, err := io.Copy(e, f); nil != err {
+		e.Close()
+		return fmt.Errorf("sending file: %w", err)
+	}
+	if err := e.Close(); nil != err {
+		return fmt.Errorf("finishing sending file: %w", err)
+	}
+	return nil
+}
+
+// put writes a uuencoded file read from br to path.  How it went is sent as
+// output.
+func (t *TransferShell) put(path string, br *bufio.Reader) {
+	if n, err := receiveFile(path, br); nil != err {
+		fmt.Fprintf(&t.out, "%s %s: %s\n", PutCommand, path, err)
+	} else {
+		fmt.Fprintf(
+			&t.out,
+			"%s %s: wrote %d bytes\n",
+			PutCommand,
+			path,
+			n,
+		)
+	}
+}
+
+// receiveFile writes a uuencoded file read from br to path.  The rest of the
+// uuencoded file is read and discarded on error, so as not to send it to the
+// shell.  br is used directly, and not wrapped in another bufio.Reader, so as
+// not to lose the input after the file.
+func receiveFile(path string, br *bufio.Reader) (int64, error) {
+	fd, err := uu.NewFileDecoder(br)
+	if nil != err {
+		skipToEnd(br)
+		return 0, fmt.Errorf("reading begin line: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fd.Mode)
+	if nil != err {
+		skipToEnd(br)
+		return 0, err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, fd)
+	if nil != err {
+		skipToEnd(br)
+		return n, fmt.Errorf("writing file: %w", err)
+	}
+	if err := f.Close(); nil != err {
+		return n, fmt.Errorf("closing file: %w", err)
+	}
+	return n, nil
+}
+
+// skipToEnd reads lines from br until it reads a uuencoded file's end line.
+func skipToEnd(br *bufio.Reader) {
+	for {
+		l, err := br.ReadString('\n')
+		if "end" == strings.TrimRight(l, "\r\n") || nil != err {
+			return
+		}
+	}
+}
+
+// lockedWriter is an io.Writer which holds a mutex while writing.  The mutex
+// may be held to make several writes directly to w at once.
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// Write writes b to lw.w while holding lw's lock.
+func (lw *lockedWriter) Write(b []byte) (int, error) {
+	lw.Lock()
+	defer lw.Unlock()
+	return lw.w.Write(b)
+}
@@ -0,0 +1,194 @@
+package simpleshell
+
+/*
+ * transfer_test.go
+ * Tests for transfer.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/curlrevshell/lib/uu"
+)
+
+func TestTransferShell(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		getFile  = filepath.Join(dir, "get")
+		putFile  = filepath.Join(dir, "put")
+		contents = strings.Repeat("kittens\n", 100)
+		ir, iw   = io.Pipe()
+		_, _, es = NewEchoShell()
+		ts       = NewTransferShell(es)
+		ech      = make(chan error, 1)
+	)
+	if err := os.WriteFile(getFile, []byte(contents), 0600); nil != err {
+		t.Fatalf("Error making file to get: %s", err)
+	}
+	ts.SetInput(ir)
+	br := bufio.NewReader(ts.Output())
+	go func() { ech <- ts.Go(context.Background()) }()
+
+	/* send writes s to ts. */
+	send := func(s string) {
+		t.Helper()
+		if _, err := io.WriteString(iw, s); nil != err {
+			t.Fatalf("Error sending %q: %s", s, err)
+		}
+	}
+	/* expect expects a line from ts. */
+	expect := func(want string) {
+		t.Helper()
+		got, err := br.ReadString('\n')
+		if nil != err {
+			t.Fatalf("Error reading line: %s", err)
+		}
+		if got != want {
+			t.Errorf(
+				"Incorrect line:\n got: %q\nwant: %q",
+				got,
+				want,
+			)
+		}
+	}
+
+	/* Normal I/O should still work. */
+	expect(TransferMarker + TransferHello + "\n")
+	send("moose\n")
+	expect("moose\n")
+
+	/* Get a file. */
+	send(GetCommand + " " + getFile + "\n")
+	m := make([]byte, len(TransferMarker))
+	if _, err := io.ReadFull(br, m); nil != err {
+		t.Fatalf("Error reading marker: %s", err)
+	} else if TransferMarker != string(m) {
+		t.Fatalf("Incorrect marker %q", m)
+	}
+	fd, err := uu.NewFileDecoder(br)
+	if nil != err {
+		t.Fatalf("Error starting to decode file: %s", err)
+	}
+	if got, err := io.ReadAll(fd); nil != err {
+		t.Errorf("Error decoding file: %s", err)
+	} else if string(got) != contents {
+		t.Errorf("Incorrect file:\n got: %q\nwant: %q", got, contents)
+	}
+	if fd.Name != getFile {
+		t.Errorf(
+			"Incorrect file name:\n got: %s\nwant: %s",
+			fd.Name,
+			getFile,
+		)
+	}
+
+	/* Getting a nonexistent file should be an error. */
+	send(GetCommand + " " + putFile + "\n")
+	got, err := br.ReadString('\n')
+	if nil != err {
+		t.Fatalf("Error reading get error: %s", err)
+	} else if !strings.HasPrefix(got, GetCommand+" "+putFile+": ") {
+		t.Errorf("Unexpected get error %q", got)
+	}
+
+	/* As should getting something which isn't a regular file, which
+	might never end. */
+	for _, name := range []string{dir, os.DevNull} {
+		send(GetCommand + " " + name + "\n")
+		got, err := br.ReadString('\n')
+		if nil != err {
+			t.Fatalf("Error reading get error: %s", err)
+		} else if !strings.HasPrefix(got, GetCommand+" "+name+": ") {
+			t.Fatalf("Unexpected get error %q", got)
+		}
+	}
+
+	/* Putting a file we can't write shouldn't send the rest of the file
+	to the shell, even if it's garbled.  It's sent in the background in
+	case some of it comes back. */
+	send(PutCommand + " " + dir + "\n")
+	go io.WriteString(
+		iw,
+		"begin 600 put\nnot uuencoded\necho garbled\n`\nend\nmoose\n",
+	)
+	got, err = br.ReadString('\n')
+	if nil != err {
+		t.Fatalf("Error reading put error: %s", err)
+	} else if !strings.HasPrefix(got, PutCommand+" "+dir+": ") {
+		t.Fatalf("Unexpected put error %q", got)
+	}
+	if got, err := br.ReadString('\n'); nil != err {
+		t.Fatalf("Error reading output after put error: %s", err)
+	} else if "moose\n" != got {
+		t.Fatalf("Rest of garbled file sent to shell: %q", got)
+	}
+
+	/* Put a file, which should be written. */
+	send(PutCommand + " " + putFile + "\n")
+	e := uu.NewFileEncoder(iw, 0600, "put")
+	if _, err := io.WriteString(e, contents); nil != err {
+		t.Fatalf("Error sending file: %s", err)
+	} else if err := e.Close(); nil != err {
+		t.Fatalf("Error finishing sending file: %s", err)
+	}
+	expect(PutCommand + " " + putFile + ": wrote 800 bytes\n")
+	if b, err := os.ReadFile(putFile); nil != err {
+		t.Errorf("Error reading put file: %s", err)
+	} else if got := string(b); got != contents {
+		t.Errorf(
+			"Incorrect put file:\n got: %q\nwant: %q",
+			got,
+			contents,
+		)
+	}
+
+	/* And after all that, the shell should still work. */
+	send("kittens\n")
+	expect("kittens\n")
+	iw.Close()
+	if rest, err := io.ReadAll(br); nil != err {
+		t.Errorf("Error reading rest of output: %s", err)
+	} else if 0 != len(rest) {
+		t.Errorf("Unexpected output %q", rest)
+	}
+	if err := <-ech; nil != err {
+		t.Errorf("Error: %s", err)
+	}
+}
+
+func TestTransferCommand(t *testing.T) {
+	for _, c := range []struct {
+		have     string
+		wantCmd  string
+		wantPath string
+		wantOK   bool
+	}{
+		{"@get /etc/passwd\n", GetCommand, "/etc/passwd", true},
+		{"@put /tmp/x\r\n", PutCommand, "/tmp/x", true},
+		{"@get /etc/passwd", "", "", false},
+		{"@get\n", "", "", false},
+		{"@getx /etc/passwd\n", "", "", false},
+		{"echo @get /etc/passwd\n", "", "", false},
+	} {
+		cmd, path, ok := transferCommand(c.have)
+		if cmd != c.wantCmd || path != c.wantPath || ok != c.wantOK {
+			t.Errorf(
+				"Incorrect parse of %q:\n"+
+					" got: %q %q %t\n"+
+					"want: %q %q %t",
+				c.have,
+				cmd, path, ok,
+				c.wantCmd, c.wantPath, c.wantOK,
+			)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package simpleshell
+
+/*
+ * window.go
+ * Kill date and operating window
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrKillDate is returned when ConnConfig.KillDate has passed.
+var ErrKillDate = errors.New("kill date passed")
+
+// ErrOutsideWindow is returned when it's outside of ConnConfig.Hours or
+// ConnConfig.Weekdays.
+var ErrOutsideWindow = errors.New("outside operating window")
+
+// errNoWindow is returned when no time is in both ConnConfig.Hours and
+// ConnConfig.Weekdays.
+var errNoWindow = errors.New("no hours in operating window")
+
+// Allowed returns nil if conf allows connecting at t.  Otherwise, it returns
+// ErrKillDate or ErrOutsideWindow.  Hours and weekdays are worked out in t's
+// location.
+func (conf ConnConfig) Allowed(t time.Time) error {
+	switch {
+	case !conf.KillDate.IsZero() && !t.Before(conf.KillDate):
+		return ErrKillDate
+	case 0 != len(conf.Hours) && !slices.Contains(conf.Hours, t.Hour()):
+		return ErrOutsideWindow
+	case 0 != len(conf.Weekdays) &&
+		!slices.Contains(conf.Weekdays, t.Weekday()):
+		return ErrOutsideWindow
+	}
+	return nil
+}
+
+// nextAllowed returns the first time at or after t at which conf allows
+// connecting.  It returns ErrKillDate if that would be at or after the kill
+// date.
+func (conf ConnConfig) nextAllowed(t time.Time) (time.Time, error) {
+	/* Try the top of each hour for the next week. */
+	for range 7*24 + 1 {
+		switch err := conf.Allowed(t); err {
+		case nil:
+			return t, nil
+		case ErrKillDate:
+			return time.Time{}, err
+		}
+		t = time.Date(
+			t.Year(),
+			t.Month(),
+			t.Day(),
+			t.Hour()+1,
+			0,
+			0,
+			0,
+			t.Location(),
+		)
+	}
+	return time.Time{}, errNoWindow
+}
+
+// waitAllowed waits until conf allows connecting.  It returns ctx.Err() if
+// ctx is done first, or ErrKillDate if the kill date will pass first.
+func (conf ConnConfig) waitAllowed(ctx context.Context) error {
+	for {
+		now := time.Now()
+		next, err := conf.nextAllowed(now)
+		if nil != err {
+			return err
+		}
+		if !next.After(now) {
+			return nil
+		}
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package simpleshell
+
+/*
+ * window_test.go
+ * Tests for window.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// windowTestTime is a Friday afternoon.
+var windowTestTime = time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC)
+
+func TestConnConfigAllowed(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		conf ConnConfig
+		want error
+	}{{
+		name: "unlimited",
+	}, {
+		name: "before_kill_date",
+		conf: ConnConfig{KillDate: windowTestTime.Add(time.Second)},
+	}, {
+		name: "at_kill_date",
+		conf: ConnConfig{KillDate: windowTestTime},
+		want: ErrKillDate,
+	}, {
+		name: "in_hours",
+		conf: ConnConfig{Hours: []int{9, 14}},
+	}, {
+		name: "outside_hours",
+		conf: ConnConfig{Hours: []int{9, 15}},
+		want: ErrOutsideWindow,
+	}, {
+		name: "in_weekdays",
+		conf: ConnConfig{Weekdays: []time.Weekday{time.Friday}},
+	}, {
+		name: "outside_weekdays",
+		conf: ConnConfig{Weekdays: []time.Weekday{time.Monday}},
+		want: ErrOutsideWindow,
+	}, {
+		name: "kill_date_first",
+		conf: ConnConfig{
+			KillDate: windowTestTime,
+			Hours:    []int{3},
+		},
+		want: ErrKillDate,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.conf.Allowed(windowTestTime)
+			if got != c.want {
+				t.Errorf(
+					"Incorrect error:\n got: %v\nwant: %v",
+					got,
+					c.want,
+				)
+			}
+		})
+	}
+}
+
+func TestConnConfigNextAllowed(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		conf    ConnConfig
+		want    time.Time
+		wantErr error
+	}{{
+		name: "now",
+		conf: ConnConfig{Hours: []int{14}},
+		want: windowTestTime,
+	}, {
+		name: "later_today",
+		conf: ConnConfig{Hours: []int{9, 17}},
+		want: time.Date(2026, 10, 16, 17, 0, 0, 0, time.UTC),
+	}, {
+		name: "next_week",
+		conf: ConnConfig{
+			Hours:    []int{9},
+			Weekdays: []time.Weekday{time.Monday},
+		},
+		want: time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+	}, {
+		name: "after_kill_date",
+		conf: ConnConfig{
+			KillDate: windowTestTime.Add(time.Hour),
+			Hours:    []int{17},
+		},
+		wantErr: ErrKillDate,
+	}, {
+		name:    "never",
+		conf:    ConnConfig{Hours: []int{24}},
+		wantErr: errNoWindow,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := c.conf.nextAllowed(windowTestTime)
+			if err != c.wantErr {
+				t.Fatalf(
+					"Incorrect error:\n got: %v\nwant: %v",
+					err,
+					c.wantErr,
+				)
+			}
+			if !got.Equal(c.want) {
+				t.Errorf(
+					"Incorrect time:\n got: %s\nwant: %s",
+					got,
+					c.want,
+				)
+			}
+		})
+	}
+}
+
+func TestGo_KillDate(t *testing.T) {
+	_, _, shell := NewEchoShell()
+	err := Go(context.Background(), ConnConfig{
+		C2:       mustDeadURL(t),
+		KillDate: time.Now(),
+	}, shell)
+	if !errors.Is(err, ErrKillDate) {
+		t.Errorf("Incorrect error: %v", err)
+	}
+}
+
+func TestGoReconnect_KillDate(t *testing.T) {
+	var nShell int
+	err := GoReconnect(context.Background(), ConnConfig{
+		C2:       mustDeadURL(t),
+		KillDate: time.Now(),
+	}, ReconnectConfig{}, func() (Shell, error) {
+		nShell++
+		_, _, shell := NewEchoShell()
+		return shell, nil
+	})
+	if !errors.Is(err, ErrKillDate) {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if 0 != nShell {
+		t.Errorf("Made %d shells after kill date", nShell)
+	}
+}
+
+func TestGoReconnect_KillDateDuringBackoff(t *testing.T) {
+	var nFail atomic.Int64
+	svr := newFailingServer(t, &nFail)
+	start := time.Now()
+	err := GoReconnect(context.Background(), ConnConfig{
+		KillDate: start.Add(time.Second),
+	}, ReconnectConfig{
+		C2s:        []string{svr.URL},
+		MinBackoff: time.Hour,
+	}, func() (Shell, error) {
+		_, _, shell := NewEchoShell()
+		return shell, nil
+	})
+	if !errors.Is(err, ErrKillDate) {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if got := nFail.Load(); 1 != got {
+		t.Errorf("Expected 1 attempt, got %d", got)
+	}
+	if d := time.Since(start); time.Second <= d {
+		t.Errorf("Waited %s for kill date", d)
+	}
+}
+
+func TestGoReconnect_OutsideWindow(t *testing.T) {
+	/* Not now, and the kill date is before the window opens. */
+	var (
+		nShell int
+		now    = time.Now()
+	)
+	err := GoReconnect(context.Background(), ConnConfig{
+		C2:       mustDeadURL(t),
+		KillDate: now.Add(time.Hour),
+		Hours:    []int{(now.Hour() + 2) % 24},
+	}, ReconnectConfig{}, func() (Shell, error) {
+		nShell++
+		_, _, shell := NewEchoShell()
+		return shell, nil
+	})
+	if !errors.Is(err, ErrKillDate) {
+		t.Errorf("Incorrect error: %v", err)
+	}
+	if 0 != nShell {
+		t.Errorf("Made %d shells outside window", nShell)
+	}
+
+	/* Without a kill date, we should wait until cancelled. */
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		10*time.Millisecond,
+	)
+	defer cancel()
+	if err := GoReconnect(ctx, ConnConfig{
+		C2:    mustDeadURL(t),
+		Hours: []int{(now.Hour() + 2) % 24},
+	}, ReconnectConfig{}, func() (Shell, error) {
+		nShell++
+		_, _, shell := NewEchoShell()
+		return shell, nil
+	}); nil != err {
+		t.Errorf("Error after cancel: %s", err)
+	}
+	if 0 != nShell {
+		t.Errorf("Made %d shells outside window", nShell)
+	}
+}
@@ -5,7 +5,7 @@ package uu
  * Errors we might return
  * By J. Stuart McMurray
  * Created 20240928
- * Last Modified 20240928
+ * Last Modified 20261016
  */
 
 import (
@@ -71,3 +71,19 @@ func (err IncorrectDataLenError) Error() string {
 		err.Actual,
 	)
 }
+
+// ErrClosed is returned when writing to a closed encoder.
+var ErrClosed = errors.New("encoder closed")
+
+// ErrInvalidFileName is returned when writing to an encoder from
+// NewFileEncoder with an unusable file name.
+var ErrInvalidFileName = errors.New("file name empty or contains a newline")
+
+// ErrMissingBegin indicates a uuencoded file had no begin line.
+var ErrMissingBegin = errors.New("missing begin line")
+
+// ErrInvalidBegin indicates a uuencoded file's begin line couldn't be parsed.
+var ErrInvalidBegin = errors.New("invalid begin line")
+
+// ErrMissingEnd indicates a uuencoded file ended before its end line.
+var ErrMissingEnd = errors.New("missing end line")
@@ -0,0 +1,257 @@
+package uu
+
+/*
+ * stream.go
+ * Streaming uuencode/uudecode
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+const (
+	// beginPrefix starts the first line of a uuencoded file.
+	beginPrefix = "begin "
+	// zeroLine is the zero-length line before endLine.
+	zeroLine = "`"
+	// endLine is the last line of a uuencoded file.
+	endLine = "end"
+)
+
+// encoder is returned by NewEncoder and NewFileEncoder.
+type encoder struct {
+	w       io.Writer
+	buf     []byte /* Unencoded bytes, less than a line's worth. */
+	out     []byte /* Encoded bytes, reused. */
+	header  []byte /* Written before anything else, if set. */
+	trailer []byte /* Written on Close. */
+	err     error  /* Sticky. */
+	closed  bool
+}
+
+// NewEncoder returns an io.WriteCloser which uuencodes bytes written to it
+// and writes them to w.  Encoded bytes are written a line at a time; Close
+// must be called to write any remaining partial line.  Close does not close
+// w.  The encoding is the same as AppendEncode's.
+func NewEncoder(w io.Writer) io.WriteCloser {
+	return &encoder{w: w, buf: make([]byte, 0, lineLen)}
+}
+
+// NewFileEncoder is like NewEncoder, but wraps the encoded data in the
+// begin/end lines expected by uudecode.  The file's permissions and name are
+// taken from mode and name.  The name must not be empty or contain a newline.
+func NewFileEncoder(
+	w io.Writer,
+	mode fs.FileMode,
+	name string,
+) io.WriteCloser {
+	e := &encoder{
+		w:   w,
+		buf: make([]byte, 0, lineLen),
+		header: fmt.Appendf(
+			nil,
+			"%s%03o %s\n",
+			beginPrefix,
+			mode.Perm(),
+			name,
+		),
+		trailer: []byte(zeroLine + "\n" + endLine + "\n"),
+	}
+	if "" == name || strings.ContainsAny(name, "\r\n") {
+		e.err = ErrInvalidFileName
+	}
+	return e
+}
+
+// Write implements io.Writer.
+func (e *encoder) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, ErrClosed
+	} else if nil != e.err {
+		return 0, e.err
+	}
+	n := len(p)
+	/* Top up the buffer, if we've got a partial line. */
+	if 0 != len(e.buf) {
+		m := min(len(p), lineLen-len(e.buf))
+		e.buf = append(e.buf, p[:m]...)
+		p = p[m:]
+		if lineLen != len(e.buf) {
+			return n, nil
+		}
+		if err := e.write(e.buf); nil != err {
+			return 0, err
+		}
+		e.buf = e.buf[:0]
+	}
+	/* Write as many full lines as we can without copying. */
+	if full := len(p) - len(p)%lineLen; 0 != full {
+		if err := e.write(p[:full]); nil != err {
+			return 0, err
+		}
+		p = p[full:]
+	}
+	/* Save the rest for later. */
+	e.buf = append(e.buf, p...)
+	return n, nil
+}
+
+// Close writes any buffered data and the trailer, if we have one.
+func (e *encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	if nil == e.err {
+		e.write(e.buf)
+	}
+	if nil == e.err && nil != e.trailer {
+		e.writeRaw(e.trailer)
+	}
+	e.closed = true
+	return e.err
+}
+
+// write encodes and writes b, writing the header first if we've not already
+// done so.
+func (e *encoder) write(b []byte) error {
+	e.out = AppendEncode(e.out[:0], b)
+	return e.writeRaw(e.out)
+}
+
+// writeRaw writes b to e.w, preceded by the header if we've not already
+// written it.
+func (e *encoder) writeRaw(b []byte) error {
+	if nil != e.err {
+		return e.err
+	}
+	if nil != e.header {
+		if _, e.err = e.w.Write(e.header); nil != e.err {
+			return e.err
+		}
+		e.header = nil
+	}
+	if 0 != len(b) {
+		_, e.err = e.w.Write(b)
+	}
+	return e.err
+}
+
+// decoder is returned by NewDecoder and used by FileDecoder.
+type decoder struct {
+	r      *bufio.Reader
+	lineN  int    /* Next line's number, for errors. */
+	buf    []byte /* Decoded but unread bytes. */
+	err    error  /* Sticky. */
+	framed bool   /* Stop at the end line. */
+}
+
+// NewDecoder returns an io.Reader which uudecodes data read from r.  Decoding
+// is the same as AppendDecode's, including errors.
+func NewDecoder(r io.Reader) io.Reader {
+	return &decoder{r: bufio.NewReader(r)}
+}
+
+// Read implements io.Reader.
+func (d *decoder) Read(p []byte) (int, error) {
+	/* Make sure we have something to return. */
+	for 0 == len(d.buf) && nil == d.err {
+		var line []byte
+		line, d.err = d.readLine()
+		if nil != d.err {
+			break
+		}
+		/* If we're at the end, we're done. */
+		if d.framed && endLine == string(line) {
+			d.err = io.EOF
+			break
+		}
+		d.buf, d.err = appendDecodeLine(d.buf[:0], line, d.lineN-1)
+	}
+	/* Send back what we have. */
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	if 0 != n {
+		return n, nil
+	}
+	return 0, d.err
+}
+
+// readLine reads a line from d.r, less the trailing newline and carriage
+// return.  It returns io.EOF only if there's no more data; for framed data
+// it returns a DecodeError wrapping ErrMissingEnd instead.
+func (d *decoder) readLine() ([]byte, error) {
+	line, err := d.r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && 0 != len(line) {
+		err = nil
+	}
+	if errors.Is(err, io.EOF) && d.framed {
+		err = DecodeError{Line: d.lineN, Err: ErrMissingEnd}
+	}
+	if nil != err {
+		return nil, err
+	}
+	d.lineN++
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	return line, nil
+}
+
+// FileDecoder decodes a uuencoded file, as produced by NewFileEncoder or
+// uuencode.
+type FileDecoder struct {
+	// Mode and Name are from the file's begin line.
+	Mode fs.FileMode
+	Name string
+
+	d decoder
+}
+
+// NewFileDecoder returns a FileDecoder which decodes a file read from r.
+// Lines before the begin line are skipped.  The begin line is read before
+// NewFileDecoder returns.  Reads return io.EOF after the end line.
+func NewFileDecoder(r io.Reader) (*FileDecoder, error) {
+	fd := &FileDecoder{d: decoder{r: bufio.NewReader(r)}}
+	/* Find the begin line. */
+	var line []byte
+	for {
+		var err error
+		if line, err = fd.d.readLine(); errors.Is(err, io.EOF) {
+			return nil, ErrMissingBegin
+		} else if nil != err {
+			return nil, err
+		}
+		if bytes.HasPrefix(line, []byte(beginPrefix)) {
+			break
+		}
+	}
+	/* Parse it. */
+	ms, name, _ := strings.Cut(
+		strings.TrimPrefix(string(line), beginPrefix),
+		" ",
+	)
+	mode, err := strconv.ParseUint(ms, 8, 32)
+	if nil != err || "" == name {
+		return nil, DecodeError{
+			Line: fd.d.lineN - 1,
+			Err:  ErrInvalidBegin,
+		}
+	}
+	fd.Mode = fs.FileMode(mode).Perm()
+	fd.Name = name
+	fd.d.framed = true
+
+	return fd, nil
+}
+
+// Read implements io.Reader.
+func (fd *FileDecoder) Read(p []byte) (int, error) { return fd.d.Read(p) }
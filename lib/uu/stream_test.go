@@ -0,0 +1,342 @@
+package uu
+
+/*
+ * stream_test.go
+ * Tests for stream.go
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// streamTestSizes are the sizes of data used in compatibility tests.
+var streamTestSizes = []int{0, 1, 2, 3, 44, 45, 46, 90, 1000, 12345}
+
+func TestNewEncoder(t *testing.T) {
+	for n, tc := range mustLoadTestCases(t) {
+		if nil == tc.Dec || tc.NoEncode {
+			continue
+		}
+		for _, cl := range []int{1, 7, lineLen, 100, len(tc.Dec) + 1} {
+			var got bytes.Buffer
+			enc := NewEncoder(&got)
+			for c := range chunks(tc.Dec, cl) {
+				if _, err := enc.Write(c); nil != err {
+					t.Fatalf(
+						"[%s/%d] Write: %s",
+						n,
+						cl,
+						err,
+					)
+				}
+			}
+			if err := enc.Close(); nil != err {
+				t.Fatalf("[%s/%d] Close: %s", n, cl, err)
+			}
+			if !bytes.Equal(got.Bytes(), tc.Enc) {
+				t.Errorf(
+					"[%s/%d] Encoded data incorrect:\n"+
+						"got:\n%s\n"+
+						"want:\n%s",
+					n,
+					cl,
+					got.Bytes(),
+					tc.Enc,
+				)
+			}
+		}
+	}
+}
+
+func TestNewEncoder_Closed(t *testing.T) {
+	enc := NewEncoder(io.Discard)
+	if err := enc.Close(); nil != err {
+		t.Fatalf("Close: %s", err)
+	}
+	if _, err := enc.Write([]byte("foo")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Incorrect error:\n got: %v\nwant: %s", err, ErrClosed)
+	}
+}
+
+func TestNewDecoder(t *testing.T) {
+	for n, tc := range mustLoadTestCases(t) {
+		r := iotest.OneByteReader(bytes.NewReader(tc.Enc))
+		got, err := io.ReadAll(NewDecoder(r))
+		if "" != tc.DecErr {
+			if nil == err {
+				t.Errorf("[%s] Got unexpected success", n)
+			} else if got := err.Error(); got != tc.DecErr {
+				t.Errorf(
+					"[%s] Incorrect error:\n"+
+						" got: %s\n"+
+						"want: %s",
+					n,
+					got,
+					tc.DecErr,
+				)
+			}
+			continue
+		}
+		if nil != err {
+			t.Errorf("[%s] Decode error: %s", n, err)
+		} else if !bytes.Equal(got, tc.Dec) {
+			t.Errorf(
+				"[%s] Decoded data incorrect:\n"+
+					"got:\n%q\n"+
+					"want:\n%q",
+				n,
+				got,
+				tc.Dec,
+			)
+		}
+	}
+}
+
+func TestFileEncoderDecoder(t *testing.T) {
+	for _, size := range streamTestSizes {
+		have := mustRandBytes(t, size)
+		var enc bytes.Buffer
+		w := NewFileEncoder(&enc, 0o751, "a file")
+		if _, err := w.Write(have); nil != err {
+			t.Fatalf("[%d] Write: %s", size, err)
+		}
+		if err := w.Close(); nil != err {
+			t.Fatalf("[%d] Close: %s", size, err)
+		}
+
+		/* Make sure it's framed properly. */
+		want := "begin 751 a file\n" +
+			string(AppendEncode(nil, have)) +
+			"`\nend\n"
+		if got := enc.String(); got != want {
+			t.Errorf(
+				"[%d] Incorrect file:\ngot:\n%s\nwant:\n%s",
+				size,
+				got,
+				want,
+			)
+		}
+
+		/* Make sure we get it back, even with junk around it. */
+		fd, err := NewFileDecoder(strings.NewReader(
+			"Some mail headers\n\n" +
+				enc.String() +
+				"Trailing junk\n",
+		))
+		if nil != err {
+			t.Fatalf("[%d] NewFileDecoder: %s", size, err)
+		}
+		if 0o751 != fd.Mode {
+			t.Errorf("[%d] Incorrect mode: got %s", size, fd.Mode)
+		}
+		if "a file" != fd.Name {
+			t.Errorf("[%d] Incorrect name: got %q", size, fd.Name)
+		}
+		got, err := io.ReadAll(fd)
+		if nil != err {
+			t.Fatalf("[%d] Decode error: %s", size, err)
+		}
+		if !bytes.Equal(got, have) {
+			t.Errorf("[%d] Decoded data incorrect", size)
+		}
+	}
+}
+
+func TestNewFileEncoder_InvalidName(t *testing.T) {
+	for _, name := range []string{"", "a\nb"} {
+		var buf bytes.Buffer
+		w := NewFileEncoder(&buf, 0o644, name)
+		_, err := w.Write([]byte("foo"))
+		if !errors.Is(err, ErrInvalidFileName) {
+			t.Errorf(
+				"Incorrect error for %q:\n got: %v\nwant: %s",
+				name,
+				err,
+				ErrInvalidFileName,
+			)
+		}
+		if 0 != buf.Len() {
+			t.Errorf("Wrote data with name %q: %q", name, &buf)
+		}
+	}
+}
+
+func TestNewFileDecoder_Errors(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		have string
+		want error
+	}{{
+		name: "no_begin",
+		have: "M86)C\n`\nend\n",
+		want: ErrMissingBegin,
+	}, {
+		name: "bad_mode",
+		have: "begin 9x9 foo\n`\nend\n",
+		want: ErrInvalidBegin,
+	}, {
+		name: "no_name",
+		have: "begin 644\n`\nend\n",
+		want: ErrInvalidBegin,
+	}, {
+		name: "no_end",
+		have: "begin 644 foo\n#86)C\n`\n",
+		want: ErrMissingEnd,
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			fd, err := NewFileDecoder(strings.NewReader(c.have))
+			if nil == err {
+				_, err = io.ReadAll(fd)
+			}
+			if !errors.Is(err, c.want) {
+				t.Errorf(
+					"Incorrect error:\n got: %v\nwant: %s",
+					err,
+					c.want,
+				)
+			}
+		})
+	}
+}
+
+// TestPerlCompat makes sure we're compatible with Perl's pack/unpack "u".
+func TestPerlCompat(t *testing.T) {
+	if _, err := exec.LookPath("perl"); nil != err {
+		t.Skipf("No perl: %s", err)
+	}
+	for _, size := range streamTestSizes {
+		have := mustRandBytes(t, size)
+		/* Perl's encoding should be ours. */
+		cmd := exec.Command(
+			"perl",
+			"-0777",
+			"-ne",
+			`print pack "u", $_`,
+		)
+		cmd.Stdin = bytes.NewReader(have)
+		want, err := cmd.Output()
+		if nil != err {
+			t.Fatalf("[%d] Perl: %s", size, err)
+		}
+		var got bytes.Buffer
+		enc := NewEncoder(&got)
+		enc.Write(have)
+		enc.Close()
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Errorf(
+				"[%d] Encoding differs from Perl's:\n"+
+					"got:\n%s\n"+
+					"want:\n%s",
+				size,
+				got.Bytes(),
+				want,
+			)
+		}
+		/* And we should decode what Perl makes. */
+		dec, err := io.ReadAll(NewDecoder(bytes.NewReader(want)))
+		if nil != err {
+			t.Errorf(
+				"[%d] Error decoding Perl's output: %s",
+				size,
+				err,
+			)
+		} else if !bytes.Equal(dec, have) {
+			t.Errorf("[%d] Incorrectly decoded Perl's output", size)
+		}
+	}
+}
+
+// TestUUDecodeCompat makes sure uudecode can decode what we encode.
+func TestUUDecodeCompat(t *testing.T) {
+	if _, err := exec.LookPath("uudecode"); nil != err {
+		t.Skipf("No uudecode: %s", err)
+	}
+	dir := t.TempDir()
+	for _, size := range streamTestSizes {
+		have := mustRandBytes(t, size)
+		var enc bytes.Buffer
+		w := NewFileEncoder(&enc, 0o600, "out")
+		w.Write(have)
+		w.Close()
+		out := filepath.Join(dir, "out")
+		os.Remove(out)
+		cmd := exec.Command("uudecode", "-o", out)
+		cmd.Stdin = &enc
+		if o, err := cmd.CombinedOutput(); nil != err {
+			t.Fatalf("[%d] uudecode: %s\n%s", size, err, o)
+		}
+		got, err := os.ReadFile(out)
+		if nil != err {
+			t.Fatalf("[%d] Reading uudecode output: %s", size, err)
+		}
+		if !bytes.Equal(got, have) {
+			t.Errorf("[%d] uudecode output differs", size)
+		}
+	}
+}
+
+// TestUUEncodeCompat makes sure we can decode what uuencode encodes.
+func TestUUEncodeCompat(t *testing.T) {
+	if _, err := exec.LookPath("uuencode"); nil != err {
+		t.Skipf("No uuencode: %s", err)
+	}
+	for _, size := range streamTestSizes {
+		have := mustRandBytes(t, size)
+		cmd := exec.Command("uuencode", "name")
+		cmd.Stdin = bytes.NewReader(have)
+		enc, err := cmd.Output()
+		if nil != err {
+			t.Fatalf("[%d] uuencode: %s", size, err)
+		}
+		fd, err := NewFileDecoder(bytes.NewReader(enc))
+		if nil != err {
+			t.Fatalf("[%d] NewFileDecoder: %s", size, err)
+		}
+		if "name" != fd.Name {
+			t.Errorf("[%d] Incorrect name %q", size, fd.Name)
+		}
+		got, err := io.ReadAll(fd)
+		if nil != err {
+			t.Fatalf("[%d] Decode error: %s", size, err)
+		}
+		if !bytes.Equal(got, have) {
+			t.Errorf("[%d] Decoded uuencode output differs", size)
+		}
+	}
+}
+
+// chunks returns an iterator over b, in chunks of size n.  Unlike
+// slices.Chunk, it yields an empty slice for an empty b.
+func chunks(b []byte, n int) func(func([]byte) bool) {
+	return func(yield func([]byte) bool) {
+		for {
+			c := b[:min(n, len(b))]
+			b = b[len(c):]
+			if !yield(c) || 0 == len(b) {
+				return
+			}
+		}
+	}
+}
+
+// mustRandBytes returns n random bytes.
+func mustRandBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); nil != err {
+		t.Fatalf("Error getting random bytes: %s", err)
+	}
+	return b
+}
@@ -10,7 +10,7 @@ package uu
  * Simple uuencode/uudecode
  * By J. Stuart McMurray
  * Created 20240928
- * Last Modified 20240928
+ * Last Modified 20261016
  */
 
 import (
@@ -34,92 +34,102 @@ const (
 func AppendDecode(dst, src []byte) ([]byte, error) {
 	/* Decode each line. */
 	for lineN, line := range bytes.Split(src, []byte{'\n'}) {
-		/* Ignore blank lines. */
-		if 0 == len(line) {
-			continue
+		var err error
+		if dst, err = appendDecodeLine(dst, line, lineN); nil != err {
+			return nil, err
 		}
-		/* Ignore \r's. */
-		if '\r' == line[len(line)-1] {
-			line = line[:len(line)-1]
+	}
+	return dst, nil
+}
+
+// appendDecodeLine decodes a single line, which should not have a trailing
+// newline, and appends it to dst.  lineN is used in returned errors.
+func appendDecodeLine(dst, line []byte, lineN int) ([]byte, error) {
+	/* Ignore blank lines. */
+	if 0 == len(line) {
+		return dst, nil
+	}
+	/* Ignore \r's. */
+	if '\r' == line[len(line)-1] {
+		line = line[:len(line)-1]
+	}
+	/* Make sure the encode part is a multiple of four bytes. */
+	if 0b00 != (len(line)-1)&0b11 {
+		return nil, DecodeError{
+			Line: lineN,
+			Err:  ErrInvalidDataLen,
 		}
-		/* Make sure the encode part is a multiple of four bytes. */
-		if 0b00 != (len(line)-1)&0b11 {
+	}
+	/* Work out how many bytes to grab. */
+	var nDec int
+	if '`' != line[0] { /* ` is a zero-byte line. */
+		if line[0] < uuOffset {
 			return nil, DecodeError{
 				Line: lineN,
-				Err:  ErrInvalidDataLen,
+				Err: InvalidLengthCharacterError(
+					line[0],
+				),
 			}
 		}
-		/* Work out how many bytes to grab. */
-		var nDec int
-		if '`' != line[0] { /* ` is a zero-byte line. */
-			if line[0] < uuOffset {
-				return nil, DecodeError{
-					Line: lineN,
-					Err: InvalidLengthCharacterError(
-						line[0],
-					),
-				}
-			}
-			nDec = int(line[0] - uuOffset)
-		}
+		nDec = int(line[0] - uuOffset)
+	}
 
-		/* Make sure we have as many as we expect. */
-		encLen := nDec / decChunkLen
-		if 0 != nDec%decChunkLen {
-			encLen++
-		}
-		encLen *= encChunkLen
-		if len(line)-1 != encLen {
-			return nil, DecodeError{
-				Line: lineN,
-				Err: IncorrectDataLenError{
-					Expected: encLen,
-					Actual:   len(line) - 1,
-				},
-			}
+	/* Make sure we have as many as we expect. */
+	encLen := nDec / decChunkLen
+	if 0 != nDec%decChunkLen {
+		encLen++
+	}
+	encLen *= encChunkLen
+	if len(line)-1 != encLen {
+		return nil, DecodeError{
+			Line: lineN,
+			Err: IncorrectDataLenError{
+				Expected: encLen,
+				Actual:   len(line) - 1,
+			},
 		}
+	}
 
-		/* Decode the line. */
-		var offset = 1 /* After length byte. */
-		nDecRem := nDec
-		for chunk := range slices.Chunk(line[1:], encChunkLen) {
-			/* Sanitize '`s. */
-			if slices.Contains(chunk, '`') {
-				chunk = bytes.Clone(chunk)
-				for i, v := range chunk {
-					if '`' == v {
-						chunk[i] = uuOffset
-					}
-				}
-			}
-			/* Make sure all of the characters are usable. */
+	/* Decode the line. */
+	var offset = 1 /* After length byte. */
+	nDecRem := nDec
+	for chunk := range slices.Chunk(line[1:], encChunkLen) {
+		/* Sanitize '`s. */
+		if slices.Contains(chunk, '`') {
+			chunk = bytes.Clone(chunk)
 			for i, v := range chunk {
-				if v < uuOffset || (0b111111+uuOffset) < v {
-					err := InvalidEncodedCharacterError(v)
-					return nil, DecodeError{
-						Line:   lineN,
-						Offset: offset + i,
-						Err:    err,
-					}
+				if '`' == v {
+					chunk[i] = uuOffset
 				}
 			}
-			dec := []byte{
-				(chunk[0]-uuOffset)<<2 +
-					(chunk[1]-uuOffset)>>4,
-				(chunk[1]-uuOffset)<<4 +
-					(chunk[2]-uuOffset)>>2,
-				(chunk[2]-uuOffset)<<6 +
-					(chunk[3] - uuOffset),
-			}
-			/* Save the decoded bits, less padding. */
-			if len(dec) > nDecRem {
-				dec = dec[:nDecRem]
+		}
+		/* Make sure all of the characters are usable. */
+		for i, v := range chunk {
+			if v < uuOffset || (0b111111+uuOffset) < v {
+				err := InvalidEncodedCharacterError(v)
+				return nil, DecodeError{
+					Line:   lineN,
+					Offset: offset + i,
+					Err:    err,
+				}
 			}
-			dst = append(dst, dec...)
-			/* Bookkeeping. */
-			offset += encChunkLen
-			nDecRem -= len(dec)
 		}
+		dec := []byte{
+			(chunk[0]-uuOffset)<<2 +
+				(chunk[1]-uuOffset)>>4,
+			(chunk[1]-uuOffset)<<4 +
+				(chunk[2]-uuOffset)>>2,
+			(chunk[2]-uuOffset)<<6 +
+				(chunk[3] - uuOffset),
+		}
+		/* Save the decoded bits, less padding. */
+		if len(dec) > nDecRem {
+			dec = dec[:nDecRem]
+		}
+		dst = append(dst, dec...)
+		/* Bookkeeping. */
+		offset += encChunkLen
+		nDecRem -= len(dec)
 	}
 
 	return dst, nil
@@ -5,7 +5,7 @@ package uu
  * Tests for uu.go
  * By J. Stuart McMurray
  * Created 20240928
- * Last Modified 20240928
+ * Last Modified 20261016
  */
 
 import (
@@ -34,6 +34,25 @@ type testC struct {
 }
 
 func Test(t *testing.T) {
+	testCs := mustLoadTestCases(t)
+
+	/* Actually test the tests. */
+	for n, tc := range testCs {
+		switch {
+		/* Normal encode/decode */
+		case nil != tc.Enc && nil != tc.Dec && "" == tc.DecErr:
+			t.Run(n, func(t *testing.T) { testEncDec(t, tc) })
+		case nil != tc.Enc && nil == tc.Dec && "" != tc.DecErr:
+			t.Run(n, func(t *testing.T) { testDecErr(t, tc) })
+		default:
+			t.Errorf("Invalid test case %s", n)
+		}
+	}
+}
+
+// mustLoadTestCases loads the test cases from testdata.
+func mustLoadTestCases(t *testing.T) map[string]testC {
+	t.Helper()
 	/* Remove the directory prefix. */
 	tdfs, err := fs.Sub(testdata, "testdata")
 	if nil != err {
@@ -108,19 +127,7 @@ func Test(t *testing.T) {
 		testCs[cn] = tc
 		return nil
 	})
-
-	/* Actually test the tests. */
-	for n, tc := range testCs {
-		switch {
-		/* Normal encode/decode */
-		case nil != tc.Enc && nil != tc.Dec && "" == tc.DecErr:
-			t.Run(n, func(t *testing.T) { testEncDec(t, tc) })
-		case nil != tc.Enc && nil == tc.Dec && "" != tc.DecErr:
-			t.Run(n, func(t *testing.T) { testDecErr(t, tc) })
-		default:
-			t.Errorf("Invalid test case %s", n)
-		}
-	}
+	return testCs
 }
 
 // testEncDec tests that tc.Enc and tc.Dec encode/decode to each other.
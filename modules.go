@@ -0,0 +1,40 @@
+package main
+
+/*
+ * modules.go
+ * Handle built-in modules
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/magisterquis/curlrevshell/internal/modules"
+)
+
+// builtinModulesName is what we call the built-in modules when there's no
+// -ctrl-i.
+const builtinModulesName = "built-in modules"
+
+// printModules prints a table of the built-in modules and their functions.
+func printModules() error {
+	ms, err := modules.List()
+	if nil != err {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 2, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Module\tFunction\tDescription\n")
+	fmt.Fprintf(tw, "------\t--------\t-----------\n")
+	for _, m := range ms {
+		for _, d := range m.Docs {
+			name, desc, _ := strings.Cut(d, " ")
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", m.Name, name, desc)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,122 @@
+package main
+
+/*
+ * watch.go
+ * Insert changed functions when -ctrl-i's source changes
+ * By J. Stuart McMurray
+ * Created 20261016
+ * Last Modified 20261016
+ */
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/magisterquis/curlrevshell/internal/iobroker"
+	"github.com/magisterquis/curlrevshell/lib/fswatch"
+	"github.com/magisterquis/curlrevshell/lib/opshell"
+	"github.com/magisterquis/curlrevshell/lib/shellfuncsfile"
+)
+
+// WatchSettle is how long we wait for things to quiet down after a change to
+// -ctrl-i's source before inserting changed functions.
+const WatchSettle = 500 * time.Millisecond
+
+// ctrlIWatcher inserts changed functions from -ctrl-i's source into the shell.
+type ctrlIWatcher struct {
+	shell     *opshell.Shell
+	iob       *iobroker.Broker
+	insertGen func() ([]byte, error) /* Generates what we'd insert. */
+	source    string                 /* -ctrl-i */
+	confirm   bool                   /* Wait for Ctrl+Y. */
+
+	connected atomic.Bool /* Shell is connected. */
+	last      []byte      /* Last generated functions. */
+}
+
+// Do watches w.source and inserts changed functions until ctx is done.
+// Errors are logged to the shell; Do only returns when ctx is done.
+func (w *ctrlIWatcher) Do(ctx context.Context) error {
+	/* Keep track of whether or not there's a shell. */
+	evCh := make(chan iobroker.Event, iobroker.EVChanLen)
+	w.iob.AddEventListener(evCh)
+	defer func() {
+		w.iob.RemoveEventListener(evCh)
+		close(evCh)
+	}()
+	go func() {
+		for ev := range evCh {
+			switch ev.Type {
+			case iobroker.EventTypeConnected:
+				w.connected.Store(true)
+			case iobroker.EventTypeDisconnected:
+				w.connected.Store(false)
+			}
+		}
+	}()
+
+	/* Work out what we start with.  If it's not there yet, we'll just
+	send everything once it is. */
+	w.last, _ = w.insertGen()
+
+	/* Insert changes every time something changes. */
+	if err := fswatch.Watch(
+		ctx,
+		w.source,
+		WatchSettle,
+		w.changed,
+	); nil != err {
+		w.shell.Logf(
+			opshell.ColorRed,
+			false,
+			"Error watching %s: %s",
+			w.source,
+			err,
+		)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// changed is called when w.source changes.  It inserts or offers to insert
+// the functions which changed.
+func (w *ctrlIWatcher) changed() {
+	/* Work out what's changed. */
+	b, err := w.insertGen()
+	if nil != err {
+		w.shell.Logf(
+			opshell.ColorRed,
+			false,
+			"Error working out what changed: %s",
+			err,
+		)
+		return
+	}
+	changed := shellfuncsfile.ChangedFunctions(w.last, b)
+	if 0 == len(changed) {
+		return
+	}
+
+	/* Send it off, if we've something to which to send it.  If not,
+	we'll try again with the next change. */
+	name := fmt.Sprintf("changes to %s", w.source)
+	if !w.connected.Load() {
+		w.shell.Logf(
+			opshell.ColorYellow,
+			false,
+			"Not inserting %s yet, no shell connected",
+			name,
+		)
+		return
+	}
+	w.last = b
+	switch {
+	case w.confirm:
+		w.shell.OfferInsert(name, changed)
+	default:
+		w.shell.Insert(name, changed)
+	}
+}